@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/Bharat0908/ledger/internal/repo"
+)
+
+// accountCommands are the subcommands of ledgerctl accounts.
+var accountCommands = map[string]command{
+	"create": {summary: "create an account, optionally with an opening balance", run: runAccountsCreate},
+	"list":   {summary: "list accounts and their balances", run: runAccountsList},
+	"get":    {summary: "show accounts and their balances", run: runAccountsGet},
+}
+
+// metadataFlag collects repeated --metadata key=value flags.
+type metadataFlag map[string]string
+
+func (m metadataFlag) String() string { return "" }
+
+func (m metadataFlag) Set(s string) error {
+	k, v, ok := strings.Cut(s, "=")
+	if !ok || k == "" {
+		return fmt.Errorf("%q is not of the form key=value", s)
+	}
+	m[k] = v
+	return nil
+}
+
+// accountRows renders accounts as table rows.
+func accountRows(accs []repo.Account) [][]string {
+	rows := make([][]string, 0, len(accs))
+	for _, a := range accs {
+		rows = append(rows, []string{a.ID.String(), a.Owner, a.Currency, a.Type, a.Status,
+			strconv.FormatInt(a.Balance, 10), formatTime(a.CreatedAt)})
+	}
+	return rows
+}
+
+var accountHeader = []string{"ID", "OWNER", "CURRENCY", "TYPE", "STATUS", "BALANCE", "CREATED"}
+
+// runAccountsCreate creates an account through POST /v1/accounts. A positive --initial-balance
+// is queued as an opening transfer, whose idempotency key is printed so its progress can be
+// followed with ledgerctl status. Creating an account with the --external-ref of an existing one
+// returns that account instead.
+func runAccountsCreate(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("accounts create", "", stderr)
+	c := apiFlags(fs)
+	var body struct {
+		Owner          string            `json:"owner"`
+		Currency       string            `json:"currency"`
+		InitialBalance int64             `json:"initial_balance"`
+		ExternalRef    string            `json:"external_ref,omitempty"`
+		Type           string            `json:"type,omitempty"`
+		DisplayName    string            `json:"display_name,omitempty"`
+		Metadata       map[string]string `json:"metadata,omitempty"`
+	}
+	fs.StringVar(&body.Owner, "owner", "", "owner of the account (required)")
+	fs.StringVar(&body.Currency, "currency", "", "ISO 4217 currency code, such as INR (required)")
+	fs.Int64Var(&body.InitialBalance, "initial-balance", 0, "opening balance in minor units, queued as a transfer; requires --external-ref")
+	fs.StringVar(&body.ExternalRef, "external-ref", "", "caller's reference, which makes creation idempotent")
+	fs.StringVar(&body.Type, "type", "", "asset (default), liability, revenue or expense")
+	fs.StringVar(&body.DisplayName, "display-name", "", "human-readable name")
+	metadata := metadataFlag{}
+	fs.Var(metadata, "metadata", "metadata as key=value; repeatable")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 || body.Owner == "" || body.Currency == "" {
+		fs.Usage()
+		return errUsage
+	}
+	if err := checkOutput("accounts create", c.output, stderr); err != nil {
+		return err
+	}
+	if len(metadata) > 0 {
+		body.Metadata = metadata
+	}
+
+	var resp struct {
+		repo.Account
+		OpeningTransfer *struct {
+			IdempotencyKey string `json:"idempotency_key"`
+		} `json:"opening_transfer,omitempty"`
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err := c.do(ctx, http.MethodPost, "/v1/accounts", nil, body, &resp); err != nil {
+		return err
+	}
+	if c.output == "json" {
+		return printJSON(stdout, resp)
+	}
+	if err := printTable(stdout, accountHeader, accountRows([]repo.Account{resp.Account})); err != nil {
+		return err
+	}
+	if resp.OpeningTransfer != nil {
+		fmt.Fprintf(stdout, "\nopening balance queued with idempotency key %s\n", resp.OpeningTransfer.IdempotencyKey)
+	}
+	return nil
+}
+
+// runAccountsList lists accounts through GET /v1/accounts, one page, or with --all every page.
+// With the table output, the cursor of the next page is printed to stderr.
+func runAccountsList(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("accounts list", "", stderr)
+	c := apiFlags(fs)
+	owner := fs.String("owner", "", "only accounts of this owner")
+	currency := fs.String("currency", "", "only accounts in this currency")
+	status := fs.String("status", "", "only accounts in this status, active or frozen")
+	sortBy := fs.String("sort", "", "created_at (default), balance or owner; prefix with - for descending order")
+	limit := fs.Int("limit", 0, "accounts per page (default 50, max 500)")
+	cursor := fs.String("cursor", "", "next_cursor of the previous page")
+	all := fs.Bool("all", false, "follow the cursor through every page")
+	metadata := metadataFlag{}
+	fs.Var(metadata, "metadata", "only accounts with this metadata, as key=value; repeatable")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return errUsage
+	}
+	if err := checkOutput("accounts list", c.output, stderr); err != nil {
+		return err
+	}
+	q := url.Values{}
+	for name, v := range map[string]string{"owner": *owner, "currency": *currency, "status": *status, "sort": *sortBy, "cursor": *cursor} {
+		if v != "" {
+			q.Set(name, v)
+		}
+	}
+	if *limit > 0 {
+		q.Set("limit", strconv.Itoa(*limit))
+	}
+	for k, v := range metadata {
+		q.Add("metadata", k+":"+v)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	var result repo.AccountPage
+	for {
+		var page repo.AccountPage
+		if err := c.do(ctx, http.MethodGet, "/v1/accounts", q, nil, &page); err != nil {
+			return err
+		}
+		result.Accounts = append(result.Accounts, page.Accounts...)
+		result.Total, result.NextCursor = page.Total, page.NextCursor
+		if !*all || page.NextCursor == "" {
+			break
+		}
+		q.Set("cursor", page.NextCursor)
+	}
+	if result.Accounts == nil {
+		result.Accounts = []repo.Account{}
+	}
+	if c.output == "json" {
+		return printJSON(stdout, result)
+	}
+	if err := printTable(stdout, accountHeader, accountRows(result.Accounts)); err != nil {
+		return err
+	}
+	fmt.Fprintf(stderr, "%d of %d accounts\n", len(result.Accounts), result.Total)
+	if result.NextCursor != "" {
+		fmt.Fprintf(stderr, "next page: --cursor %s\n", result.NextCursor)
+	}
+	return nil
+}
+
+// runAccountsGet shows accounts, with their balances, through GET /v1/accounts/{id}.
+func runAccountsGet(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("accounts get", "<account-id>...", stderr)
+	c := apiFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errUsage
+	}
+	if err := checkOutput("accounts get", c.output, stderr); err != nil {
+		return err
+	}
+	ids := make([]uuid.UUID, fs.NArg())
+	for i, arg := range fs.Args() {
+		id, err := uuid.Parse(arg)
+		if err != nil {
+			fmt.Fprintf(stderr, "ledgerctl accounts get: %q is not an account ID\n", arg)
+			return errUsage
+		}
+		ids[i] = id
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	accs := make([]repo.Account, len(ids))
+	for i, id := range ids {
+		if err := c.do(ctx, http.MethodGet, "/v1/accounts/"+id.String(), nil, nil, &accs[i]); err != nil {
+			return fmt.Errorf("%s: %w", id, err)
+		}
+	}
+	if c.output == "json" {
+		if len(accs) == 1 {
+			return printJSON(stdout, accs[0])
+		}
+		return printJSON(stdout, accs)
+	}
+	return printTable(stdout, accountHeader, accountRows(accs))
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Bharat0908/ledger/internal/http/problem"
+)
+
+// apiClient calls the ledger's REST API with an API key (X-API-Key) or a bearer token.
+type apiClient struct {
+	base   string
+	key    string
+	token  string
+	output string
+	http   *http.Client
+}
+
+// apiFlags registers the flags of the commands that go through the API, defaulting to the
+// LEDGER_API_URL, LEDGER_API_KEY and LEDGER_API_TOKEN environment variables, and -o.
+func apiFlags(fs *flag.FlagSet) *apiClient {
+	c := &apiClient{http: &http.Client{Timeout: 30 * time.Second}}
+	base := os.Getenv("LEDGER_API_URL")
+	if base == "" {
+		base = "http://localhost:8080"
+	}
+	fs.StringVar(&c.base, "api", base, "base URL of the ledger API (env LEDGER_API_URL)")
+	fs.StringVar(&c.key, "api-key", os.Getenv("LEDGER_API_KEY"), "API key sent as X-API-Key (env LEDGER_API_KEY)")
+	fs.StringVar(&c.token, "token", os.Getenv("LEDGER_API_TOKEN"), "bearer token, such as a JWT (env LEDGER_API_TOKEN)")
+	outputFlag(fs, &c.output)
+	return c
+}
+
+// outputFlag registers -o, which selects between a table and JSON.
+func outputFlag(fs *flag.FlagSet, output *string) {
+	fs.StringVar(output, "o", "table", "output format, table or json")
+}
+
+// checkOutput reports an unknown -o value.
+func checkOutput(name, output string, stderr io.Writer) error {
+	if output != "table" && output != "json" {
+		fmt.Fprintf(stderr, "ledgerctl %s: -o must be table or json\n", name)
+		return errUsage
+	}
+	return nil
+}
+
+// apiError is a problem returned by the API.
+type apiError struct {
+	status int
+	p      problem.Details
+}
+
+func (e *apiError) Error() string {
+	msg := fmt.Sprintf("%d %s", e.status, http.StatusText(e.status))
+	if e.p.Code != "" {
+		msg += " (" + e.p.Code + ")"
+	}
+	if e.p.Detail != "" {
+		msg += ": " + e.p.Detail
+	}
+	for _, p := range e.p.InvalidParams {
+		msg += fmt.Sprintf("; %s: %s", p.Name, p.Reason)
+	}
+	return msg
+}
+
+// do sends a request with a JSON body, unless in is nil, and decodes a JSON response into out,
+// unless it is nil. Responses other than 2xx are returned as an *apiError.
+func (c *apiClient) do(ctx context.Context, method, path string, query url.Values, in, out interface{}) error {
+	u := strings.TrimRight(c.base, "/") + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.key != "" {
+		req.Header.Set("X-API-Key", c.key)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		e := &apiError{status: resp.StatusCode}
+		_ = json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&e.p)
+		return e
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode %s %s response: %w", method, path, err)
+	}
+	return nil
+}
+
+// printTable writes rows under a header as aligned columns.
+func printTable(w io.Writer, header []string, rows [][]string) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// formatTime formats t for tables, leaving zero times blank.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"github.com/Bharat0908/ledger/internal/config"
+	"github.com/Bharat0908/ledger/internal/queue"
+)
+
+// dlqCommands are the subcommands of ledgerctl dlq.
+var dlqCommands = map[string]command{
+	"list":   {summary: "show the messages at the front of the dead-letter queue", run: runDLQList},
+	"replay": {summary: "move dead-lettered messages back to the transaction queue", run: runDLQReplay},
+}
+
+// keysFlag collects repeated --key flags.
+type keysFlag map[string]bool
+
+func (k keysFlag) String() string { return "" }
+
+func (k keysFlag) Set(s string) error {
+	k[s] = true
+	return nil
+}
+
+// openDLQ connects to RabbitMQ and returns the configured dead-letter queue, a channel in
+// confirm mode, the number of messages in the queue, and a function that closes the connection.
+func openDLQ(mq config.RabbitMQ) (string, *amqp.Channel, int, func(), error) {
+	if mq.DeadLetterQueue == "" {
+		return "", nil, 0, nil, errors.New("no dead-letter queue is configured: set RABBITMQ_DEAD_LETTER_QUEUE")
+	}
+	conn, err := amqp.Dial(mq.URL.Value())
+	if err != nil {
+		return "", nil, 0, nil, fmt.Errorf("connect rabbitmq: %w", err)
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return "", nil, 0, nil, fmt.Errorf("open rabbitmq channel: %w", err)
+	}
+	if err := ch.Confirm(false); err != nil {
+		conn.Close()
+		return "", nil, 0, nil, fmt.Errorf("enable rabbitmq publisher confirms: %w", err)
+	}
+	q, err := ch.QueueDeclarePassive(mq.DeadLetterQueue, true, false, false, false, nil)
+	if err != nil {
+		conn.Close()
+		return "", nil, 0, nil, fmt.Errorf("inspect %s: %w", mq.DeadLetterQueue, err)
+	}
+	return q.Name, ch, q.Messages, func() { conn.Close() }, nil
+}
+
+// printDeadLetters prints dead letters as a table, or as JSON with their bodies.
+func printDeadLetters(w io.Writer, output string, dls []queue.DeadLetter) error {
+	if output == "json" {
+		if dls == nil {
+			dls = []queue.DeadLetter{}
+		}
+		return printJSON(w, dls)
+	}
+	rows := make([][]string, len(dls))
+	for i, dl := range dls {
+		rows[i] = []string{dl.IdempotencyKey, dl.Kind, dl.Reason, strconv.FormatInt(dl.Count, 10), formatTime(dl.DeadLetteredAt)}
+	}
+	return printTable(w, []string{"IDEMPOTENCY_KEY", "KIND", "REASON", "COUNT", "DEAD_LETTERED"}, rows)
+}
+
+// runDLQList shows the messages at the front of the dead-letter queue configured by
+// RABBITMQ_DEAD_LETTER_QUEUE without removing them. The worker dead-letters the messages it
+// rejects, such as withdrawals from accounts without the funds, and those it cannot read; -o json
+// includes their bodies.
+func runDLQList(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("dlq list", "", stderr)
+	var output string
+	outputFlag(fs, &output)
+	limit := fs.Int("limit", 20, "number of messages to show")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 || *limit < 1 {
+		fs.Usage()
+		return errUsage
+	}
+	if err := checkOutput("dlq list", output, stderr); err != nil {
+		return err
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	name, ch, n, closeConn, err := openDLQ(cfg.RabbitMQ)
+	if err != nil {
+		return err
+	}
+	defer closeConn()
+	dls, err := queue.PeekDeadLetters(ch, name, *limit)
+	if err != nil {
+		return err
+	}
+	if err := printDeadLetters(stdout, output, dls); err != nil {
+		return err
+	}
+	fmt.Fprintf(stderr, "%d messages in %s\n", n, name)
+	return nil
+}
+
+// runDLQReplay moves dead-lettered messages back to the transaction exchange, oldest first, so
+// the worker applies them again once whatever made it reject them has been fixed, such as
+// funding an account or unfreezing it. Either the messages with the given --key values or, with
+// --all, every message is replayed, up to --limit. Messages are republished unchanged, so they
+// keep their idempotency keys and are applied at most once; those rejected again return to the
+// dead-letter queue.
+func runDLQReplay(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("dlq replay", "", stderr)
+	var output string
+	outputFlag(fs, &output)
+	keys := keysFlag{}
+	fs.Var(keys, "key", "replay the message with this idempotency key; repeatable")
+	all := fs.Bool("all", false, "replay every message")
+	limit := fs.Int("limit", 0, "replay at most this many messages (default no limit)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 || *limit < 0 || (len(keys) == 0) == !*all {
+		fmt.Fprintln(stderr, "ledgerctl dlq replay: set either --key or --all")
+		fs.Usage()
+		return errUsage
+	}
+	if err := checkOutput("dlq replay", output, stderr); err != nil {
+		return err
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	name, ch, _, closeConn, err := openDLQ(cfg.RabbitMQ)
+	if err != nil {
+		return err
+	}
+	defer closeConn()
+	var match func(queue.DeadLetter) bool
+	if !*all {
+		match = func(dl queue.DeadLetter) bool { return keys[dl.IdempotencyKey] }
+	}
+	pub := queue.NewPublisher(ch, cfg.RabbitMQ.Exchange, cfg.RabbitMQ.RoutingKey)
+	replayed, err := pub.ReplayDeadLetters(ctx, name, *limit, match)
+	if perr := printDeadLetters(stdout, output, replayed); perr != nil && err == nil {
+		err = perr
+	}
+	if err != nil {
+		return fmt.Errorf("after replaying %d messages: %w", len(replayed), err)
+	}
+	fmt.Fprintf(stderr, "replayed %d messages from %s\n", len(replayed), name)
+	for _, dl := range replayed {
+		delete(keys, dl.IdempotencyKey)
+	}
+	if !*all && len(keys) > 0 {
+		fmt.Fprintf(stderr, "ledgerctl dlq replay: %d keys not found in %s\n", len(keys), name)
+		return errFailed
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/Bharat0908/ledger/internal/export"
+	"github.com/Bharat0908/ledger/internal/repo"
+)
+
+// runExport streams ledger entries, oldest first, from the configured ledger store to a file or
+// stdout as CSV, NDJSON or Parquet: those of one account with --account, or of every account,
+// optionally within --from and --to. Entries are read from a store cursor and encoded as they
+// arrive, so exports of any size run in constant memory. A failed export removes its output
+// file rather than leave a truncated one behind.
+func runExport(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("export", "", stderr)
+	account := fs.String("account", "", "export only the entries of this account ID")
+	from := fs.String("from", "", "export only entries created at or after this RFC 3339 time")
+	to := fs.String("to", "", "export only entries created before this RFC 3339 time")
+	format := fs.String("format", "", "csv, ndjson or parquet (default from the output extension, else csv)")
+	output := fs.String("output", "-", "file to write, or - for stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return errUsage
+	}
+	var f repo.LedgerFilter
+	if *account != "" {
+		id, err := uuid.Parse(*account)
+		if err != nil {
+			fmt.Fprintln(stderr, "ledgerctl export: --account must be a UUID")
+			return errUsage
+		}
+		f.AccountID = id.String()
+	}
+	for _, t := range []struct {
+		name string
+		v    string
+		dst  *time.Time
+	}{{"from", *from, &f.From}, {"to", *to, &f.To}} {
+		if t.v == "" {
+			continue
+		}
+		var err error
+		if *t.dst, err = time.Parse(time.RFC3339, t.v); err != nil {
+			fmt.Fprintf(stderr, "ledgerctl export: --%s must be an RFC 3339 time\n", t.name)
+			return errUsage
+		}
+	}
+	if *format == "" {
+		*format = export.FormatCSV
+		switch strings.ToLower(filepath.Ext(*output)) {
+		case ".ndjson", ".jsonl":
+			*format = export.FormatNDJSON
+		case ".parquet":
+			*format = export.FormatParquet
+		}
+	}
+	if !slices.Contains(export.Formats, *format) {
+		fmt.Fprintln(stderr, "ledgerctl export: --format must be csv, ndjson or parquet")
+		return errUsage
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	store, closeStore, err := openLedger(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	out := stdout
+	if *output != "-" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+	n, err := exportLedger(ctx, store, f, *format, out)
+	if err != nil {
+		if *output != "-" {
+			os.Remove(*output)
+		}
+		return fmt.Errorf("after %d entries: %w", n, err)
+	}
+	fmt.Fprintf(stderr, "exported %d entries\n", n)
+	return nil
+}
+
+// exportLedger writes the entries matching f to w in format and returns how many it wrote.
+func exportLedger(ctx context.Context, store ledgerStore, f repo.LedgerFilter, format string, w io.Writer) (int, error) {
+	buf := bufio.NewWriterSize(w, 64<<10)
+	enc, err := export.NewWriter(buf, format)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	if err := store.ExportLedger(ctx, f, func(e repo.LedgerEntry) error {
+		n++
+		return enc.Write(e)
+	}); err != nil {
+		return n, err
+	}
+	if err := enc.Close(); err != nil {
+		return n, err
+	}
+	return n, buf.Flush()
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"github.com/Bharat0908/ledger/internal/config"
+	"github.com/Bharat0908/ledger/internal/importer"
+	"github.com/Bharat0908/ledger/internal/queue"
+)
+
+// columnsFlag collects repeated --column field:Header flags.
+type columnsFlag map[string]string
+
+func (c columnsFlag) String() string { return "" }
+
+func (c columnsFlag) Set(s string) error {
+	field, header, ok := strings.Cut(s, ":")
+	if !ok || field == "" || header == "" {
+		return fmt.Errorf("%q is not of the form field:Header", s)
+	}
+	c[field] = header
+	return nil
+}
+
+// runImport validates a file of deposits, withdrawals and transfers and publishes it straight to
+// the transaction queue configured for the services, like POST /v1/imports does but without
+// going through the API's access checks and quotas. The report is printed as JSON. A file with
+// invalid rows is not enqueued at all, and with --dry-run nothing is; neither needs a
+// connection to RabbitMQ.
+//
+// Messages are published with publisher confirms, and the command fails unless the broker
+// confirms every one. Since idempotency keys are derived from the file's content, a failed
+// import can simply be run again.
+func runImport(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("import", "<file|->", stderr)
+	format := fs.String("format", "", "file format, csv or ndjson (default from the file extension)")
+	dryRun := fs.Bool("dry-run", false, "validate the file and print the report without enqueuing anything")
+	columns := columnsFlag{}
+	fs.Var(columns, "column", "read a field from a differently named CSV column, as field:Header; repeatable")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errUsage
+	}
+	path := fs.Arg(0)
+	if *format == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".csv":
+			*format = importer.FormatCSV
+		case ".ndjson", ".jsonl":
+			*format = importer.FormatNDJSON
+		default:
+			fmt.Fprintln(stderr, "ledgerctl import: cannot tell the format from the file name; set --format")
+			return errUsage
+		}
+	}
+	var (
+		data []byte
+		err  error
+	)
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return err
+	}
+
+	rep, err := importer.Parse(data, importer.Options{Format: *format, Columns: columns})
+	if err != nil {
+		return err
+	}
+	rep.DryRun = *dryRun
+	if *dryRun || !rep.OK() {
+		if err := printJSON(stdout, rep); err != nil {
+			return err
+		}
+		if !rep.OK() {
+			fmt.Fprintf(stderr, "ledgerctl import: %d invalid rows, nothing enqueued\n", rep.Invalid)
+			return errFailed
+		}
+		return nil
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	rep.Enqueued, err = publishRecords(ctx, cfg.RabbitMQ, rep.Records)
+	if perr := printJSON(stdout, rep); perr != nil && err == nil {
+		err = perr
+	}
+	if err != nil {
+		return fmt.Errorf("%d of %d rows enqueued: %w", rep.Enqueued, rep.Valid, err)
+	}
+	return nil
+}
+
+// publishRecords publishes the records to the transaction exchange and waits for the broker to
+// confirm them, returning how many were confirmed in a row from the start.
+func publishRecords(ctx context.Context, mq config.RabbitMQ, recs []importer.Record) (int, error) {
+	conn, err := amqp.Dial(mq.URL.Value())
+	if err != nil {
+		return 0, fmt.Errorf("connect rabbitmq: %w", err)
+	}
+	defer conn.Close()
+	ch, err := conn.Channel()
+	if err != nil {
+		return 0, fmt.Errorf("open rabbitmq channel: %w", err)
+	}
+	defer ch.Close()
+	if err := ch.Confirm(false); err != nil {
+		return 0, fmt.Errorf("enable rabbitmq publisher confirms: %w", err)
+	}
+	confirms := ch.NotifyPublish(make(chan amqp.Confirmation, len(recs)))
+
+	sent, err := importer.Enqueue(ctx, queue.NewPublisher(ch, mq.Exchange, mq.RoutingKey), recs, nil)
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	for i := 0; i < sent; i++ {
+		select {
+		case c, ok := <-confirms:
+			if !ok {
+				return i, fmt.Errorf("rabbitmq channel closed before row %d was confirmed", recs[i].Row)
+			}
+			if !c.Ack {
+				return i, fmt.Errorf("row %d: %w", recs[i].Row, queue.ErrNotConfirmed)
+			}
+		case <-ctx.Done():
+			return i, fmt.Errorf("waiting for row %d to be confirmed: %w", recs[i].Row, ctx.Err())
+		}
+	}
+	return sent, err
+}
+
+// printJSON writes v to w as indented JSON.
+func printJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// command is a ledgerctl subcommand. run receives the arguments after the command's name and
+// returns errUsage, after printing why, when they are invalid.
+type command struct {
+	summary string
+	run     func(args []string, stdout, stderr io.Writer) error
+}
+
+// commands maps the name of every subcommand to its implementation. Those documented as going
+// through the API take --api, --api-key and --token; the others use the services' dependencies
+// directly.
+var commands = map[string]command{
+	"accounts":  {summary: "create, list and show accounts and their balances (API)", run: group("accounts", accountCommands)},
+	"deposit":   {summary: "submit a deposit (API)", run: runTransaction("deposit")},
+	"withdraw":  {summary: "submit a withdrawal (API)", run: runTransaction("withdraw")},
+	"transfer":  {summary: "submit a transfer between accounts (API)", run: runTransfer},
+	"status":    {summary: "show whether the transaction with an idempotency key was applied (API)", run: runStatus},
+	"ledger":    {summary: "show an account's latest ledger entries (API)", run: runLedger},
+	"dlq":       {summary: "inspect and replay dead-lettered transactions", run: group("dlq", dlqCommands)},
+	"reconcile": {summary: "check account balances against the ledger", run: runReconcile},
+	"export":    {summary: "export ledger entries as CSV, NDJSON or Parquet", run: runExport},
+	"import":    {summary: "validate a CSV or NDJSON file of transactions and enqueue it", run: runImport},
+}
+
+// errUsage is returned by commands given invalid arguments; ledgerctl then exits with status 2.
+var errUsage = errors.New("usage")
+
+// errFailed is returned by commands that already reported why they failed; ledgerctl then exits
+// with status 1 without printing anything more.
+var errFailed = errors.New("failed")
+
+// main is the entry point of ledgerctl, the operators' command line tool. It runs the subcommand
+// named by its first argument. Commands that go through the API find it and their credentials
+// with flags or the LEDGER_API_URL, LEDGER_API_KEY and LEDGER_API_TOKEN variables; those that
+// talk to the ledger's dependencies read their settings like the services do, from the file
+// named by LEDGER_CONFIG and the environment (see package config).
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run runs the subcommand named by args[0] and returns the process exit status.
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		usage(stderr)
+		return 2
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "ledgerctl: unknown command %q\n", args[0])
+		usage(stderr)
+		return 2
+	}
+	switch err := cmd.run(args[1:], stdout, stderr); {
+	case err == nil:
+		return 0
+	case errors.Is(err, errUsage), errors.Is(err, flag.ErrHelp):
+		return 2
+	case errors.Is(err, errFailed):
+		return 1
+	default:
+		fmt.Fprintf(stderr, "ledgerctl %s: %v\n", args[0], err)
+		return 1
+	}
+}
+
+// usage lists the subcommands.
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: ledgerctl <command> [flags] [args]")
+	listCommands(w, commands)
+	fmt.Fprintln(w, "\nRun ledgerctl <command> -h for the flags of a command.")
+}
+
+// listCommands prints the names and summaries of cmds.
+func listCommands(w io.Writer, cmds map[string]command) {
+	fmt.Fprintln(w, "\ncommands:")
+	names := make([]string, 0, len(cmds))
+	for name := range cmds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-12s %s\n", name, cmds[name].summary)
+	}
+}
+
+// group returns the run function of a command made of subcommands, such as ledgerctl accounts
+// list, which runs the subcommand named by its first argument.
+func group(name string, subs map[string]command) func(args []string, stdout, stderr io.Writer) error {
+	return func(args []string, stdout, stderr io.Writer) error {
+		if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+			fmt.Fprintf(stderr, "usage: ledgerctl %s <command> [flags] [args]\n", name)
+			listCommands(stderr, subs)
+			return errUsage
+		}
+		sub, ok := subs[args[0]]
+		if !ok {
+			fmt.Fprintf(stderr, "ledgerctl %s: unknown command %q\n", name, args[0])
+			return errUsage
+		}
+		return sub.run(args[1:], stdout, stderr)
+	}
+}
+
+// newFlagSet returns the flag set of the named command, printing errors and help to stderr.
+func newFlagSet(name, args string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet("ledgerctl "+name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "usage: ledgerctl %s [flags] %s\n\nflags:\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+
+	"github.com/google/uuid"
+
+	"github.com/Bharat0908/ledger/internal/reconcile"
+)
+
+// runReconcile checks every account's balance, or with --account one account's, against its
+// ledger entries, reading the configured stores directly (see package reconcile). Discrepancies
+// are printed and make the command fail, so it can run from cron; the check is read-only and
+// safe to run while the services are up.
+func runReconcile(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("reconcile", "", stderr)
+	var output string
+	outputFlag(fs, &output)
+	account := fs.String("account", "", "reconcile only this account ID")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return errUsage
+	}
+	if err := checkOutput("reconcile", output, stderr); err != nil {
+		return err
+	}
+	var id uuid.UUID
+	if *account != "" {
+		var err error
+		if id, err = uuid.Parse(*account); err != nil {
+			fmt.Fprintln(stderr, "ledgerctl reconcile: --account must be a UUID")
+			return errUsage
+		}
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	accounts, ledger, closeStores, err := openStores(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer closeStores()
+
+	var rep reconcile.Report
+	if id != uuid.Nil {
+		m, ok, err := reconcile.Account(ctx, accounts, ledger, id)
+		if err != nil {
+			return err
+		}
+		rep = reconcile.Report{Accounts: 1, Mismatches: []reconcile.Mismatch{}, Orphans: []reconcile.Orphan{}}
+		if !ok {
+			rep.Mismatches = append(rep.Mismatches, m)
+		}
+	} else if rep, err = reconcile.Run(ctx, accounts, ledger); err != nil {
+		return err
+	}
+
+	if output == "json" {
+		err = printJSON(stdout, rep)
+	} else {
+		err = printReconcileReport(stdout, rep)
+	}
+	if err != nil {
+		return err
+	}
+	if !rep.OK() {
+		fmt.Fprintf(stderr, "ledgerctl reconcile: %d accounts out of balance, %d orphaned ledger accounts\n", len(rep.Mismatches), len(rep.Orphans))
+		return errFailed
+	}
+	return nil
+}
+
+// printReconcileReport prints the discrepancies of rep as tables, or that there are none.
+func printReconcileReport(w io.Writer, rep reconcile.Report) error {
+	if rep.Entries > 0 {
+		fmt.Fprintf(w, "checked %d accounts against %d ledger entries\n", rep.Accounts, rep.Entries)
+	} else {
+		fmt.Fprintf(w, "checked %d accounts\n", rep.Accounts)
+	}
+	if rep.OK() {
+		_, err := fmt.Fprintln(w, "all balances agree with the ledger")
+		return err
+	}
+	var errs []error
+	if len(rep.Mismatches) > 0 {
+		fmt.Fprintln(w, "\naccounts out of balance:")
+		rows := make([][]string, len(rep.Mismatches))
+		for i, m := range rep.Mismatches {
+			rows[i] = []string{m.AccountID.String(), m.Currency, strconv.FormatInt(m.Balance, 10), strconv.FormatInt(m.Ledger.Sum, 10),
+				strconv.FormatInt(m.Ledger.LastBalanceAfter, 10), strconv.FormatInt(m.Difference, 10), strconv.FormatInt(m.Ledger.Entries, 10)}
+		}
+		errs = append(errs, printTable(w, []string{"ACCOUNT", "CURRENCY", "BALANCE", "LEDGER_SUM", "LAST_BALANCE_AFTER", "DIFFERENCE", "ENTRIES"}, rows))
+	}
+	if len(rep.Orphans) > 0 {
+		fmt.Fprintln(w, "\nledger entries without an account:")
+		rows := make([][]string, len(rep.Orphans))
+		for i, o := range rep.Orphans {
+			rows[i] = []string{o.AccountID, strconv.FormatInt(o.Ledger.Sum, 10), strconv.FormatInt(o.Ledger.Entries, 10)}
+		}
+		errs = append(errs, printTable(w, []string{"ACCOUNT", "LEDGER_SUM", "ENTRIES"}, rows))
+	}
+	return errors.Join(errs...)
+}
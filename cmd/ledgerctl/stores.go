@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/Bharat0908/ledger/internal/config"
+	"github.com/Bharat0908/ledger/internal/reconcile"
+	"github.com/Bharat0908/ledger/internal/repo"
+)
+
+// loadConfig reads the services' configuration from the file named by LEDGER_CONFIG and the
+// environment. Flags are not read: they belong to the command.
+func loadConfig() (config.Config, error) {
+	cfg, _, err := config.Load(nil, os.Getenv)
+	if err != nil {
+		return cfg, fmt.Errorf("config: %w", err)
+	}
+	return cfg, nil
+}
+
+// ledgerStore reads ledger entries. It is implemented by repo.MongoRepo, repo.PGLedgerRepo and
+// repo.SQLiteRepo.
+type ledgerStore interface {
+	ExportLedger(ctx context.Context, f repo.LedgerFilter, fn func(repo.LedgerEntry) error) error
+}
+
+// openLedger opens the ledger store the configuration selects, as the API does, and returns it
+// with a function that closes it.
+func openLedger(ctx context.Context, cfg config.Config) (ledgerStore, func(), error) {
+	if cfg.Storage == "sqlite" {
+		db, err := repo.OpenSQLite(ctx, cfg.SQLite.Path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("open sqlite %s: %w", cfg.SQLite.Path, err)
+		}
+		return db, func() { db.DB.Close() }, nil
+	}
+	if cfg.LedgerStore == "mongo" {
+		mc, err := mongo.Connect(ctx, options.Client().ApplyURI(cfg.Mongo.URI.Value()))
+		if err != nil {
+			return nil, nil, fmt.Errorf("connect mongo: %w", err)
+		}
+		return &repo.MongoRepo{C: mc.Database(cfg.Mongo.Database).Collection(cfg.Mongo.Collection)},
+			func() { mc.Disconnect(context.Background()) }, nil
+	}
+	pg, err := pgxpool.New(ctx, cfg.Postgres.DSN.Value())
+	if err != nil {
+		return nil, nil, fmt.Errorf("connect postgres: %w", err)
+	}
+	return &repo.PGLedgerRepo{DB: pg}, pg.Close, nil
+}
+
+// openStores opens the account store and the ledger store the configuration selects, as the API
+// does, and returns them with a function that closes them. With SQLite storage both are the same
+// database.
+func openStores(ctx context.Context, cfg config.Config) (reconcile.AccountStore, ledgerStore, func(), error) {
+	if cfg.Storage == "sqlite" {
+		db, err := repo.OpenSQLite(ctx, cfg.SQLite.Path)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("open sqlite %s: %w", cfg.SQLite.Path, err)
+		}
+		return db, db, func() { db.DB.Close() }, nil
+	}
+	pg, err := pgxpool.New(ctx, cfg.Postgres.DSN.Value())
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("connect postgres: %w", err)
+	}
+	ledger, closeLedger, err := openLedger(ctx, cfg)
+	if err != nil {
+		pg.Close()
+		return nil, nil, nil, err
+	}
+	return &repo.PGRepo{DB: pg}, ledger, func() { closeLedger(); pg.Close() }, nil
+}
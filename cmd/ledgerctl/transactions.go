@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/Bharat0908/ledger/internal/repo"
+)
+
+// transactionStatus is the body of GET /v1/transactions/{key}.
+type transactionStatus struct {
+	IdempotencyKey string     `json:"idempotency_key"`
+	Status         string     `json:"status"`
+	AccountID      *uuid.UUID `json:"account_id,omitempty"`
+	Type           string     `json:"type,omitempty"`
+	Amount         int64      `json:"amount,omitempty"`
+	AppliedAt      *time.Time `json:"applied_at,omitempty"`
+}
+
+// submitted is the body of a 202 from POST /v1/transactions or /v1/transfers, completed with
+// the transaction's status when --wait is set.
+type submitted struct {
+	Status         string             `json:"status"`
+	IdempotencyKey string             `json:"idempotency_key"`
+	Applied        *transactionStatus `json:"applied,omitempty"`
+}
+
+// submitFlags registers the flags shared by deposit, withdraw and transfer.
+func submitFlags(fs *flag.FlagSet) (key *string, wait *time.Duration) {
+	key = fs.String("key", "", "idempotency key (default a random UUID chosen by the API)")
+	wait = fs.Duration("wait", 0, "wait up to this long for the worker to apply the transaction")
+	return key, wait
+}
+
+// parseAmount parses a positive amount in minor units.
+func parseAmount(name, s string, stderr io.Writer) (int64, error) {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n <= 0 {
+		fmt.Fprintf(stderr, "ledgerctl %s: the amount must be a positive integer in minor units\n", name)
+		return 0, errUsage
+	}
+	return n, nil
+}
+
+// runTransaction returns the command that submits a deposit or withdrawal through
+// POST /v1/transactions.
+func runTransaction(typ string) func(args []string, stdout, stderr io.Writer) error {
+	return func(args []string, stdout, stderr io.Writer) error {
+		fs := newFlagSet(typ, "<account-id> <amount>", stderr)
+		c := apiFlags(fs)
+		key, wait := submitFlags(fs)
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		if fs.NArg() != 2 {
+			fs.Usage()
+			return errUsage
+		}
+		if err := checkOutput(typ, c.output, stderr); err != nil {
+			return err
+		}
+		id, err := uuid.Parse(fs.Arg(0))
+		if err != nil {
+			fmt.Fprintf(stderr, "ledgerctl %s: %q is not an account ID\n", typ, fs.Arg(0))
+			return errUsage
+		}
+		amount, err := parseAmount(typ, fs.Arg(1), stderr)
+		if err != nil {
+			return err
+		}
+		body := map[string]interface{}{"account_id": id, "type": typ, "amount": amount}
+		if *key != "" {
+			body["idempotency_key"] = *key
+		}
+		return submit(c, "/v1/transactions", body, *wait, stdout)
+	}
+}
+
+// runTransfer submits a transfer through POST /v1/transfers.
+func runTransfer(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("transfer", "<from-account-id> <to-account-id> <amount>", stderr)
+	c := apiFlags(fs)
+	key, wait := submitFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 3 {
+		fs.Usage()
+		return errUsage
+	}
+	if err := checkOutput("transfer", c.output, stderr); err != nil {
+		return err
+	}
+	var ids [2]uuid.UUID
+	for i := range ids {
+		id, err := uuid.Parse(fs.Arg(i))
+		if err != nil {
+			fmt.Fprintf(stderr, "ledgerctl transfer: %q is not an account ID\n", fs.Arg(i))
+			return errUsage
+		}
+		ids[i] = id
+	}
+	amount, err := parseAmount("transfer", fs.Arg(2), stderr)
+	if err != nil {
+		return err
+	}
+	body := map[string]interface{}{"from_account_id": ids[0], "to_account_id": ids[1], "amount": amount}
+	if *key != "" {
+		body["idempotency_key"] = *key
+	}
+	return submit(c, "/v1/transfers", body, *wait, stdout)
+}
+
+// errNotApplied is returned by submit when the transaction was not applied within --wait.
+var errNotApplied = errors.New("not applied in time: it may still be queued, or have been rejected (see ledgerctl dlq list)")
+
+// submit posts a transaction or transfer and prints its idempotency key, after waiting for the
+// worker to apply it if wait is positive.
+func submit(c *apiClient, path string, body map[string]interface{}, wait time.Duration, stdout io.Writer) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	var out submitted
+	if err := c.do(ctx, http.MethodPost, path, nil, body, &out); err != nil {
+		return err
+	}
+	var waitErr error
+	if wait > 0 {
+		out.Applied, waitErr = waitApplied(ctx, c, out.IdempotencyKey, wait)
+		if out.Applied != nil && out.Applied.Status == "applied" {
+			out.Status = "applied"
+		}
+	}
+	var err error
+	if c.output == "json" {
+		err = printJSON(stdout, out)
+	} else {
+		err = printTable(stdout, []string{"IDEMPOTENCY_KEY", "STATUS"}, [][]string{{out.IdempotencyKey, out.Status}})
+	}
+	if waitErr != nil {
+		return fmt.Errorf("%s: %w", out.IdempotencyKey, waitErr)
+	}
+	return err
+}
+
+// waitApplied polls the status of the transaction with the key until it is applied or wait
+// elapses, when it returns errNotApplied with the last status.
+func waitApplied(ctx context.Context, c *apiClient, key string, wait time.Duration) (*transactionStatus, error) {
+	ctx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+	tick := time.NewTicker(250 * time.Millisecond)
+	defer tick.Stop()
+	for {
+		var st transactionStatus
+		err := c.do(ctx, http.MethodGet, "/v1/transactions/"+url.PathEscape(key), nil, nil, &st)
+		switch {
+		case err == nil && st.Status == "applied":
+			return &st, nil
+		case err != nil && ctx.Err() == nil:
+			return nil, err
+		}
+		select {
+		case <-tick.C:
+		case <-ctx.Done():
+			if st.Status == "" {
+				return nil, errNotApplied
+			}
+			return &st, errNotApplied
+		}
+	}
+}
+
+// runStatus shows, through GET /v1/transactions/{key}, whether the transactions or transfers
+// submitted with the idempotency keys were applied.
+func runStatus(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("status", "<idempotency-key>...", stderr)
+	c := apiFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errUsage
+	}
+	if err := checkOutput("status", c.output, stderr); err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	sts := make([]transactionStatus, fs.NArg())
+	for i, key := range fs.Args() {
+		if err := c.do(ctx, http.MethodGet, "/v1/transactions/"+url.PathEscape(key), nil, nil, &sts[i]); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	if c.output == "json" {
+		if len(sts) == 1 {
+			return printJSON(stdout, sts[0])
+		}
+		return printJSON(stdout, sts)
+	}
+	rows := make([][]string, len(sts))
+	for i, st := range sts {
+		rows[i] = []string{st.IdempotencyKey, st.Status, "", st.Type, "", ""}
+		if st.AccountID != nil {
+			rows[i][2] = st.AccountID.String()
+		}
+		if st.AppliedAt != nil {
+			rows[i][4], rows[i][5] = strconv.FormatInt(st.Amount, 10), formatTime(*st.AppliedAt)
+		}
+	}
+	return printTable(stdout, []string{"IDEMPOTENCY_KEY", "STATUS", "ACCOUNT", "TYPE", "AMOUNT", "APPLIED"}, rows)
+}
+
+// runLedger shows an account's latest ledger entries, newest first, through
+// GET /v1/accounts/{id}/ledger.
+func runLedger(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("ledger", "<account-id>", stderr)
+	c := apiFlags(fs)
+	limit := fs.Int("limit", 50, "number of entries to show")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 || *limit < 1 {
+		fs.Usage()
+		return errUsage
+	}
+	if err := checkOutput("ledger", c.output, stderr); err != nil {
+		return err
+	}
+	id, err := uuid.Parse(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(stderr, "ledgerctl ledger: %q is not an account ID\n", fs.Arg(0))
+		return errUsage
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	var resp struct {
+		Entries []repo.LedgerEntry `json:"entries"`
+	}
+	q := url.Values{"limit": {strconv.Itoa(*limit)}}
+	if err := c.do(ctx, http.MethodGet, "/v1/accounts/"+id.String()+"/ledger", q, nil, &resp); err != nil {
+		return err
+	}
+	if resp.Entries == nil {
+		resp.Entries = []repo.LedgerEntry{}
+	}
+	if c.output == "json" {
+		return printJSON(stdout, resp)
+	}
+	rows := make([][]string, len(resp.Entries))
+	for i, e := range resp.Entries {
+		rows[i] = []string{formatTime(e.CreatedAt), e.Type, strconv.FormatInt(e.Amount, 10),
+			strconv.FormatInt(e.BalanceAfter, 10), e.IdempotencyKey}
+	}
+	return printTable(stdout, []string{"CREATED", "TYPE", "AMOUNT", "BALANCE_AFTER", "IDEMPOTENCY_KEY"}, rows)
+}
@@ -2,7 +2,8 @@ package main
 
 import (
 	"context"
-	"log"
+	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
@@ -13,64 +14,160 @@ import (
 	amqp "github.com/rabbitmq/amqp091-go"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
 
+	"github.com/Bharat0908/ledger/internal/bulk"
+	"github.com/Bharat0908/ledger/internal/config"
+	"github.com/Bharat0908/ledger/internal/health"
+	"github.com/Bharat0908/ledger/internal/logging"
+	"github.com/Bharat0908/ledger/internal/metrics"
 	"github.com/Bharat0908/ledger/internal/queue"
 	"github.com/Bharat0908/ledger/internal/repo"
+	"github.com/Bharat0908/ledger/internal/tracing"
+	"github.com/Bharat0908/ledger/internal/webhook"
 )
 
 // main is the entry point for the worker service. It initializes connections to PostgreSQL (via pgxpool),
-// MongoDB, and RabbitMQ using environment variables for configuration. The function sets up repositories
+// MongoDB, and RabbitMQ, configured like the API by package config (a YAML file, the environment
+// and flags, with the same defaults). MongoDB is not used when the ledger store is postgres; ledger
+// entries are then written to Postgres alongside the balance change. The function sets up repositories
 // for both databases, constructs a transaction applier and a ledger writer, and starts a queue consumer
-// to process incoming messages. It listens for system interrupt or termination signals to gracefully
-// shut down the worker, allowing time for cleanup before exiting.
+// to process incoming messages, publishing the resulting ledger events to the events exchange and
+// queueing them for subscribed webhooks, which it delivers in the background.
+// /healthz and /readyz, reporting on every dependency, are served on the admin address (default
+// :8081), along with /metrics. Trace spans are exported as configured by OTEL_TRACES_EXPORTER (see
+// package tracing). On SIGINT or SIGTERM the consumer stops taking messages and waits, for up to
+// the shutdown timeout, for those in flight to be settled before the connections are closed.
 func main() {
+	cfg := config.MustLoad()
+	logging.Setup("ledger-worker", cfg.Log.Level, cfg.Log.Format)
 	ctx := context.Background()
-	pg, err := pgxpool.New(ctx, os.Getenv("POSTGRES_DSN"))
+	shutdownTracing, err := tracing.Setup(ctx, "ledger-worker")
 	if err != nil {
-		log.Fatalf("pgxpool: %v", err)
+		logging.Fatal("set up tracing", "error", err)
 	}
-	defer pg.Close()
-
-	mc, err := mongo.Connect(ctx, options.Client().ApplyURI(os.Getenv("MONGO_URI")))
+	hc := &health.Health{Timeout: cfg.Health.Timeout, CacheTTL: cfg.Health.CacheTTL}
+	pg, err := pgxpool.New(ctx, cfg.Postgres.DSN.Value())
 	if err != nil {
-		log.Fatalf("mongo connect: %v", err)
+		logging.Fatal("connect postgres", "error", err)
 	}
-	defer mc.Disconnect(ctx)
-
-	mcol := mc.Database("ledger").Collection("entries")
+	defer pg.Close()
+	hc.Add("postgres", pg.Ping)
 
-	conn, err := amqp.Dial(os.Getenv("RABBITMQ_URL"))
+	conn, err := amqp.Dial(cfg.RabbitMQ.URL.Value())
 	if err != nil {
-		log.Fatalf("amqp dial: %v", err)
+		logging.Fatal("connect rabbitmq", "error", err)
 	}
 	defer conn.Close()
 	ch, err := conn.Channel()
 	if err != nil {
-		log.Fatalf("amqp channel: %v", err)
+		logging.Fatal("open rabbitmq channel", "error", err)
 	}
 	defer ch.Close()
+	hc.Add("rabbitmq", queue.CheckAMQP(conn, ch))
 
 	pgRepo := &repo.PGRepo{DB: pg}
-	mongoRepo := &repo.MongoRepo{C: mcol}
-
 	txApplier := &workerApplier{pg: pgRepo}
-	ledgerWriter := &workerLedgerWriter{m: mongoRepo}
-
-	consumer := &queue.Consumer{Ch: ch, Queue: "tx-queue", Applier: txApplier, Ledger: ledgerWriter}
+	consumer := &queue.Consumer{Ch: ch, Queue: cfg.RabbitMQ.Queue, Applier: txApplier, Concurrency: cfg.RabbitMQ.Concurrency}
+
+	// Ledger events are queued for the webhooks subscribed to them, mark refused bulk transfers
+	// failed and, unless disabled, are published to the events exchange on a channel of their own,
+	// so publishing is not held up by deliveries.
+	webhooks := &repo.PGWebhookRepo{DB: pg}
+	events := queue.EventPublishers{&webhook.Dispatcher{Store: webhooks}, &bulk.Recorder{Store: &repo.PGBatchRepo{DB: pg}}}
+	if name := cfg.RabbitMQ.EventsExchange; name != "" {
+		evCh, err := conn.Channel()
+		if err != nil {
+			logging.Fatal("open rabbitmq events channel", "error", err)
+		}
+		defer evCh.Close()
+		if err := evCh.ExchangeDeclare(name, queue.EventsExchangeKind, true, false, false, false, nil); err != nil {
+			logging.Fatal("declare events exchange", "exchange", name, "error", err)
+		}
+		events = append(events, queue.NewEventExchange(evCh, name))
+	}
+	consumer.Events = events
+
+	// Ledger store: MongoDB (default) or the Postgres ledger_entries table, in which case
+	// entries are written by PGRepo in the same transaction as the balance change.
+	switch cfg.LedgerStore {
+	case "mongo":
+		mc, err := mongo.Connect(ctx, options.Client().ApplyURI(cfg.Mongo.URI.Value()))
+		if err != nil {
+			logging.Fatal("connect mongo", "error", err)
+		}
+		defer mc.Disconnect(ctx)
+		hc.Add("mongo", func(ctx context.Context) error { return mc.Ping(ctx, readpref.Primary()) })
+		mongoRepo := &repo.MongoRepo{C: mc.Database(cfg.Mongo.Database).Collection(cfg.Mongo.Collection)}
+		consumer.Ledger = &workerLedgerWriter{m: mongoRepo}
+	case "postgres":
+		pgRepo.WriteLedger = true
+	}
 
 	// start consumer
+	consumerDone := make(chan error, 1)
+	go func() { consumerDone <- consumer.Start(ctx) }()
+
+	// deliver webhooks
+	deliverCtx, stopDelivering := context.WithCancel(ctx)
+	deliverDone := make(chan struct{})
 	go func() {
-		if err := consumer.Start(context.Background()); err != nil {
-			log.Fatalf("consumer error: %v", err)
+		defer close(deliverDone)
+		newDeliverer(webhooks, cfg.Webhooks).Run(deliverCtx)
+	}()
+
+	admin := newAdminServer(cfg.Admin.Addr, hc)
+	go func() {
+		slog.Info("worker admin listening", "addr", admin.Addr)
+		if err := admin.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logging.Fatal("serve admin", "error", err)
 		}
 	}()
 
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
-	<-stop
-	log.Println("worker shutting down")
-	// allow some time for cleanup
-	time.Sleep(2 * time.Second)
+	select {
+	case <-stop:
+	case err := <-consumerDone:
+		logging.Fatal("consumer stopped", "error", err)
+	}
+
+	// Stop taking messages and let the ones in flight finish before the stores are closed by the
+	// deferred calls above; whatever is cut off by the deadline is rolled back and redelivered.
+	slog.Info("shutting down", "timeout", cfg.ShutdownTimeout)
+	ctxShut, cancelShut := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancelShut()
+	drained, err := consumer.Shutdown(ctxShut)
+	if err != nil {
+		slog.Warn("consumer drain interrupted", "drained", drained, "error", err)
+	} else {
+		slog.Info("consumer drained", "drained", drained)
+	}
+	// Webhook attempts cut off here are not recorded; they are retried once their lease expires.
+	stopDelivering()
+	<-deliverDone
+	admin.Shutdown(ctxShut)
+	if err := shutdownTracing(ctxShut); err != nil {
+		slog.Warn("flush traces", "error", err)
+	}
+}
+
+// newAdminServer returns the worker's admin HTTP server, listening on addr. It carries no API,
+// only operational endpoints.
+func newAdminServer(addr string, hc *health.Health) *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", hc.Live)
+	mux.HandleFunc("/readyz", hc.Ready)
+	mux.Handle("/metrics", metrics.Handler())
+	return &http.Server{Addr: addr, Handler: mux, ReadTimeout: 10 * time.Second, WriteTimeout: 10 * time.Second}
+}
+
+// newDeliverer returns the webhook deliverer configured by cfg.
+func newDeliverer(store webhook.Store, cfg config.Webhooks) *webhook.Deliverer {
+	return &webhook.Deliverer{
+		Store: store, MaxAttempts: cfg.MaxAttempts, InitialBackoff: cfg.InitialBackoff, MaxBackoff: cfg.MaxBackoff,
+		Timeout: cfg.Timeout, PollInterval: cfg.PollInterval, Batch: cfg.Batch, AllowedNetworks: cfg.AllowedNetworks,
+	}
 }
 
 // small adapters
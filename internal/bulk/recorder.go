@@ -0,0 +1,34 @@
+// Package bulk follows the transfers of bulk submissions through the worker.
+package bulk
+
+import (
+	"context"
+
+	"github.com/Bharat0908/ledger/internal/metrics"
+	"github.com/Bharat0908/ledger/internal/queue"
+	"github.com/Bharat0908/ledger/internal/repo"
+)
+
+// Failures is the batch storage used by the Recorder.
+type Failures interface {
+	FailBatchItems(ctx context.Context, fs []repo.BatchItemFailure) error
+}
+
+// Recorder is a queue.EventPublisher that marks the batch items of rejected transfers failed, with
+// the reason of the rejection. Applied transfers need no bookkeeping: batch progress finds them by
+// idempotency key and source account. Transfers that were not submitted in bulk match no item, and
+// repeated events leave failed items as they are.
+type Recorder struct {
+	Store Failures
+}
+
+// PublishEvents records the failures among events.
+func (r *Recorder) PublishEvents(ctx context.Context, events []queue.Event) error {
+	var fs []repo.BatchItemFailure
+	for _, e := range events {
+		if e.Type == queue.EventTransactionRejected && e.Kind == metrics.KindTransfer {
+			fs = append(fs, repo.BatchItemFailure{IdempotencyKey: e.IdempotencyKey, AccountID: e.AccountID, Reason: e.Reason})
+		}
+	}
+	return r.Store.FailBatchItems(ctx, fs)
+}
@@ -0,0 +1,47 @@
+package bulk_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Bharat0908/ledger/internal/bulk"
+	"github.com/Bharat0908/ledger/internal/metrics"
+	"github.com/Bharat0908/ledger/internal/queue"
+	"github.com/Bharat0908/ledger/internal/repo"
+)
+
+func TestRecorder_PublishEvents(t *testing.T) {
+	ctx := context.Background()
+	store, err := repo.OpenSQLite(ctx, ":memory:")
+	if err != nil {
+		t.Fatalf("OpenSQLite() failed: %v", err)
+	}
+	defer store.DB.Close()
+	b, err := store.CreateTransferBatch(ctx, repo.NewTransferBatch{Items: []repo.NewBatchItem{
+		{IdempotencyKey: "k1", Status: repo.BatchItemQueued},
+		{IdempotencyKey: "k2", Status: repo.BatchItemQueued},
+		{IdempotencyKey: "k3", Status: repo.BatchItemQueued},
+	}})
+	if err != nil {
+		t.Fatalf("CreateTransferBatch() failed: %v", err)
+	}
+
+	rec := &bulk.Recorder{Store: store}
+	events := []queue.Event{
+		{Type: queue.EventTransactionRejected, Kind: metrics.KindTransfer, IdempotencyKey: "k1", Reason: repo.ErrInsufficientFunds.Code},
+		{Type: queue.EventTransactionRejected, Kind: metrics.KindTransaction, IdempotencyKey: "k2", Reason: repo.ErrAccountFrozen.Code},
+		{Type: queue.EventTransactionApplied, Kind: metrics.KindTransfer, IdempotencyKey: "k3"},
+	}
+	for i := 0; i < 2; i++ {
+		if err := rec.PublishEvents(ctx, events); err != nil {
+			t.Fatalf("PublishEvents() failed: %v", err)
+		}
+	}
+	got, err := store.GetTransferBatch(ctx, b.ID)
+	if err != nil {
+		t.Fatalf("GetTransferBatch() failed: %v", err)
+	}
+	if got.Failed != 1 || got.Pending != 2 {
+		t.Errorf("batch = %+v, want only the rejected transfer failed", got)
+	}
+}
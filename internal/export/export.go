@@ -0,0 +1,128 @@
+// Package export encodes ledger entries as CSV, NDJSON or Parquet, one entry at a time, so
+// exports of any size can be streamed from a store cursor to a file or an HTTP response.
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+
+	"github.com/Bharat0908/ledger/internal/repo"
+)
+
+// Export formats.
+const (
+	FormatCSV     = "csv"
+	FormatNDJSON  = "ndjson"
+	FormatParquet = "parquet"
+)
+
+// Formats lists every export format.
+var Formats = []string{FormatCSV, FormatNDJSON, FormatParquet}
+
+// parquetRowGroup is the number of entries buffered before a Parquet row group is written,
+// which bounds the memory a Parquet export holds.
+const parquetRowGroup = 64 << 10
+
+// header is the CSV header row, in column order.
+var header = []string{"account_id", "type", "amount", "balance_after", "idempotency_key", "created_at"}
+
+// Writer encodes ledger entries. Close must be called after the last entry: it writes what the
+// format needs at the end, such as the Parquet footer, but does not close the underlying writer.
+type Writer interface {
+	Write(e repo.LedgerEntry) error
+	Close() error
+}
+
+// NewWriter returns a Writer encoding entries to w in format. CSV files start with a header row
+// and carry times in RFC 3339 with nanoseconds, in UTC; Parquet files are Snappy-compressed with
+// times in microseconds.
+func NewWriter(w io.Writer, format string) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w), nil
+	case FormatNDJSON:
+		return &ndjsonWriter{enc: json.NewEncoder(w)}, nil
+	case FormatParquet:
+		return &parquetWriter{w: parquet.NewGenericWriter[repo.LedgerEntry](w,
+			parquet.Compression(&parquet.Snappy), parquet.MaxRowsPerRowGroup(parquetRowGroup))}, nil
+	}
+	return nil, fmt.Errorf("export: unknown format %q", format)
+}
+
+// ContentType returns the media type of format.
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv"
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	case FormatParquet:
+		return "application/vnd.apache.parquet"
+	}
+	return "application/octet-stream"
+}
+
+// csvWriter writes entries as CSV rows after a header row.
+type csvWriter struct {
+	w      *csv.Writer
+	header bool
+}
+
+func newCSVWriter(w io.Writer) *csvWriter { return &csvWriter{w: csv.NewWriter(w)} }
+
+func (c *csvWriter) Write(e repo.LedgerEntry) error {
+	if !c.header {
+		c.header = true
+		if err := c.w.Write(header); err != nil {
+			return err
+		}
+	}
+	return c.w.Write([]string{
+		e.AccountID,
+		e.Type,
+		strconv.FormatInt(e.Amount, 10),
+		strconv.FormatInt(e.BalanceAfter, 10),
+		e.IdempotencyKey,
+		e.CreatedAt.UTC().Format(time.RFC3339Nano),
+	})
+}
+
+// Close writes the header of an empty export and flushes buffered rows.
+func (c *csvWriter) Close() error {
+	if !c.header {
+		c.header = true
+		if err := c.w.Write(header); err != nil {
+			return err
+		}
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// ndjsonWriter writes entries as JSON objects, one per line.
+type ndjsonWriter struct{ enc *json.Encoder }
+
+func (n *ndjsonWriter) Write(e repo.LedgerEntry) error { return n.enc.Encode(e) }
+
+func (n *ndjsonWriter) Close() error { return nil }
+
+// parquetWriter writes entries as the rows of a Parquet file.
+type parquetWriter struct {
+	w   *parquet.GenericWriter[repo.LedgerEntry]
+	row [1]repo.LedgerEntry
+}
+
+func (p *parquetWriter) Write(e repo.LedgerEntry) error {
+	p.row[0] = e
+	_, err := p.w.Write(p.row[:])
+	return err
+}
+
+// Close writes the buffered row group and the footer.
+func (p *parquetWriter) Close() error { return p.w.Close() }
@@ -0,0 +1,83 @@
+package export_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+
+	"github.com/Bharat0908/ledger/internal/export"
+	"github.com/Bharat0908/ledger/internal/repo"
+)
+
+var entries = []repo.LedgerEntry{
+	{AccountID: "11111111-1111-1111-1111-111111111111", Type: "deposit", Amount: 700, BalanceAfter: 700, IdempotencyKey: "dep-1", CreatedAt: time.Date(2024, 3, 1, 9, 0, 0, 123456000, time.UTC)},
+	{AccountID: "11111111-1111-1111-1111-111111111111", Type: "transfer_debit", Amount: -250, BalanceAfter: 450, IdempotencyKey: "xfer-1", CreatedAt: time.Date(2024, 3, 1, 9, 5, 0, 0, time.UTC)},
+}
+
+func write(t *testing.T, format string, es []repo.LedgerEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := export.NewWriter(&buf, format)
+	if err != nil {
+		t.Fatalf("NewWriter(%s) failed: %v", format, err)
+	}
+	for _, e := range es {
+		if err := w.Write(e); err != nil {
+			t.Fatalf("Write() failed: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestWriter_CSV(t *testing.T) {
+	rows, err := csv.NewReader(bytes.NewReader(write(t, export.FormatCSV, entries))).ReadAll()
+	if err != nil {
+		t.Fatalf("read csv: %v", err)
+	}
+	if len(rows) != 3 || rows[0][0] != "account_id" || rows[2][2] != "-250" || rows[1][5] != "2024-03-01T09:00:00.123456Z" {
+		t.Errorf("csv = %v", rows)
+	}
+	if empty := string(write(t, export.FormatCSV, nil)); empty != "account_id,type,amount,balance_after,idempotency_key,created_at\n" {
+		t.Errorf("empty csv = %q, want the header alone", empty)
+	}
+}
+
+func TestWriter_NDJSON(t *testing.T) {
+	sc := bufio.NewScanner(bytes.NewReader(write(t, export.FormatNDJSON, entries)))
+	var got []repo.LedgerEntry
+	for sc.Scan() {
+		var e repo.LedgerEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			t.Fatalf("line %q: %v", sc.Text(), err)
+		}
+		got = append(got, e)
+	}
+	if len(got) != 2 || got[1] != entries[1] || !got[0].CreatedAt.Equal(entries[0].CreatedAt) {
+		t.Errorf("ndjson = %+v, want %+v", got, entries)
+	}
+}
+
+func TestWriter_Parquet(t *testing.T) {
+	b := write(t, export.FormatParquet, entries)
+	got, err := parquet.Read[repo.LedgerEntry](bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatalf("read parquet: %v", err)
+	}
+	if len(got) != 2 || got[1].Amount != -250 || got[0].IdempotencyKey != "dep-1" || !got[0].CreatedAt.Equal(entries[0].CreatedAt) {
+		t.Errorf("parquet = %+v, want %+v", got, entries)
+	}
+}
+
+func TestNewWriter_UnknownFormat(t *testing.T) {
+	if _, err := export.NewWriter(&bytes.Buffer{}, "xlsx"); err == nil {
+		t.Error("NewWriter(xlsx) succeeded, want an error")
+	}
+}
@@ -0,0 +1,171 @@
+// Package health reports whether a service and the dependencies it needs are up.
+//
+// A Health holds named dependency checks. Live answers /healthz, which only says the process is
+// serving; Ready answers /readyz by running every check, concurrently and with a timeout, and
+// reporting each component's status and latency as JSON. Results are cached briefly so frequent
+// probes from several orchestrators do not hammer the dependencies.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Default check settings.
+const (
+	DefaultTimeout  = 2 * time.Second
+	DefaultCacheTTL = time.Second
+)
+
+// Component and overall statuses.
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+)
+
+// CheckFunc checks a dependency, returning nil if it is usable. It must honour ctx.
+type CheckFunc func(ctx context.Context) error
+
+// Component is the result of one check.
+type Component struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Report is the result of running every check. Status is StatusOK only if every component is.
+type Report struct {
+	Status     string               `json:"status"`
+	Components map[string]Component `json:"components"`
+	CheckedAt  time.Time            `json:"checked_at"`
+}
+
+// Health runs dependency checks. Timeout bounds each check (default DefaultTimeout) and results
+// are reused for CacheTTL (default DefaultCacheTTL). The zero value has no checks and is always
+// ready.
+type Health struct {
+	Timeout  time.Duration
+	CacheTTL time.Duration
+
+	mu     sync.Mutex
+	names  []string
+	checks map[string]CheckFunc
+	last   *Report
+}
+
+// New returns a Health with the default settings.
+func New() *Health { return &Health{} }
+
+// Add registers a check under name, replacing any check with the same name.
+func (h *Health) Add(name string, check CheckFunc) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.checks == nil {
+		h.checks = map[string]CheckFunc{}
+	}
+	if _, ok := h.checks[name]; !ok {
+		h.names = append(h.names, name)
+		sort.Strings(h.names)
+	}
+	h.checks[name] = check
+	h.last = nil
+}
+
+// Check runs every check, or returns the cached report if it is recent enough. Concurrent
+// callers wait for a single run.
+func (h *Health) Check(ctx context.Context) Report {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ttl := h.CacheTTL
+	if ttl <= 0 {
+		ttl = DefaultCacheTTL
+	}
+	if h.last != nil && time.Since(h.last.CheckedAt) < ttl {
+		return *h.last
+	}
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	// The report is shared with later callers, so one caller going away must not fail it.
+	ctx = context.WithoutCancel(ctx)
+
+	results := make([]Component, len(h.names))
+	var wg sync.WaitGroup
+	for i, name := range h.names {
+		wg.Add(1)
+		go func(i int, check CheckFunc) {
+			defer wg.Done()
+			results[i] = run(ctx, check, timeout)
+		}(i, h.checks[name])
+	}
+	wg.Wait()
+
+	rep := Report{Status: StatusOK, Components: make(map[string]Component, len(h.names)), CheckedAt: time.Now()}
+	for i, name := range h.names {
+		rep.Components[name] = results[i]
+		if results[i].Status != StatusOK {
+			rep.Status = StatusUnavailable
+		}
+	}
+	h.last = &rep
+	return rep
+}
+
+// run runs one check with a timeout. A check that ignores its context is abandoned when the
+// timeout expires and reported as unavailable.
+func run(ctx context.Context, check CheckFunc, timeout time.Duration) Component {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				done <- fmt.Errorf("check panicked: %v", p)
+			}
+		}()
+		done <- check(ctx)
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	c := Component{Status: StatusOK, LatencyMS: float64(time.Since(start).Microseconds()) / 1000}
+	if err != nil {
+		c.Status = StatusUnavailable
+		c.Error = err.Error()
+		if errors.Is(err, context.DeadlineExceeded) {
+			c.Error = fmt.Sprintf("timed out after %s", timeout)
+		}
+	}
+	return c
+}
+
+// Live answers liveness probes: the process is up and serving HTTP.
+func (h *Health) Live(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok"))
+}
+
+// Ready answers readiness probes with the JSON Report, with status 200 when every dependency is
+// available and 503 otherwise.
+func (h *Health) Ready(w http.ResponseWriter, r *http.Request) {
+	rep := h.Check(r.Context())
+	status := http.StatusOK
+	if rep.Status != StatusOK {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(rep)
+}
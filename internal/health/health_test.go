@@ -0,0 +1,84 @@
+package health_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Bharat0908/ledger/internal/health"
+)
+
+func TestHealth_Ready(t *testing.T) {
+	ok := func(ctx context.Context) error { return nil }
+	down := func(ctx context.Context) error { return errors.New("connection refused") }
+	hang := func(ctx context.Context) error { <-ctx.Done(); return ctx.Err() }
+	stuck := func(ctx context.Context) error { time.Sleep(time.Second); return nil }
+
+	tests := []struct {
+		name       string
+		checks     map[string]health.CheckFunc
+		wantStatus int
+		wantDown   map[string]string
+	}{
+		{"no checks", nil, http.StatusOK, nil},
+		{"all up", map[string]health.CheckFunc{"postgres": ok, "rabbitmq": ok}, http.StatusOK, nil},
+		{"one down", map[string]health.CheckFunc{"postgres": ok, "mongo": down}, http.StatusServiceUnavailable, map[string]string{"mongo": "connection refused"}},
+		{"timeout", map[string]health.CheckFunc{"postgres": hang}, http.StatusServiceUnavailable, map[string]string{"postgres": "timed out after 50ms"}},
+		{"check ignoring its context", map[string]health.CheckFunc{"rabbitmq": stuck}, http.StatusServiceUnavailable, map[string]string{"rabbitmq": "timed out after 50ms"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &health.Health{Timeout: 50 * time.Millisecond}
+			for name, c := range tt.checks {
+				h.Add(name, c)
+			}
+			rec := httptest.NewRecorder()
+			h.Ready(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %s)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			var rep health.Report
+			if err := json.NewDecoder(rec.Body).Decode(&rep); err != nil {
+				t.Fatalf("decode report: %v", err)
+			}
+			if len(rep.Components) != len(tt.checks) {
+				t.Errorf("components = %v, want one per check", rep.Components)
+			}
+			for name, c := range rep.Components {
+				if want, isDown := tt.wantDown[name]; isDown {
+					if c.Status != health.StatusUnavailable || c.Error != want {
+						t.Errorf("%s = %+v, want unavailable with error %q", name, c, want)
+					}
+				} else if c.Status != health.StatusOK {
+					t.Errorf("%s = %+v, want ok", name, c)
+				}
+			}
+		})
+	}
+}
+
+func TestHealth_CachesResults(t *testing.T) {
+	var calls atomic.Int32
+	h := &health.Health{CacheTTL: time.Hour}
+	h.Add("postgres", func(ctx context.Context) error { calls.Add(1); return nil })
+	for i := 0; i < 3; i++ {
+		h.Check(context.Background())
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("check ran %d times within the cache TTL, want 1", n)
+	}
+
+	// A canceled caller must not poison the shared result.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	h = &health.Health{}
+	h.Add("postgres", func(ctx context.Context) error { return ctx.Err() })
+	if rep := h.Check(ctx); rep.Status != health.StatusOK {
+		t.Errorf("Check(canceled ctx) = %+v, want ok", rep)
+	}
+}
@@ -0,0 +1,188 @@
+// Package auth authenticates API callers and carries their identity and permissions through the
+// request context.
+//
+// A Middleware built from an Authenticator resolves the caller to a Principal or answers 401.
+// Handlers then check scopes with Require and account restrictions with Principal.CanAccess.
+// When no Middleware is installed there is no Principal in the context and every check passes,
+// which keeps authentication optional for tests and trusted deployments.
+package auth
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/Bharat0908/ledger/internal/http/problem"
+)
+
+// Scopes understood by the API. ScopeAdmin implies every other scope.
+const (
+	ScopeAccountsRead      = "accounts:read"
+	ScopeAccountsWrite     = "accounts:write"
+	ScopeTransactionsWrite = "transactions:write"
+	ScopeWebhooksManage    = "webhooks:manage"
+	ScopeAdmin             = "admin"
+)
+
+// Scopes lists every valid scope.
+var Scopes = []string{ScopeAccountsRead, ScopeAccountsWrite, ScopeTransactionsWrite, ScopeWebhooksManage, ScopeAdmin}
+
+// ValidScope reports whether s is one of Scopes.
+func ValidScope(s string) bool {
+	for _, v := range Scopes {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Errors returned by authenticators. ErrNoCredentials means the request carries no credentials
+// the authenticator understands; ErrInvalidCredentials means it does but they were rejected.
+var (
+	ErrNoCredentials      = errors.New("auth: no credentials")
+	ErrInvalidCredentials = errors.New("auth: invalid credentials")
+)
+
+// Principal is an authenticated caller. Subject identifies it in logs (an API key ID for
+// API keys). An empty Accounts list means the caller is not restricted to particular accounts.
+// A non-empty Tenant restricts the caller to accounts whose owner is Tenant.
+type Principal struct {
+	Subject  string
+	Scopes   []string
+	Accounts []uuid.UUID
+	Tenant   string
+}
+
+// HasScope reports whether the principal was granted scope, directly or through ScopeAdmin.
+func (p *Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// Restricted reports whether the principal may only act on the accounts in Accounts.
+func (p *Principal) Restricted() bool { return len(p.Accounts) > 0 }
+
+// CanAccess reports whether the principal may act on the account.
+func (p *Principal) CanAccess(id uuid.UUID) bool {
+	if !p.Restricted() {
+		return true
+	}
+	for _, a := range p.Accounts {
+		if a == id {
+			return true
+		}
+	}
+	return false
+}
+
+type principalKey struct{}
+
+// NewContext returns a copy of ctx carrying p.
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the principal stored in ctx, or nil when the request was not
+// authenticated because no Middleware is installed.
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
+
+// Authenticator resolves the caller of a request.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// Chain tries each authenticator in turn and returns the first principal found. A request is
+// only reported as having no credentials if every authenticator said so.
+type Chain []Authenticator
+
+// Authenticate implements Authenticator.
+func (c Chain) Authenticate(r *http.Request) (*Principal, error) {
+	err := ErrNoCredentials
+	for _, a := range c {
+		p, aerr := a.Authenticate(r)
+		switch {
+		case aerr == nil:
+			return p, nil
+		case errors.Is(aerr, ErrNoCredentials):
+		case errors.Is(aerr, ErrInvalidCredentials):
+			err = aerr
+		default:
+			return nil, aerr
+		}
+	}
+	return nil, err
+}
+
+// Middleware authenticates every request with a, storing the Principal in the request context.
+// Requests without valid credentials are rejected with a 401 problem; other authenticator
+// errors are reported as 500 without details.
+func Middleware(a Authenticator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, err := a.Authenticate(r)
+			switch {
+			case err == nil:
+				next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), p)))
+			case errors.Is(err, ErrNoCredentials):
+				Unauthorized(w, r, "missing credentials")
+			case errors.Is(err, ErrInvalidCredentials):
+				slog.WarnContext(r.Context(), "authentication failed", "error", err)
+				Unauthorized(w, r, "invalid credentials")
+			default:
+				slog.ErrorContext(r.Context(), "authenticate", "error", err)
+				problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "internal server error")
+			}
+		})
+	}
+}
+
+// Require rejects requests whose principal lacks scope with a 403 problem. Requests without a
+// principal (authentication disabled) pass.
+func Require(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if p := FromContext(r.Context()); p != nil && !p.HasScope(scope) {
+				Forbidden(w, r, "missing scope "+scope)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Unauthorized writes a 401 problem with a Bearer challenge.
+func Unauthorized(w http.ResponseWriter, r *http.Request, detail string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="ledger"`)
+	problem.Error(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, detail)
+}
+
+// Forbidden writes a 403 problem and logs the refusal with the caller's subject.
+func Forbidden(w http.ResponseWriter, r *http.Request, detail string) {
+	var subject string
+	if p := FromContext(r.Context()); p != nil {
+		subject = p.Subject
+	}
+	slog.WarnContext(r.Context(), "access denied", "subject", subject, "reason", detail)
+	problem.Error(w, r, http.StatusForbidden, problem.CodeForbidden, detail)
+}
+
+// bearerToken returns the token of an "Authorization: Bearer <token>" header.
+func bearerToken(r *http.Request) (string, bool) {
+	h := r.Header.Get("Authorization")
+	if len(h) > 7 && strings.EqualFold(h[:7], "bearer ") {
+		return strings.TrimSpace(h[7:]), true
+	}
+	return "", false
+}
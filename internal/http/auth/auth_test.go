@@ -0,0 +1,106 @@
+package auth_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/Bharat0908/ledger/internal/http/auth"
+	"github.com/Bharat0908/ledger/internal/repo"
+)
+
+// fakeKeys is an in-memory KeyIssuer keyed by hash.
+type fakeKeys map[string]repo.APIKey
+
+func (f fakeKeys) APIKeyByHash(ctx context.Context, hash []byte) (repo.APIKey, error) {
+	k, ok := f[string(hash)]
+	if !ok {
+		return repo.APIKey{}, repo.ErrAPIKeyNotFound
+	}
+	return k, nil
+}
+
+func (f fakeKeys) CreateAPIKey(ctx context.Context, in repo.NewAPIKey) (repo.APIKey, error) {
+	k := repo.APIKey{ID: uuid.New(), Name: in.Name, Prefix: in.Prefix, Hash: in.Hash, Scopes: in.Scopes, AccountIDs: in.AccountIDs}
+	f[string(in.Hash)] = k
+	return k, nil
+}
+
+func TestAPIKeys_Middleware(t *testing.T) {
+	keys := fakeKeys{}
+	acc := uuid.New()
+	readKey, _, err := auth.GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey() failed: %v", err)
+	}
+	keys.CreateAPIKey(context.Background(), repo.NewAPIKey{Name: "reader", Hash: auth.HashKey(readKey), Scopes: []string{auth.ScopeAccountsRead}, AccountIDs: []uuid.UUID{acc}})
+	revokedKey, _, _ := auth.GenerateKey()
+	revoked, _ := keys.CreateAPIKey(context.Background(), repo.NewAPIKey{Name: "old", Hash: auth.HashKey(revokedKey), Scopes: []string{auth.ScopeAdmin}})
+	now := time.Now()
+	revoked.RevokedAt = &now
+	keys[string(revoked.Hash)] = revoked
+	if err := auth.Bootstrap(context.Background(), keys, "bootstrap-secret"); err != nil {
+		t.Fatalf("Bootstrap() failed: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		header     string
+		value      string
+		scope      string
+		wantStatus int
+	}{
+		{"no credentials", "", "", auth.ScopeAccountsRead, http.StatusUnauthorized},
+		{"unknown key", "X-API-Key", "lk_nope", auth.ScopeAccountsRead, http.StatusUnauthorized},
+		{"revoked key", "X-API-Key", revokedKey, auth.ScopeAccountsRead, http.StatusUnauthorized},
+		{"bearer key with scope", "Authorization", "Bearer " + readKey, auth.ScopeAccountsRead, http.StatusOK},
+		{"header key with scope", "X-API-Key", readKey, auth.ScopeAccountsRead, http.StatusOK},
+		{"missing scope", "X-API-Key", readKey, auth.ScopeTransactionsWrite, http.StatusForbidden},
+		{"bootstrap admin has every scope", "X-API-Key", "bootstrap-secret", auth.ScopeTransactionsWrite, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *auth.Principal
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { got = auth.FromContext(r.Context()) })
+			h := auth.Middleware(&auth.APIKeys{Store: keys})(auth.Require(tt.scope)(next))
+			req := httptest.NewRequest(http.MethodGet, "/v1/accounts", nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %s)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantStatus == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401 without WWW-Authenticate challenge")
+			}
+			if tt.wantStatus == http.StatusOK && got == nil {
+				t.Error("handler saw no principal")
+			}
+		})
+	}
+}
+
+func TestPrincipal_CanAccess(t *testing.T) {
+	acc := uuid.New()
+	tests := []struct {
+		name string
+		p    auth.Principal
+		id   uuid.UUID
+		want bool
+	}{
+		{"unrestricted", auth.Principal{}, uuid.New(), true},
+		{"listed account", auth.Principal{Accounts: []uuid.UUID{acc}}, acc, true},
+		{"other account", auth.Principal{Accounts: []uuid.UUID{acc}}, uuid.New(), false},
+	}
+	for _, tt := range tests {
+		if got := tt.p.CanAccess(tt.id); got != tt.want {
+			t.Errorf("%s: CanAccess() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default JWKS cache settings.
+const (
+	DefaultJWKSRefresh    = 5 * time.Minute
+	DefaultJWKSMinRefresh = 30 * time.Second
+)
+
+// JWKS is a JSON Web Key Set loaded from a local file or an http(s) URL. Keys are cached for
+// Refresh and reloaded on the next lookup after that, so rotated keys are picked up without a
+// restart; a token signed with an unknown key ID also triggers a reload, at most once per
+// MinRefresh. If a reload fails the previously loaded keys stay in use.
+//
+// Only RSA keys and EC keys on P-256 are loaded; other keys in the set are ignored.
+type JWKS struct {
+	Source     string
+	Refresh    time.Duration
+	MinRefresh time.Duration
+	Client     *http.Client
+
+	mu       sync.Mutex
+	keys     map[string]crypto.PublicKey
+	loadedAt time.Time
+	tried    time.Time
+	loading  chan struct{} // closed when the reload in progress, if any, ends
+}
+
+// jwk is the subset of RFC 7517 key members used for RSA and EC public keys.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// errUnknownKey is returned by key when the set has no key with the requested ID.
+var errUnknownKey = errors.New("auth: unknown signing key")
+
+// key returns the public key with the given ID. An empty kid matches the only key of a
+// single-key set.
+func (j *JWKS) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	refresh, minRefresh := j.Refresh, j.MinRefresh
+	if refresh <= 0 {
+		refresh = DefaultJWKSRefresh
+	}
+	if minRefresh <= 0 {
+		minRefresh = DefaultJWKSMinRefresh
+	}
+	now := time.Now()
+	// Reloads are rate limited by MinRefresh, so a failing source is not hit on every request;
+	// a reload already in progress is waited for instead.
+	canReload := func() bool { return j.loading != nil || now.Sub(j.tried) > minRefresh }
+	if (j.keys == nil || now.Sub(j.loadedAt) > refresh) && canReload() {
+		j.reload(ctx, now)
+	}
+	if k, ok := j.lookup(kid); ok {
+		return k, nil
+	}
+	if canReload() {
+		j.reload(ctx, now)
+		if k, ok := j.lookup(kid); ok {
+			return k, nil
+		}
+	}
+	if j.keys == nil {
+		return nil, fmt.Errorf("auth: no JWKS loaded from %s", j.Source)
+	}
+	return nil, errUnknownKey
+}
+
+func (j *JWKS) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(j.keys) == 1 {
+		for _, k := range j.keys {
+			return k, true
+		}
+	}
+	k, ok := j.keys[kid]
+	return k, ok
+}
+
+// reload fetches the set, keeping the current keys if that fails. j.mu must be held; it is
+// released during the fetch, so lookups of loaded keys are not held up by a slow source, and
+// callers reloading meanwhile wait for that fetch rather than starting another.
+func (j *JWKS) reload(ctx context.Context, now time.Time) {
+	if done := j.loading; done != nil {
+		j.mu.Unlock()
+		select {
+		case <-done:
+		case <-ctx.Done():
+		}
+		j.mu.Lock()
+		return
+	}
+	j.tried = now
+	done := make(chan struct{})
+	j.loading = done
+	j.mu.Unlock()
+	keys, err := j.fetch(ctx)
+	j.mu.Lock()
+	j.loading = nil
+	close(done)
+	if err != nil {
+		slog.WarnContext(ctx, "reload JWKS, keeping current keys", "source", j.Source, "error", err)
+		return
+	}
+	j.keys, j.loadedAt = keys, now
+}
+
+// Load fetches the key set now. It is meant for startup, to fail fast on a bad source.
+func (j *JWKS) Load(ctx context.Context) error {
+	keys, err := j.fetch(ctx)
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	j.keys, j.loadedAt, j.tried = keys, time.Now(), time.Now()
+	j.mu.Unlock()
+	return nil
+}
+
+func (j *JWKS) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	var (
+		data []byte
+		err  error
+	)
+	if strings.HasPrefix(j.Source, "http://") || strings.HasPrefix(j.Source, "https://") {
+		data, err = j.download(ctx)
+	} else {
+		data, err = os.ReadFile(j.Source)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseJWKS(data)
+}
+
+func (j *JWKS) download(ctx context.Context) ([]byte, error) {
+	client := j.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.Source, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", j.Source, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+// parseJWKS decodes a key set, skipping keys that are not RSA or P-256 EC signing keys.
+func parseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("parse jwks: %w", err)
+	}
+	keys := map[string]crypto.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("jwks key %q: %w", k.Kid, err)
+		}
+		if pub != nil {
+			keys[k.Kid] = pub
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("jwks contains no usable RSA or P-256 keys")
+	}
+	return keys, nil
+}
+
+// publicKey converts the JWK to a public key, or returns nil for unsupported key types.
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch {
+	case k.Kty == "RSA":
+		n, err := b64Int(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := b64Int(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() < 3 || n.BitLen() < 2048 {
+			return nil, errors.New("RSA key must be at least 2048 bits with a valid exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case k.Kty == "EC" && k.Crv == "P-256":
+		x, errX := base64.RawURLEncoding.DecodeString(k.X)
+		y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+		if errX != nil || errY != nil || len(x) != 32 || len(y) != 32 {
+			return nil, errors.New("EC coordinates must be 32-byte base64url values")
+		}
+		// crypto/ecdh rejects points that are not on the curve.
+		if _, err := ecdh.P256().NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	}
+	return nil, nil
+}
+
+func b64Int(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("invalid base64url integer")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
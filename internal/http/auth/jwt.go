@@ -0,0 +1,215 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Default claim names read by JWT.
+const (
+	DefaultTenantClaim = "tenant"
+	DefaultScopeClaim  = "scope"
+)
+
+// JWT authenticates requests carrying an RS256 or ES256 signed JSON Web Token as
+// "Authorization: Bearer <token>", verified against the keys in JWKS.
+//
+// Tokens must not be expired and, when Issuer or Audience is set, must carry a matching iss and
+// aud. Scopes are read from ScopeClaim, either a space-separated string or an array; scopes this
+// API does not know are ignored. The tenant is read from TenantClaim and limits the caller to
+// accounts whose owner is that tenant; tokens without a tenant are rejected unless they carry
+// the admin scope.
+type JWT struct {
+	Keys        *JWKS
+	Issuer      string
+	Audience    string
+	TenantClaim string
+	ScopeClaim  string
+	Leeway      time.Duration
+	Now         func() time.Time
+}
+
+// Authenticate implements Authenticator. Bearer tokens that are not JWTs are treated as absent
+// so JWT can be chained with APIKeys.
+func (a *JWT) Authenticate(r *http.Request) (*Principal, error) {
+	token, ok := bearerToken(r)
+	if !ok || strings.Count(token, ".") != 2 {
+		return nil, ErrNoCredentials
+	}
+	claims, err := a.verify(r.Context(), token)
+	if err != nil {
+		if errors.Is(err, ErrInvalidCredentials) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+	return a.principal(claims)
+}
+
+// verify checks the token signature and registered claims and returns the claims.
+func (a *JWT) verify(ctx context.Context, token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("header: %w", err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("signature is not base64url")
+	}
+	key, err := a.Keys.key(ctx, header.Kid)
+	if errors.Is(err, errUnknownKey) {
+		return nil, err
+	}
+	if err != nil {
+		// The key set could not be loaded at all; that is our failure, not the caller's.
+		return nil, fmt.Errorf("jwks: %v", err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	switch header.Alg {
+	case "RS256":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok || rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig) != nil {
+			return nil, errors.New("bad signature")
+		}
+	case "ES256":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(sig) != 64 {
+			return nil, errors.New("bad signature")
+		}
+		r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(pub, digest[:], r, s) {
+			return nil, errors.New("bad signature")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported alg %q", header.Alg)
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("claims: %w", err)
+	}
+	if err := a.checkRegistered(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// checkRegistered validates exp, nbf, iss and aud.
+func (a *JWT) checkRegistered(claims map[string]interface{}) error {
+	now := time.Now()
+	if a.Now != nil {
+		now = a.Now()
+	}
+	exp, ok := numericDate(claims["exp"])
+	if !ok {
+		return errors.New("missing exp")
+	}
+	if !now.Before(exp.Add(a.Leeway)) {
+		return errors.New("token expired")
+	}
+	if nbf, ok := numericDate(claims["nbf"]); ok && now.Add(a.Leeway).Before(nbf) {
+		return errors.New("token not yet valid")
+	}
+	if a.Issuer != "" && claims["iss"] != a.Issuer {
+		return errors.New("unexpected issuer")
+	}
+	if a.Audience != "" && !contains(stringList(claims["aud"], false), a.Audience) {
+		return errors.New("unexpected audience")
+	}
+	return nil
+}
+
+// principal maps verified claims to a Principal.
+func (a *JWT) principal(claims map[string]interface{}) (*Principal, error) {
+	scopeClaim, tenantClaim := a.ScopeClaim, a.TenantClaim
+	if scopeClaim == "" {
+		scopeClaim = DefaultScopeClaim
+	}
+	if tenantClaim == "" {
+		tenantClaim = DefaultTenantClaim
+	}
+	p := &Principal{}
+	if sub, ok := claims["sub"].(string); ok {
+		p.Subject = "jwt:" + sub
+	}
+	for _, s := range stringList(claims[scopeClaim], true) {
+		if ValidScope(s) {
+			p.Scopes = append(p.Scopes, s)
+		}
+	}
+	p.Tenant, _ = claims[tenantClaim].(string)
+	if p.Tenant == "" && !contains(p.Scopes, ScopeAdmin) {
+		return nil, fmt.Errorf("%w: token has no %s claim", ErrInvalidCredentials, tenantClaim)
+	}
+	return p, nil
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// numericDate reads a JWT NumericDate (seconds since the epoch).
+func numericDate(v interface{}) (time.Time, bool) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	sec := int64(f)
+	return time.Unix(sec, int64((f-float64(sec))*1e9)), true
+}
+
+// stringList reads a claim that is a string or an array of strings. With split set, a string is
+// split on spaces (the OAuth scope format).
+func stringList(v interface{}, split bool) []string {
+	switch v := v.(type) {
+	case string:
+		if split {
+			return strings.Fields(v)
+		}
+		return []string{v}
+	case []interface{}:
+		var out []string
+		for _, e := range v {
+			if s, ok := e.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
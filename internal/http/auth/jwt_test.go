@@ -0,0 +1,296 @@
+package auth_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Bharat0908/ledger/internal/http/auth"
+	"github.com/Bharat0908/ledger/internal/repo"
+)
+
+func b64(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+// signToken builds a compact JWT signed with key (an *rsa.PrivateKey or *ecdsa.PrivateKey).
+func signToken(t *testing.T, alg, kid string, key crypto.Signer, claims map[string]interface{}) string {
+	t.Helper()
+	h, _ := json.Marshal(map[string]string{"alg": alg, "typ": "JWT", "kid": kid})
+	c, _ := json.Marshal(claims)
+	input := b64(h) + "." + b64(c)
+	digest := sha256.Sum256([]byte(input))
+	var sig []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		s, err := rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+		sig = s
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	return input + "." + b64(sig)
+}
+
+// jwksJSON renders the public halves of keys as a JWKS document.
+func jwksJSON(keys map[string]crypto.Signer) []byte {
+	var set struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	for kid, k := range keys {
+		switch pub := k.Public().(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, map[string]string{"kty": "RSA", "kid": kid, "use": "sig",
+				"n": b64(pub.N.Bytes()), "e": b64(big.NewInt(int64(pub.E)).Bytes())})
+		case *ecdsa.PublicKey:
+			set.Keys = append(set.Keys, map[string]string{"kty": "EC", "kid": kid, "crv": "P-256",
+				"x": b64(pub.X.FillBytes(make([]byte, 32))), "y": b64(pub.Y.FillBytes(make([]byte, 32)))})
+		}
+	}
+	b, _ := json.Marshal(set)
+	return b
+}
+
+func TestJWT_Authenticate(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa key: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ec key: %v", err)
+	}
+	strangerKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, jwksJSON(map[string]crypto.Signer{"rsa": rsaKey, "ec": ecKey}), 0o600); err != nil {
+		t.Fatalf("write jwks: %v", err)
+	}
+	a := &auth.JWT{Keys: &auth.JWKS{Source: path}, Issuer: "https://idp.example", Audience: "ledger"}
+
+	claims := func(mod func(map[string]interface{})) map[string]interface{} {
+		c := map[string]interface{}{
+			"iss": "https://idp.example", "aud": []string{"ledger", "other"}, "sub": "alice",
+			"exp": time.Now().Add(time.Hour).Unix(), "tenant": "acme", "scope": "accounts:read unknown:scope",
+		}
+		if mod != nil {
+			mod(c)
+		}
+		return c
+	}
+	none := b64([]byte(`{"alg":"none","kid":"rsa"}`)) + "." + b64([]byte(`{"tenant":"acme","exp":9999999999}`)) + "."
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+		tenant  string
+	}{
+		{"RS256", signToken(t, "RS256", "rsa", rsaKey, claims(nil)), nil, "acme"},
+		{"ES256", signToken(t, "ES256", "ec", ecKey, claims(nil)), nil, "acme"},
+		{"admin without tenant", signToken(t, "RS256", "rsa", rsaKey, claims(func(c map[string]interface{}) {
+			delete(c, "tenant")
+			c["scope"] = []string{"admin"}
+		})), nil, ""},
+		{"not a JWT", "lk_somekey", auth.ErrNoCredentials, ""},
+		{"expired", signToken(t, "RS256", "rsa", rsaKey, claims(func(c map[string]interface{}) { c["exp"] = time.Now().Add(-time.Minute).Unix() })), auth.ErrInvalidCredentials, ""},
+		{"missing exp", signToken(t, "RS256", "rsa", rsaKey, claims(func(c map[string]interface{}) { delete(c, "exp") })), auth.ErrInvalidCredentials, ""},
+		{"not yet valid", signToken(t, "RS256", "rsa", rsaKey, claims(func(c map[string]interface{}) { c["nbf"] = time.Now().Add(time.Hour).Unix() })), auth.ErrInvalidCredentials, ""},
+		{"wrong audience", signToken(t, "RS256", "rsa", rsaKey, claims(func(c map[string]interface{}) { c["aud"] = "billing" })), auth.ErrInvalidCredentials, ""},
+		{"wrong issuer", signToken(t, "RS256", "rsa", rsaKey, claims(func(c map[string]interface{}) { c["iss"] = "https://evil.example" })), auth.ErrInvalidCredentials, ""},
+		{"no tenant", signToken(t, "RS256", "rsa", rsaKey, claims(func(c map[string]interface{}) { delete(c, "tenant") })), auth.ErrInvalidCredentials, ""},
+		{"unknown key", signToken(t, "ES256", "stranger", strangerKey, claims(nil)), auth.ErrInvalidCredentials, ""},
+		{"forged signature", signToken(t, "ES256", "ec", strangerKey, claims(nil)), auth.ErrInvalidCredentials, ""},
+		{"alg/key mismatch", signToken(t, "ES256", "rsa", ecKey, claims(nil)), auth.ErrInvalidCredentials, ""},
+		{"alg none", none, auth.ErrInvalidCredentials, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/v1/accounts", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			p, err := a.Authenticate(req)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("Authenticate() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if p.Tenant != tt.tenant || p.Subject != "jwt:alice" {
+				t.Errorf("principal = %+v, want tenant %q and subject jwt:alice", p, tt.tenant)
+			}
+			for _, s := range p.Scopes {
+				if !auth.ValidScope(s) {
+					t.Errorf("principal has unknown scope %q", s)
+				}
+			}
+		})
+	}
+}
+
+func TestJWKS_Rotation(t *testing.T) {
+	oldKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	newKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	var (
+		doc     atomic.Value
+		fetches atomic.Int32
+	)
+	doc.Store(jwksJSON(map[string]crypto.Signer{"k1": oldKey}))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		w.Write(doc.Load().([]byte))
+	}))
+	defer srv.Close()
+
+	keys := &auth.JWKS{Source: srv.URL, MinRefresh: time.Nanosecond}
+	if err := keys.Load(context.Background()); err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	a := &auth.JWT{Keys: keys}
+	check := func(kid string, key crypto.Signer) error {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+signToken(t, "ES256", kid, key, map[string]interface{}{"exp": time.Now().Add(time.Minute).Unix(), "tenant": "acme"}))
+		_, err := a.Authenticate(req)
+		return err
+	}
+	if err := check("k1", oldKey); err != nil {
+		t.Fatalf("token signed with current key: %v", err)
+	}
+
+	// The issuer rotates to k2; the first token signed with it triggers a reload.
+	doc.Store(jwksJSON(map[string]crypto.Signer{"k2": newKey}))
+	time.Sleep(time.Millisecond)
+	if err := check("k2", newKey); err != nil {
+		t.Fatalf("token signed with rotated key: %v", err)
+	}
+	if err := check("k1", oldKey); !errors.Is(err, auth.ErrInvalidCredentials) {
+		t.Errorf("token signed with retired key: error = %v, want %v", err, auth.ErrInvalidCredentials)
+	}
+
+	// With the default minimum refresh interval, unknown key IDs do not hammer the source.
+	keys.MinRefresh = 0
+	before := fetches.Load()
+	for i := 0; i < 5; i++ {
+		check("k3", newKey)
+	}
+	if got := fetches.Load() - before; got > 1 {
+		t.Errorf("%d fetches for repeated unknown kid, want at most 1", got)
+	}
+}
+
+func TestJWKS_SlowReload(t *testing.T) {
+	oldKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	newKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	var (
+		doc     atomic.Value
+		fetches atomic.Int32
+	)
+	doc.Store(jwksJSON(map[string]crypto.Signer{"k1": oldKey}))
+	fetching, release := make(chan struct{}, 1), make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fetches.Add(1) > 1 {
+			fetching <- struct{}{}
+			<-release
+		}
+		w.Write(doc.Load().([]byte))
+	}))
+	defer srv.Close()
+
+	keys := &auth.JWKS{Source: srv.URL, MinRefresh: time.Nanosecond}
+	if err := keys.Load(context.Background()); err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	a := &auth.JWT{Keys: keys}
+	check := func(kid string, key crypto.Signer) <-chan error {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+signToken(t, "ES256", kid, key, map[string]interface{}{"exp": time.Now().Add(time.Minute).Unix(), "tenant": "acme"}))
+		errc := make(chan error, 1)
+		go func() {
+			_, err := a.Authenticate(req)
+			errc <- err
+		}()
+		return errc
+	}
+
+	// A token signed with a rotated key reloads the set from a source that is slow to answer.
+	doc.Store(jwksJSON(map[string]crypto.Signer{"k1": oldKey, "k2": newKey}))
+	time.Sleep(time.Millisecond)
+	first := check("k2", newKey)
+	<-fetching
+
+	// Meanwhile tokens signed with loaded keys are verified, and other tokens signed with the
+	// rotated key wait for the reload in progress.
+	select {
+	case err := <-check("k1", oldKey):
+		if err != nil {
+			t.Errorf("token signed with loaded key during reload: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		close(release)
+		t.Fatal("token signed with loaded key waited for the reload")
+	}
+	second := check("k2", newKey)
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	for _, errc := range []<-chan error{first, second} {
+		if err := <-errc; err != nil {
+			t.Errorf("token signed with rotated key: %v", err)
+		}
+	}
+	if got := fetches.Load(); got != 2 {
+		t.Errorf("%d fetches, want the initial load and one reload", got)
+	}
+}
+
+func TestChain(t *testing.T) {
+	keys := fakeKeys{}
+	apiKey, _, _ := auth.GenerateKey()
+	keys.CreateAPIKey(context.Background(), repo.NewAPIKey{Name: "svc", Hash: auth.HashKey(apiKey), Scopes: []string{auth.ScopeAdmin}})
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	os.WriteFile(path, jwksJSON(map[string]crypto.Signer{"ec": ecKey}), 0o600)
+	chain := auth.Chain{&auth.APIKeys{Store: keys}, &auth.JWT{Keys: &auth.JWKS{Source: path}}}
+	valid := signToken(t, "ES256", "ec", ecKey, map[string]interface{}{"exp": time.Now().Add(time.Minute).Unix(), "tenant": "acme"})
+	expired := signToken(t, "ES256", "ec", ecKey, map[string]interface{}{"exp": time.Now().Add(-time.Minute).Unix(), "tenant": "acme"})
+
+	tests := []struct {
+		name    string
+		bearer  string
+		wantErr error
+	}{
+		{"api key", apiKey, nil},
+		{"jwt", valid, nil},
+		{"expired jwt", expired, auth.ErrInvalidCredentials},
+		{"unknown api key", "lk_nope", auth.ErrInvalidCredentials},
+		{"no credentials", "", auth.ErrNoCredentials},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.bearer != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.bearer)
+			}
+			_, err := chain.Authenticate(req)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Errorf("Authenticate() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
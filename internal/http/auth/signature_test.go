@@ -0,0 +1,110 @@
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Bharat0908/ledger/internal/http/auth"
+	"github.com/Bharat0908/ledger/internal/repo"
+)
+
+func TestAPIKeys_SignedRequests(t *testing.T) {
+	keys := fakeKeys{}
+	apiKey, _, _ := auth.GenerateKey()
+	secret, err := auth.GenerateSigningSecret()
+	if err != nil {
+		t.Fatalf("GenerateSigningSecret() failed: %v", err)
+	}
+	keys.CreateAPIKey(context.Background(), repo.NewAPIKey{Name: "partner", Hash: auth.HashKey(apiKey), Scopes: []string{auth.ScopeAdmin}})
+	k := keys[string(auth.HashKey(apiKey))]
+	k.SigningSecret, k.SignedRequests = []byte(secret), true
+	keys[string(k.Hash)] = k
+
+	now := time.Unix(1_700_000_000, 0)
+	a := &auth.APIKeys{Store: keys, Now: func() time.Time { return now }}
+	const body = `{"from_account_id":"a","to_account_id":"b","amount":100}`
+	newReq := func(signedAt time.Time, secret string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/v1/transfers?dry_run=false", strings.NewReader(body))
+		req.Header.Set("X-API-Key", apiKey)
+		if secret != "" {
+			if err := auth.SignRequest(req, []byte(secret), signedAt); err != nil {
+				t.Fatalf("SignRequest() failed: %v", err)
+			}
+		}
+		return req
+	}
+
+	tests := []struct {
+		name    string
+		req     func() *http.Request
+		wantErr error
+	}{
+		{"signed", func() *http.Request { return newReq(now, secret) }, nil},
+		{"within skew", func() *http.Request { return newReq(now.Add(-4*time.Minute), secret) }, nil},
+		{"unsigned", func() *http.Request { return newReq(now, "") }, auth.ErrInvalidCredentials},
+		{"wrong secret", func() *http.Request { return newReq(now, "lks_other") }, auth.ErrInvalidCredentials},
+		{"stale timestamp", func() *http.Request { return newReq(now.Add(-6*time.Minute), secret) }, auth.ErrInvalidCredentials},
+		{"future timestamp", func() *http.Request { return newReq(now.Add(6*time.Minute), secret) }, auth.ErrInvalidCredentials},
+		{"tampered body", func() *http.Request {
+			req := newReq(now, secret)
+			req.Body = io.NopCloser(strings.NewReader(strings.Replace(body, "100", "900", 1)))
+			return req
+		}, auth.ErrInvalidCredentials},
+		{"tampered query", func() *http.Request {
+			req := newReq(now, secret)
+			req.URL.RawQuery = "dry_run=true"
+			return req
+		}, auth.ErrInvalidCredentials},
+		{"tampered method", func() *http.Request {
+			req := newReq(now, secret)
+			req.Method = http.MethodPut
+			return req
+		}, auth.ErrInvalidCredentials},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := tt.req()
+			_, err := a.Authenticate(req)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("Authenticate() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil {
+				if got, _ := io.ReadAll(req.Body); string(got) != body {
+					t.Errorf("body after verification = %q, want it restored", got)
+				}
+			}
+		})
+	}
+
+	t.Run("replayed nonce", func(t *testing.T) {
+		req := newReq(now, secret)
+		replay := req.Clone(context.Background())
+		replay.Body = io.NopCloser(strings.NewReader(body))
+		if _, err := a.Authenticate(req); err != nil {
+			t.Fatalf("first request: %v", err)
+		}
+		if _, err := a.Authenticate(replay); !errors.Is(err, auth.ErrInvalidCredentials) {
+			t.Errorf("replay error = %v, want %v", err, auth.ErrInvalidCredentials)
+		}
+	})
+}
+
+func TestNonceCache(t *testing.T) {
+	var c auth.NonceCache
+	now := time.Now()
+	if !c.Use("n1", now, now.Add(time.Minute)) {
+		t.Fatal("first use of a nonce rejected")
+	}
+	if c.Use("n1", now.Add(30*time.Second), now.Add(time.Minute)) {
+		t.Error("nonce reused within its lifetime")
+	}
+	if !c.Use("n1", now.Add(2*time.Minute), now.Add(3*time.Minute)) {
+		t.Error("expired nonce not released")
+	}
+}
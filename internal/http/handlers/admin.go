@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/Bharat0908/ledger/internal/http/auth"
+	"github.com/Bharat0908/ledger/internal/repo"
+)
+
+// KeyRepo defines the API key operations used by the admin endpoints. It is implemented by
+// repo.PGAPIKeyRepo and repo.SQLiteRepo.
+type KeyRepo interface {
+	CreateAPIKey(ctx context.Context, in repo.NewAPIKey) (repo.APIKey, error)
+	ListAPIKeys(ctx context.Context) ([]repo.APIKey, error)
+	RevokeAPIKey(ctx context.Context, id uuid.UUID) (repo.APIKey, error)
+}
+
+// createAPIKey handles HTTP requests to issue an API key.
+// It expects a JSON payload with a name, the granted scopes and optionally the account IDs the key
+// is restricted to. The key is generated here and returned once, in the "key" field of the 201
+// response; only its hash is stored. With signed_requests set, the key also gets an HMAC signing
+// secret, returned once in "signing_secret", and only accepts signed requests. Unknown scopes are
+// rejected with 400.
+func (h *Handlers) createAPIKey(w http.ResponseWriter, r *http.Request) {
+	type req struct {
+		Name           string      `json:"name"`
+		Scopes         []string    `json:"scopes"`
+		AccountIDs     []uuid.UUID `json:"account_ids"`
+		SignedRequests bool        `json:"signed_requests"`
+	}
+	type resp struct {
+		repo.APIKey
+		Key           string `json:"key"`
+		SigningSecret string `json:"signing_secret,omitempty"`
+	}
+	var body req
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&body); err != nil {
+		badRequest(w, r, "malformed JSON body")
+		return
+	}
+	for _, s := range body.Scopes {
+		if !auth.ValidScope(s) {
+			badRequest(w, r, "unknown scope "+s)
+			return
+		}
+	}
+	key, prefix, err := auth.GenerateKey()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var secret string
+	if body.SignedRequests {
+		if secret, err = auth.GenerateSigningSecret(); err != nil {
+			writeError(w, r, err)
+			return
+		}
+	}
+	k, err := h.Keys.CreateAPIKey(r.Context(), repo.NewAPIKey{
+		Name: body.Name, Prefix: prefix, Hash: auth.HashKey(key), Scopes: body.Scopes, AccountIDs: body.AccountIDs,
+		SigningSecret: []byte(secret),
+	})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, resp{APIKey: k, Key: key, SigningSecret: secret})
+}
+
+// listAPIKeys handles HTTP requests to list issued API keys, including revoked ones. Key material
+// is never returned; keys are identified by ID, name and prefix.
+func (h *Handlers) listAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.Keys.ListAPIKeys(r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"api_keys": keys})
+}
+
+// revokeAPIKey handles HTTP requests to revoke an API key by ID. Revocation takes effect on the
+// next request made with the key and is idempotent. Responds with the revoked key, or 404.
+func (h *Handlers) revokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		badRequest(w, r, "invalid API key id")
+		return
+	}
+	k, err := h.Keys.RevokeAPIKey(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, k)
+}
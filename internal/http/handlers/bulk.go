@@ -0,0 +1,318 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/Bharat0908/ledger/internal/http/auth"
+	"github.com/Bharat0908/ledger/internal/http/problem"
+	"github.com/Bharat0908/ledger/internal/http/ratelimit"
+	"github.com/Bharat0908/ledger/internal/queue"
+	"github.com/Bharat0908/ledger/internal/repo"
+)
+
+// Bulk submission defaults, used when Handlers.BulkMaxItems and BulkPublishBatch are not set.
+const (
+	defaultBulkMaxItems     = 50000
+	defaultBulkPublishBatch = 500
+	// bulkBytesPerItem bounds the body of a bulk submission to this many bytes per allowed item.
+	bulkBytesPerItem = 1024
+	// maxIdempotencyKeyLen mirrors the IdempotencyKey schema of the OpenAPI document.
+	maxIdempotencyKeyLen = 255
+)
+
+// codeDuplicateKey is the item error code of a transfer reusing the idempotency key of an
+// earlier item of the same batch.
+const codeDuplicateKey = "duplicate_idempotency_key"
+
+// BatchRepo stores bulk transfer batches. It is implemented by repo.PGBatchRepo and
+// repo.SQLiteRepo.
+type BatchRepo interface {
+	CreateTransferBatch(ctx context.Context, in repo.NewTransferBatch) (repo.TransferBatch, error)
+	RejectBatchItems(ctx context.Context, id uuid.UUID, keys []string, code string) error
+	GetTransferBatch(ctx context.Context, id uuid.UUID) (repo.TransferBatch, error)
+}
+
+// bulkTransfer is one item of a bulk submission, with the fields of a single transfer request.
+type bulkTransfer struct {
+	FromAccountID  string `json:"from_account_id"`
+	ToAccountID    string `json:"to_account_id"`
+	Amount         int64  `json:"amount"`
+	IdempotencyKey string `json:"idempotency_key"`
+}
+
+// bulkItemError is the reason an item of a bulk submission was rejected.
+type bulkItemError struct {
+	Code   string `json:"code"`
+	Detail string `json:"detail"`
+}
+
+// bulkItemResult is the outcome of one item of a bulk submission.
+type bulkItemResult struct {
+	Index          int            `json:"index"`
+	IdempotencyKey string         `json:"idempotency_key"`
+	Status         string         `json:"status"`
+	Error          *bulkItemError `json:"error,omitempty"`
+}
+
+// reject marks the item rejected with code and detail.
+func (it *bulkItemResult) reject(code, detail string) {
+	it.Status = repo.BatchItemRejected
+	it.Error = &bulkItemError{Code: code, Detail: detail}
+}
+
+// enqueueTransfers handles HTTP requests to enqueue many transfers at once, such as a payroll
+// run. The body is either a JSON array of transfer objects or, with Content-Type
+// application/x-ndjson, a stream of them, one per line; both take the fields of POST
+// /v1/transfers and may hold up to BulkMaxItems transfers. A body that cannot be decoded fails
+// as a whole with 400.
+//
+// Every item is then checked on its own: account IDs must be UUIDs, the amount positive, the
+// accounts distinct and the idempotency key, generated when missing, unique within the batch.
+// Transfers out of opening accounts and keys reserved for opening transfers are rejected as over
+// POST /v1/transfers. Items the caller may not access, or that exceed its daily quota, are rejected
+// too. The batch is stored before anything is published, so its progress can be followed from the
+// start, and accepted items are published BulkPublishBatch at a time, waiting for the broker to
+// confirm each chunk; items that could not be published are rejected with queue_unavailable, and
+// given back to the caller's quota.
+//
+// Responds with 202 Accepted, a Location header pointing at the batch and the outcome of every
+// item in submission order, or with 503 when no item could be published at all. The server's
+// read and write timeouts do not apply, since a large batch takes longer than they allow.
+func (h *Handlers) enqueueTransfers(w http.ResponseWriter, r *http.Request) {
+	maxItems := h.BulkMaxItems
+	if maxItems <= 0 {
+		maxItems = defaultBulkMaxItems
+	}
+	// The server's timeouts are meant for ordinary requests: reading, checking and publishing
+	// tens of thousands of transfers can outlast them.
+	rc := http.NewResponseController(w)
+	_ = rc.SetReadDeadline(time.Time{})
+	_ = rc.SetWriteDeadline(time.Time{})
+	r.Body = http.MaxBytesReader(w, r.Body, int64(maxItems)*bulkBytesPerItem)
+	transfers, status, msg := decodeBulkTransfers(r, maxItems)
+	if msg != "" {
+		problem.Error(w, r, status, problem.CodeInvalidRequest, msg)
+		return
+	}
+
+	ctx := r.Context()
+	results := make([]bulkItemResult, len(transfers))
+	msgs := make([]queue.TransferMessage, 0, len(transfers))
+	index := make([]int, 0, len(transfers)) // position in results of each entry of msgs
+	seen := make(map[string]bool, len(transfers))
+	denials := map[uuid.UUID]string{}
+	client, now := ratelimit.ClientKey(r), time.Now()
+	var charged int64 // amount charged to the quota for msgs
+	for i, t := range transfers {
+		it := &results[i]
+		it.Index, it.IdempotencyKey, it.Status = i, t.IdempotencyKey, repo.BatchItemQueued
+		if it.IdempotencyKey == "" {
+			it.IdempotencyKey = uuid.NewString()
+		}
+		from, errFrom := uuid.Parse(t.FromAccountID)
+		to, errTo := uuid.Parse(t.ToAccountID)
+		switch {
+		case errFrom != nil:
+			it.reject(problem.CodeInvalidRequest, "from_account_id must be a UUID")
+		case errTo != nil:
+			it.reject(problem.CodeInvalidRequest, "to_account_id must be a UUID")
+		case len(it.IdempotencyKey) > maxIdempotencyKeyLen:
+			it.reject(problem.CodeInvalidRequest, fmt.Sprintf("idempotency_key must be at most %d characters", maxIdempotencyKeyLen))
+		case t.Amount <= 0:
+			it.reject(repo.ErrInvalidAmount.Code, repo.ErrInvalidAmount.Message)
+		case from == to:
+			it.reject(repo.ErrSameAccount.Code, repo.ErrSameAccount.Message)
+		case seen[it.IdempotencyKey]:
+			it.reject(codeDuplicateKey, "idempotency_key is used by an earlier item of the batch")
+		}
+		if it.Error == nil {
+			var de *repo.Error
+			if errors.As(repo.CheckSubmission(t.FromAccountID, it.IdempotencyKey, h.OpeningAccounts), &de) {
+				it.reject(de.Code, de.Message)
+			}
+		}
+		if it.Error != nil {
+			continue
+		}
+		seen[it.IdempotencyKey] = true
+		reason, ok := denials[from]
+		if !ok {
+			var err error
+			if reason, err = h.accountDenial(ctx, from); err != nil {
+				h.refundQuota(ctx, client, now, int64(len(msgs)), charged)
+				writeError(w, r, err)
+				return
+			}
+			denials[from] = reason
+		}
+		if reason != "" {
+			it.reject(problem.CodeForbidden, reason)
+			continue
+		}
+		if err := h.chargeQuota(ctx, client, now, t.Amount); errors.Is(err, repo.ErrQuotaExceeded) {
+			it.reject(repo.ErrQuotaExceeded.Code, repo.ErrQuotaExceeded.Message)
+			continue
+		} else if err != nil {
+			h.refundQuota(ctx, client, now, int64(len(msgs)), charged)
+			writeError(w, r, err)
+			return
+		}
+		charged += t.Amount
+		msgs = append(msgs, queue.TransferMessage{FromAccountID: t.FromAccountID, ToAccountID: t.ToAccountID, Amount: t.Amount, Key: it.IdempotencyKey, CreatedAt: now})
+		index = append(index, i)
+	}
+
+	items := make([]repo.NewBatchItem, len(results))
+	for i, it := range results {
+		items[i] = repo.NewBatchItem{IdempotencyKey: it.IdempotencyKey, Status: it.Status}
+		if from, err := uuid.Parse(transfers[i].FromAccountID); err == nil {
+			items[i].AccountID = from.String()
+		}
+		if it.Error != nil {
+			items[i].Error = it.Error.Code
+		}
+	}
+	batch, err := h.Batches.CreateTransferBatch(ctx, repo.NewTransferBatch{Owner: clientOwner(auth.FromContext(ctx)), Items: items})
+	if err != nil {
+		h.refundQuota(ctx, client, now, int64(len(msgs)), charged)
+		writeError(w, r, err)
+		return
+	}
+
+	chunk := h.BulkPublishBatch
+	if chunk <= 0 {
+		chunk = defaultBulkPublishBatch
+	}
+	var failed []string
+	var publishErr error
+	var unpublished int64 // amount of the failed items, given back to the quota
+	for start := 0; start < len(msgs); start += chunk {
+		end := min(start+chunk, len(msgs))
+		for j, err := range h.Pub.PublishTransfers(ctx, msgs[start:end]) {
+			if err == nil {
+				continue
+			}
+			publishErr = err
+			unpublished += msgs[start+j].Amount
+			it := &results[index[start+j]]
+			it.reject(problem.CodeQueueUnavailable, "transaction queue unavailable, retry later")
+			failed = append(failed, it.IdempotencyKey)
+		}
+	}
+	if len(failed) > 0 {
+		h.refundQuota(ctx, client, now, int64(len(failed)), unpublished)
+		if err := h.Batches.RejectBatchItems(ctx, batch.ID, failed, problem.CodeQueueUnavailable); err != nil {
+			slog.ErrorContext(ctx, "record unpublished batch items", "batch_id", batch.ID, "error", err)
+		}
+		if len(failed) == len(msgs) {
+			writePublishError(w, r, publishErr)
+			return
+		}
+	}
+
+	accepted := len(msgs) - len(failed)
+	slog.InfoContext(ctx, "transfer batch queued",
+		"batch_id", batch.ID, "total", len(results), "accepted", accepted, "rejected", len(results)-accepted)
+	w.Header().Set("Location", "/v1/transfers/bulk/"+batch.ID.String())
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{
+		"batch_id": batch.ID,
+		"total":    len(results),
+		"accepted": accepted,
+		"rejected": len(results) - accepted,
+		"items":    results,
+	})
+}
+
+// decodeBulkTransfers reads the transfers of a bulk submission, as a JSON array or as NDJSON
+// depending on the request's Content-Type. When the body cannot be used it returns the status
+// and message to answer with.
+func decodeBulkTransfers(r *http.Request, maxItems int) ([]bulkTransfer, int, string) {
+	ndjson := false
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		mt, _, err := mime.ParseMediaType(ct)
+		switch {
+		case err == nil && mt == "application/x-ndjson":
+			ndjson = true
+		case err == nil && mt == "application/json":
+		default:
+			return nil, http.StatusBadRequest, "Content-Type must be application/json or application/x-ndjson"
+		}
+	}
+	dec := json.NewDecoder(r.Body)
+	if !ndjson {
+		if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+			return nil, decodeStatus(err), "body must be a JSON array of transfers"
+		}
+	}
+	dec.DisallowUnknownFields()
+	var out []bulkTransfer
+	for ndjson || dec.More() {
+		var t bulkTransfer
+		err := dec.Decode(&t)
+		if ndjson && errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, decodeStatus(err), fmt.Sprintf("malformed JSON in item %d", len(out))
+		}
+		if len(out) == maxItems {
+			return nil, http.StatusRequestEntityTooLarge, fmt.Sprintf("a batch may hold at most %d transfers", maxItems)
+		}
+		out = append(out, t)
+	}
+	if !ndjson {
+		if _, err := dec.Token(); err != nil {
+			return nil, decodeStatus(err), "body must be a JSON array of transfers"
+		}
+		if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+			return nil, decodeStatus(err), "unexpected data after the array of transfers"
+		}
+	}
+	if len(out) == 0 {
+		return nil, http.StatusBadRequest, "batch holds no transfers"
+	}
+	return out, 0, ""
+}
+
+// decodeStatus is the status answering a body that failed to decode with err: 413 when it went
+// over the size limit, 400 otherwise.
+func decodeStatus(err error) int {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// getTransferBatch handles HTTP requests to follow the progress of one of the caller's bulk
+// submissions: how many of its transfers were accepted, applied, refused by the worker or are
+// still pending. Batches of other clients are reported as 404 unless the caller is an admin.
+func (h *Handlers) getTransferBatch(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		badRequest(w, r, "invalid batch id")
+		return
+	}
+	b, err := h.Batches.GetTransferBatch(r.Context(), id)
+	if err == nil {
+		if p := auth.FromContext(r.Context()); p != nil && !p.HasScope(auth.ScopeAdmin) && b.Owner != clientOwner(p) {
+			err = repo.ErrBatchNotFound
+		}
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, b)
+}
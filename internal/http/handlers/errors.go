@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/google/uuid"
+
+	"github.com/Bharat0908/ledger/internal/http/auth"
+	"github.com/Bharat0908/ledger/internal/http/problem"
+	"github.com/Bharat0908/ledger/internal/repo"
+)
+
+// domainStatus maps repository domain error codes to HTTP status codes.
+var domainStatus = map[string]int{
+	repo.ErrNotFound.Code:          http.StatusNotFound,
+	repo.ErrInsufficientFunds.Code: http.StatusUnprocessableEntity,
+	repo.ErrInvalidType.Code:       http.StatusUnprocessableEntity,
+	repo.ErrInvalidAmount.Code:     http.StatusUnprocessableEntity,
+	repo.ErrAccountFrozen.Code:     http.StatusConflict,
+	repo.ErrSameAccount.Code:       http.StatusUnprocessableEntity,
+	repo.ErrCurrencyMismatch.Code:  http.StatusUnprocessableEntity,
+	repo.ErrOpeningAccount.Code:    http.StatusUnprocessableEntity,
+	repo.ErrReservedKey.Code:       http.StatusUnprocessableEntity,
+
+	repo.ErrInvalidAccountType.Code:  http.StatusUnprocessableEntity,
+	repo.ErrExternalRefConflict.Code: http.StatusConflict,
+	repo.ErrExternalRefRequired.Code: http.StatusUnprocessableEntity,
+	repo.ErrReservedExternalRef.Code: http.StatusUnprocessableEntity,
+
+	repo.ErrInvalidSort.Code:   http.StatusBadRequest,
+	repo.ErrInvalidLimit.Code:  http.StatusBadRequest,
+	repo.ErrInvalidStatus.Code: http.StatusBadRequest,
+	repo.ErrInvalidCursor.Code: http.StatusBadRequest,
+
+	repo.ErrInvalidEventID.Code: http.StatusBadRequest,
+
+	repo.ErrAPIKeyNotFound.Code: http.StatusNotFound,
+	repo.ErrInvalidAPIKey.Code:  http.StatusUnprocessableEntity,
+
+	repo.ErrWebhookNotFound.Code:         http.StatusNotFound,
+	repo.ErrWebhookDeliveryNotFound.Code: http.StatusNotFound,
+	repo.ErrInvalidWebhook.Code:          http.StatusUnprocessableEntity,
+
+	repo.ErrBatchNotFound.Code: http.StatusNotFound,
+
+	repo.ErrQuotaExceeded.Code: http.StatusTooManyRequests,
+}
+
+// badRequest responds with a 400 invalid_request problem.
+func badRequest(w http.ResponseWriter, r *http.Request, detail string) {
+	problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidRequest, detail)
+}
+
+// writeError maps err to a problem response. Repository domain errors are exposed with their
+// stable code; anything else is logged and reported as a generic internal error so driver
+// messages never reach the client.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	var de *repo.Error
+	if errors.As(err, &de) {
+		status, ok := domainStatus[de.Code]
+		if !ok {
+			status = http.StatusUnprocessableEntity
+		}
+		problem.Error(w, r, status, de.Code, de.Message)
+		return
+	}
+	slog.ErrorContext(r.Context(), "request failed", "method", r.Method, "path", r.URL.Path, "error", err)
+	problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, "internal server error")
+}
+
+// writePublishError reports a failure to enqueue a message.
+func writePublishError(w http.ResponseWriter, r *http.Request, err error) {
+	slog.ErrorContext(r.Context(), "publish failed", "method", r.Method, "path", r.URL.Path, "error", err)
+	problem.Error(w, r, http.StatusServiceUnavailable, problem.CodeQueueUnavailable, "transaction queue unavailable, retry later")
+}
+
+// allowAccount reports whether the caller may act on the account, answering 403 when not (see
+// accountDenial).
+func (h *Handlers) allowAccount(w http.ResponseWriter, r *http.Request, id uuid.UUID) bool {
+	reason, err := h.accountDenial(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err)
+		return false
+	}
+	if reason != "" {
+		auth.Forbidden(w, r, reason)
+		return false
+	}
+	return true
+}
+
+// accountDenial returns why the caller may not act on the account, or "" if it may. Callers
+// bound to a tenant may only act on accounts owned by that tenant, which requires loading the
+// account; unknown accounts pass so the caller gets the usual not-found handling.
+func (h *Handlers) accountDenial(ctx context.Context, id uuid.UUID) (string, error) {
+	p := auth.FromContext(ctx)
+	if p == nil {
+		return "", nil
+	}
+	if !p.CanAccess(id) {
+		return "API credentials are not allowed to access this account", nil
+	}
+	if p.Tenant == "" {
+		return "", nil
+	}
+	acc, err := h.Repo.GetAccount(ctx, id)
+	if errors.Is(err, repo.ErrNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if acc.Owner != p.Tenant {
+		return "account belongs to another tenant", nil
+	}
+	return "", nil
+}
+
+// allowAccountID is allowAccount for an account ID taken from a request body. Restricted
+// callers are refused IDs that do not parse; for others, validation is left to the worker.
+func (h *Handlers) allowAccountID(w http.ResponseWriter, r *http.Request, s string) bool {
+	id, err := uuid.Parse(s)
+	if err != nil {
+		if p := auth.FromContext(r.Context()); p != nil && (p.Restricted() || p.Tenant != "") {
+			auth.Forbidden(w, r, "API credentials are not allowed to access this account")
+			return false
+		}
+		return true
+	}
+	return h.allowAccount(w, r, id)
+}
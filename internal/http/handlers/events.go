@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// Streamer is the live feed of committed ledger entries behind the account event stream. It is
+// implemented by stream.Broker.
+type Streamer interface {
+	Subscribe(accountID string) (<-chan map[string]interface{}, func())
+}
+
+// defaultHeartbeat is the interval between heartbeats when Handlers.Heartbeat is unset.
+const defaultHeartbeat = 15 * time.Second
+
+// replayPage is the number of ledger entries read at a time when resuming a stream.
+const replayPage = 500
+
+// streamEvents handles HTTP requests for the Server-Sent Events stream of an account's activity.
+// Every ledger entry committed for the account is sent as a "ledger_entry" event whose ID is the
+// entry's ID (see repo.EntryID) and whose data is the entry, as returned by getLedger. A client
+// that reconnects with a Last-Event-ID header first receives the entries written after that one,
+// read from the ledger, oldest first; an ID that names no entry of the account is rejected with
+// 400.
+// A comment is sent every Heartbeat so proxies keep idle streams open. The stream ends when the
+// client goes away, when it falls too far behind, or when the server shuts down; clients resume
+// by reconnecting. Invalid IDs are rejected with 400 and inaccessible accounts with 403.
+func (h *Handlers) streamEvents(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		badRequest(w, r, "invalid account id")
+		return
+	}
+	if !h.allowAccount(w, r, id) {
+		return
+	}
+	// Subscribe before replaying so entries committed in between are not missed; those that
+	// are both replayed and received live are sent once.
+	live, cancel := h.Stream.Subscribe(id.String())
+	defer cancel()
+	var replay []map[string]interface{}
+	last := r.Header.Get("Last-Event-ID")
+	if last != "" {
+		if replay, err = h.LedgerRepo.GetTransactionsAfter(r.Context(), id.String(), last, replayPage); err != nil {
+			writeError(w, r, err)
+			return
+		}
+	}
+
+	rc := http.NewResponseController(w)
+	// The server's write timeout is meant for ordinary responses, not for a stream.
+	_ = rc.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+	slog.DebugContext(r.Context(), "event stream opened", "account_id", id, "last_event_id", last)
+
+	replayed := map[string]bool{}
+	for len(replay) > 0 {
+		for _, e := range replay {
+			entryID, _ := e["id"].(string)
+			replayed[entryID] = true
+			if !writeEntry(w, e) {
+				return
+			}
+		}
+		if len(replay) < replayPage {
+			break
+		}
+		after, _ := replay[len(replay)-1]["id"].(string)
+		if replay, err = h.LedgerRepo.GetTransactionsAfter(r.Context(), id.String(), after, replayPage); err != nil {
+			slog.WarnContext(r.Context(), "event stream replay failed", "account_id", id, "error", err)
+			return
+		}
+	}
+	if rc.Flush() != nil {
+		return
+	}
+
+	interval := h.Heartbeat
+	if interval <= 0 {
+		interval = defaultHeartbeat
+	}
+	heartbeat := time.NewTicker(interval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-live:
+			if !ok {
+				return
+			}
+			if entryID, _ := e["id"].(string); replayed[entryID] {
+				continue
+			}
+			if !writeEntry(w, e) {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		if rc.Flush() != nil {
+			return
+		}
+	}
+}
+
+// writeEntry writes the ledger entry e as a "ledger_entry" event and reports whether the stream
+// is still writable. Entry IDs end in an idempotency key chosen by a client, so one that would
+// break the event framing is left out and the event has no ID.
+func writeEntry(w http.ResponseWriter, e map[string]interface{}) bool {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return false
+	}
+	if entryID, _ := e["id"].(string); entryID != "" && !strings.ContainsAny(entryID, "\r\n") {
+		if _, err := fmt.Fprintf(w, "id: %s\n", entryID); err != nil {
+			return false
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: ledger_entry\ndata: %s\n\n", data)
+	return err == nil
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/Bharat0908/ledger/internal/export"
+	"github.com/Bharat0908/ledger/internal/repo"
+)
+
+// exportLedger handles HTTP requests to download an account's ledger entries, oldest first, as
+// CSV (the default), NDJSON or Parquet, chosen with the format query parameter. from and to
+// (RFC 3339) restrict the export to entries created at or after from and before to.
+//
+// Entries are encoded as they are read from the ledger store, so exports of any size are served
+// without being held in memory, and the server's write timeout does not apply. A failure before
+// the first byte is answered with a problem; after it the connection is aborted so the client
+// sees a truncated download rather than a complete-looking file. Invalid parameters are rejected
+// with 400 and inaccessible accounts with 403.
+func (h *Handlers) exportLedger(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		badRequest(w, r, "invalid account id")
+		return
+	}
+	q := r.URL.Query()
+	format := q.Get("format")
+	if format == "" {
+		format = export.FormatCSV
+	}
+	if !slices.Contains(export.Formats, format) {
+		badRequest(w, r, "format must be csv, ndjson or parquet")
+		return
+	}
+	f := repo.LedgerFilter{AccountID: id.String()}
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+	}{{"from", &f.From}, {"to", &f.To}} {
+		if v := q.Get(p.name); v != "" {
+			if *p.dst, err = time.Parse(time.RFC3339, v); err != nil {
+				badRequest(w, r, p.name+" must be an RFC 3339 time")
+				return
+			}
+		}
+	}
+	if !f.From.IsZero() && !f.To.IsZero() && !f.From.Before(f.To) {
+		badRequest(w, r, "from must be before to")
+		return
+	}
+	if !h.allowAccount(w, r, id) {
+		return
+	}
+
+	// The server's write timeout is meant for ordinary responses, not for a download.
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	out := &startingWriter{w: w, start: func() {
+		w.Header().Set("Content-Type", export.ContentType(format))
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="ledger-%s.%s"`, id, format))
+		w.WriteHeader(http.StatusOK)
+	}}
+	enc, err := export.NewWriter(out, format)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	n := 0
+	err = h.LedgerRepo.ExportLedger(r.Context(), f, func(e repo.LedgerEntry) error {
+		n++
+		return enc.Write(e)
+	})
+	if err == nil {
+		err = enc.Close()
+	}
+	if err != nil {
+		if !out.started {
+			writeError(w, r, err)
+			return
+		}
+		slog.ErrorContext(r.Context(), "ledger export aborted", "account_id", id, "format", format, "entries", n, "error", err)
+		panic(http.ErrAbortHandler)
+	}
+	slog.InfoContext(r.Context(), "ledger exported", "account_id", id, "format", format, "entries", n)
+}
+
+// startingWriter calls start before the first write, so a response can still turn into an
+// error until the first byte of the body is ready.
+type startingWriter struct {
+	w       http.ResponseWriter
+	start   func()
+	started bool
+}
+
+func (s *startingWriter) Write(p []byte) (int, error) {
+	if !s.started {
+		s.started = true
+		s.start()
+	}
+	return s.w.Write(p)
+}
@@ -7,113 +7,381 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"log/slog"
 	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 
+	"github.com/Bharat0908/ledger/internal/health"
+	"github.com/Bharat0908/ledger/internal/http/auth"
+	"github.com/Bharat0908/ledger/internal/http/ratelimit"
 	"github.com/Bharat0908/ledger/internal/queue"
-	//"github.com/Bharat0908/ledger/internal/repo"
+	"github.com/Bharat0908/ledger/internal/repo"
 )
 
 // AccountRepo defines the interface for account-related operations in the ledger system.
 // It provides methods to create a new account and retrieve account information.
 //
 // Methods:
-//   - CreateAccount: Creates a new account with the specified owner, currency, and initial balance.
-//     Returns the UUID of the created account or an error if the operation fails.
-//   - GetAccount: Retrieves the balance of the account identified by the given UUID.
-//     Returns the account balance or an error if the account does not exist or retrieval fails.
+//   - CreateAccount: Creates a new account with the specified attributes and a zero balance.
+//     Returns the stored account and whether it was newly created (false when an account with the
+//     same external reference already exists), or an error if the operation fails.
+//   - GetAccount: Retrieves the account identified by the given UUID, including its balance.
+//     Returns the account or an error if the account does not exist or retrieval fails.
+//   - ListAccounts: Returns one page of the accounts matching the filter and the total number of
+//     matches, or an error (domain errors for invalid sorts, limits, statuses and cursors).
 type AccountRepo interface {
-	CreateAccount(ctx context.Context, owner, currency string, initial int64) (uuid.UUID, error)
-	GetAccount(ctx context.Context, id uuid.UUID) (int64, error)
+	CreateAccount(ctx context.Context, in repo.NewAccount) (repo.Account, bool, error)
+	GetAccount(ctx context.Context, id uuid.UUID) (repo.Account, error)
+	ListAccounts(ctx context.Context, f repo.AccountFilter) (repo.AccountPage, error)
 }
 
 // LedgerRepo defines the interface for accessing ledger transactions.
-// It provides methods to retrieve transactions for a specific account.
+// It provides methods to retrieve transactions for a specific account: the most recent ones, and
+// those written after the entry with a given idempotency key, used to resume event streams.
+// ExportLedger streams every entry matching a filter, oldest first, for exports.
 type LedgerRepo interface {
 	GetTransactions(ctx context.Context, accountID string, limit int) ([]map[string]interface{}, error)
+	GetTransactionsAfter(ctx context.Context, accountID, key string, limit int) ([]map[string]interface{}, error)
+	ExportLedger(ctx context.Context, f repo.LedgerFilter, fn func(repo.LedgerEntry) error) error
+}
+
+// TransactionRepo looks up applied transactions by idempotency key. Keys are scoped to the
+// account of a transaction or the source of a transfer, so one key may have been applied on
+// several accounts. It is implemented by repo.PGRepo and repo.SQLiteRepo.
+type TransactionRepo interface {
+	GetProcessedTransactions(ctx context.Context, key string) ([]repo.ProcessedTransaction, error)
+}
+
+// Publisher defines the interface for enqueuing transactions and transfers for asynchronous
+// processing. It is implemented by queue.Publisher (RabbitMQ) and queue.LocalQueue (in-process).
+// PublishTransfers publishes a batch of transfers and returns one error per message, in order.
+type Publisher interface {
+	Publish(ctx context.Context, msg queue.TxMessage) error
+	PublishTransfer(ctx context.Context, msg queue.TransferMessage) error
+	PublishTransfers(ctx context.Context, msgs []queue.TransferMessage) []error
 }
 
 // Handlers encapsulates dependencies required by HTTP handlers, including
 // a message queue publisher, an account repository, and a ledger repository.
+//
+// Auth, when set, authenticates every /v1 request (see auth.Middleware); routes then require the
+// scope matching their operation and callers restricted to particular accounts may only act on
+// those. Keys, when set, enables the /v1/admin/api-keys endpoints, and Webhooks the /v1/webhooks
+// endpoints, which refuse URLs pointing at loopback, private or link-local addresses outside
+// WebhookAllowedNetworks, and Batches the /v1/transfers/bulk endpoints, which take up to
+// BulkMaxItems transfers per request (default 50000) and publish them BulkPublishBatch at a time
+// (default 500). Transactions, when set, enables GET /v1/transactions/{key}. Stream, when set,
+// enables the account event stream, which sends a heartbeat every Heartbeat (default 15s).
+//
+// ReadLimit and WriteLimit, when set, throttle read and write /v1 routes (see
+// ratelimit.Middleware); the gRPC server shares them, so a client's REST and gRPC calls draw on
+// the same buckets. Quotas, when set together with QuotaLimits, caps the number and total
+// amount of transactions and transfers each client may enqueue per UTC day.
+//
+// Health, when set, backs /readyz with the service's dependency checks; without it /readyz
+// reports ready as long as the process serves requests.
+//
+// OpeningAccounts maps a currency to the equity account that funds opening balances in that
+// currency. Currencies without an entry are funded from a system equity account that is
+// provisioned on first use with the external reference "opening-equity:<CURRENCY>".
 type Handlers struct {
-	Pub        *queue.Publisher
-	Repo       AccountRepo
-	LedgerRepo LedgerRepo
+	Pub                    Publisher
+	Repo                   AccountRepo
+	LedgerRepo             LedgerRepo
+	Transactions           TransactionRepo
+	Auth                   func(http.Handler) http.Handler
+	Keys                   KeyRepo
+	Webhooks               WebhookRepo
+	WebhookAllowedNetworks []netip.Prefix
+	Batches                BatchRepo
+	BulkMaxItems           int
+	BulkPublishBatch       int
+	Stream                 Streamer
+	Heartbeat              time.Duration
+	ReadLimit              *ratelimit.Limiter
+	WriteLimit             *ratelimit.Limiter
+	Quotas                 QuotaRepo
+	QuotaLimits            repo.QuotaLimits
+	Health                 *health.Health
+	OpeningAccounts        map[string]uuid.UUID
 }
 
-// New creates and returns a new Handlers instance with the provided queue.Publisher,
+// New creates and returns a new Handlers instance with the provided Publisher,
 // AccountRepo, and LedgerRepo. It initializes the Handlers struct with these dependencies
 // for handling HTTP requests related to accounts and ledgers.
-func New(pub *queue.Publisher, repo AccountRepo, lrepo LedgerRepo) *Handlers {
+func New(pub Publisher, repo AccountRepo, lrepo LedgerRepo) *Handlers {
 	return &Handlers{Pub: pub, Repo: repo, LedgerRepo: lrepo}
 }
 
-// Routes sets up and returns the HTTP routes for the ledger service, including endpoints for account creation,
-// account retrieval, ledger retrieval, transaction and transfer enqueuing, as well as health and readiness checks.
+// Routes sets up and returns the HTTP routes for the ledger service, including endpoints for
+// account creation, account retrieval, ledger retrieval, transaction and transfer enqueuing, as
+// well as health and readiness checks. /healthz and /readyz are served outside the authenticated
+// /v1 group so probes need no credentials.
 func (h *Handlers) Routes() http.Handler {
 	r := chi.NewRouter()
-	r.Post("/v1/accounts", h.createAccount)
-	r.Get("/v1/accounts/{id}", h.getAccount)
-	r.Get("/v1/accounts/{id}/ledger", h.getLedger)
-	r.Post("/v1/transactions", h.enqueueTx)
-	r.Post("/v1/transfers", h.enqueueTransfer)
-	r.Get("/healthz", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK); w.Write([]byte("ok")) })
-	r.Get("/readyz", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK); w.Write([]byte("ok")) })
+	r.Group(func(r chi.Router) {
+		if h.Auth != nil {
+			r.Use(h.Auth)
+		}
+		rl, wl := limit(h.ReadLimit), limit(h.WriteLimit)
+		read, write := auth.Require(auth.ScopeAccountsRead), auth.Require(auth.ScopeAccountsWrite)
+		tx := auth.Require(auth.ScopeTransactionsWrite)
+		r.With(rl, read).Get("/v1/accounts", h.listAccounts)
+		r.With(wl, write).Post("/v1/accounts", h.createAccount)
+		r.With(rl, read).Get("/v1/accounts/{id}", h.getAccount)
+		r.With(rl, read).Get("/v1/accounts/{id}/ledger", h.getLedger)
+		r.With(rl, read).Get("/v1/accounts/{id}/ledger/export", h.exportLedger)
+		if h.Stream != nil {
+			r.With(rl, read).Get("/v1/accounts/{id}/events", h.streamEvents)
+		}
+		r.With(wl, tx).Post("/v1/transactions", h.enqueueTx)
+		if h.Transactions != nil {
+			r.With(rl, read).Get("/v1/transactions/{key}", h.getTransaction)
+		}
+		r.With(wl, tx).Post("/v1/transfers", h.enqueueTransfer)
+		r.With(wl, tx).Post("/v1/imports", h.importFile)
+		if h.Batches != nil {
+			r.With(wl, tx).Post("/v1/transfers/bulk", h.enqueueTransfers)
+			r.With(rl, read).Get("/v1/transfers/bulk/{id}", h.getTransferBatch)
+		}
+		if h.Keys != nil {
+			r.Route("/v1/admin/api-keys", func(r chi.Router) {
+				r.Use(wl, auth.Require(auth.ScopeAdmin))
+				r.Post("/", h.createAPIKey)
+				r.Get("/", h.listAPIKeys)
+				r.Delete("/{id}", h.revokeAPIKey)
+			})
+		}
+		if h.Webhooks != nil {
+			r.Route("/v1/webhooks", func(r chi.Router) {
+				manage := auth.Require(auth.ScopeWebhooksManage)
+				r.With(wl, manage).Post("/", h.createWebhook)
+				r.With(rl, manage).Get("/", h.listWebhooks)
+				r.With(rl, manage).Get("/{id}", h.getWebhook)
+				r.With(wl, manage).Delete("/{id}", h.deleteWebhook)
+				r.With(rl, manage).Get("/{id}/deliveries", h.listWebhookDeliveries)
+				r.With(wl, manage).Post("/{id}/deliveries/{delivery_id}/redeliver", h.redeliverWebhook)
+			})
+		}
+	})
+	hc := h.Health
+	if hc == nil {
+		hc = health.New()
+	}
+	r.Get("/healthz", hc.Live)
+	r.Get("/readyz", hc.Ready)
 	return r
 }
 
-// createAccount handles HTTP requests to create a new account.
-// It expects a JSON payload with the account owner, currency, and initial balance.
-// On success, it returns the created account's ID with HTTP status 201 Created.
-// If the request body is invalid or an error occurs during account creation,
-// it responds with the appropriate HTTP error code and message.
+// limit returns the middleware throttling clients with l, or one that does nothing if l is nil.
+func limit(l *ratelimit.Limiter) func(http.Handler) http.Handler {
+	if l == nil {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	return ratelimit.Middleware(l)
+}
+
+// createAccount handles HTTP requests to create a new account. It expects a JSON payload with the
+// account owner, currency, and initial balance, and optionally an external reference, account type,
+// display name and metadata map. The account is always stored with a zero balance. A positive
+// initial_balance is then enqueued as an opening transfer from the currency's equity account, keyed
+// by repo.OpeningBalanceKey, so the ledger history of the account sums to its balance; the response
+// carries the transfer's idempotency key. A positive initial_balance requires an external_ref, so
+// that a request whose transfer could not be enqueued can be retried without leaving an unfunded
+// account behind. On success, it returns the created account with HTTP status 201 Created. If an
+// account with the same external_ref already exists, that account is returned with HTTP status 200
+// OK instead, so clients can safely retry provisioning; the opening transfer is re-enqueued under
+// the same key and applied at most once. Equity accounts are reserved for funding opening balances
+// and cannot be created. Invalid bodies and repository errors are reported as problem+json, and a
+// failure to enqueue the opening transfer as 503 so the client retries. Callers bound to a tenant
+// get 403 for any other owner.
 func (h *Handlers) createAccount(w http.ResponseWriter, r *http.Request) {
 	type req struct {
-		Owner, Currency string `json:"owner"`
-		InitialBalance  int64  `json:"initial_balance"`
+		Owner          string            `json:"owner"`
+		Currency       string            `json:"currency"`
+		InitialBalance int64             `json:"initial_balance"`
+		ExternalRef    string            `json:"external_ref"`
+		Type           string            `json:"type"`
+		DisplayName    string            `json:"display_name"`
+		Metadata       map[string]string `json:"metadata"`
+	}
+	type openingTransfer struct {
+		Status         string    `json:"status"`
+		IdempotencyKey string    `json:"idempotency_key"`
+		FromAccountID  uuid.UUID `json:"from_account_id"`
+		Amount         int64     `json:"amount"`
+	}
+	type resp struct {
+		repo.Account
+		OpeningTransfer *openingTransfer `json:"opening_transfer,omitempty"`
 	}
 	var body req
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, err.Error(), 400)
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&body); err != nil {
+		badRequest(w, r, "malformed JSON body")
+		return
+	}
+	in := repo.NewAccount{
+		Owner:       body.Owner,
+		Currency:    body.Currency,
+		ExternalRef: body.ExternalRef,
+		Type:        body.Type,
+		DisplayName: body.DisplayName,
+		Metadata:    body.Metadata,
+	}
+	if err := in.CheckClient(body.InitialBalance); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if p := auth.FromContext(r.Context()); p != nil && p.Tenant != "" && body.Owner != p.Tenant {
+		auth.Forbidden(w, r, "cannot create accounts for another tenant")
 		return
 	}
-	id, err := h.Repo.CreateAccount(r.Context(), body.Owner, body.Currency, body.InitialBalance)
+	acc, created, err := h.Repo.CreateAccount(r.Context(), in)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	slog.InfoContext(r.Context(), "account provisioned", "account_id", acc.ID, "created", created, "external_ref", acc.ExternalRef)
+	out := resp{Account: acc}
+	if body.InitialBalance > 0 {
+		from, err := h.openingAccount(r.Context(), acc.Currency)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		key := repo.OpeningBalanceKey(acc.ID)
+		msg := queue.TransferMessage{FromAccountID: from.String(), ToAccountID: acc.ID.String(), Amount: body.InitialBalance, Key: key, CreatedAt: time.Now()}
+		if err := h.Pub.PublishTransfer(r.Context(), msg); err != nil {
+			writePublishError(w, r, err)
+			return
+		}
+		slog.InfoContext(r.Context(), "opening transfer queued",
+			"from_account_id", from, "to_account_id", acc.ID, "amount", body.InitialBalance, "idempotency_key", key)
+		out.OpeningTransfer = &openingTransfer{Status: "queued", IdempotencyKey: key, FromAccountID: from, Amount: body.InitialBalance}
+	}
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	writeJSON(w, status, out)
+}
+
+// openingAccount returns the equity account that funds opening balances in currency (see
+// repo.OpeningAccount).
+func (h *Handlers) openingAccount(ctx context.Context, currency string) (uuid.UUID, error) {
+	return repo.OpeningAccount(ctx, h.Repo, h.OpeningAccounts, currency)
+}
+
+// listAccounts handles HTTP requests to list and search accounts.
+// Accounts can be filtered by owner, currency, status, creation time (created_from inclusive,
+// created_to exclusive, both RFC 3339) and metadata, given as repeated metadata=key:value
+// parameters that must all match. sort is created_at (default), balance or owner, prefixed with
+// "-" for descending order. Results are paginated with limit (default 50, max 500) and the opaque
+// next_cursor of the previous page; total counts all matching accounts. Callers restricted to
+// particular accounts only see those, and callers bound to a tenant only see accounts that
+// tenant owns. Malformed parameters are rejected with 400.
+func (h *Handlers) listAccounts(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f := repo.AccountFilter{
+		Owner:    q.Get("owner"),
+		Currency: q.Get("currency"),
+		Status:   q.Get("status"),
+		Sort:     q.Get("sort"),
+		Cursor:   q.Get("cursor"),
+	}
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+	}{{"created_from", &f.CreatedFrom}, {"created_to", &f.CreatedTo}} {
+		if v := q.Get(p.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				badRequest(w, r, p.name+" must be an RFC 3339 date-time")
+				return
+			}
+			*p.dst = t
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			badRequest(w, r, "limit must be a positive integer")
+			return
+		}
+		f.Limit = n
+	}
+	for _, kv := range q["metadata"] {
+		k, v, ok := strings.Cut(kv, ":")
+		if !ok || k == "" {
+			badRequest(w, r, "metadata filters must be key:value")
+			return
+		}
+		if f.Metadata == nil {
+			f.Metadata = map[string]string{}
+		}
+		f.Metadata[k] = v
+	}
+	if p := auth.FromContext(r.Context()); p != nil {
+		if p.Restricted() {
+			f.IDs = p.Accounts
+		}
+		if p.Tenant != "" {
+			if f.Owner != "" && f.Owner != p.Tenant {
+				auth.Forbidden(w, r, "cannot list accounts of another tenant")
+				return
+			}
+			f.Owner = p.Tenant
+		}
+	}
+	page, err := h.Repo.ListAccounts(r.Context(), f)
 	if err != nil {
-		http.Error(w, err.Error(), 500)
+		writeError(w, r, err)
 		return
 	}
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]string{"id": id.String()})
+	writeJSON(w, http.StatusOK, page)
 }
 
-// getAccount handles HTTP requests to retrieve the balance of an account by its ID.
-// It expects the account ID as a URL parameter, validates it, and fetches the account balance
-// from the repository. If successful, it responds with a JSON object containing the balance.
-// Returns a 400 error if the ID is invalid, or a 500 error if the repository operation fails.
+// getAccount handles HTTP requests to retrieve an account by its ID.
+// It expects the account ID as a URL parameter, validates it, and fetches the account from the
+// repository. If successful, it responds with the account, including its balance.
+// Errors are reported as problem+json: 400 if the ID is invalid, 403 if the caller may not access
+// the account, 404 if the account does not exist, or 500 if the repository operation fails.
 func (h *Handlers) getAccount(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
 	id, err := uuid.Parse(idStr)
 	if err != nil {
-		http.Error(w, "invalid id", 400)
+		badRequest(w, r, "invalid account id")
+		return
+	}
+	if !h.allowAccount(w, r, id) {
 		return
 	}
-	bal, err := h.Repo.GetAccount(r.Context(), id)
+	acc, err := h.Repo.GetAccount(r.Context(), id)
 	if err != nil {
-		http.Error(w, err.Error(), 500)
+		writeError(w, r, err)
 		return
 	}
-	json.NewEncoder(w).Encode(map[string]int64{"balance": bal})
+	writeJSON(w, http.StatusOK, acc)
 }
 
-// enqueueTx handles HTTP requests to enqueue a transaction message for processing.
-// It expects a JSON payload containing account_id, type, amount, and an optional idempotency_key.
-// If idempotency_key is not provided in the payload or headers, a new UUID is generated.
-// The transaction message is published to the queue, and a response is returned with the status and idempotency key.
-// Responds with 400 Bad Request on JSON decoding errors, 500 Internal Server Error on publishing failures,
-// and 202 Accepted on successful queuing.
+// enqueueTx handles HTTP requests to enqueue a transaction message for processing. It expects a
+// JSON payload containing account_id, type, amount, and an optional idempotency_key. If
+// idempotency_key is not provided in the payload or headers, a new UUID is generated. Callers
+// restricted to particular accounts get 403 for any other account, and callers over their daily
+// quota get 429; a transaction that cannot be queued is given back to the quota. Withdrawals from
+// opening accounts and keys reserved for opening transfers are refused with 422 (see
+// repo.CheckSubmission). The transaction message is published to the queue, and a response is
+// returned with the status and idempotency key. Responds with 400 Bad Request on JSON decoding
+// errors, 503 Service Unavailable on publishing failures, and 202 Accepted on successful queuing.
 func (h *Handlers) enqueueTx(w http.ResponseWriter, r *http.Request) {
 	type req struct {
 		AccountID      string `json:"account_id"`
@@ -123,7 +391,10 @@ func (h *Handlers) enqueueTx(w http.ResponseWriter, r *http.Request) {
 	}
 	var body req
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, err.Error(), 400)
+		badRequest(w, r, "malformed JSON body")
+		return
+	}
+	if !h.allowAccountID(w, r, body.AccountID) {
 		return
 	}
 	key := body.IdempotencyKey
@@ -133,22 +404,81 @@ func (h *Handlers) enqueueTx(w http.ResponseWriter, r *http.Request) {
 	if key == "" {
 		key = uuid.NewString()
 	}
+	debit := ""
+	if body.Type == "withdraw" {
+		debit = body.AccountID
+	}
+	if err := repo.CheckSubmission(debit, key, h.OpeningAccounts); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	refund, ok := h.consumeQuota(w, r, body.Amount)
+	if !ok {
+		return
+	}
 	msg := queue.TxMessage{AccountID: body.AccountID, Type: body.Type, Amount: body.Amount, Key: key, CreatedAt: time.Now()}
 	if err := h.Pub.Publish(r.Context(), msg); err != nil {
-		http.Error(w, err.Error(), 500)
+		refund()
+		writePublishError(w, r, err)
 		return
 	}
+	slog.InfoContext(r.Context(), "transaction queued",
+		"account_id", msg.AccountID, "type", msg.Type, "amount", msg.Amount, "idempotency_key", key)
 	w.WriteHeader(http.StatusAccepted)
 	json.NewEncoder(w).Encode(map[string]string{"status": "queued", "idempotency_key": key})
 }
 
-// enqueueTransfer handles HTTP requests to enqueue a money transfer operation.
-// It expects a JSON payload containing the source account ID, destination account ID,
-// transfer amount, and an optional idempotency key. If the idempotency key is not provided
-// in the payload, it attempts to read it from the "Idempotency-Key" header, or generates
-// a new UUID if none is found. The transfer request is published to a message queue for
-// asynchronous processing. Responds with HTTP 202 Accepted and returns the idempotency key
-// in the response body if successful, or an error message otherwise.
+// getTransaction handles HTTP requests for the status of the transaction or transfer submitted
+// with an idempotency key, like the gRPC GetTransactionStatus call: applied, with its account,
+// type, amount and time, once the worker has applied it, and not_applied while it is queued,
+// after it was rejected, or if it was never submitted. Only transactions on accounts the caller
+// may access are reported, and opening transfers to them; keys applied on other accounts are
+// not_applied, so callers cannot tell which keys other tenants use.
+func (h *Handlers) getTransaction(w http.ResponseWriter, r *http.Request) {
+	type resp struct {
+		IdempotencyKey string     `json:"idempotency_key"`
+		Status         string     `json:"status"`
+		AccountID      *uuid.UUID `json:"account_id,omitempty"`
+		Type           string     `json:"type,omitempty"`
+		Amount         int64      `json:"amount,omitempty"`
+		AppliedAt      *time.Time `json:"applied_at,omitempty"`
+	}
+	key := chi.URLParam(r, "key")
+	txs, err := h.Transactions.GetProcessedTransactions(r.Context(), key)
+	if err != nil && !errors.Is(err, repo.ErrTransactionNotFound) {
+		writeError(w, r, err)
+		return
+	}
+	for _, tx := range txs {
+		id := tx.AccountID
+		if opened, ok := repo.OpeningBalanceAccount(tx.IdempotencyKey); ok {
+			id = opened
+		}
+		reason, err := h.accountDenial(r.Context(), id)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		if reason != "" {
+			continue
+		}
+		writeJSON(w, http.StatusOK, resp{IdempotencyKey: key, Status: "applied", AccountID: &tx.AccountID,
+			Type: tx.Type, Amount: tx.Amount, AppliedAt: &tx.ProcessedAt})
+		return
+	}
+	writeJSON(w, http.StatusOK, resp{IdempotencyKey: key, Status: "not_applied"})
+}
+
+// enqueueTransfer handles HTTP requests to enqueue a money transfer operation. It expects a JSON
+// payload containing the source account ID, destination account ID, transfer amount, and an
+// optional idempotency key. If the idempotency key is not provided in the payload, it attempts to
+// read it from the "Idempotency-Key" header, or generates a new UUID if none is found. The transfer
+// request is published to a message queue for asynchronous processing. Callers restricted to
+// particular accounts may only transfer out of those accounts, and callers over their daily quota
+// get 429; a transfer that cannot be queued is given back to the quota. Transfers out of opening
+// accounts and keys reserved for opening transfers are refused with 422. Responds with HTTP 202
+// Accepted and returns the idempotency key in the response body if successful, or an error message
+// otherwise.
 func (h *Handlers) enqueueTransfer(w http.ResponseWriter, r *http.Request) {
 	type req struct {
 		FromAccountID  string `json:"from_account_id"`
@@ -158,7 +488,10 @@ func (h *Handlers) enqueueTransfer(w http.ResponseWriter, r *http.Request) {
 	}
 	var body req
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, err.Error(), 400)
+		badRequest(w, r, "malformed JSON body")
+		return
+	}
+	if !h.allowAccountID(w, r, body.FromAccountID) {
 		return
 	}
 	key := body.IdempotencyKey
@@ -168,26 +501,59 @@ func (h *Handlers) enqueueTransfer(w http.ResponseWriter, r *http.Request) {
 	if key == "" {
 		key = uuid.NewString()
 	}
+	if err := repo.CheckSubmission(body.FromAccountID, key, h.OpeningAccounts); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	refund, ok := h.consumeQuota(w, r, body.Amount)
+	if !ok {
+		return
+	}
 	msg := queue.TransferMessage{FromAccountID: body.FromAccountID, ToAccountID: body.ToAccountID, Amount: body.Amount, Key: key, CreatedAt: time.Now()}
 	if err := h.Pub.PublishTransfer(r.Context(), msg); err != nil {
-		http.Error(w, err.Error(), 500)
+		refund()
+		writePublishError(w, r, err)
 		return
 	}
+	slog.InfoContext(r.Context(), "transfer queued",
+		"from_account_id", msg.FromAccountID, "to_account_id", msg.ToAccountID, "amount", msg.Amount, "idempotency_key", key)
 	w.WriteHeader(http.StatusAccepted)
 	json.NewEncoder(w).Encode(map[string]string{"status": "queued", "idempotency_key": key})
 }
 
-// getLedger handles HTTP requests to retrieve a limited number of ledger transactions for a given ledger ID.
-// It extracts the "id" parameter from the URL, fetches up to 50 transactions from the LedgerRepo,
-// and responds with a JSON object containing the entries. If an error occurs during retrieval,
-// it responds with an HTTP 500 error and the error message.
+// getLedger handles HTTP requests to retrieve a limited number of ledger transactions for a given
+// ledger ID. It extracts the "id" parameter from the URL, fetches up to "limit" (default 50)
+// transactions from the LedgerRepo, and responds with a JSON object containing the entries. Invalid
+// IDs are rejected with 400 and retrieval failures are reported as a generic 500 problem.
 func (h *Handlers) getLedger(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		badRequest(w, r, "invalid account id")
+		return
+	}
+	if !h.allowAccount(w, r, id) {
+		return
+	}
 	limit := 50
-	entries, err := h.LedgerRepo.GetTransactions(r.Context(), id, limit)
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			badRequest(w, r, "limit must be a positive integer")
+			return
+		}
+		limit = n
+	}
+	entries, err := h.LedgerRepo.GetTransactions(r.Context(), id.String(), limit)
 	if err != nil {
-		http.Error(w, err.Error(), 500)
+		writeError(w, r, err)
 		return
 	}
 	json.NewEncoder(w).Encode(map[string]interface{}{"entries": entries})
 }
+
+// writeJSON encodes v as the JSON response body with the given status.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,1345 @@
+package handlers_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/Bharat0908/ledger/internal/http/auth"
+	handlers "github.com/Bharat0908/ledger/internal/http/handlers"
+	"github.com/Bharat0908/ledger/internal/http/problem"
+	"github.com/Bharat0908/ledger/internal/http/ratelimit"
+	"github.com/Bharat0908/ledger/internal/queue"
+	"github.com/Bharat0908/ledger/internal/repo"
+	"github.com/Bharat0908/ledger/internal/stream"
+)
+
+// fakeRepo is an in-memory AccountRepo and LedgerRepo whose calls can be made to fail.
+type fakeRepo struct {
+	accounts  map[uuid.UUID]repo.Account
+	entries   []map[string]interface{}
+	ledger    []repo.LedgerEntry
+	ledgerErr error
+	filter    repo.AccountFilter
+	err       error
+}
+
+func (f *fakeRepo) CreateAccount(ctx context.Context, in repo.NewAccount) (repo.Account, bool, error) {
+	if f.err != nil {
+		return repo.Account{}, false, f.err
+	}
+	for _, a := range f.accounts {
+		if in.ExternalRef != "" && a.ExternalRef == in.ExternalRef {
+			return a, false, nil
+		}
+	}
+	a := repo.Account{
+		ID: uuid.New(), Owner: in.Owner, Currency: in.Currency, Status: repo.StatusActive,
+		Type: in.Type, ExternalRef: in.ExternalRef, DisplayName: in.DisplayName, Metadata: in.Metadata,
+	}
+	f.accounts[a.ID] = a
+	return a, true, nil
+}
+
+func (f *fakeRepo) GetAccount(ctx context.Context, id uuid.UUID) (repo.Account, error) {
+	if f.err != nil {
+		return repo.Account{}, f.err
+	}
+	a, ok := f.accounts[id]
+	if !ok {
+		return repo.Account{}, repo.ErrNotFound
+	}
+	return a, nil
+}
+
+func (f *fakeRepo) ListAccounts(ctx context.Context, filter repo.AccountFilter) (repo.AccountPage, error) {
+	f.filter = filter
+	if f.err != nil {
+		return repo.AccountPage{}, f.err
+	}
+	page := repo.AccountPage{Accounts: []repo.Account{}}
+	for _, a := range f.accounts {
+		page.Accounts = append(page.Accounts, a)
+	}
+	page.Total = int64(len(page.Accounts))
+	return page, nil
+}
+
+func (f *fakeRepo) GetTransactions(ctx context.Context, accountID string, limit int) ([]map[string]interface{}, error) {
+	return nil, f.err
+}
+
+func (f *fakeRepo) GetTransactionsAfter(ctx context.Context, accountID, entryID string, limit int) ([]map[string]interface{}, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	for i, e := range f.entries {
+		if e["account_id"] == accountID && e["id"] == entryID {
+			rest := f.entries[i+1:]
+			if len(rest) > limit {
+				rest = rest[:limit]
+			}
+			return rest, nil
+		}
+	}
+	return nil, repo.ErrInvalidEventID
+}
+
+func (f *fakeRepo) ExportLedger(ctx context.Context, filter repo.LedgerFilter, fn func(repo.LedgerEntry) error) error {
+	for _, e := range f.ledger {
+		if filter.AccountID != "" && e.AccountID != filter.AccountID ||
+			!filter.From.IsZero() && e.CreatedAt.Before(filter.From) || !filter.To.IsZero() && !e.CreatedAt.Before(filter.To) {
+			continue
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return f.ledgerErr
+}
+
+// fakePublisher records published messages. Transfers keyed in refuse fail to publish.
+type fakePublisher struct {
+	txs       []queue.TxMessage
+	transfers []queue.TransferMessage
+	err       error
+	refuse    map[string]bool
+	batches   int
+}
+
+func (p *fakePublisher) Publish(ctx context.Context, msg queue.TxMessage) error {
+	p.txs = append(p.txs, msg)
+	return p.err
+}
+
+func (p *fakePublisher) PublishTransfer(ctx context.Context, msg queue.TransferMessage) error {
+	if p.refuse[msg.Key] {
+		return queue.ErrNotConfirmed
+	}
+	p.transfers = append(p.transfers, msg)
+	return p.err
+}
+
+func (p *fakePublisher) PublishTransfers(ctx context.Context, msgs []queue.TransferMessage) []error {
+	p.batches++
+	errs := make([]error, len(msgs))
+	for i, msg := range msgs {
+		errs[i] = p.PublishTransfer(ctx, msg)
+	}
+	return errs
+}
+
+func newTestHandlers() (*handlers.Handlers, *fakeRepo, *fakePublisher) {
+	r := &fakeRepo{accounts: map[uuid.UUID]repo.Account{}}
+	p := &fakePublisher{}
+	return handlers.New(p, r, r), r, p
+}
+
+func decodeProblem(t *testing.T, rec *httptest.ResponseRecorder) problem.Details {
+	t.Helper()
+	if ct := rec.Header().Get("Content-Type"); ct != problem.ContentType {
+		t.Fatalf("Content-Type = %q, want %q", ct, problem.ContentType)
+	}
+	var p problem.Details
+	if err := json.NewDecoder(rec.Body).Decode(&p); err != nil {
+		t.Fatalf("decode problem: %v", err)
+	}
+	return p
+}
+
+func TestHandlers_Errors(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		repoErr    error
+		pubErr     error
+		wantStatus int
+		wantCode   string
+	}{
+		{"invalid account id", http.MethodGet, "/v1/accounts/nope", "", nil, nil, http.StatusBadRequest, problem.CodeInvalidRequest},
+		{"account not found", http.MethodGet, "/v1/accounts/" + uuid.NewString(), "", nil, nil, http.StatusNotFound, "not_found"},
+		{"driver error is hidden", http.MethodGet, "/v1/accounts/" + uuid.NewString(), "", errors.New("pq: connection refused"), nil, http.StatusInternalServerError, problem.CodeInternal},
+		{"frozen account", http.MethodGet, "/v1/accounts/" + uuid.NewString(), "", repo.ErrAccountFrozen, nil, http.StatusConflict, "account_frozen"},
+		{"malformed body", http.MethodPost, "/v1/transactions", "{", nil, nil, http.StatusBadRequest, problem.CodeInvalidRequest},
+		{"queue down", http.MethodPost, "/v1/transfers", `{"from_account_id":"a","to_account_id":"b","amount":1}`, nil, errors.New("amqp closed"), http.StatusServiceUnavailable, problem.CodeQueueUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, r, p := newTestHandlers()
+			r.err, p.err = tt.repoErr, tt.pubErr
+			rec := httptest.NewRecorder()
+			h.Routes().ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			got := decodeProblem(t, rec)
+			if got.Code != tt.wantCode || got.Status != tt.wantStatus || got.Type != "/problems/"+tt.wantCode {
+				t.Errorf("problem = %+v, want code %q", got, tt.wantCode)
+			}
+			if strings.Contains(got.Detail, "pq:") || strings.Contains(got.Detail, "amqp") {
+				t.Errorf("problem detail leaks driver error: %q", got.Detail)
+			}
+		})
+	}
+}
+
+func TestHandlers_CreateAccount(t *testing.T) {
+	h, r, _ := newTestHandlers()
+	body := `{"owner":"alice","currency":"INR","initial_balance":0,"external_ref":"crm-42","type":"liability","display_name":"Alice","metadata":{"tier":"gold"}}`
+
+	post := func() (*httptest.ResponseRecorder, repo.Account) {
+		rec := httptest.NewRecorder()
+		h.Routes().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/accounts", strings.NewReader(body)))
+		var got repo.Account
+		if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+			t.Fatalf("decode account: %v", err)
+		}
+		return rec, got
+	}
+
+	rec, first := post()
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("first create status = %d, want %d", rec.Code, http.StatusCreated)
+	}
+	stored := r.accounts[first.ID]
+	if stored.Owner != "alice" || stored.Currency != "INR" || stored.Type != "liability" || stored.Metadata["tier"] != "gold" {
+		t.Errorf("stored account = %+v, want owner alice, currency INR, type liability, metadata tier=gold", stored)
+	}
+
+	rec, again := post()
+	if rec.Code != http.StatusOK || again.ID != first.ID {
+		t.Errorf("retried create = %d %v, want %d %v", rec.Code, again.ID, http.StatusOK, first.ID)
+	}
+	if len(r.accounts) != 1 {
+		t.Errorf("repo holds %d accounts, want 1", len(r.accounts))
+	}
+}
+
+func TestHandlers_CreateAccount_OpeningBalance(t *testing.T) {
+	configured := uuid.New()
+	tests := []struct {
+		name     string
+		opening  map[string]uuid.UUID
+		wantFrom func(r *fakeRepo) uuid.UUID
+	}{
+		{"configured equity account", map[string]uuid.UUID{"USD": configured}, func(*fakeRepo) uuid.UUID { return configured }},
+		{"system equity account", nil, func(r *fakeRepo) uuid.UUID {
+			for id, a := range r.accounts {
+				if a.ExternalRef == "opening-equity:USD" && a.Type == repo.TypeEquity {
+					return id
+				}
+			}
+			t.Fatal("system equity account was not provisioned")
+			return uuid.Nil
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, r, p := newTestHandlers()
+			h.OpeningAccounts = tt.opening
+			body := `{"owner":"alice","currency":"USD","initial_balance":250,"external_ref":"crm-7"}`
+			var keys []string
+			for i := 0; i < 2; i++ {
+				rec := httptest.NewRecorder()
+				h.Routes().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/accounts", strings.NewReader(body)))
+				var got struct {
+					repo.Account
+					OpeningTransfer struct {
+						IdempotencyKey string `json:"idempotency_key"`
+					} `json:"opening_transfer"`
+				}
+				if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+					t.Fatalf("decode account: %v", err)
+				}
+				if got.Balance != 0 {
+					t.Errorf("create #%d balance = %d, want 0 until the opening transfer is applied", i, got.Balance)
+				}
+				if want := repo.OpeningBalanceKey(got.ID); got.OpeningTransfer.IdempotencyKey != want {
+					t.Errorf("create #%d opening key = %q, want %q", i, got.OpeningTransfer.IdempotencyKey, want)
+				}
+				keys = append(keys, got.OpeningTransfer.IdempotencyKey)
+			}
+			if len(p.transfers) != 2 || keys[0] != keys[1] {
+				t.Fatalf("published %d opening transfers with keys %v, want 2 with the same key", len(p.transfers), keys)
+			}
+			msg := p.transfers[0]
+			if msg.FromAccountID != tt.wantFrom(r).String() || msg.Amount != 250 || msg.Key != keys[0] {
+				t.Errorf("opening transfer = %+v, want 250 from the equity account", msg)
+			}
+		})
+	}
+}
+
+func TestHandlers_CreateAccount_RetryAfterPublishFailure(t *testing.T) {
+	h, r, p := newTestHandlers()
+	body := `{"owner":"alice","currency":"USD","initial_balance":250,"external_ref":"crm-9"}`
+	post := func() int {
+		rec := httptest.NewRecorder()
+		h.Routes().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/accounts", strings.NewReader(body)))
+		return rec.Code
+	}
+	p.err = errors.New("amqp closed")
+	if got := post(); got != http.StatusServiceUnavailable {
+		t.Fatalf("create with the queue down status = %d, want %d", got, http.StatusServiceUnavailable)
+	}
+	p.err, p.transfers = nil, nil
+	if got := post(); got != http.StatusOK {
+		t.Fatalf("retried create status = %d, want %d", got, http.StatusOK)
+	}
+	var customers int
+	for _, a := range r.accounts {
+		if a.Owner == "alice" {
+			customers++
+		}
+	}
+	if customers != 1 || len(p.transfers) != 1 || p.transfers[0].Amount != 250 {
+		t.Errorf("after the retry: %d accounts of alice and opening transfers %+v, want 1 account funded with 250", customers, p.transfers)
+	}
+}
+
+func TestHandlers_OpeningAccounts(t *testing.T) {
+	opening, other := uuid.New(), uuid.NewString()
+	tests := []struct {
+		name       string
+		path       string
+		body       string
+		wantStatus int
+		wantCode   string
+	}{
+		{"equity account", "/v1/accounts", `{"owner":"alice","currency":"USD","initial_balance":0,"type":"equity"}`, http.StatusUnprocessableEntity, repo.ErrInvalidAccountType.Code},
+		{"opening balance without external ref", "/v1/accounts", `{"owner":"alice","currency":"USD","initial_balance":10}`, http.StatusUnprocessableEntity, repo.ErrExternalRefRequired.Code},
+		{"reserved external ref", "/v1/accounts", `{"owner":"system","currency":"USD","initial_balance":0,"external_ref":"opening-equity:USD"}`, http.StatusUnprocessableEntity, repo.ErrReservedExternalRef.Code},
+		{"withdrawal from an opening account", "/v1/transactions", `{"account_id":"` + opening.String() + `","type":"withdraw","amount":1}`, http.StatusUnprocessableEntity, repo.ErrOpeningAccount.Code},
+		{"transfer out of an opening account", "/v1/transfers", `{"from_account_id":"` + opening.String() + `","to_account_id":"` + other + `","amount":1}`, http.StatusUnprocessableEntity, repo.ErrOpeningAccount.Code},
+		{"reserved key", "/v1/transfers", `{"from_account_id":"` + other + `","to_account_id":"` + opening.String() + `","amount":1,"idempotency_key":"opening:` + other + `"}`, http.StatusUnprocessableEntity, repo.ErrReservedKey.Code},
+		{"deposit to an opening account", "/v1/transactions", `{"account_id":"` + opening.String() + `","type":"deposit","amount":1}`, http.StatusAccepted, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, r, p := newTestHandlers()
+			h.OpeningAccounts = map[string]uuid.UUID{"USD": opening}
+			rec := httptest.NewRecorder()
+			h.Routes().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body)))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantCode == "" {
+				return
+			}
+			if got := decodeProblem(t, rec); got.Code != tt.wantCode {
+				t.Errorf("problem code = %q, want %q", got.Code, tt.wantCode)
+			}
+			if len(r.accounts) != 0 || len(p.txs) != 0 || len(p.transfers) != 0 {
+				t.Errorf("refused request stored %d accounts and published %d messages", len(r.accounts), len(p.txs)+len(p.transfers))
+			}
+		})
+	}
+}
+
+func TestHandlers_ListAccounts(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		repoErr    error
+		wantStatus int
+		wantFilter repo.AccountFilter
+	}{
+		{
+			name:       "all filters",
+			query:      "?owner=alice&currency=USD&status=active&created_from=2024-01-01T00:00:00Z&created_to=2024-02-01T00:00:00Z&metadata=tier:gold&metadata=region:eu&sort=-balance&limit=10&cursor=abc",
+			wantStatus: http.StatusOK,
+			wantFilter: repo.AccountFilter{
+				Owner: "alice", Currency: "USD", Status: "active",
+				CreatedFrom: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), CreatedTo: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+				Metadata: map[string]string{"tier": "gold", "region": "eu"}, Sort: "-balance", Limit: 10, Cursor: "abc",
+			},
+		},
+		{name: "no filters", wantStatus: http.StatusOK},
+		{name: "bad created_from", query: "?created_from=yesterday", wantStatus: http.StatusBadRequest},
+		{name: "bad metadata", query: "?metadata=gold", wantStatus: http.StatusBadRequest},
+		{name: "bad limit", query: "?limit=0", wantStatus: http.StatusBadRequest},
+		{name: "stale cursor", query: "?cursor=x", repoErr: repo.ErrInvalidCursor, wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, r, _ := newTestHandlers()
+			r.err = tt.repoErr
+			rec := httptest.NewRecorder()
+			h.Routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/accounts"+tt.query, nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %s)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if !reflect.DeepEqual(r.filter, tt.wantFilter) {
+				t.Errorf("filter = %+v, want %+v", r.filter, tt.wantFilter)
+			}
+			var page repo.AccountPage
+			if err := json.NewDecoder(rec.Body).Decode(&page); err != nil || page.Accounts == nil {
+				t.Errorf("decode page = %+v, %v; want accounts array", page, err)
+			}
+		})
+	}
+}
+
+// fakeKeys is an in-memory KeyRepo.
+type fakeKeys struct{ keys []repo.APIKey }
+
+func (f *fakeKeys) CreateAPIKey(ctx context.Context, in repo.NewAPIKey) (repo.APIKey, error) {
+	if len(in.Scopes) == 0 {
+		return repo.APIKey{}, repo.ErrInvalidAPIKey
+	}
+	k := repo.APIKey{ID: uuid.New(), Name: in.Name, Prefix: in.Prefix, Hash: in.Hash, Scopes: in.Scopes, AccountIDs: in.AccountIDs,
+		SigningSecret: in.SigningSecret, SignedRequests: len(in.SigningSecret) > 0}
+	f.keys = append(f.keys, k)
+	return k, nil
+}
+
+func (f *fakeKeys) ListAPIKeys(ctx context.Context) ([]repo.APIKey, error) { return f.keys, nil }
+
+func (f *fakeKeys) RevokeAPIKey(ctx context.Context, id uuid.UUID) (repo.APIKey, error) {
+	for i, k := range f.keys {
+		if k.ID == id {
+			now := time.Now()
+			f.keys[i].RevokedAt = &now
+			return f.keys[i], nil
+		}
+	}
+	return repo.APIKey{}, repo.ErrAPIKeyNotFound
+}
+
+// as returns a middleware authenticating every request as p.
+func as(p *auth.Principal) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(auth.NewContext(r.Context(), p)))
+		})
+	}
+}
+
+func TestHandlers_Authorization(t *testing.T) {
+	mine, other := uuid.New(), uuid.New()
+	restricted := &auth.Principal{Scopes: []string{auth.ScopeAccountsRead, auth.ScopeTransactionsWrite}, Accounts: []uuid.UUID{mine}}
+	readOnly := &auth.Principal{Scopes: []string{auth.ScopeAccountsRead}}
+	tests := []struct {
+		name       string
+		p          *auth.Principal
+		method     string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{"own account", restricted, http.MethodGet, "/v1/accounts/" + mine.String(), "", http.StatusOK},
+		{"other account", restricted, http.MethodGet, "/v1/accounts/" + other.String(), "", http.StatusForbidden},
+		{"other ledger", restricted, http.MethodGet, "/v1/accounts/" + other.String() + "/ledger", "", http.StatusForbidden},
+		{"deposit to own account", restricted, http.MethodPost, "/v1/transactions", `{"account_id":"` + mine.String() + `","type":"deposit","amount":1}`, http.StatusAccepted},
+		{"deposit to other account", restricted, http.MethodPost, "/v1/transactions", `{"account_id":"` + other.String() + `","type":"deposit","amount":1}`, http.StatusForbidden},
+		{"transfer out of own account", restricted, http.MethodPost, "/v1/transfers", `{"from_account_id":"` + mine.String() + `","to_account_id":"` + other.String() + `","amount":1}`, http.StatusAccepted},
+		{"transfer out of other account", restricted, http.MethodPost, "/v1/transfers", `{"from_account_id":"` + other.String() + `","to_account_id":"` + mine.String() + `","amount":1}`, http.StatusForbidden},
+		{"create without accounts:write", readOnly, http.MethodPost, "/v1/accounts", `{"owner":"a","currency":"USD","initial_balance":0}`, http.StatusForbidden},
+		{"deposit without transactions:write", readOnly, http.MethodPost, "/v1/transactions", `{"account_id":"` + mine.String() + `","type":"deposit","amount":1}`, http.StatusForbidden},
+		{"admin endpoint without admin", restricted, http.MethodGet, "/v1/admin/api-keys", "", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, r, _ := newTestHandlers()
+			h.Auth, h.Keys = as(tt.p), &fakeKeys{}
+			r.accounts[mine] = repo.Account{ID: mine}
+			r.accounts[other] = repo.Account{ID: other}
+			rec := httptest.NewRecorder()
+			h.Routes().ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %s)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantStatus == http.StatusForbidden {
+				if p := decodeProblem(t, rec); p.Code != problem.CodeForbidden {
+					t.Errorf("problem code = %q, want %q", p.Code, problem.CodeForbidden)
+				}
+			}
+		})
+	}
+
+	t.Run("restricted listing", func(t *testing.T) {
+		h, r, _ := newTestHandlers()
+		h.Auth = as(restricted)
+		rec := httptest.NewRecorder()
+		h.Routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/accounts", nil))
+		if rec.Code != http.StatusOK || len(r.filter.IDs) != 1 || r.filter.IDs[0] != mine {
+			t.Errorf("list = %d with IDs %v, want 200 restricted to %v", rec.Code, r.filter.IDs, mine)
+		}
+	})
+}
+
+func TestHandlers_TenantIsolation(t *testing.T) {
+	mine, other := uuid.New(), uuid.New()
+	tenant := &auth.Principal{Scopes: []string{auth.ScopeAccountsRead, auth.ScopeAccountsWrite, auth.ScopeTransactionsWrite}, Tenant: "acme"}
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{"own account", http.MethodGet, "/v1/accounts/" + mine.String(), "", http.StatusOK},
+		{"other tenant's account", http.MethodGet, "/v1/accounts/" + other.String(), "", http.StatusForbidden},
+		{"other tenant's ledger", http.MethodGet, "/v1/accounts/" + other.String() + "/ledger", "", http.StatusForbidden},
+		{"unknown account", http.MethodGet, "/v1/accounts/" + uuid.NewString(), "", http.StatusNotFound},
+		{"deposit to other tenant", http.MethodPost, "/v1/transactions", `{"account_id":"` + other.String() + `","type":"deposit","amount":1}`, http.StatusForbidden},
+		{"transfer out of own account", http.MethodPost, "/v1/transfers", `{"from_account_id":"` + mine.String() + `","to_account_id":"` + other.String() + `","amount":1}`, http.StatusAccepted},
+		{"transfer out of other tenant", http.MethodPost, "/v1/transfers", `{"from_account_id":"` + other.String() + `","to_account_id":"` + mine.String() + `","amount":1}`, http.StatusForbidden},
+		{"create for own tenant", http.MethodPost, "/v1/accounts", `{"owner":"acme","currency":"USD","initial_balance":0}`, http.StatusCreated},
+		{"create for other tenant", http.MethodPost, "/v1/accounts", `{"owner":"globex","currency":"USD","initial_balance":0}`, http.StatusForbidden},
+		{"list other tenant", http.MethodGet, "/v1/accounts?owner=globex", "", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, r, _ := newTestHandlers()
+			h.Auth = as(tenant)
+			r.accounts[mine] = repo.Account{ID: mine, Owner: "acme"}
+			r.accounts[other] = repo.Account{ID: other, Owner: "globex"}
+			rec := httptest.NewRecorder()
+			h.Routes().ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %s)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+		})
+	}
+
+	t.Run("listing is scoped to the tenant", func(t *testing.T) {
+		h, r, _ := newTestHandlers()
+		h.Auth = as(tenant)
+		rec := httptest.NewRecorder()
+		h.Routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/accounts", nil))
+		if rec.Code != http.StatusOK || r.filter.Owner != "acme" {
+			t.Errorf("list = %d with owner %q, want 200 scoped to acme", rec.Code, r.filter.Owner)
+		}
+	})
+}
+
+func TestHandlers_APIKeyAdmin(t *testing.T) {
+	h, _, _ := newTestHandlers()
+	keys := &fakeKeys{}
+	h.Auth, h.Keys = as(&auth.Principal{Scopes: []string{auth.ScopeAdmin}}), keys
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.Routes().ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+
+	rec := do(http.MethodPost, "/v1/admin/api-keys", `{"name":"ops","scopes":["accounts:read"]}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create status = %d, want %d (body %s)", rec.Code, http.StatusCreated, rec.Body.String())
+	}
+	var created struct {
+		ID     uuid.UUID `json:"id"`
+		Key    string    `json:"key"`
+		Prefix string    `json:"prefix"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&created); err != nil {
+		t.Fatalf("decode key: %v", err)
+	}
+	if !strings.HasPrefix(created.Key, auth.KeyPrefix) || !strings.HasPrefix(created.Key, created.Prefix) {
+		t.Errorf("issued key %q with prefix %q, want %s... sharing the prefix", created.Key, created.Prefix, auth.KeyPrefix)
+	}
+	if string(keys.keys[0].Hash) != string(auth.HashKey(created.Key)) {
+		t.Error("stored hash does not match the issued key")
+	}
+	if strings.Contains(do(http.MethodGet, "/v1/admin/api-keys", "").Body.String(), created.Key) {
+		t.Error("listing exposes the key")
+	}
+	if keys.keys[0].SignedRequests {
+		t.Error("unsigned key was given a signing secret")
+	}
+
+	rec = do(http.MethodPost, "/v1/admin/api-keys", `{"name":"partner","scopes":["accounts:read"],"signed_requests":true}`)
+	var signed struct {
+		SigningSecret  string `json:"signing_secret"`
+		SignedRequests bool   `json:"signed_requests"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&signed); err != nil || rec.Code != http.StatusCreated {
+		t.Fatalf("create signed key = %d, %v", rec.Code, err)
+	}
+	if !signed.SignedRequests || !strings.HasPrefix(signed.SigningSecret, auth.SecretPrefix) || string(keys.keys[1].SigningSecret) != signed.SigningSecret {
+		t.Errorf("signed key = %+v, want a stored %s... secret", signed, auth.SecretPrefix)
+	}
+	if strings.Contains(do(http.MethodGet, "/v1/admin/api-keys", "").Body.String(), signed.SigningSecret) {
+		t.Error("listing exposes the signing secret")
+	}
+	if rec := do(http.MethodPost, "/v1/admin/api-keys", `{"name":"x","scopes":["everything"]}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown scope status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if rec := do(http.MethodDelete, "/v1/admin/api-keys/"+created.ID.String(), ""); rec.Code != http.StatusOK || !keys.keys[0].Revoked() {
+		t.Errorf("revoke status = %d (revoked %v), want %d", rec.Code, keys.keys[0].Revoked(), http.StatusOK)
+	}
+	if rec := do(http.MethodDelete, "/v1/admin/api-keys/"+uuid.NewString(), ""); rec.Code != http.StatusNotFound {
+		t.Errorf("revoke unknown status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+// fakeQuotas counts usage per client, ignoring the day.
+type fakeQuotas map[string]repo.QuotaUsage
+
+func (f fakeQuotas) ConsumeQuota(ctx context.Context, client string, at time.Time, amount int64, lim repo.QuotaLimits) (repo.QuotaUsage, error) {
+	u := f[client]
+	u.Count, u.Amount = u.Count+1, u.Amount+amount
+	if (lim.DailyCount > 0 && u.Count > lim.DailyCount) || (lim.DailyAmount > 0 && u.Amount > lim.DailyAmount) {
+		return repo.QuotaUsage{}, repo.ErrQuotaExceeded
+	}
+	f[client] = u
+	return u, nil
+}
+
+func (f fakeQuotas) ConsumeQuotaBatch(ctx context.Context, client string, at time.Time, count, amount int64, lim repo.QuotaLimits) (repo.QuotaUsage, error) {
+	u := f[client]
+	u.Count, u.Amount = u.Count+count, u.Amount+amount
+	if (lim.DailyCount > 0 && u.Count > lim.DailyCount) || (lim.DailyAmount > 0 && u.Amount > lim.DailyAmount) {
+		return repo.QuotaUsage{}, repo.ErrQuotaExceeded
+	}
+	f[client] = u
+	return u, nil
+}
+
+func (f fakeQuotas) RefundQuota(ctx context.Context, client string, at time.Time, count, amount int64) error {
+	u := f[client]
+	u.Count, u.Amount = max(u.Count-count, 0), max(u.Amount-amount, 0)
+	f[client] = u
+	return nil
+}
+
+func TestHandlers_RateLimitsAndQuotas(t *testing.T) {
+	acc := uuid.New()
+	deposit := func(amount int) string {
+		return fmt.Sprintf(`{"account_id":"%s","type":"deposit","amount":%d}`, acc, amount)
+	}
+	do := func(h *handlers.Handlers, p *auth.Principal, method, path, body string) *httptest.ResponseRecorder {
+		h.Auth = as(p)
+		rec := httptest.NewRecorder()
+		h.Routes().ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+	alice := &auth.Principal{Subject: "api-key:alice", Scopes: []string{auth.ScopeAdmin}}
+	bob := &auth.Principal{Subject: "api-key:bob", Scopes: []string{auth.ScopeAdmin}}
+
+	t.Run("write limit", func(t *testing.T) {
+		h, _, _ := newTestHandlers()
+		h.WriteLimit = &ratelimit.Limiter{Rate: 0.001, Burst: 2}
+		for i := 0; i < 2; i++ {
+			if rec := do(h, alice, http.MethodPost, "/v1/transactions", deposit(1)); rec.Code != http.StatusAccepted {
+				t.Fatalf("request %d status = %d, want %d", i, rec.Code, http.StatusAccepted)
+			}
+		}
+		rec := do(h, alice, http.MethodPost, "/v1/transactions", deposit(1))
+		if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+			t.Fatalf("over limit = %d with Retry-After %q, want 429 with Retry-After", rec.Code, rec.Header().Get("Retry-After"))
+		}
+		if p := decodeProblem(t, rec); p.Code != problem.CodeRateLimited {
+			t.Errorf("problem code = %q, want %q", p.Code, problem.CodeRateLimited)
+		}
+		if rec := do(h, bob, http.MethodPost, "/v1/transactions", deposit(1)); rec.Code != http.StatusAccepted {
+			t.Errorf("other client status = %d, want %d", rec.Code, http.StatusAccepted)
+		}
+		if rec := do(h, alice, http.MethodGet, "/v1/accounts", ""); rec.Code != http.StatusOK {
+			t.Errorf("read after write limit status = %d, want %d", rec.Code, http.StatusOK)
+		}
+	})
+
+	t.Run("daily quota", func(t *testing.T) {
+		h, _, pub := newTestHandlers()
+		h.Quotas, h.QuotaLimits = fakeQuotas{}, repo.QuotaLimits{DailyAmount: 500}
+		if rec := do(h, alice, http.MethodPost, "/v1/transactions", deposit(400)); rec.Code != http.StatusAccepted {
+			t.Fatalf("within quota status = %d, want %d", rec.Code, http.StatusAccepted)
+		}
+		rec := do(h, alice, http.MethodPost, "/v1/transfers", fmt.Sprintf(`{"from_account_id":"%s","to_account_id":"%s","amount":200}`, acc, uuid.New()))
+		if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+			t.Fatalf("over quota = %d with Retry-After %q, want 429 with Retry-After", rec.Code, rec.Header().Get("Retry-After"))
+		}
+		if p := decodeProblem(t, rec); p.Code != repo.ErrQuotaExceeded.Code {
+			t.Errorf("problem code = %q, want %q", p.Code, repo.ErrQuotaExceeded.Code)
+		}
+		if len(pub.transfers) != 0 {
+			t.Error("transfer over quota was published")
+		}
+		if rec := do(h, bob, http.MethodPost, "/v1/transactions", deposit(400)); rec.Code != http.StatusAccepted {
+			t.Errorf("other client status = %d, want %d", rec.Code, http.StatusAccepted)
+		}
+	})
+
+	t.Run("quota given back when the queue is down", func(t *testing.T) {
+		h, _, pub := newTestHandlers()
+		quotas := fakeQuotas{}
+		h.Quotas, h.QuotaLimits = quotas, repo.QuotaLimits{DailyAmount: 500}
+		pub.err = errors.New("broker down")
+		for _, req := range []struct{ path, body string }{
+			{"/v1/transactions", deposit(400)},
+			{"/v1/transfers", fmt.Sprintf(`{"from_account_id":"%s","to_account_id":"%s","amount":400}`, acc, uuid.New())},
+		} {
+			if rec := do(h, alice, http.MethodPost, req.path, req.body); rec.Code != http.StatusServiceUnavailable {
+				t.Fatalf("%s with the queue down status = %d, want %d", req.path, rec.Code, http.StatusServiceUnavailable)
+			}
+			if u := quotas[alice.Subject]; u.Count != 0 || u.Amount != 0 {
+				t.Errorf("%s with the queue down left %+v charged, want nothing", req.path, u)
+			}
+		}
+		pub.err = nil
+		if rec := do(h, alice, http.MethodPost, "/v1/transactions", deposit(500)); rec.Code != http.StatusAccepted {
+			t.Errorf("status after the queue is back = %d, want %d", rec.Code, http.StatusAccepted)
+		}
+	})
+}
+
+func TestHandlers_Webhooks(t *testing.T) {
+	ctx := context.Background()
+	store, err := repo.OpenSQLite(ctx, ":memory:")
+	if err != nil {
+		t.Fatalf("OpenSQLite() failed: %v", err)
+	}
+	defer store.DB.Close()
+	mine, theirs := uuid.New(), uuid.New()
+	acme := &auth.Principal{Subject: "jwt:svc-billing", Scopes: []string{auth.ScopeWebhooksManage}, Tenant: "acme"}
+	globex := &auth.Principal{Subject: "api-key:globex", Scopes: []string{auth.ScopeWebhooksManage}}
+	admin := &auth.Principal{Subject: "api-key:ops", Scopes: []string{auth.ScopeAdmin}}
+	do := func(p *auth.Principal, method, path, body string) *httptest.ResponseRecorder {
+		h, r, _ := newTestHandlers()
+		h.Auth, h.Webhooks = as(p), store
+		r.accounts[mine] = repo.Account{ID: mine, Owner: "acme"}
+		r.accounts[theirs] = repo.Account{ID: theirs, Owner: "globex"}
+		rec := httptest.NewRecorder()
+		h.Routes().ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+
+	refused := []struct {
+		name       string
+		p          *auth.Principal
+		body       string
+		wantStatus int
+	}{
+		{"without webhooks:manage", &auth.Principal{Scopes: []string{auth.ScopeAccountsRead}}, `{"url":"https://a.example","event_types":["transaction.applied"]}`, http.StatusForbidden},
+		{"tenant watching every account", acme, `{"url":"https://a.example","event_types":["transaction.applied"]}`, http.StatusForbidden},
+		{"tenant watching another tenant", acme, `{"url":"https://a.example","event_types":["transaction.applied"],"account_ids":["` + theirs.String() + `"]}`, http.StatusForbidden},
+		{"tenant watching an unknown account", acme, `{"url":"https://a.example","event_types":["transaction.applied"],"account_ids":["` + uuid.NewString() + `"]}`, http.StatusForbidden},
+		{"unknown event type", globex, `{"url":"https://a.example","event_types":["account.deleted"]}`, http.StatusBadRequest},
+		{"relative url", globex, `{"url":"/hook","event_types":["transaction.applied"]}`, http.StatusBadRequest},
+		{"metadata address", globex, `{"url":"http://169.254.169.254/latest/meta-data","event_types":["transaction.applied"]}`, http.StatusBadRequest},
+		{"loopback address", globex, `{"url":"http://127.0.0.1:8081/admin","event_types":["transaction.applied"]}`, http.StatusBadRequest},
+		{"ipv6 loopback", globex, `{"url":"http://[::1]/hook","event_types":["transaction.applied"]}`, http.StatusBadRequest},
+		{"private address", globex, `{"url":"https://10.0.0.5/hook","event_types":["transaction.applied"]}`, http.StatusBadRequest},
+		{"localhost", globex, `{"url":"http://localhost:5432","event_types":["transaction.applied"]}`, http.StatusBadRequest},
+		{"short secret", globex, `{"url":"https://a.example","event_types":["transaction.applied"],"secret":"short"}`, http.StatusBadRequest},
+		{"no event types", globex, `{"url":"https://a.example","event_types":[]}`, http.StatusUnprocessableEntity},
+	}
+	for _, tt := range refused {
+		if rec := do(tt.p, http.MethodPost, "/v1/webhooks", tt.body); rec.Code != tt.wantStatus {
+			t.Errorf("%s: status = %d, want %d (body %s)", tt.name, rec.Code, tt.wantStatus, rec.Body.String())
+		}
+	}
+
+	rec := do(acme, http.MethodPost, "/v1/webhooks", `{"url":"https://acme.example/hook","event_types":["transaction.applied"],"account_ids":["`+mine.String()+`"]}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create status = %d, want %d (body %s)", rec.Code, http.StatusCreated, rec.Body.String())
+	}
+	var created struct {
+		repo.Webhook
+		Secret string `json:"secret"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&created); err != nil {
+		t.Fatalf("decode webhook: %v", err)
+	}
+	stored, err := store.GetWebhook(ctx, created.ID)
+	if err != nil || created.Owner != "tenant:acme" || !strings.HasPrefix(created.Secret, "whsec_") || string(stored.Secret) != created.Secret {
+		t.Fatalf("created %+v (stored %+v, %v), want an acme webhook with a generated secret", created, stored, err)
+	}
+	if rec := do(globex, http.MethodPost, "/v1/webhooks", `{"url":"https://globex.example","event_types":["account.balance_changed"],"secret":"0123456789abcdef"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("create with own secret status = %d (body %s)", rec.Code, rec.Body.String())
+	}
+
+	path := "/v1/webhooks/" + created.ID.String()
+	for _, tt := range []struct {
+		name      string
+		p         *auth.Principal
+		wantCount int
+	}{{"owner", acme, 1}, {"other client", globex, 1}, {"admin", admin, 2}} {
+		rec := do(tt.p, http.MethodGet, "/v1/webhooks", "")
+		var list struct {
+			Webhooks []repo.Webhook `json:"webhooks"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&list); err != nil || len(list.Webhooks) != tt.wantCount {
+			t.Errorf("%s: listed %+v, %v; want %d webhooks", tt.name, list.Webhooks, err, tt.wantCount)
+		}
+	}
+	if rec := do(acme, http.MethodGet, path, ""); rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), created.Secret) {
+		t.Errorf("get status = %d (body %s), want 200 without the secret", rec.Code, rec.Body.String())
+	}
+	if rec := do(globex, http.MethodGet, path, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("get by another client status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	eventID := uuid.NewString()
+	if err := store.EnqueueWebhookDeliveries(ctx, []repo.NewWebhookDelivery{{WebhookID: created.ID, EventID: eventID, EventType: "transaction.applied", Payload: []byte(`{}`)}}); err != nil {
+		t.Fatalf("EnqueueWebhookDeliveries() failed: %v", err)
+	}
+	rec = do(acme, http.MethodGet, path+"/deliveries", "")
+	var log struct {
+		Deliveries []repo.WebhookDelivery `json:"deliveries"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&log); err != nil || len(log.Deliveries) != 1 || log.Deliveries[0].EventID != eventID {
+		t.Fatalf("deliveries = %+v, %v; want the queued event", log.Deliveries, err)
+	}
+	if rec := do(acme, http.MethodGet, path+"/deliveries?limit=0", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("deliveries with limit=0 status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	redeliver := path + "/deliveries/" + log.Deliveries[0].ID.String() + "/redeliver"
+	if rec := do(acme, http.MethodPost, redeliver, ""); rec.Code != http.StatusAccepted {
+		t.Errorf("redeliver status = %d, want %d (body %s)", rec.Code, http.StatusAccepted, rec.Body.String())
+	}
+	if rec := do(globex, http.MethodPost, redeliver, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("redeliver by another client status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if rec := do(acme, http.MethodPost, path+"/deliveries/"+uuid.NewString()+"/redeliver", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("redeliver unknown status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	if rec := do(globex, http.MethodDelete, path, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("delete by another client status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if rec := do(acme, http.MethodDelete, path, ""); rec.Code != http.StatusNoContent {
+		t.Errorf("delete status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+	if rec := do(acme, http.MethodGet, path, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("get deleted status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	h, _, _ := newTestHandlers()
+	h.Auth, h.Webhooks = as(globex), store
+	h.WebhookAllowedNetworks = []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+	rec = httptest.NewRecorder()
+	h.Routes().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/webhooks", strings.NewReader(`{"url":"https://10.0.0.5/hook","event_types":["transaction.applied"]}`)))
+	if rec.Code != http.StatusCreated {
+		t.Errorf("create for an allowed network status = %d, want %d (body %s)", rec.Code, http.StatusCreated, rec.Body.String())
+	}
+}
+
+func TestHandlers_EventStream(t *testing.T) {
+	h, r, _ := newTestHandlers()
+	broker := &stream.Broker{}
+	h.Stream, h.Heartbeat = broker, 20*time.Millisecond
+	acc := uuid.New()
+	r.accounts[acc] = repo.Account{ID: acc, Owner: "alice", Currency: "USD"}
+	entry := func(key string, after int64) map[string]interface{} {
+		return map[string]interface{}{"id": repo.EntryID(acc.String(), key), "account_id": acc.String(), "type": "deposit",
+			"amount": int64(10), "balance_after": after, "idempotency_key": key}
+	}
+	id := func(source uuid.UUID, key string) string { return "id: " + repo.EntryID(source.String(), key) }
+	r.entries = []map[string]interface{}{entry("k1", 10), entry("k2", 20)}
+	srv := httptest.NewServer(h.Routes())
+	defer srv.Close()
+	path := srv.URL + "/v1/accounts/" + acc.String() + "/events"
+
+	req, _ := http.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("Last-Event-ID", "nope")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET events: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("unknown Last-Event-ID status = %d, want %d", res.StatusCode, http.StatusBadRequest)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ = http.NewRequestWithContext(ctx, http.MethodGet, path, nil)
+	req.Header.Set("Last-Event-ID", repo.EntryID(acc.String(), "k1"))
+	res, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET events: %v", err)
+	}
+	defer res.Body.Close()
+	if ct := res.Header.Get("Content-Type"); res.StatusCode != http.StatusOK || ct != "text/event-stream" {
+		t.Fatalf("status = %d, Content-Type = %q; want an event stream", res.StatusCode, ct)
+	}
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		sc := bufio.NewScanner(res.Body)
+		for sc.Scan() {
+			lines <- sc.Text()
+		}
+	}()
+	// expect reads lines until want is seen, failing on timeout or on a line listed in never.
+	expect := func(want string, never ...string) {
+		t.Helper()
+		timeout := time.After(2 * time.Second)
+		for {
+			select {
+			case l, ok := <-lines:
+				if !ok {
+					t.Fatalf("stream ended before %q", want)
+				}
+				for _, n := range never {
+					if l == n {
+						t.Fatalf("got %q before %q", l, want)
+					}
+				}
+				if l == want {
+					return
+				}
+			case <-timeout:
+				t.Fatalf("timed out waiting for %q", want)
+			}
+		}
+	}
+	expect(id(acc, "k2"), id(acc, "k1"))
+
+	// The replayed deposit is skipped when it arrives live, but not a transfer into the account
+	// from another one that shares its key.
+	after, payer := int64(30), uuid.New()
+	events := []queue.Event{
+		{Type: queue.EventBalanceChanged, AccountID: acc.String(), Kind: "transaction", TransactionType: "deposit", IdempotencyKey: "k2", Amount: 10, BalanceAfter: &after},
+		{Type: queue.EventBalanceChanged, AccountID: uuid.NewString(), Kind: "transaction", TransactionType: "deposit", IdempotencyKey: "other", Amount: 10, BalanceAfter: &after},
+		{Type: queue.EventBalanceChanged, AccountID: acc.String(), Kind: "transfer", FromAccountID: payer.String(), ToAccountID: acc.String(), IdempotencyKey: "k2", Amount: 5, Delta: 5, BalanceAfter: &after},
+		{Type: queue.EventBalanceChanged, AccountID: acc.String(), Kind: "transaction", TransactionType: "deposit", IdempotencyKey: "k3", Amount: 10, BalanceAfter: &after},
+	}
+	if err := broker.PublishEvents(ctx, events); err != nil {
+		t.Fatalf("PublishEvents() failed: %v", err)
+	}
+	expect(id(payer, "k2"), id(acc, "k2"), "id: other")
+	expect(id(acc, "k3"), id(acc, "k2"))
+	expect(": heartbeat")
+
+	broker.Close()
+	for range lines {
+	}
+}
+
+func TestHandlers_BulkTransfers(t *testing.T) {
+	ctx := context.Background()
+	store, err := repo.OpenSQLite(ctx, ":memory:")
+	if err != nil {
+		t.Fatalf("OpenSQLite() failed: %v", err)
+	}
+	defer store.DB.Close()
+	mine, theirs, payee := uuid.New(), uuid.New(), uuid.New()
+	acme := &auth.Principal{Subject: "jwt:svc-payroll", Scopes: []string{auth.ScopeTransactionsWrite, auth.ScopeAccountsRead}, Tenant: "acme"}
+	globex := &auth.Principal{Subject: "api-key:globex", Scopes: []string{auth.ScopeTransactionsWrite, auth.ScopeAccountsRead}}
+	admin := &auth.Principal{Subject: "api-key:ops", Scopes: []string{auth.ScopeAdmin}}
+	pub := &fakePublisher{}
+	quotas := fakeQuotas{}
+	do := func(p *auth.Principal, method, path, contentType, body string) *httptest.ResponseRecorder {
+		h, r, _ := newTestHandlers()
+		h.Pub, h.Auth, h.Batches = pub, as(p), store
+		h.Quotas, h.QuotaLimits = quotas, repo.QuotaLimits{DailyCount: 100}
+		h.BulkMaxItems, h.BulkPublishBatch = 10, 2
+		r.accounts[mine] = repo.Account{ID: mine, Owner: "acme"}
+		r.accounts[theirs] = repo.Account{ID: theirs, Owner: "globex"}
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		rec := httptest.NewRecorder()
+		h.Routes().ServeHTTP(rec, req)
+		return rec
+	}
+	item := func(from, to uuid.UUID, amount int, key string) string {
+		return fmt.Sprintf(`{"from_account_id":"%s","to_account_id":"%s","amount":%d,"idempotency_key":"%s"}`, from, to, amount, key)
+	}
+
+	pub.refuse = map[string]bool{"p5": true}
+	body := "[" + strings.Join([]string{
+		item(mine, payee, 100, "p1"),
+		item(mine, payee, 0, "p2"),
+		item(mine, mine, 100, "p3"),
+		item(mine, payee, 100, "p1"),
+		item(theirs, payee, 100, "p4"),
+		item(mine, payee, 100, "p5"),
+		`{"from_account_id":"` + mine.String() + `","to_account_id":"` + payee.String() + `","amount":7}`,
+	}, ",") + "]"
+	rec := do(acme, http.MethodPost, "/v1/transfers/bulk", "application/json", body)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("submit status = %d, want %d (body %s)", rec.Code, http.StatusAccepted, rec.Body.String())
+	}
+	var res struct {
+		BatchID  uuid.UUID `json:"batch_id"`
+		Total    int       `json:"total"`
+		Accepted int       `json:"accepted"`
+		Rejected int       `json:"rejected"`
+		Items    []struct {
+			Index          int    `json:"index"`
+			IdempotencyKey string `json:"idempotency_key"`
+			Status         string `json:"status"`
+			Error          *struct {
+				Code string `json:"code"`
+			} `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		t.Fatalf("decode result: %v", err)
+	}
+	if res.Total != 7 || res.Accepted != 2 || res.Rejected != 5 || len(res.Items) != 7 {
+		t.Fatalf("result = %+v, want 2 of 7 accepted", res)
+	}
+	if loc := rec.Header().Get("Location"); loc != "/v1/transfers/bulk/"+res.BatchID.String() {
+		t.Errorf("Location = %q, want the batch", loc)
+	}
+	wantCodes := []string{"", repo.ErrInvalidAmount.Code, repo.ErrSameAccount.Code, "duplicate_idempotency_key", problem.CodeForbidden, problem.CodeQueueUnavailable, ""}
+	for i, it := range res.Items {
+		code := ""
+		if it.Error != nil {
+			code = it.Error.Code
+		}
+		if it.Index != i || code != wantCodes[i] || (code == "") != (it.Status == repo.BatchItemQueued) {
+			t.Errorf("item %d = %+v, want error code %q", i, it, wantCodes[i])
+		}
+	}
+	if generated := res.Items[6].IdempotencyKey; generated == "" || len(pub.transfers) != 2 || pub.transfers[1].Key != generated {
+		t.Errorf("published %+v, want p1 and the item with generated key %q", pub.transfers, generated)
+	}
+	if pub.batches != 2 {
+		t.Errorf("published in %d batches, want 2 of at most 2 transfers", pub.batches)
+	}
+	if u := quotas[acme.Subject]; u.Count != 2 || u.Amount != 107 {
+		t.Errorf("quota charged %+v, want the 2 published transfers of 107 and not the unpublished one", u)
+	}
+
+	path := "/v1/transfers/bulk/" + res.BatchID.String()
+	rec = do(acme, http.MethodGet, path, "", "")
+	var batch repo.TransferBatch
+	if err := json.NewDecoder(rec.Body).Decode(&batch); err != nil || batch.ID != res.BatchID || batch.Accepted != 2 || batch.Rejected != 5 || batch.Pending != 2 {
+		t.Errorf("batch = %+v, %v; want 2 pending of 2 accepted", batch, err)
+	}
+	if rec := do(globex, http.MethodGet, path, "", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("get by another client status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if rec := do(admin, http.MethodGet, path, "", ""); rec.Code != http.StatusOK {
+		t.Errorf("get by admin status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	ndjson := item(theirs, payee, 5, "n1") + "\n" + item(theirs, payee, 6, "n2") + "\n"
+	if rec := do(globex, http.MethodPost, "/v1/transfers/bulk", "application/x-ndjson", ndjson); rec.Code != http.StatusAccepted ||
+		!strings.Contains(rec.Body.String(), `"accepted":2`) {
+		t.Errorf("ndjson status = %d (body %s), want both transfers accepted", rec.Code, rec.Body.String())
+	}
+
+	pub.err = errors.New("broker down")
+	if rec := do(globex, http.MethodPost, "/v1/transfers/bulk", "", "["+item(theirs, payee, 5, "d1")+"]"); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("queue down status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	pub.err = nil
+	if u := quotas[globex.Subject]; u.Count != 2 || u.Amount != 11 {
+		t.Errorf("quota charged %+v, want the 2 ndjson transfers of 11 and not the batch refused with 503", u)
+	}
+
+	eleven := strings.TrimSuffix(strings.Repeat(item(theirs, payee, 1, "")+",", 11), ",")
+	for _, tt := range []struct {
+		name, contentType, body string
+		wantStatus              int
+	}{
+		{"malformed item", "application/json", `[` + item(theirs, payee, 1, "x") + `,{"amount":"ten"}]`, http.StatusBadRequest},
+		{"unknown field", "application/x-ndjson", `{"from_account_id":"a","memo":"x"}`, http.StatusBadRequest},
+		{"not an array", "application/json", item(theirs, payee, 1, "x"), http.StatusBadRequest},
+		{"empty", "application/json", `[]`, http.StatusBadRequest},
+		{"too many items", "application/json", "[" + eleven + "]", http.StatusRequestEntityTooLarge},
+		{"wrong content type", "text/csv", "from,to,amount", http.StatusBadRequest},
+	} {
+		if rec := do(globex, http.MethodPost, "/v1/transfers/bulk", tt.contentType, tt.body); rec.Code != tt.wantStatus {
+			t.Errorf("%s: status = %d, want %d (body %s)", tt.name, rec.Code, tt.wantStatus, rec.Body.String())
+		}
+	}
+}
+
+// slowPublisher takes delay to publish every chunk of transfers.
+type slowPublisher struct {
+	*fakePublisher
+	delay time.Duration
+}
+
+func (p slowPublisher) PublishTransfers(ctx context.Context, msgs []queue.TransferMessage) []error {
+	time.Sleep(p.delay)
+	return p.fakePublisher.PublishTransfers(ctx, msgs)
+}
+
+func TestHandlers_BulkTransfers_OutlastsWriteTimeout(t *testing.T) {
+	ctx := context.Background()
+	store, err := repo.OpenSQLite(ctx, ":memory:")
+	if err != nil {
+		t.Fatalf("OpenSQLite() failed: %v", err)
+	}
+	defer store.DB.Close()
+	h, r, _ := newTestHandlers()
+	from, to := uuid.New(), uuid.New()
+	r.accounts[from] = repo.Account{ID: from, Owner: "alice"}
+	h.Pub, h.Batches, h.BulkPublishBatch = slowPublisher{&fakePublisher{}, 100 * time.Millisecond}, store, 1
+	srv := httptest.NewUnstartedServer(h.Routes())
+	srv.Config.WriteTimeout = 50 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	body := fmt.Sprintf(`[{"from_account_id":"%s","to_account_id":"%s","amount":1},{"from_account_id":"%s","to_account_id":"%s","amount":2}]`, from, to, from, to)
+	resp, err := http.Post(srv.URL+"/v1/transfers/bulk", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("POST /v1/transfers/bulk failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Errorf("status = %d, want %d after publishing for longer than the write timeout", resp.StatusCode, http.StatusAccepted)
+	}
+}
+
+func TestHandlers_Import(t *testing.T) {
+	mine, theirs, payee := uuid.New(), uuid.New(), uuid.New()
+	acme := &auth.Principal{Subject: "jwt:finance", Scopes: []string{auth.ScopeTransactionsWrite}, Tenant: "acme"}
+	pub := &fakePublisher{}
+	quotas := fakeQuotas{}
+	do := func(path, contentType, body string) *httptest.ResponseRecorder {
+		h, r, _ := newTestHandlers()
+		h.Pub, h.Auth = pub, as(acme)
+		h.Quotas, h.QuotaLimits = quotas, repo.QuotaLimits{DailyAmount: 1000}
+		r.accounts[mine] = repo.Account{ID: mine, Owner: "acme"}
+		r.accounts[theirs] = repo.Account{ID: theirs, Owner: "globex"}
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		rec := httptest.NewRecorder()
+		h.Routes().ServeHTTP(rec, req)
+		return rec
+	}
+	type report struct {
+		Rows     int  `json:"rows"`
+		Valid    int  `json:"valid"`
+		Invalid  int  `json:"invalid"`
+		DryRun   bool `json:"dry_run"`
+		Enqueued int  `json:"enqueued"`
+		Errors   []struct {
+			Row  int    `json:"row"`
+			Code string `json:"code"`
+		} `json:"errors"`
+	}
+	decode := func(rec *httptest.ResponseRecorder) report {
+		t.Helper()
+		var rep report
+		if err := json.NewDecoder(rec.Body).Decode(&rep); err != nil {
+			t.Fatalf("decode report: %v", err)
+		}
+		return rep
+	}
+
+	file := fmt.Sprintf("Kind,Account,From,To,Amount\ndeposit,%s,,,100\ntransfer,,%s,%s,50\n", mine, mine, payee)
+	columns := "?column=type:Kind&column=account_id:Account&column=from_account_id:From&column=to_account_id:To"
+	rec := do("/v1/imports"+columns+"&dry_run=true", "text/csv", file)
+	if rep := decode(rec); rec.Code != http.StatusOK || !rep.DryRun || rep.Valid != 2 || rep.Enqueued != 0 || len(pub.txs)+len(pub.transfers) != 0 {
+		t.Fatalf("dry run = %d %+v, want 2 valid rows and nothing enqueued", rec.Code, rep)
+	}
+
+	rec = do("/v1/imports"+columns, "text/csv", file)
+	if rep := decode(rec); rec.Code != http.StatusAccepted || rep.Enqueued != 2 {
+		t.Fatalf("import = %d %+v, want 2 rows enqueued", rec.Code, rep)
+	}
+	if len(pub.txs) != 1 || len(pub.transfers) != 1 || !strings.HasPrefix(pub.txs[0].Key, "import-") {
+		t.Fatalf("published %+v and %+v, want a deposit and a transfer with derived keys", pub.txs, pub.transfers)
+	}
+	first := pub.txs[0].Key
+	do("/v1/imports"+columns, "text/csv", file)
+	if len(pub.txs) != 2 || pub.txs[1].Key != first {
+		t.Errorf("re-upload published key %q, want %q again", pub.txs[len(pub.txs)-1].Key, first)
+	}
+
+	bad := fmt.Sprintf(`{"type":"deposit","account_id":"%s","amount":5}`+"\n"+`{"type":"withdraw","account_id":"%s","amount":5}`+"\n"+`{"type":"deposit","account_id":"%s","amount":0}`, mine, theirs, mine)
+	rec = do("/v1/imports", "application/x-ndjson", bad)
+	rep := decode(rec)
+	if rec.Code != http.StatusUnprocessableEntity || rep.Invalid != 2 || len(pub.txs) != 2 {
+		t.Fatalf("invalid file = %d %+v, want 422 with 2 invalid rows and nothing enqueued", rec.Code, rep)
+	}
+	for _, e := range rep.Errors {
+		if want := map[int]string{2: problem.CodeForbidden, 3: "invalid_amount"}[e.Row]; e.Code != want {
+			t.Errorf("row %d error = %q, want %q", e.Row, e.Code, want)
+		}
+	}
+
+	over := fmt.Sprintf("type,account_id,amount\ndeposit,%s,400\ndeposit,%s,400\n", mine, mine)
+	used, published := quotas[acme.Subject], len(pub.txs)
+	if rec := do("/v1/imports", "text/csv", over); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("over quota status = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	if quotas[acme.Subject] != used || len(pub.txs) != published {
+		t.Errorf("over quota charged %+v and published %d rows, want nothing charged (%+v) or published", quotas[acme.Subject], len(pub.txs)-published, used)
+	}
+	delete(quotas, acme.Subject) // the next day
+	if rec := do("/v1/imports", "text/csv", over); rec.Code != http.StatusAccepted || len(pub.txs) != published+2 {
+		t.Fatalf("re-import after the quota stop = %d with %d rows published, want 202 with 2", rec.Code, len(pub.txs)-published)
+	}
+	if u := quotas[acme.Subject]; u.Count != 2 || u.Amount != 800 {
+		t.Errorf("re-import after the quota stop charged %+v, want the file's 2 rows and 800 once", u)
+	}
+	delete(quotas, acme.Subject)
+
+	pub.err = errors.New("broker down")
+	if rec := do("/v1/imports?format=csv", "", "type,account_id,amount\nwithdraw,"+mine.String()+",1\n"); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("queue down status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	if u := quotas[acme.Subject]; u.Count != 0 || u.Amount != 0 {
+		t.Errorf("queue down left %+v charged, want the unqueued row given back", u)
+	}
+	pub.err = nil
+
+	for _, tt := range []struct {
+		name, path, contentType, body string
+	}{
+		{"no format", "/v1/imports", "application/json", "[]"},
+		{"missing column", "/v1/imports", "text/csv", "type,account_id\n"},
+		{"bad column mapping", "/v1/imports?column=amount", "text/csv", "type,amount\n"},
+	} {
+		if rec := do(tt.path, tt.contentType, tt.body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want %d (body %s)", tt.name, rec.Code, http.StatusBadRequest, rec.Body.String())
+		}
+	}
+}
+
+func TestHandlers_LedgerExport(t *testing.T) {
+	mine, theirs := uuid.New(), uuid.New()
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	ledger := []repo.LedgerEntry{
+		{AccountID: mine.String(), Type: "deposit", Amount: 700, BalanceAfter: 700, IdempotencyKey: "k1", CreatedAt: day.Add(time.Hour)},
+		{AccountID: theirs.String(), Type: "deposit", Amount: 5, BalanceAfter: 5, IdempotencyKey: "k2", CreatedAt: day.Add(2 * time.Hour)},
+		{AccountID: mine.String(), Type: "withdraw", Amount: -200, BalanceAfter: 500, IdempotencyKey: "k3", CreatedAt: day.Add(25 * time.Hour)},
+	}
+	acme := &auth.Principal{Subject: "jwt:analytics", Scopes: []string{auth.ScopeAccountsRead}, Tenant: "acme"}
+	do := func(path string, fail error) *httptest.ResponseRecorder {
+		h, r, _ := newTestHandlers()
+		h.Auth = as(acme)
+		r.accounts[mine] = repo.Account{ID: mine, Owner: "acme"}
+		r.accounts[theirs] = repo.Account{ID: theirs, Owner: "globex"}
+		r.ledger, r.ledgerErr = ledger, fail
+		rec := httptest.NewRecorder()
+		h.Routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+	base := "/v1/accounts/" + mine.String() + "/ledger/export"
+
+	rec := do(base, nil)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "text/csv" {
+		t.Fatalf("csv export = %d %q, want 200 text/csv", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if cd := rec.Header().Get("Content-Disposition"); !strings.Contains(cd, "ledger-"+mine.String()+".csv") {
+		t.Errorf("Content-Disposition = %q, want the account's file name", cd)
+	}
+	if lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n"); len(lines) != 3 || !strings.HasPrefix(lines[1], mine.String()+",deposit,700,700,k1,") {
+		t.Errorf("csv = %q, want a header and the account's 2 entries", rec.Body.String())
+	}
+
+	rec = do(base+"?format=ndjson&from=2024-03-01T00:00:00Z&to=2024-03-02T00:00:00Z", nil)
+	var e repo.LedgerEntry
+	if err := json.Unmarshal(rec.Body.Bytes(), &e); err != nil || rec.Code != http.StatusOK || e.IdempotencyKey != "k1" {
+		t.Errorf("ndjson export = %d %q, want the first day's entry only", rec.Code, rec.Body.String())
+	}
+	if rec := do(base+"?format=parquet", nil); rec.Code != http.StatusOK || !bytes.HasPrefix(rec.Body.Bytes(), []byte("PAR1")) {
+		t.Errorf("parquet export = %d, want a Parquet file", rec.Code)
+	}
+
+	for _, tt := range []struct {
+		name, path string
+		fail       error
+		wantStatus int
+	}{
+		{"unknown format", base + "?format=xlsx", nil, http.StatusBadRequest},
+		{"bad time", base + "?from=yesterday", nil, http.StatusBadRequest},
+		{"empty range", base + "?from=2024-03-02T00:00:00Z&to=2024-03-01T00:00:00Z", nil, http.StatusBadRequest},
+		{"other tenant", "/v1/accounts/" + theirs.String() + "/ledger/export", nil, http.StatusForbidden},
+		{"store down", base + "?format=ndjson&to=2024-01-01T00:00:00Z", errors.New("mongo down"), http.StatusInternalServerError},
+	} {
+		if rec := do(tt.path, tt.fail); rec.Code != tt.wantStatus {
+			t.Errorf("%s: status = %d, want %d", tt.name, rec.Code, tt.wantStatus)
+		}
+	}
+}
+
+// fakeTransactions is a TransactionRepo holding the applied transactions by key.
+type fakeTransactions map[string][]repo.ProcessedTransaction
+
+func (f fakeTransactions) GetProcessedTransactions(ctx context.Context, key string) ([]repo.ProcessedTransaction, error) {
+	txs, ok := f[key]
+	if !ok {
+		return nil, repo.ErrTransactionNotFound
+	}
+	return txs, nil
+}
+
+func TestHandlers_TransactionStatus(t *testing.T) {
+	mine, theirs, equity := uuid.New(), uuid.New(), uuid.New()
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	opening := repo.OpeningBalanceKey(mine)
+	txs := fakeTransactions{
+		"k1": {{IdempotencyKey: "k1", AccountID: mine, Type: "deposit", Amount: 700, ProcessedAt: at}},
+		"k2": {{IdempotencyKey: "k2", AccountID: theirs, Type: "transfer", Amount: 5, ProcessedAt: at}},
+		"k3": {
+			{IdempotencyKey: "k3", AccountID: theirs, Type: "withdraw", Amount: 9, ProcessedAt: at},
+			{IdempotencyKey: "k3", AccountID: mine, Type: "deposit", Amount: 3, ProcessedAt: at},
+		},
+		opening: {{IdempotencyKey: opening, AccountID: equity, Type: "transfer", Amount: 50, ProcessedAt: at}},
+	}
+	p := &auth.Principal{Subject: "key:1", Scopes: []string{auth.ScopeAccountsRead}, Accounts: []uuid.UUID{mine}}
+	get := func(h *handlers.Handlers, key string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.Routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/transactions/"+key, nil))
+		return rec
+	}
+
+	h, _, _ := newTestHandlers()
+	if rec := get(h, "k1"); rec.Code != http.StatusNotFound {
+		t.Errorf("without Transactions = %d, want 404", rec.Code)
+	}
+	h.Transactions, h.Auth = txs, as(p)
+
+	type status struct {
+		IdempotencyKey string     `json:"idempotency_key"`
+		Status         string     `json:"status"`
+		AccountID      *uuid.UUID `json:"account_id"`
+		Type           string     `json:"type"`
+		Amount         int64      `json:"amount"`
+		AppliedAt      *time.Time `json:"applied_at"`
+	}
+	decode := func(rec *httptest.ResponseRecorder) status {
+		t.Helper()
+		var s status
+		if err := json.NewDecoder(rec.Body).Decode(&s); err != nil {
+			t.Fatalf("decode status: %v", err)
+		}
+		return s
+	}
+	rec := get(h, "k1")
+	if s := decode(rec); rec.Code != http.StatusOK || s.Status != "applied" || s.AccountID == nil || *s.AccountID != mine ||
+		s.Type != "deposit" || s.Amount != 700 || s.AppliedAt == nil || !s.AppliedAt.Equal(at) {
+		t.Errorf("applied = %d %+v, want the applied deposit", rec.Code, s)
+	}
+	rec = get(h, "pending")
+	if s := decode(rec); rec.Code != http.StatusOK || s.Status != "not_applied" || s.IdempotencyKey != "pending" || s.AccountID != nil {
+		t.Errorf("unknown key = %d %+v, want not_applied", rec.Code, s)
+	}
+	rec = get(h, "k2")
+	if s := decode(rec); rec.Code != http.StatusOK || s.Status != "not_applied" || s.AccountID != nil {
+		t.Errorf("other account's key = %d %+v, want not_applied", rec.Code, s)
+	}
+	rec = get(h, "k3")
+	if s := decode(rec); rec.Code != http.StatusOK || s.Status != "applied" || s.AccountID == nil || *s.AccountID != mine || s.Amount != 3 {
+		t.Errorf("key on two accounts = %d %+v, want the deposit of 3 to %s", rec.Code, s, mine)
+	}
+	rec = get(h, opening)
+	if s := decode(rec); rec.Code != http.StatusOK || s.Status != "applied" || s.Amount != 50 {
+		t.Errorf("opening transfer = %d %+v, want the applied transfer of 50", rec.Code, s)
+	}
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/Bharat0908/ledger/internal/http/problem"
+	"github.com/Bharat0908/ledger/internal/http/ratelimit"
+	"github.com/Bharat0908/ledger/internal/importer"
+	"github.com/Bharat0908/ledger/internal/repo"
+)
+
+// maxImportBytes bounds the size of an uploaded import file.
+const maxImportBytes = 32 << 20
+
+// importFile handles HTTP requests to import a file of deposits, withdrawals and transfers, as
+// CSV (Content-Type text/csv) or NDJSON (application/x-ndjson); the format query parameter
+// overrides the Content-Type. CSV columns are matched by name, and each column query parameter,
+// of the form field:Header, reads a field from a differently named column. See package importer
+// for the fields and how idempotency keys are derived, which makes uploading the same file again
+// harmless.
+//
+// The whole file is validated first, including the caller's access to the accounts it names and the
+// checks of repo.CheckSubmission. With dry_run=true nothing is enqueued and the report is returned
+// with 200. Otherwise a file with invalid rows is refused as a whole with 422 and the report, and a
+// valid one is charged to the caller's daily quota as a whole, then enqueued row by row and
+// answered with 202 and the report. A file that does not fit in what is left of the quota is
+// refused with 429 before anything is charged or enqueued. When the queue fails partway the rows
+// enqueued so far stay enqueued, the rest are given back to the quota and the request fails with
+// 503; importing the file again enqueues the rest, and is charged again. The server's read and
+// write timeouts do not apply to imports.
+func (h *Handlers) importFile(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	opts := importer.Options{Format: q.Get("format"), Columns: map[string]string{}}
+	if opts.Format == "" {
+		mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		switch mt {
+		case "text/csv":
+			opts.Format = importer.FormatCSV
+		case "application/x-ndjson":
+			opts.Format = importer.FormatNDJSON
+		default:
+			badRequest(w, r, "Content-Type must be text/csv or application/x-ndjson, or set format")
+			return
+		}
+	}
+	for _, c := range q["column"] {
+		field, header, ok := strings.Cut(c, ":")
+		if !ok || field == "" || header == "" {
+			badRequest(w, r, "column must be of the form field:Header")
+			return
+		}
+		opts.Columns[field] = header
+	}
+	dryRun, _ := strconv.ParseBool(q.Get("dry_run"))
+
+	// The server's timeouts are meant for ordinary requests: reading, checking and enqueuing a
+	// large file can outlast them.
+	rc := http.NewResponseController(w)
+	_ = rc.SetReadDeadline(time.Time{})
+	_ = rc.SetWriteDeadline(time.Time{})
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxImportBytes))
+	if err != nil {
+		problem.Error(w, r, decodeStatus(err), problem.CodeInvalidRequest, "could not read the import file")
+		return
+	}
+	rep, err := importer.Parse(data, opts)
+	if errors.Is(err, importer.ErrInvalidFile) {
+		badRequest(w, r, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	rep.DryRun = dryRun
+
+	ctx := r.Context()
+	denials := map[string]string{}
+	for _, rec := range append([]importer.Record(nil), rep.Records...) {
+		field, id, debit := importer.FieldAccountID, rec.AccountID, ""
+		switch rec.Type {
+		case importer.TypeTransfer:
+			field, id, debit = importer.FieldFromAccountID, rec.FromAccountID, rec.FromAccountID
+		case importer.TypeWithdraw:
+			debit = rec.AccountID
+		}
+		var de *repo.Error
+		if errors.As(repo.CheckSubmission(debit, rec.IdempotencyKey, h.OpeningAccounts), &de) {
+			if de == repo.ErrReservedKey {
+				field = importer.FieldIdempotencyKey
+			}
+			rep.Reject(importer.RowError{Row: rec.Row, Field: field, Code: de.Code, Detail: de.Message})
+			continue
+		}
+		reason, ok := denials[id]
+		if !ok {
+			if reason, err = h.accountDenial(ctx, uuid.MustParse(id)); err != nil {
+				writeError(w, r, err)
+				return
+			}
+			denials[id] = reason
+		}
+		if reason != "" {
+			rep.Reject(importer.RowError{Row: rec.Row, Field: field, Code: problem.CodeForbidden, Detail: reason})
+		}
+	}
+
+	switch {
+	case dryRun:
+		writeJSON(w, http.StatusOK, rep)
+		return
+	case !rep.OK():
+		writeJSON(w, http.StatusUnprocessableEntity, rep)
+		return
+	}
+
+	var total int64
+	for _, rec := range rep.Records {
+		total += rec.Amount
+	}
+	client, now := ratelimit.ClientKey(r), time.Now()
+	err = h.chargeQuotaBatch(ctx, client, now, int64(len(rep.Records)), total)
+	if errors.Is(err, repo.ErrQuotaExceeded) {
+		midnight := now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+		ratelimit.TooManyRequests(w, r, midnight.Sub(now), repo.ErrQuotaExceeded.Code,
+			fmt.Sprintf("%s: the %d rows of the file do not fit in what is left of today's quota", repo.ErrQuotaExceeded.Message, rep.Valid))
+		return
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	rep.Enqueued, err = importer.Enqueue(ctx, h.Pub, rep.Records, nil)
+	if err != nil {
+		var unqueued int64
+		for _, rec := range rep.Records[rep.Enqueued:] {
+			unqueued += rec.Amount
+		}
+		h.refundQuota(ctx, client, now, int64(len(rep.Records)-rep.Enqueued), unqueued)
+		slog.WarnContext(ctx, "import interrupted", "file_sha256", rep.FileSHA256, "enqueued", rep.Enqueued, "valid", rep.Valid)
+		writePublishError(w, r, err)
+		return
+	}
+	slog.InfoContext(ctx, "file imported", "format", rep.Format, "file_sha256", rep.FileSHA256, "enqueued", rep.Enqueued)
+	writeJSON(w, http.StatusAccepted, rep)
+}
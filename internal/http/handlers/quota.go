@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/Bharat0908/ledger/internal/http/ratelimit"
+	"github.com/Bharat0908/ledger/internal/repo"
+)
+
+// QuotaRepo records per-client daily transaction usage. It is implemented by repo.PGQuotaRepo
+// and repo.SQLiteRepo.
+type QuotaRepo interface {
+	ConsumeQuota(ctx context.Context, client string, at time.Time, amount int64, lim repo.QuotaLimits) (repo.QuotaUsage, error)
+	ConsumeQuotaBatch(ctx context.Context, client string, at time.Time, count, amount int64, lim repo.QuotaLimits) (repo.QuotaUsage, error)
+	RefundQuota(ctx context.Context, client string, at time.Time, count, amount int64) error
+}
+
+// consumeQuota charges one transaction of amount to the caller's daily quota and reports whether
+// the request may proceed, with a function giving the charge back should it fail to be queued
+// after all. An exhausted quota is answered with 429 and a Retry-After pointing at the next UTC
+// midnight, when usage resets. Without Quotas or limits every request passes.
+func (h *Handlers) consumeQuota(w http.ResponseWriter, r *http.Request, amount int64) (refund func(), ok bool) {
+	client, now := ratelimit.ClientKey(r), time.Now()
+	err := h.chargeQuota(r.Context(), client, now, amount)
+	if errors.Is(err, repo.ErrQuotaExceeded) {
+		midnight := now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+		ratelimit.TooManyRequests(w, r, midnight.Sub(now), repo.ErrQuotaExceeded.Code, repo.ErrQuotaExceeded.Message)
+		return nil, false
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return nil, false
+	}
+	return func() { h.refundQuota(r.Context(), client, now, 1, max(amount, 0)) }, true
+}
+
+// chargeQuota charges one transaction of amount at now to the daily quota of client, returning
+// repo.ErrQuotaExceeded once it is exhausted. Without Quotas or limits it does nothing.
+func (h *Handlers) chargeQuota(ctx context.Context, client string, now time.Time, amount int64) error {
+	if h.Quotas == nil || !h.QuotaLimits.Enabled() {
+		return nil
+	}
+	if amount < 0 {
+		// Negative amounts are rejected by the worker; they must not free up quota.
+		amount = 0
+	}
+	_, err := h.Quotas.ConsumeQuota(ctx, client, now, amount, h.QuotaLimits)
+	return err
+}
+
+// chargeQuotaBatch charges count transactions totalling amount at now to the daily quota of
+// client, all or none of them, returning repo.ErrQuotaExceeded when they do not fit. Without
+// Quotas or limits it does nothing.
+func (h *Handlers) chargeQuotaBatch(ctx context.Context, client string, now time.Time, count, amount int64) error {
+	if h.Quotas == nil || !h.QuotaLimits.Enabled() {
+		return nil
+	}
+	_, err := h.Quotas.ConsumeQuotaBatch(ctx, client, now, count, amount, h.QuotaLimits)
+	return err
+}
+
+// refundQuota gives count transactions totalling amount, charged at now, back to the daily quota
+// of client, for requests that could not be queued after all. A failure is only logged, since
+// the request has failed already. Without Quotas or limits it does nothing.
+func (h *Handlers) refundQuota(ctx context.Context, client string, now time.Time, count, amount int64) {
+	if h.Quotas == nil || !h.QuotaLimits.Enabled() || count == 0 {
+		return
+	}
+	// The request may have failed because it was canceled; the refund must go through anyway.
+	if err := h.Quotas.RefundQuota(context.WithoutCancel(ctx), client, now, count, amount); err != nil {
+		slog.ErrorContext(ctx, "refund quota", "client", client, "count", count, "amount", amount, "error", err)
+	}
+}
@@ -0,0 +1,261 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/Bharat0908/ledger/internal/http/auth"
+	"github.com/Bharat0908/ledger/internal/queue"
+	"github.com/Bharat0908/ledger/internal/repo"
+	"github.com/Bharat0908/ledger/internal/webhook"
+)
+
+// minWebhookSecret is the shortest secret a caller may choose for a webhook.
+const minWebhookSecret = 16
+
+// WebhookRepo defines the webhook operations used by the /v1/webhooks endpoints. It is
+// implemented by repo.PGWebhookRepo and repo.SQLiteRepo.
+type WebhookRepo interface {
+	CreateWebhook(ctx context.Context, in repo.NewWebhook) (repo.Webhook, error)
+	GetWebhook(ctx context.Context, id uuid.UUID) (repo.Webhook, error)
+	ListWebhooks(ctx context.Context, owner string) ([]repo.Webhook, error)
+	DeleteWebhook(ctx context.Context, id uuid.UUID) error
+	ListWebhookDeliveries(ctx context.Context, webhookID uuid.UUID, limit int) ([]repo.WebhookDelivery, error)
+	RedeliverWebhookDelivery(ctx context.Context, webhookID, id uuid.UUID) (repo.WebhookDelivery, error)
+}
+
+// clientOwner identifies the client owning webhooks and transfer batches: the caller's tenant,
+// or its subject. Those created without authentication have no owner.
+func clientOwner(p *auth.Principal) string {
+	switch {
+	case p == nil:
+		return ""
+	case p.Tenant != "":
+		return "tenant:" + p.Tenant
+	}
+	return p.Subject
+}
+
+// createWebhook handles HTTP requests to subscribe a URL to ledger events.
+// It expects a JSON payload with the URL, the event types to deliver and optionally the account
+// IDs to deliver events about, a description and a secret of at least 16 characters. Without a
+// secret one is generated; either way it is returned once, in the "secret" field of the 201
+// response, and used to sign every delivery. Callers restricted to accounts or to a tenant must
+// list accounts they may access. URLs whose host is localhost or a non-public IP address are
+// refused unless WebhookAllowedNetworks covers it; names are checked again when deliveries
+// connect.
+func (h *Handlers) createWebhook(w http.ResponseWriter, r *http.Request) {
+	type req struct {
+		URL         string      `json:"url"`
+		EventTypes  []string    `json:"event_types"`
+		AccountIDs  []uuid.UUID `json:"account_ids"`
+		Description string      `json:"description"`
+		Secret      string      `json:"secret"`
+	}
+	type resp struct {
+		repo.Webhook
+		Secret string `json:"secret"`
+	}
+	var body req
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&body); err != nil {
+		badRequest(w, r, "malformed JSON body")
+		return
+	}
+	u, err := url.Parse(body.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		badRequest(w, r, "url must be an absolute http or https URL")
+		return
+	}
+	if !webhook.HostAllowed(u.Hostname(), h.WebhookAllowedNetworks) {
+		badRequest(w, r, "url must not point at a loopback, private or link-local address")
+		return
+	}
+	for _, t := range body.EventTypes {
+		if !validEventType(t) {
+			badRequest(w, r, "unknown event type "+t)
+			return
+		}
+	}
+	if body.Secret != "" && len(body.Secret) < minWebhookSecret {
+		badRequest(w, r, "secret must be at least 16 characters")
+		return
+	}
+	if !h.allowWebhookAccounts(w, r, body.AccountIDs) {
+		return
+	}
+	secret := body.Secret
+	if secret == "" {
+		var err error
+		if secret, err = webhook.GenerateSecret(); err != nil {
+			writeError(w, r, err)
+			return
+		}
+	}
+	hook, err := h.Webhooks.CreateWebhook(r.Context(), repo.NewWebhook{
+		Owner: clientOwner(auth.FromContext(r.Context())), URL: body.URL, EventTypes: body.EventTypes,
+		AccountIDs: body.AccountIDs, Description: body.Description, Secret: []byte(secret),
+	})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, resp{Webhook: hook, Secret: secret})
+}
+
+// listWebhooks handles HTTP requests to list the caller's webhooks; admins see every webhook.
+// Secrets are never returned.
+func (h *Handlers) listWebhooks(w http.ResponseWriter, r *http.Request) {
+	owner := ""
+	if p := auth.FromContext(r.Context()); p != nil && !p.HasScope(auth.ScopeAdmin) {
+		owner = clientOwner(p)
+	}
+	hooks, err := h.Webhooks.ListWebhooks(r.Context(), owner)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"webhooks": hooks})
+}
+
+// getWebhook handles HTTP requests to retrieve one of the caller's webhooks by ID, or 404.
+func (h *Handlers) getWebhook(w http.ResponseWriter, r *http.Request) {
+	hook, ok := h.ownWebhook(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, hook)
+}
+
+// deleteWebhook handles HTTP requests to delete one of the caller's webhooks, together with its
+// pending deliveries and delivery log. Responds with 204, or 404.
+func (h *Handlers) deleteWebhook(w http.ResponseWriter, r *http.Request) {
+	hook, ok := h.ownWebhook(w, r)
+	if !ok {
+		return
+	}
+	if err := h.Webhooks.DeleteWebhook(r.Context(), hook.ID); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listWebhookDeliveries handles HTTP requests for the delivery log of one of the caller's
+// webhooks: its latest deliveries (limit, default 50, max 500), newest first, each with every
+// attempt made.
+func (h *Handlers) listWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	hook, ok := h.ownWebhook(w, r)
+	if !ok {
+		return
+	}
+	limit := 50
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 500 {
+			badRequest(w, r, "limit must be an integer between 1 and 500")
+			return
+		}
+		limit = n
+	}
+	ds, err := h.Webhooks.ListWebhookDeliveries(r.Context(), hook.ID, limit)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"deliveries": ds})
+}
+
+// redeliverWebhook handles HTTP requests to deliver an event again, whatever the outcome of
+// earlier attempts. The delivery becomes pending, due immediately, with a fresh budget of
+// attempts; responds with 202 and the delivery, or 404.
+func (h *Handlers) redeliverWebhook(w http.ResponseWriter, r *http.Request) {
+	hook, ok := h.ownWebhook(w, r)
+	if !ok {
+		return
+	}
+	id, err := uuid.Parse(chi.URLParam(r, "delivery_id"))
+	if err != nil {
+		badRequest(w, r, "invalid delivery id")
+		return
+	}
+	d, err := h.Webhooks.RedeliverWebhookDelivery(r.Context(), hook.ID, id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, d)
+}
+
+// ownWebhook loads the webhook named by the "id" URL parameter. Webhooks of other owners are
+// reported as not found, except to admins.
+func (h *Handlers) ownWebhook(w http.ResponseWriter, r *http.Request) (repo.Webhook, bool) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		badRequest(w, r, "invalid webhook id")
+		return repo.Webhook{}, false
+	}
+	hook, err := h.Webhooks.GetWebhook(r.Context(), id)
+	if err == nil {
+		if p := auth.FromContext(r.Context()); p != nil && !p.HasScope(auth.ScopeAdmin) && hook.Owner != clientOwner(p) {
+			err = repo.ErrWebhookNotFound
+		}
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return repo.Webhook{}, false
+	}
+	return hook, true
+}
+
+// allowWebhookAccounts reports whether the caller may watch the accounts, answering 403 when
+// not. Callers restricted to accounts or to a tenant must name the accounts, which must exist
+// and, for a tenant, be owned by it: a webhook on an account created later could otherwise
+// receive another tenant's events.
+func (h *Handlers) allowWebhookAccounts(w http.ResponseWriter, r *http.Request, ids []uuid.UUID) bool {
+	p := auth.FromContext(r.Context())
+	if p == nil || (!p.Restricted() && p.Tenant == "") {
+		return true
+	}
+	if len(ids) == 0 {
+		auth.Forbidden(w, r, "API credentials restricted to accounts must list the accounts to watch")
+		return false
+	}
+	for _, id := range ids {
+		if !p.CanAccess(id) {
+			auth.Forbidden(w, r, "API credentials are not allowed to access this account")
+			return false
+		}
+		if p.Tenant == "" {
+			continue
+		}
+		acc, err := h.Repo.GetAccount(r.Context(), id)
+		if errors.Is(err, repo.ErrNotFound) || (err == nil && acc.Owner != p.Tenant) {
+			auth.Forbidden(w, r, "account belongs to another tenant")
+			return false
+		}
+		if err != nil {
+			writeError(w, r, err)
+			return false
+		}
+	}
+	return true
+}
+
+// validEventType reports whether t is one of queue.EventTypes.
+func validEventType(t string) bool {
+	for _, v := range queue.EventTypes {
+		if v == t {
+			return true
+		}
+	}
+	return false
+}
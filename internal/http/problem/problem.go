@@ -0,0 +1,66 @@
+// Package problem writes RFC 7807 "application/problem+json" error responses.
+// Every problem carries a stable machine-readable Code; the Type URI is derived from it
+// so clients can key their error handling on either.
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// ContentType is the media type of problem responses.
+const ContentType = "application/problem+json"
+
+// Stable error codes that are not tied to a repository domain error.
+const (
+	CodeInvalidRequest   = "invalid_request"
+	CodeInternal         = "internal_error"
+	CodeQueueUnavailable = "queue_unavailable"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeRateLimited      = "rate_limited"
+)
+
+// Details is an RFC 7807 problem details object extended with a stable error code and, for
+// validation failures, the list of offending parameters.
+type Details struct {
+	Type          string         `json:"type"`
+	Title         string         `json:"title"`
+	Status        int            `json:"status"`
+	Detail        string         `json:"detail,omitempty"`
+	Instance      string         `json:"instance,omitempty"`
+	Code          string         `json:"code"`
+	InvalidParams []InvalidParam `json:"invalid_params,omitempty"`
+}
+
+// InvalidParam describes one request field or parameter that failed validation.
+type InvalidParam struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// New builds a problem for the given status and code. The type is "/problems/<code>".
+func New(status int, code, detail string) Details {
+	return Details{
+		Type:   "/problems/" + code,
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// Write sends p as the response, filling Instance from the request path when unset.
+func Write(w http.ResponseWriter, r *http.Request, p Details) {
+	if p.Instance == "" && r != nil {
+		p.Instance = r.URL.Path
+	}
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// Error is a shorthand for Write(w, r, New(status, code, detail)).
+func Error(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	Write(w, r, New(status, code, detail))
+}
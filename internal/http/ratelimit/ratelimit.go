@@ -0,0 +1,121 @@
+// Package ratelimit throttles API clients with per-client token buckets.
+//
+// Clients are identified by ClientKey: the authenticated principal when there is one, otherwise
+// the remote IP address. Each Limiter keeps its own buckets, so separate limiters can be used for
+// read and write routes. Buckets live in process memory; with several API replicas each enforces
+// its limits independently.
+package ratelimit
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Bharat0908/ledger/internal/http/auth"
+	"github.com/Bharat0908/ledger/internal/http/problem"
+)
+
+// sweepInterval is how often idle buckets are dropped.
+const sweepInterval = time.Minute
+
+// Limiter is a set of token buckets, one per client, each refilled at Rate tokens per second up
+// to Burst tokens. A request takes one token; a client with an empty bucket is refused.
+type Limiter struct {
+	Rate  float64
+	Burst int
+	Now   func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	nextSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// New returns a Limiter allowing rate requests per second with bursts of up to burst requests.
+func New(rate float64, burst int) *Limiter {
+	return &Limiter{Rate: rate, Burst: burst}
+}
+
+// Allow takes a token from key's bucket. If the bucket is empty it returns false and the time
+// until the next token is available.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	now := time.Now()
+	if l.Now != nil {
+		now = l.Now()
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.buckets == nil {
+		l.buckets = map[string]*bucket{}
+	}
+	burst := float64(l.Burst)
+	if now.After(l.nextSweep) {
+		// A bucket that has been idle long enough to refill is indistinguishable from a new one.
+		for k, b := range l.buckets {
+			if b.tokens+now.Sub(b.last).Seconds()*l.Rate >= burst {
+				delete(l.buckets, k)
+			}
+		}
+		l.nextSweep = now.Add(sweepInterval)
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*l.Rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / l.Rate * float64(time.Second))
+}
+
+// Middleware refuses requests from clients that exceeded l with a 429 problem and a Retry-After
+// header. It must run after authentication so clients are keyed by principal.
+func Middleware(l *Limiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if ok, wait := l.Allow(ClientKey(r)); !ok {
+				TooManyRequests(w, r, wait, problem.CodeRateLimited, "rate limit exceeded")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// TooManyRequests writes a 429 problem telling the client to retry after wait, rounded up to
+// whole seconds, and logs the refusal.
+func TooManyRequests(w http.ResponseWriter, r *http.Request, wait time.Duration, code, detail string) {
+	secs := int(math.Ceil(wait.Seconds()))
+	if secs < 1 {
+		secs = 1
+	}
+	slog.InfoContext(r.Context(), "request throttled", "client", ClientKey(r), "code", code, "retry_after_s", secs)
+	w.Header().Set("Retry-After", strconv.Itoa(secs))
+	problem.Error(w, r, http.StatusTooManyRequests, code, fmt.Sprintf("%s, retry after %ds", detail, secs))
+}
+
+// ClientKey identifies the client of a request: the principal's subject when the request was
+// authenticated, otherwise "ip:" and the remote address without its port.
+func ClientKey(r *http.Request) string {
+	if p := auth.FromContext(r.Context()); p != nil && p.Subject != "" {
+		return p.Subject
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
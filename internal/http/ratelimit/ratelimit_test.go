@@ -0,0 +1,69 @@
+package ratelimit_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Bharat0908/ledger/internal/http/auth"
+	"github.com/Bharat0908/ledger/internal/http/ratelimit"
+)
+
+func TestLimiter_Allow(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	l := &ratelimit.Limiter{Rate: 2, Burst: 3, Now: func() time.Time { return now }}
+	steps := []struct {
+		advance  time.Duration
+		key      string
+		want     bool
+		wantWait time.Duration
+	}{
+		{0, "a", true, 0},
+		{0, "a", true, 0},
+		{0, "a", true, 0},
+		{0, "a", false, 500 * time.Millisecond},
+		{0, "b", true, 0},
+		{250 * time.Millisecond, "a", false, 250 * time.Millisecond},
+		{250 * time.Millisecond, "a", true, 0},
+		{10 * time.Second, "a", true, 0},
+		{0, "a", true, 0},
+		{0, "a", true, 0},
+		{0, "a", false, 500 * time.Millisecond},
+	}
+	for i, s := range steps {
+		now = now.Add(s.advance)
+		got, wait := l.Allow(s.key)
+		if got != s.want || wait != s.wantWait {
+			t.Errorf("step %d: Allow(%q) = %v, %v; want %v, %v", i, s.key, got, wait, s.want, s.wantWait)
+		}
+	}
+}
+
+func TestClientKey(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "203.0.113.7:51234"
+	if got := ratelimit.ClientKey(req); got != "ip:203.0.113.7" {
+		t.Errorf("ClientKey(anonymous) = %q, want ip:203.0.113.7", got)
+	}
+	req = req.WithContext(auth.NewContext(req.Context(), &auth.Principal{Subject: "api-key:42"}))
+	if got := ratelimit.ClientKey(req); got != "api-key:42" {
+		t.Errorf("ClientKey(authenticated) = %q, want api-key:42", got)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	h := ratelimit.Middleware(ratelimit.New(1, 1))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	codes := []int{}
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		codes = append(codes, rec.Code)
+		if rec.Code == http.StatusTooManyRequests && rec.Header().Get("Retry-After") != "1" {
+			t.Errorf("Retry-After = %q, want 1", rec.Header().Get("Retry-After"))
+		}
+	}
+	if codes[0] != http.StatusOK || codes[1] != http.StatusTooManyRequests {
+		t.Errorf("statuses = %v, want [200 429]", codes)
+	}
+}
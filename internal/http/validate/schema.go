@@ -0,0 +1,177 @@
+package validate
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/Bharat0908/ledger/internal/http/problem"
+)
+
+// validate checks v (decoded with json.Decoder.UseNumber) against s, appending a problem
+// parameter for every violation found under the given field name.
+func (s *Schema) validate(field string, v interface{}, errs *[]problem.InvalidParam) {
+	if s == nil {
+		return
+	}
+	fail := func(format string, args ...interface{}) {
+		name := field
+		if name == "" {
+			name = "body"
+		}
+		*errs = append(*errs, problem.InvalidParam{Name: name, Reason: fmt.Sprintf(format, args...)})
+	}
+
+	switch s.Type {
+	case "object":
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			fail("must be an object")
+			return
+		}
+		s.validateObject(field, obj, errs)
+		return
+	case "array":
+		arr, ok := v.([]interface{})
+		if !ok {
+			fail("must be an array")
+			return
+		}
+		for i, item := range arr {
+			s.Items.validate(fmt.Sprintf("%s[%d]", field, i), item, errs)
+		}
+		return
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			fail("must be a string")
+			return
+		}
+		s.validateString(str, fail)
+	case "integer", "number":
+		n, ok := v.(json.Number)
+		if !ok {
+			fail("must be %s", article(s.Type))
+			return
+		}
+		f, err := n.Float64()
+		if err != nil {
+			fail("must be %s", article(s.Type))
+			return
+		}
+		if s.Type == "integer" {
+			if _, err := n.Int64(); err != nil {
+				fail("must be an integer")
+				return
+			}
+		}
+		if s.Minimum != nil && f < *s.Minimum {
+			fail("must be >= %s", formatNum(*s.Minimum))
+		}
+		if s.Maximum != nil && f > *s.Maximum {
+			fail("must be <= %s", formatNum(*s.Maximum))
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			fail("must be a boolean")
+			return
+		}
+	}
+
+	if len(s.Enum) > 0 && !inEnum(s.Enum, v) {
+		fail("must be one of %v", s.Enum)
+	}
+}
+
+func (s *Schema) validateObject(field string, obj map[string]interface{}, errs *[]problem.InvalidParam) {
+	prefix := ""
+	if field != "" {
+		prefix = field + "."
+	}
+	for _, name := range s.Required {
+		if _, ok := obj[name]; !ok {
+			*errs = append(*errs, problem.InvalidParam{Name: prefix + name, Reason: "is required"})
+		}
+	}
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if ps, ok := s.Properties[name]; ok {
+			ps.validate(prefix+name, obj[name], errs)
+			continue
+		}
+		switch {
+		case s.AdditionalProperties == nil || (s.AdditionalProperties.Allowed && s.AdditionalProperties.Schema == nil):
+		case !s.AdditionalProperties.Allowed:
+			*errs = append(*errs, problem.InvalidParam{Name: prefix + name, Reason: "is not a known field"})
+		default:
+			s.AdditionalProperties.Schema.validate(prefix+name, obj[name], errs)
+		}
+	}
+}
+
+func (s *Schema) validateString(str string, fail func(string, ...interface{})) {
+	if s.MinLength != nil && len(str) < *s.MinLength {
+		fail("must be at least %d characters", *s.MinLength)
+	}
+	if s.MaxLength != nil && len(str) > *s.MaxLength {
+		fail("must be at most %d characters", *s.MaxLength)
+	}
+	if s.pattern != nil && !s.pattern.MatchString(str) {
+		fail("must match %s", s.Pattern)
+	}
+	switch s.Format {
+	case "uuid":
+		if _, err := uuid.Parse(str); err != nil {
+			fail("must be a UUID")
+		}
+	case "date-time":
+		if _, err := time.Parse(time.RFC3339, str); err != nil {
+			fail("must be an RFC 3339 date-time")
+		}
+	}
+}
+
+// coerce converts a raw path, query or header value into the JSON representation expected by
+// the schema so parameters and bodies share one validation path.
+func (s *Schema) coerce(raw string) interface{} {
+	if s == nil {
+		return raw
+	}
+	switch s.Type {
+	case "integer", "number":
+		if _, err := strconv.ParseFloat(raw, 64); err == nil {
+			return json.Number(raw)
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(raw); err == nil {
+			return b
+		}
+	}
+	return raw
+}
+
+func inEnum(enum []interface{}, v interface{}) bool {
+	for _, e := range enum {
+		if fmt.Sprint(e) == fmt.Sprint(v) {
+			return true
+		}
+	}
+	return false
+}
+
+func article(typ string) string {
+	if typ == "integer" {
+		return "an integer"
+	}
+	return "a number"
+}
+
+func formatNum(f float64) string { return strconv.FormatFloat(f, 'f', -1, 64) }
@@ -0,0 +1,230 @@
+// Package validate checks incoming HTTP requests against the OpenAPI document before they
+// reach the handlers, so malformed transactions are rejected with a structured 400 instead of
+// failing later in the worker.
+//
+// Only the subset of OpenAPI 3 used by openapi.yaml is understood: path, query and header
+// parameters, JSON request bodies, local $ref to components/schemas and components/parameters,
+// and the schema keywords type, format (uuid, date-time), enum, pattern, minimum, maximum,
+// minLength, maxLength, required, properties, additionalProperties (boolean or schema) and items.
+package validate
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Schema is a JSON Schema object as used by OpenAPI 3.0.
+type Schema struct {
+	Ref                  string             `yaml:"$ref"`
+	Type                 string             `yaml:"type"`
+	Format               string             `yaml:"format"`
+	Enum                 []interface{}      `yaml:"enum"`
+	Pattern              string             `yaml:"pattern"`
+	Minimum              *float64           `yaml:"minimum"`
+	Maximum              *float64           `yaml:"maximum"`
+	MinLength            *int               `yaml:"minLength"`
+	MaxLength            *int               `yaml:"maxLength"`
+	Required             []string           `yaml:"required"`
+	Properties           map[string]*Schema `yaml:"properties"`
+	AdditionalProperties *additional        `yaml:"additionalProperties"`
+	Items                *Schema            `yaml:"items"`
+
+	pattern *regexp.Regexp
+}
+
+// additional holds additionalProperties, which may be a boolean or a schema.
+type additional struct {
+	Allowed bool
+	Schema  *Schema
+}
+
+func (a *additional) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		return n.Decode(&a.Allowed)
+	}
+	a.Allowed = true
+	return n.Decode(&a.Schema)
+}
+
+type parameter struct {
+	Ref      string  `yaml:"$ref"`
+	Name     string  `yaml:"name"`
+	In       string  `yaml:"in"`
+	Required bool    `yaml:"required"`
+	Schema   *Schema `yaml:"schema"`
+}
+
+type mediaType struct {
+	Schema *Schema `yaml:"schema"`
+}
+
+type requestBody struct {
+	Required bool                 `yaml:"required"`
+	Content  map[string]mediaType `yaml:"content"`
+}
+
+type operation struct {
+	Parameters  []parameter  `yaml:"parameters"`
+	RequestBody *requestBody `yaml:"requestBody"`
+	// Streamed is the x-streamed extension, set on operations that read large bodies themselves.
+	Streamed bool `yaml:"x-streamed"`
+}
+
+type document struct {
+	Paths      map[string]map[string]yaml.Node `yaml:"paths"`
+	Components struct {
+		Schemas    map[string]*Schema   `yaml:"schemas"`
+		Parameters map[string]parameter `yaml:"parameters"`
+	} `yaml:"components"`
+}
+
+// route is a compiled path template with its operations keyed by upper-case method.
+type route struct {
+	template string
+	segments []string
+	ops      map[string]*operation
+}
+
+// match reports whether path matches the template and returns the path parameters.
+func (rt *route) match(path string) (map[string]string, bool) {
+	segs := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segs) != len(rt.segments) {
+		return nil, false
+	}
+	params := map[string]string{}
+	for i, s := range rt.segments {
+		if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") {
+			if segs[i] == "" {
+				return nil, false
+			}
+			params[s[1:len(s)-1]] = segs[i]
+			continue
+		}
+		if s != segs[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+var httpMethods = map[string]bool{"get": true, "put": true, "post": true, "delete": true, "patch": true, "head": true, "options": true}
+
+// parse loads the document, resolves schema references and compiles patterns.
+func parse(spec []byte) ([]*route, error) {
+	var doc document
+	if err := yaml.Unmarshal(spec, &doc); err != nil {
+		return nil, fmt.Errorf("parse openapi: %w", err)
+	}
+	res := &resolver{schemas: doc.Components.Schemas}
+	var routes []*route
+	for tmpl, item := range doc.Paths {
+		rt := &route{template: tmpl, segments: strings.Split(strings.Trim(tmpl, "/"), "/"), ops: map[string]*operation{}}
+		for method, node := range item {
+			if !httpMethods[method] {
+				continue
+			}
+			var op operation
+			if err := node.Decode(&op); err != nil {
+				return nil, fmt.Errorf("%s %s: %w", strings.ToUpper(method), tmpl, err)
+			}
+			for i, p := range op.Parameters {
+				if p.Ref != "" {
+					target, ok := doc.Components.Parameters[strings.TrimPrefix(p.Ref, "#/components/parameters/")]
+					if !ok {
+						return nil, fmt.Errorf("%s %s: unresolved $ref %q", strings.ToUpper(method), tmpl, p.Ref)
+					}
+					op.Parameters[i] = target
+				}
+				if err := res.resolve(&op.Parameters[i].Schema); err != nil {
+					return nil, fmt.Errorf("%s %s: %w", strings.ToUpper(method), tmpl, err)
+				}
+			}
+			if op.RequestBody != nil {
+				for ct, mt := range op.RequestBody.Content {
+					if err := res.resolve(&mt.Schema); err != nil {
+						return nil, fmt.Errorf("%s %s: %w", strings.ToUpper(method), tmpl, err)
+					}
+					op.RequestBody.Content[ct] = mt
+				}
+			}
+			rt.ops[strings.ToUpper(method)] = &op
+		}
+		routes = append(routes, rt)
+	}
+	// Prefer literal segments over templated ones when both match (e.g. /v1/accounts/search
+	// over /v1/accounts/{id}).
+	sortRoutes(routes)
+	return routes, nil
+}
+
+// resolver replaces local $refs with the referenced component schema.
+type resolver struct {
+	schemas map[string]*Schema
+	seen    map[*Schema]bool
+}
+
+func (r *resolver) resolve(sp **Schema) error {
+	s := *sp
+	if s == nil {
+		return nil
+	}
+	if s.Ref != "" {
+		name := strings.TrimPrefix(s.Ref, "#/components/schemas/")
+		target, ok := r.schemas[name]
+		if !ok || name == s.Ref {
+			return fmt.Errorf("unresolved $ref %q", s.Ref)
+		}
+		*sp = target
+		s = target
+	}
+	if r.seen == nil {
+		r.seen = map[*Schema]bool{}
+	}
+	if r.seen[s] {
+		return nil
+	}
+	r.seen[s] = true
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("pattern %q: %w", s.Pattern, err)
+		}
+		s.pattern = re
+	}
+	for name := range s.Properties {
+		p := s.Properties[name]
+		if err := r.resolve(&p); err != nil {
+			return err
+		}
+		s.Properties[name] = p
+	}
+	if s.AdditionalProperties != nil {
+		if err := r.resolve(&s.AdditionalProperties.Schema); err != nil {
+			return err
+		}
+	}
+	return r.resolve(&s.Items)
+}
+
+// sortRoutes orders routes so that templates with more literal segments are tried first.
+func sortRoutes(routes []*route) {
+	literal := func(rt *route) int {
+		n := 0
+		for _, s := range rt.segments {
+			if !strings.HasPrefix(s, "{") {
+				n++
+			}
+		}
+		return n
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if li, lj := literal(routes[i]), literal(routes[j]); li != lj {
+			return li > lj
+		}
+		return routes[i].template < routes[j].template
+	})
+}
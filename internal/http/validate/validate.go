@@ -0,0 +1,138 @@
+package validate
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/Bharat0908/ledger/internal/http/problem"
+)
+
+// maxBodyBytes caps the request body read for validation.
+const maxBodyBytes = 1 << 20
+
+// Validator validates requests against the operations declared in an OpenAPI document.
+type Validator struct {
+	routes []*route
+}
+
+// New parses the OpenAPI document and returns a Validator for it.
+func New(spec []byte) (*Validator, error) {
+	routes, err := parse(spec)
+	if err != nil {
+		return nil, err
+	}
+	return &Validator{routes: routes}, nil
+}
+
+// Middleware rejects requests that do not conform to the spec with a 400 problem listing every
+// invalid parameter. Requests for paths or methods the spec does not describe are passed through
+// unchanged so the router can answer them (e.g. health checks or 404/405). Operations marked
+// x-streamed: true only have their parameters checked; their body is passed on unread, without
+// the size cap, for the handler to decode and validate as it streams.
+func (v *Validator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		op, pathParams := v.lookup(r)
+		if op == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		var errs []problem.InvalidParam
+		v.checkParams(r, op, pathParams, &errs)
+		if op.RequestBody != nil && !op.Streamed {
+			body, err := io.ReadAll(io.LimitReader(r.Body, maxBodyBytes+1))
+			if err != nil {
+				problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidRequest, "could not read request body")
+				return
+			}
+			if len(body) > maxBodyBytes {
+				problem.Error(w, r, http.StatusRequestEntityTooLarge, problem.CodeInvalidRequest, "request body too large")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			if msg := checkBody(r, op.RequestBody, body, &errs); msg != "" {
+				problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidRequest, msg)
+				return
+			}
+		}
+		if len(errs) > 0 {
+			p := problem.New(http.StatusBadRequest, problem.CodeInvalidRequest, "request failed validation")
+			p.InvalidParams = errs
+			problem.Write(w, r, p)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// lookup finds the operation for the request method and path.
+func (v *Validator) lookup(r *http.Request) (*operation, map[string]string) {
+	for _, rt := range v.routes {
+		params, ok := rt.match(r.URL.Path)
+		if !ok {
+			continue
+		}
+		return rt.ops[r.Method], params
+	}
+	return nil, nil
+}
+
+func (v *Validator) checkParams(r *http.Request, op *operation, pathParams map[string]string, errs *[]problem.InvalidParam) {
+	query := r.URL.Query()
+	for _, p := range op.Parameters {
+		var (
+			raw     string
+			present bool
+		)
+		switch p.In {
+		case "path":
+			raw, present = pathParams[p.Name]
+		case "query":
+			present = query.Has(p.Name)
+			raw = query.Get(p.Name)
+		case "header":
+			raw = r.Header.Get(p.Name)
+			present = raw != ""
+		default:
+			continue
+		}
+		if !present {
+			if p.Required {
+				*errs = append(*errs, problem.InvalidParam{Name: p.Name, Reason: "is required"})
+			}
+			continue
+		}
+		p.Schema.validate(p.Name, p.Schema.coerce(raw), errs)
+	}
+}
+
+// checkBody validates a JSON body. It returns a non-empty message when the body cannot be
+// interpreted at all; schema violations are appended to errs.
+func checkBody(r *http.Request, rb *requestBody, body []byte, errs *[]problem.InvalidParam) string {
+	if len(bytes.TrimSpace(body)) == 0 {
+		if rb.Required {
+			return "request body is required"
+		}
+		return ""
+	}
+	mt, ok := rb.Content["application/json"]
+	if !ok {
+		return ""
+	}
+	if ct := r.Header.Get("Content-Type"); ct != "" && !strings.HasPrefix(ct, "application/json") {
+		return "Content-Type must be application/json"
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return "malformed JSON body"
+	}
+	if dec.More() {
+		return "malformed JSON body"
+	}
+	mt.Schema.validate("", doc, errs)
+	return ""
+}
@@ -0,0 +1,182 @@
+package validate_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/Bharat0908/ledger"
+	"github.com/Bharat0908/ledger/internal/http/problem"
+	"github.com/Bharat0908/ledger/internal/http/validate"
+)
+
+func TestValidator_Middleware(t *testing.T) {
+	v, err := validate.New(ledger.OpenAPISpec)
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	acc := uuid.NewString()
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		body        string
+		wantStatus  int
+		wantInvalid []string // sorted names reported in invalid_params
+	}{
+		{
+			name: "valid transaction", method: http.MethodPost, path: "/v1/transactions",
+			body:       `{"account_id":"` + acc + `","type":"deposit","amount":100}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "negative amount and unknown type", method: http.MethodPost, path: "/v1/transactions",
+			body:       `{"account_id":"` + acc + `","type":"refund","amount":-5}`,
+			wantStatus: http.StatusBadRequest, wantInvalid: []string{"amount", "type"},
+		},
+		{
+			name: "zero amount", method: http.MethodPost, path: "/v1/transactions",
+			body:       `{"account_id":"` + acc + `","type":"withdraw","amount":0}`,
+			wantStatus: http.StatusBadRequest, wantInvalid: []string{"amount"},
+		},
+		{
+			name: "missing and malformed account", method: http.MethodPost, path: "/v1/transfers",
+			body:       `{"from_account_id":"","amount":10}`,
+			wantStatus: http.StatusBadRequest, wantInvalid: []string{"from_account_id", "to_account_id"},
+		},
+		{
+			name: "unknown field", method: http.MethodPost, path: "/v1/transfers",
+			body:       `{"from_account_id":"` + acc + `","to_account_id":"` + acc + `","amount":10,"memo":"x"}`,
+			wantStatus: http.StatusBadRequest, wantInvalid: []string{"memo"},
+		},
+		{
+			name: "fractional amount", method: http.MethodPost, path: "/v1/transfers",
+			body:       `{"from_account_id":"` + acc + `","to_account_id":"` + acc + `","amount":1.5}`,
+			wantStatus: http.StatusBadRequest, wantInvalid: []string{"amount"},
+		},
+		{
+			name: "lowercase currency", method: http.MethodPost, path: "/v1/accounts",
+			body:       `{"owner":"alice","currency":"usd","initial_balance":0}`,
+			wantStatus: http.StatusBadRequest, wantInvalid: []string{"currency"},
+		},
+		{
+			name: "metadata values must be strings", method: http.MethodPost, path: "/v1/accounts",
+			body:       `{"owner":"alice","currency":"USD","initial_balance":0,"type":"savings","metadata":{"tier":1}}`,
+			wantStatus: http.StatusBadRequest, wantInvalid: []string{"metadata.tier", "type"},
+		},
+		{
+			name: "body is not an object", method: http.MethodPost, path: "/v1/accounts",
+			body:       `[1,2]`,
+			wantStatus: http.StatusBadRequest, wantInvalid: []string{"body"},
+		},
+		{
+			name: "malformed json", method: http.MethodPost, path: "/v1/accounts",
+			body:       `{"owner":`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "wrong content type", method: http.MethodPost, path: "/v1/accounts", contentType: "text/plain",
+			body:       `{"owner":"alice","currency":"USD","initial_balance":0}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "path id must be a uuid", method: http.MethodGet, path: "/v1/accounts/123",
+			wantStatus: http.StatusBadRequest, wantInvalid: []string{"id"},
+		},
+		{
+			name: "limit out of range", method: http.MethodGet, path: "/v1/accounts/" + acc + "/ledger?limit=0",
+			wantStatus: http.StatusBadRequest, wantInvalid: []string{"limit"},
+		},
+		{
+			name: "valid account search", method: http.MethodGet, path: "/v1/accounts?owner=alice&status=frozen&sort=-balance&metadata=tier:gold&created_from=2024-01-01T00:00:00Z",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "account search parameters", method: http.MethodGet, path: "/v1/accounts?sort=id&created_to=today&limit=501",
+			wantStatus: http.StatusBadRequest, wantInvalid: []string{"created_to", "limit", "sort"},
+		},
+		{
+			name: "streamed body is left to the handler", method: http.MethodPost, path: "/v1/transfers/bulk", contentType: "application/x-ndjson",
+			body:       `{"from_account_id":"` + acc + `","to_account_id":"x","amount":-1}` + "\n" + `not json`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "transaction status by key", method: http.MethodGet, path: "/v1/transactions/import-abc-2",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "batch id must be a uuid", method: http.MethodGet, path: "/v1/transfers/bulk/123",
+			wantStatus: http.StatusBadRequest, wantInvalid: []string{"id"},
+		},
+		{
+			name: "export range and format are checked", method: http.MethodGet, path: "/v1/accounts/" + acc + "/ledger/export?format=xlsx&from=yesterday",
+			wantStatus: http.StatusBadRequest, wantInvalid: []string{"format", "from"},
+		},
+		{
+			name: "import file is left to the handler", method: http.MethodPost, path: "/v1/imports?dry_run=true&column=amount:Amount%20(paise)", contentType: "text/csv",
+			body:       "type,Amount (paise)\ndeposit,5\n",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "import format must be known", method: http.MethodPost, path: "/v1/imports?format=xlsx&dry_run=maybe", contentType: "text/csv",
+			body:       "type,amount\n",
+			wantStatus: http.StatusBadRequest, wantInvalid: []string{"dry_run", "format"},
+		},
+		{
+			name: "unspecified route passes through", method: http.MethodGet, path: "/healthz",
+			wantStatus: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotBody string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, _ := io.ReadAll(r.Body)
+				gotBody = string(b)
+			})
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			ct := tt.contentType
+			if ct == "" && tt.body != "" {
+				ct = "application/json"
+			}
+			if ct != "" {
+				req.Header.Set("Content-Type", ct)
+			}
+			rec := httptest.NewRecorder()
+			v.Middleware(next).ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %s)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantStatus == http.StatusOK {
+				if gotBody != tt.body {
+					t.Errorf("handler saw body %q, want %q", gotBody, tt.body)
+				}
+				return
+			}
+			var p problem.Details
+			if err := json.NewDecoder(rec.Body).Decode(&p); err != nil {
+				t.Fatalf("decode problem: %v", err)
+			}
+			if p.Code != problem.CodeInvalidRequest {
+				t.Errorf("code = %q, want %q", p.Code, problem.CodeInvalidRequest)
+			}
+			var names []string
+			for _, ip := range p.InvalidParams {
+				names = append(names, ip.Name)
+			}
+			sort.Strings(names)
+			if strings.Join(names, ",") != strings.Join(tt.wantInvalid, ",") {
+				t.Errorf("invalid_params = %v, want %v", p.InvalidParams, tt.wantInvalid)
+			}
+		})
+	}
+}
@@ -0,0 +1,393 @@
+// Package importer reads files of deposits, withdrawals and transfers, such as spreadsheets of
+// adjustments exported as CSV, validates them and enqueues them.
+//
+// Every row gets an idempotency key derived from the SHA-256 of the file and the row's line
+// number, unless the file provides one, so uploading the same file again enqueues nothing new:
+// the worker skips keys it has already applied. A file is validated as a whole before anything
+// is enqueued, and the resulting Report doubles as the dry-run output.
+package importer
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/Bharat0908/ledger/internal/queue"
+)
+
+// File formats.
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+// Fields of a row. In CSV files each is read from the column with the same name unless
+// Options.Columns maps it to another; NDJSON objects use them as keys.
+const (
+	FieldType           = "type"
+	FieldAccountID      = "account_id"
+	FieldFromAccountID  = "from_account_id"
+	FieldToAccountID    = "to_account_id"
+	FieldAmount         = "amount"
+	FieldIdempotencyKey = "idempotency_key"
+)
+
+// Fields lists every field, in the order CSV columns are looked up.
+var Fields = []string{FieldType, FieldAccountID, FieldFromAccountID, FieldToAccountID, FieldAmount, FieldIdempotencyKey}
+
+// Row types. Deposits and withdrawals name account_id; transfers name from_account_id and
+// to_account_id.
+const (
+	TypeDeposit  = "deposit"
+	TypeWithdraw = "withdraw"
+	TypeTransfer = "transfer"
+)
+
+// Row error codes.
+const (
+	CodeMalformedRow     = "malformed_row"
+	CodeInvalidType      = "invalid_type"
+	CodeInvalidAccountID = "invalid_account_id"
+	CodeInvalidAmount    = "invalid_amount"
+	CodeInvalidKey       = "invalid_idempotency_key"
+	CodeSameAccount      = "same_account"
+	CodeDuplicateKey     = "duplicate_idempotency_key"
+)
+
+// maxKeyLen is the longest idempotency key the API accepts.
+const maxKeyLen = 255
+
+// ErrInvalidFile is wrapped by the errors of files that cannot be read at all, as opposed to
+// files with invalid rows.
+var ErrInvalidFile = errors.New("invalid import file")
+
+// Options configures Parse. Columns maps fields to the CSV header naming them, for files whose
+// columns are named differently, e.g. {"amount": "Amount (paise)"}. Headers match
+// case-insensitively.
+type Options struct {
+	Format  string
+	Columns map[string]string
+}
+
+// Record is a valid row, ready to be enqueued. Row is the row's line number in the file, so
+// CSV rows are numbered like in a spreadsheet, header included.
+type Record struct {
+	Row            int    `json:"row"`
+	Type           string `json:"type"`
+	AccountID      string `json:"account_id,omitempty"`
+	FromAccountID  string `json:"from_account_id,omitempty"`
+	ToAccountID    string `json:"to_account_id,omitempty"`
+	Amount         int64  `json:"amount"`
+	IdempotencyKey string `json:"idempotency_key"`
+}
+
+// RowError reports why a row cannot be imported.
+type RowError struct {
+	Row    int    `json:"row"`
+	Field  string `json:"field,omitempty"`
+	Code   string `json:"code"`
+	Detail string `json:"detail"`
+}
+
+// Total counts the valid rows of one type and sums their amounts.
+type Total struct {
+	Count  int   `json:"count"`
+	Amount int64 `json:"amount"`
+}
+
+// Report describes an import: what the file holds, which rows are invalid and, once enqueued,
+// how many records were. Records holds the valid rows.
+type Report struct {
+	Format     string           `json:"format"`
+	FileSHA256 string           `json:"file_sha256"`
+	Rows       int              `json:"rows"`
+	Valid      int              `json:"valid"`
+	Invalid    int              `json:"invalid"`
+	Totals     map[string]Total `json:"totals"`
+	Errors     []RowError       `json:"errors"`
+	DryRun     bool             `json:"dry_run"`
+	Enqueued   int              `json:"enqueued"`
+	Records    []Record         `json:"-"`
+}
+
+// OK reports whether every row is valid.
+func (rep *Report) OK() bool { return len(rep.Errors) == 0 }
+
+// Reject marks the valid record of row invalid, for checks made outside the package such as
+// access control.
+func (rep *Report) Reject(e RowError) {
+	for i, rec := range rep.Records {
+		if rec.Row == e.Row {
+			rep.Records = append(rep.Records[:i], rep.Records[i+1:]...)
+			rep.Errors = append(rep.Errors, e)
+			rep.count()
+			return
+		}
+	}
+}
+
+// count derives the counts from Records and Errors.
+func (rep *Report) count() {
+	rep.Valid, rep.Invalid = len(rep.Records), 0
+	rows := map[int]bool{}
+	for _, e := range rep.Errors {
+		if !rows[e.Row] {
+			rows[e.Row] = true
+			rep.Invalid++
+		}
+	}
+	rep.Totals = map[string]Total{}
+	for _, rec := range rep.Records {
+		t := rep.Totals[rec.Type]
+		t.Count++
+		t.Amount += rec.Amount
+		rep.Totals[rec.Type] = t
+	}
+}
+
+// row is a row as read from the file, before validation.
+type row struct {
+	line   int
+	fields map[string]string
+}
+
+// Parse reads and validates a whole file. It returns an error wrapping ErrInvalidFile when the
+// file cannot be read at all: an unknown format, a CSV file without a header or lacking a
+// required column, or broken CSV quoting. Invalid rows are listed in the report instead.
+func Parse(data []byte, opts Options) (*Report, error) {
+	sum := sha256.Sum256(data)
+	rep := &Report{Format: opts.Format, FileSHA256: hex.EncodeToString(sum[:]), Errors: []RowError{}}
+	var (
+		rows []row
+		err  error
+	)
+	switch opts.Format {
+	case FormatCSV:
+		rows, err = readCSV(data, opts.Columns)
+	case FormatNDJSON:
+		rows, err = readNDJSON(data, rep)
+	default:
+		err = fmt.Errorf("%w: format must be %s or %s", ErrInvalidFile, FormatCSV, FormatNDJSON)
+	}
+	if err != nil {
+		return nil, err
+	}
+	rep.Rows += len(rows)
+	seen := map[string]int{}
+	for _, r := range rows {
+		rec, e := validate(r, rep.FileSHA256)
+		if e == nil {
+			if first, dup := seen[rec.IdempotencyKey]; dup {
+				e = &RowError{Row: r.line, Field: FieldIdempotencyKey, Code: CodeDuplicateKey, Detail: fmt.Sprintf("idempotency_key is already used by row %d", first)}
+			}
+		}
+		if e != nil {
+			rep.Errors = append(rep.Errors, *e)
+			continue
+		}
+		seen[rec.IdempotencyKey] = r.line
+		rep.Records = append(rep.Records, rec)
+	}
+	rep.count()
+	return rep, nil
+}
+
+// readCSV reads the rows of a CSV file whose first record is the header.
+func readCSV(data []byte, columns map[string]string) ([]row, error) {
+	cr := csv.NewReader(bytes.NewReader(data))
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%w: the file has no header row", ErrInvalidFile)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFile, err)
+	}
+	index := map[string]int{}
+	for i, h := range header {
+		index[headerName(strings.TrimPrefix(h, "\ufeff"))] = i
+	}
+	for f := range columns {
+		if !isField(f) {
+			return nil, fmt.Errorf("%w: unknown field %q in column mapping", ErrInvalidFile, f)
+		}
+	}
+	pos := map[string]int{}
+	for _, f := range Fields {
+		name, mapped := columns[f]
+		if !mapped {
+			name = f
+		}
+		i, ok := index[headerName(name)]
+		if !ok && mapped {
+			return nil, fmt.Errorf("%w: no column %q for %s", ErrInvalidFile, name, f)
+		}
+		if ok {
+			pos[f] = i
+		}
+	}
+	for _, f := range []string{FieldType, FieldAmount} {
+		if _, ok := pos[f]; !ok {
+			return nil, fmt.Errorf("%w: no %s column", ErrInvalidFile, f)
+		}
+	}
+	var rows []row
+	for {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidFile, err)
+		}
+		line, _ := cr.FieldPos(0)
+		if len(rec) == 1 && strings.TrimSpace(rec[0]) == "" {
+			continue
+		}
+		r := row{line: line, fields: map[string]string{}}
+		for f, i := range pos {
+			if i < len(rec) {
+				r.fields[f] = strings.TrimSpace(rec[i])
+			}
+		}
+		rows = append(rows, r)
+	}
+}
+
+// readNDJSON reads the rows of an NDJSON file, one object per line. Blank lines are skipped;
+// lines that are not objects of known fields are reported in rep.
+func readNDJSON(data []byte, rep *Report) ([]row, error) {
+	var rows []row
+	for i, l := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(l)) == 0 {
+			continue
+		}
+		var obj struct {
+			Type           string          `json:"type"`
+			AccountID      string          `json:"account_id"`
+			FromAccountID  string          `json:"from_account_id"`
+			ToAccountID    string          `json:"to_account_id"`
+			Amount         json.RawMessage `json:"amount"`
+			IdempotencyKey string          `json:"idempotency_key"`
+		}
+		dec := json.NewDecoder(bytes.NewReader(l))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&obj); err != nil || dec.More() {
+			rep.Rows++
+			rep.Errors = append(rep.Errors, RowError{Row: i + 1, Code: CodeMalformedRow, Detail: "line is not a JSON object of known fields"})
+			continue
+		}
+		rows = append(rows, row{line: i + 1, fields: map[string]string{
+			FieldType:           obj.Type,
+			FieldAccountID:      obj.AccountID,
+			FieldFromAccountID:  obj.FromAccountID,
+			FieldToAccountID:    obj.ToAccountID,
+			FieldAmount:         string(obj.Amount),
+			FieldIdempotencyKey: obj.IdempotencyKey,
+		}})
+	}
+	return rows, nil
+}
+
+// validate turns a row into a record, or reports its first problem. Rows without an
+// idempotency key get one derived from the file hash and the row's line number.
+func validate(r row, fileHash string) (Record, *RowError) {
+	fail := func(field, code, detail string) (Record, *RowError) {
+		return Record{}, &RowError{Row: r.line, Field: field, Code: code, Detail: detail}
+	}
+	rec := Record{Row: r.line, Type: strings.ToLower(r.fields[FieldType]), IdempotencyKey: r.fields[FieldIdempotencyKey]}
+	uuidField := func(f string) (string, *RowError) {
+		id, err := uuid.Parse(r.fields[f])
+		if err != nil {
+			_, e := fail(f, CodeInvalidAccountID, f+" must be a UUID")
+			return "", e
+		}
+		return id.String(), nil
+	}
+	var e *RowError
+	switch rec.Type {
+	case TypeDeposit, TypeWithdraw:
+		if rec.AccountID, e = uuidField(FieldAccountID); e != nil {
+			return Record{}, e
+		}
+	case TypeTransfer:
+		if rec.FromAccountID, e = uuidField(FieldFromAccountID); e != nil {
+			return Record{}, e
+		}
+		if rec.ToAccountID, e = uuidField(FieldToAccountID); e != nil {
+			return Record{}, e
+		}
+		if rec.FromAccountID == rec.ToAccountID {
+			return fail(FieldToAccountID, CodeSameAccount, "cannot transfer to the same account")
+		}
+	default:
+		return fail(FieldType, CodeInvalidType, "type must be deposit, withdraw or transfer")
+	}
+	amount, err := strconv.ParseInt(strings.Trim(r.fields[FieldAmount], `"`), 10, 64)
+	if err != nil || amount <= 0 {
+		return fail(FieldAmount, CodeInvalidAmount, "amount must be a positive integer of minor units")
+	}
+	rec.Amount = amount
+	if rec.IdempotencyKey == "" {
+		rec.IdempotencyKey = fmt.Sprintf("import-%s-%d", fileHash, r.line)
+	} else if len(rec.IdempotencyKey) > maxKeyLen {
+		return fail(FieldIdempotencyKey, CodeInvalidKey, fmt.Sprintf("idempotency_key must be at most %d characters", maxKeyLen))
+	}
+	return rec, nil
+}
+
+// headerName normalizes a CSV header for matching.
+func headerName(h string) string { return strings.ToLower(strings.TrimSpace(h)) }
+
+// isField reports whether f names a field.
+func isField(f string) bool {
+	for _, g := range Fields {
+		if f == g {
+			return true
+		}
+	}
+	return false
+}
+
+// Publisher enqueues transactions and transfers. It is implemented by queue.Publisher and
+// queue.LocalQueue.
+type Publisher interface {
+	Publish(ctx context.Context, msg queue.TxMessage) error
+	PublishTransfer(ctx context.Context, msg queue.TransferMessage) error
+}
+
+// Enqueue publishes the records in order and returns how many were published. It stops at the
+// first failure: of before, when set, which is called with each record before it is published
+// (to charge quotas, for example), or of publishing. Since keys are deterministic, the file can
+// then be imported again to enqueue the rest.
+func Enqueue(ctx context.Context, pub Publisher, recs []Record, before func(Record) error) (int, error) {
+	now := time.Now()
+	for i, rec := range recs {
+		if before != nil {
+			if err := before(rec); err != nil {
+				return i, err
+			}
+		}
+		var err error
+		if rec.Type == TypeTransfer {
+			err = pub.PublishTransfer(ctx, queue.TransferMessage{FromAccountID: rec.FromAccountID, ToAccountID: rec.ToAccountID, Amount: rec.Amount, Key: rec.IdempotencyKey, CreatedAt: now})
+		} else {
+			err = pub.Publish(ctx, queue.TxMessage{AccountID: rec.AccountID, Type: rec.Type, Amount: rec.Amount, Key: rec.IdempotencyKey, CreatedAt: now})
+		}
+		if err != nil {
+			return i, fmt.Errorf("row %d: %w", rec.Row, err)
+		}
+	}
+	return len(recs), nil
+}
@@ -0,0 +1,195 @@
+package importer_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Bharat0908/ledger/internal/importer"
+	"github.com/Bharat0908/ledger/internal/queue"
+)
+
+const (
+	acc1 = "11111111-1111-1111-1111-111111111111"
+	acc2 = "22222222-2222-2222-2222-222222222222"
+)
+
+func TestParse_CSV(t *testing.T) {
+	data := []byte("Kind,Account,From,To,Amount (paise)\n" +
+		"deposit," + acc1 + ",,,500\n" +
+		"Withdraw," + acc1 + ",,,200\n" +
+		"transfer,," + acc1 + "," + acc2 + ",100\n" +
+		"transfer,," + acc1 + "," + acc1 + ",100\n" +
+		"deposit,not-a-uuid,,,5\n" +
+		"refund," + acc1 + ",,,5\n" +
+		"deposit," + acc1 + ",,,-5\n")
+	rep, err := importer.Parse(data, importer.Options{Format: importer.FormatCSV, Columns: map[string]string{
+		importer.FieldType:          "kind",
+		importer.FieldAccountID:     "Account",
+		importer.FieldFromAccountID: "From",
+		importer.FieldToAccountID:   "To",
+		importer.FieldAmount:        "Amount (paise)",
+	}})
+	if err != nil {
+		t.Fatalf("Parse() failed: %v", err)
+	}
+	if rep.Rows != 7 || rep.Valid != 3 || rep.Invalid != 4 {
+		t.Errorf("rows/valid/invalid = %d/%d/%d, want 7/3/4", rep.Rows, rep.Valid, rep.Invalid)
+	}
+	wantCodes := map[int]string{
+		5: importer.CodeSameAccount,
+		6: importer.CodeInvalidAccountID,
+		7: importer.CodeInvalidType,
+		8: importer.CodeInvalidAmount,
+	}
+	for _, e := range rep.Errors {
+		if wantCodes[e.Row] != e.Code {
+			t.Errorf("row %d error = %s, want %s", e.Row, e.Code, wantCodes[e.Row])
+		}
+	}
+	if got := rep.Totals[importer.TypeDeposit]; got.Count != 1 || got.Amount != 500 {
+		t.Errorf("deposit totals = %+v, want 1 of 500", got)
+	}
+	if got := rep.Records[1]; got.Row != 3 || got.Type != importer.TypeWithdraw {
+		t.Errorf("second record = %+v, want the withdrawal of row 3", got)
+	}
+	want := fmt.Sprintf("import-%s-%d", rep.FileSHA256, 2)
+	if got := rep.Records[0].IdempotencyKey; got != want {
+		t.Errorf("key = %q, want %q", got, want)
+	}
+
+	again, err := importer.Parse(data, importer.Options{Format: importer.FormatCSV, Columns: map[string]string{
+		importer.FieldType: "kind", importer.FieldAccountID: "account", importer.FieldFromAccountID: "from",
+		importer.FieldToAccountID: "to", importer.FieldAmount: "amount (paise)",
+	}})
+	if err != nil {
+		t.Fatalf("Parse() failed: %v", err)
+	}
+	for i := range rep.Records {
+		if again.Records[i].IdempotencyKey != rep.Records[i].IdempotencyKey {
+			t.Errorf("record %d key changed between parses", i)
+		}
+	}
+}
+
+func TestParse_NDJSON(t *testing.T) {
+	data := []byte(`{"type":"deposit","account_id":"` + acc1 + `","amount":500,"idempotency_key":"adj-1"}` + "\n" +
+		"\n" +
+		`{"type":"transfer","from_account_id":"` + acc1 + `","to_account_id":"` + acc2 + `","amount":100}` + "\n" +
+		`{"type":"deposit","account_id":"` + acc1 + `","amount":5,"idempotency_key":"adj-1"}` + "\n" +
+		`{"type":"deposit","memo":"x"}` + "\n" +
+		`not json` + "\n")
+	rep, err := importer.Parse(data, importer.Options{Format: importer.FormatNDJSON})
+	if err != nil {
+		t.Fatalf("Parse() failed: %v", err)
+	}
+	if rep.Rows != 5 || rep.Valid != 2 || rep.Invalid != 3 {
+		t.Errorf("rows/valid/invalid = %d/%d/%d, want 5/2/3", rep.Rows, rep.Valid, rep.Invalid)
+	}
+	wantCodes := map[int]string{
+		4: importer.CodeDuplicateKey,
+		5: importer.CodeMalformedRow,
+		6: importer.CodeMalformedRow,
+	}
+	for _, e := range rep.Errors {
+		if wantCodes[e.Row] != e.Code {
+			t.Errorf("row %d error = %s, want %s", e.Row, e.Code, wantCodes[e.Row])
+		}
+	}
+	if got := rep.Records[0].IdempotencyKey; got != "adj-1" {
+		t.Errorf("explicit key = %q, want adj-1", got)
+	}
+	if got := rep.Records[1].IdempotencyKey; !strings.HasSuffix(got, "-3") {
+		t.Errorf("derived key = %q, want it to name line 3", got)
+	}
+}
+
+func TestParse_InvalidFile(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		opts importer.Options
+	}{
+		{"unknown format", "type,amount\n", importer.Options{Format: "xlsx"}},
+		{"empty csv", "", importer.Options{Format: importer.FormatCSV}},
+		{"missing amount column", "type,account_id\n", importer.Options{Format: importer.FormatCSV}},
+		{"missing mapped column", "type,amount\n", importer.Options{Format: importer.FormatCSV, Columns: map[string]string{importer.FieldAccountID: "Account"}}},
+		{"unknown field", "type,amount\n", importer.Options{Format: importer.FormatCSV, Columns: map[string]string{"memo": "type"}}},
+		{"broken quoting", "type,amount\n\"deposit,5\n", importer.Options{Format: importer.FormatCSV}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := importer.Parse([]byte(tc.data), tc.opts); !errors.Is(err, importer.ErrInvalidFile) {
+				t.Errorf("Parse() error = %v, want ErrInvalidFile", err)
+			}
+		})
+	}
+}
+
+func TestReport_Reject(t *testing.T) {
+	rep, err := importer.Parse([]byte("type,account_id,amount\ndeposit,"+acc1+",5\ndeposit,"+acc2+",7\n"), importer.Options{Format: importer.FormatCSV})
+	if err != nil {
+		t.Fatalf("Parse() failed: %v", err)
+	}
+	rep.Reject(importer.RowError{Row: 3, Field: importer.FieldAccountID, Code: "forbidden", Detail: "no access"})
+	if rep.OK() || rep.Valid != 1 || rep.Invalid != 1 || rep.Totals[importer.TypeDeposit].Amount != 5 {
+		t.Errorf("report = %+v, want row 3 rejected", rep)
+	}
+}
+
+type fakePublisher struct {
+	txs       []queue.TxMessage
+	transfers []queue.TransferMessage
+	err       error
+}
+
+func (p *fakePublisher) Publish(_ context.Context, msg queue.TxMessage) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.txs = append(p.txs, msg)
+	return nil
+}
+
+func (p *fakePublisher) PublishTransfer(_ context.Context, msg queue.TransferMessage) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.transfers = append(p.transfers, msg)
+	return nil
+}
+
+func TestEnqueue(t *testing.T) {
+	ctx := context.Background()
+	recs := []importer.Record{
+		{Row: 2, Type: importer.TypeDeposit, AccountID: acc1, Amount: 5, IdempotencyKey: "k2"},
+		{Row: 3, Type: importer.TypeTransfer, FromAccountID: acc1, ToAccountID: acc2, Amount: 3, IdempotencyKey: "k3"},
+		{Row: 4, Type: importer.TypeWithdraw, AccountID: acc2, Amount: 1, IdempotencyKey: "k4"},
+	}
+	pub := &fakePublisher{}
+	n, err := importer.Enqueue(ctx, pub, recs, nil)
+	if err != nil || n != 3 {
+		t.Fatalf("Enqueue() = %d, %v, want 3", n, err)
+	}
+	if len(pub.txs) != 2 || len(pub.transfers) != 1 || pub.transfers[0].Key != "k3" || pub.txs[1].Type != importer.TypeWithdraw {
+		t.Errorf("published %+v and %+v", pub.txs, pub.transfers)
+	}
+
+	stop := errors.New("quota")
+	n, err = importer.Enqueue(ctx, &fakePublisher{}, recs, func(r importer.Record) error {
+		if r.Row == 3 {
+			return stop
+		}
+		return nil
+	})
+	if n != 1 || !errors.Is(err, stop) {
+		t.Errorf("Enqueue() = %d, %v, want to stop before row 3", n, err)
+	}
+
+	down := errors.New("broker down")
+	if n, err = importer.Enqueue(ctx, &fakePublisher{err: down}, recs, nil); n != 0 || !errors.Is(err, down) {
+		t.Errorf("Enqueue() = %d, %v, want the publish error", n, err)
+	}
+}
@@ -0,0 +1,113 @@
+package logging_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Bharat0908/ledger/internal/logging"
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// capture makes a JSON logger the default for the test and returns its output.
+func capture(t *testing.T, level string) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	l, err := logging.New(&buf, "test", level, "json")
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	prev := slog.Default()
+	slog.SetDefault(l)
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return &buf
+}
+
+// lines decodes every JSON log line written to buf.
+func lines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var out []map[string]any
+	for _, l := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var m map[string]any
+		if err := json.Unmarshal([]byte(l), &m); err != nil {
+			t.Fatalf("log line %q is not JSON: %v", l, err)
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+func TestMiddleware(t *testing.T) {
+	api := chi.NewRouter()
+	api.Post("/v1/transfers", func(w http.ResponseWriter, r *http.Request) {
+		slog.InfoContext(r.Context(), "transfer queued")
+		w.WriteHeader(http.StatusAccepted)
+	})
+	r := chi.NewRouter()
+	r.Use(logging.Middleware)
+	r.Mount("/", api)
+
+	tests := []struct {
+		name   string
+		header string
+		keep   bool
+	}{
+		{"client id kept", "req-42:retry.1", true},
+		{"missing id generated", "", false},
+		{"unsafe id replaced", `x" "level":"ERROR`, false},
+		{"overlong id replaced", strings.Repeat("a", 129), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := capture(t, "")
+			req := httptest.NewRequest(http.MethodPost, "/v1/transfers", nil)
+			if tt.header != "" {
+				req.Header.Set(logging.RequestIDHeader, tt.header)
+			}
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+
+			id := rec.Header().Get(logging.RequestIDHeader)
+			if tt.keep && id != tt.header || !tt.keep && (id == tt.header || !logging.ValidRequestID(id)) {
+				t.Fatalf("response request id = %q (sent %q)", id, tt.header)
+			}
+			logs := lines(t, buf)
+			if len(logs) != 2 {
+				t.Fatalf("log lines = %d, want handler line and access line", len(logs))
+			}
+			for _, l := range logs {
+				if l["request_id"] != id || l["service"] != "test" {
+					t.Errorf("log line %v lacks request_id %q and service", l, id)
+				}
+			}
+			if access := logs[1]; access["msg"] != "request" || access["route"] != "/v1/transfers" || access["status"] != float64(http.StatusAccepted) {
+				t.Errorf("access line = %v, want route and status", access)
+			}
+		})
+	}
+}
+
+func TestNew_TraceIDAndLevel(t *testing.T) {
+	buf := capture(t, "warn")
+	sc := trace.NewSpanContext(trace.SpanContextConfig{TraceID: trace.TraceID{1}, SpanID: trace.SpanID{1}})
+	ctx := trace.ContextWithSpanContext(context.Background(), sc)
+	slog.InfoContext(ctx, "filtered")
+	slog.WarnContext(ctx, "kept")
+	logs := lines(t, buf)
+	if len(logs) != 1 || logs[0]["msg"] != "kept" || logs[0]["trace_id"] != sc.TraceID().String() {
+		t.Errorf("logs = %v, want only the warning, with its trace id", logs)
+	}
+
+	if _, err := logging.New(&bytes.Buffer{}, "test", "loud", "json"); err == nil {
+		t.Error("New() accepted an invalid level")
+	}
+	if _, err := logging.New(&bytes.Buffer{}, "test", "info", "xml"); err == nil {
+		t.Error("New() accepted an invalid format")
+	}
+}
@@ -0,0 +1,157 @@
+// Package metrics defines the Prometheus metrics exported by the API and the worker.
+//
+// Metrics are registered with the default Prometheus registry, which also carries the Go runtime
+// and process collectors, and are served by Handler. Label values are kept to small fixed sets
+// (route patterns, domain error codes, message kinds) so series counts stay bounded.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "ledger"
+
+// Message kinds used as the "kind" label of queue metrics.
+const (
+	KindTransaction = "transaction"
+	KindTransfer    = "transfer"
+	KindUnknown     = "unknown"
+)
+
+var (
+	// HTTPRequestDuration observes API request latency by route pattern, method and status.
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency by route pattern, method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	// GRPCRequestDuration observes gRPC call latency by full method name and status code. For
+	// streaming calls it covers the whole stream.
+	GRPCRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "grpc",
+		Name:      "request_duration_seconds",
+		Help:      "gRPC call latency by method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "code"})
+
+	// Published counts messages handed to the queue, by kind and result (ok or error).
+	Published = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "queue",
+		Name:      "published_total",
+		Help:      "Messages published to the transaction queue by kind and result.",
+	}, []string{"kind", "result"})
+
+	// Consumed counts processed messages by kind and outcome: ack, requeue (nack with requeue),
+	// reject (refused by a business rule, nack without requeue) or drop (unreadable, nack without
+	// requeue).
+	Consumed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "queue",
+		Name:      "consumed_total",
+		Help:      "Messages consumed from the transaction queue by kind and outcome (ack, requeue, reject, drop).",
+	}, []string{"kind", "outcome"})
+
+	// EventsPublished counts ledger events published for downstream consumers, by event type and
+	// result (ok or error).
+	EventsPublished = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "events",
+		Name:      "published_total",
+		Help:      "Ledger events published to the events exchange by type and result.",
+	}, []string{"type", "result"})
+
+	// WebhookDeliveries counts webhook delivery attempts by result: succeeded, retry (the attempt
+	// failed and will be retried) or failed (the attempt failed and was the last one).
+	WebhookDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "webhooks",
+		Name:      "delivery_attempts_total",
+		Help:      "Webhook delivery attempts by result.",
+	}, []string{"result"})
+
+	// StreamSubscribers is the number of open account event streams.
+	StreamSubscribers = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "stream",
+		Name:      "subscribers",
+		Help:      "Open account activity streams, over Server-Sent Events or gRPC.",
+	})
+
+	// StreamDropped counts event stream subscribers dropped for falling behind.
+	StreamDropped = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "stream",
+		Name:      "dropped_total",
+		Help:      "Event stream subscribers disconnected for falling behind.",
+	})
+
+	// ProcessingLatency observes the time from a message's CreatedAt to it being applied.
+	ProcessingLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "queue",
+		Name:      "processing_latency_seconds",
+		Help:      "Time from enqueueing a message (its created_at) to applying it, by kind.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 300},
+	}, []string{"kind"})
+
+	// DBTxDuration observes balance-store transactions by backend, operation and result: ok,
+	// a domain error code such as insufficient_funds, or error.
+	DBTxDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "db",
+		Name:      "tx_duration_seconds",
+		Help:      "Database transaction duration by backend, operation and result.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"backend", "op", "result"})
+
+	// IdempotentDuplicates counts messages whose idempotency key had already been applied.
+	IdempotentDuplicates = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "idempotent_duplicates_total",
+		Help:      "Transactions and transfers skipped because their idempotency key was already applied, by operation.",
+	}, []string{"op"})
+
+	// InsufficientFunds counts withdrawals and transfers rejected for lack of funds.
+	InsufficientFunds = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "insufficient_funds_total",
+		Help:      "Withdrawals and transfers rejected for insufficient funds, by operation.",
+	}, []string{"op"})
+)
+
+// Handler serves the metrics in the Prometheus exposition format.
+func Handler() http.Handler { return promhttp.Handler() }
+
+// InstrumentHTTP records HTTPRequestDuration for every request. Requests are labelled with the
+// chi route pattern they matched, not their path, so arbitrary paths cannot create new series;
+// requests answered before routing, such as those refused by request validation, are labelled
+// "unmatched".
+func InstrumentHTTP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+		route := "unmatched"
+		if rc := chi.RouteContext(r.Context()); rc != nil && rc.RoutePattern() != "" {
+			route = rc.RoutePattern()
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		HTTPRequestDuration.WithLabelValues(route, r.Method, strconv.Itoa(status)).Observe(time.Since(start).Seconds())
+	})
+}
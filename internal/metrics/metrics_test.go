@@ -0,0 +1,69 @@
+package metrics_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Bharat0908/ledger/internal/metrics"
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// requests returns how many requests HTTPRequestDuration has observed for the given labels.
+func requests(t *testing.T, route, method, status string) uint64 {
+	t.Helper()
+	var m dto.Metric
+	if err := metrics.HTTPRequestDuration.WithLabelValues(route, method, status).(prometheus.Metric).Write(&m); err != nil {
+		t.Fatalf("read histogram: %v", err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestInstrumentHTTP(t *testing.T) {
+	api := chi.NewRouter()
+	api.Get("/v1/accounts/{id}", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("{}")) })
+	api.Post("/v1/transactions", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusAccepted) })
+	r := chi.NewRouter()
+	r.Use(metrics.InstrumentHTTP)
+	r.Mount("/", api)
+
+	tests := []struct {
+		name          string
+		method, path  string
+		route, status string
+		want          uint64
+	}{
+		{"path parameters collapse into the pattern", http.MethodGet, "/v1/accounts/0b6f", "/v1/accounts/{id}", "200", 2},
+		{"explicit status", http.MethodPost, "/v1/transactions", "/v1/transactions", "202", 1},
+		{"unknown path", http.MethodGet, "/no/such/path", "/*", "404", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := requests(t, tt.route, tt.method, tt.status)
+			for i := uint64(0); i < tt.want; i++ {
+				r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(tt.method, tt.path, nil))
+			}
+			if got := requests(t, tt.route, tt.method, tt.status) - before; got != tt.want {
+				t.Errorf("observations for %s %s %s = %d, want %d", tt.method, tt.route, tt.status, got, tt.want)
+			}
+		})
+	}
+	if got := requests(t, "/v1/accounts/0b6f", http.MethodGet, "200"); got != 0 {
+		t.Errorf("raw path recorded as a route %d times", got)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	metrics.Published.WithLabelValues(metrics.KindTransfer, "ok").Inc()
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	if body := rec.Body.String(); !strings.Contains(body, `ledger_queue_published_total{kind="transfer",result="ok"}`) {
+		t.Errorf("exposition lacks the published counter:\n%s", body)
+	}
+}
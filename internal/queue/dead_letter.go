@@ -0,0 +1,196 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/Bharat0908/ledger/internal/metrics"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// DeclareQueue declares the durable direct exchange the API publishes transactions to and the
+// queue the worker consumes, bound with routingKey. When deadLetterQueue is set it is declared as
+// well, and the queue dead-letters to it through the default exchange, so the messages the
+// worker rejects or cannot read are kept for inspection and replay (see ReplayDeadLetters)
+// instead of being discarded.
+//
+// RabbitMQ refuses to redeclare a queue with different arguments, so turning dead-lettering on
+// or off for an existing queue means deleting the queue first, or using a policy instead.
+func DeclareQueue(ch *amqp.Channel, exchange, queue, routingKey, deadLetterQueue string) error {
+	if err := ch.ExchangeDeclare(exchange, "direct", true, false, false, false, nil); err != nil {
+		return fmt.Errorf("declare exchange %s: %w", exchange, err)
+	}
+	var args amqp.Table
+	if deadLetterQueue != "" {
+		if _, err := ch.QueueDeclare(deadLetterQueue, true, false, false, false, nil); err != nil {
+			return fmt.Errorf("declare queue %s: %w", deadLetterQueue, err)
+		}
+		args = amqp.Table{"x-dead-letter-exchange": "", "x-dead-letter-routing-key": deadLetterQueue}
+	}
+	if _, err := ch.QueueDeclare(queue, true, false, false, false, args); err != nil {
+		return fmt.Errorf("declare queue %s: %w", queue, err)
+	}
+	if err := ch.QueueBind(queue, routingKey, exchange, false, nil); err != nil {
+		return fmt.Errorf("bind queue %s: %w", queue, err)
+	}
+	return nil
+}
+
+// DeadLetter describes a message found in the dead-letter queue.
+type DeadLetter struct {
+	// IdempotencyKey is the message's key, empty when its body cannot be read.
+	IdempotencyKey string `json:"idempotency_key"`
+	// Kind is transaction, transfer or unknown, as in the queue metrics.
+	Kind string `json:"kind"`
+	// Reason is why the broker dead-lettered the message, rejected for those the worker refused.
+	Reason string `json:"reason"`
+	// Queue is the queue the message was dead-lettered from.
+	Queue string `json:"queue"`
+	// Count is how many times the message was dead-lettered from Queue for Reason.
+	Count int64 `json:"count"`
+	// DeadLetteredAt is when the message was first dead-lettered for Reason, if known.
+	DeadLetteredAt time.Time `json:"dead_lettered_at,omitempty"`
+	// Body is the message as published.
+	Body string `json:"body"`
+}
+
+// ParseDeadLetter describes a delivery from the dead-letter queue, reading its key and kind from
+// the body and why it was dead-lettered from the x-death header the broker adds, whose first
+// entry is the latest.
+func ParseDeadLetter(d amqp.Delivery) DeadLetter {
+	dl := DeadLetter{Kind: metrics.KindUnknown, Body: string(d.Body)}
+	var m struct {
+		Key           string `json:"idempotency_key"`
+		AccountID     string `json:"account_id"`
+		FromAccountID string `json:"from_account_id"`
+	}
+	if json.Unmarshal(d.Body, &m) == nil {
+		dl.IdempotencyKey = m.Key
+		switch {
+		case m.FromAccountID != "":
+			dl.Kind = metrics.KindTransfer
+		case m.AccountID != "":
+			dl.Kind = metrics.KindTransaction
+		}
+	}
+	if deaths, ok := d.Headers["x-death"].([]interface{}); ok && len(deaths) > 0 {
+		if death, ok := deaths[0].(amqp.Table); ok {
+			dl.Reason, _ = death["reason"].(string)
+			dl.Queue, _ = death["queue"].(string)
+			dl.Count, _ = death["count"].(int64)
+			dl.DeadLetteredAt, _ = death["time"].(time.Time)
+		}
+	}
+	return dl
+}
+
+// PeekDeadLetters returns up to limit messages from the front of the dead-letter queue without
+// removing them: they are fetched unacknowledged and all returned to the queue, in order, before
+// PeekDeadLetters returns.
+func PeekDeadLetters(ch *amqp.Channel, deadLetterQueue string, limit int) ([]DeadLetter, error) {
+	var (
+		out  []DeadLetter
+		last amqp.Delivery
+	)
+	for len(out) < limit {
+		d, ok, err := ch.Get(deadLetterQueue, false)
+		if err != nil {
+			return out, fmt.Errorf("get from %s: %w", deadLetterQueue, err)
+		}
+		if !ok {
+			break
+		}
+		out = append(out, ParseDeadLetter(d))
+		last = d
+	}
+	if len(out) > 0 {
+		if err := last.Nack(true, true); err != nil {
+			return out, fmt.Errorf("return messages to %s: %w", deadLetterQueue, err)
+		}
+	}
+	return out, nil
+}
+
+// ReplayDeadLetters moves messages from the dead-letter queue back to the publisher's exchange,
+// oldest first, so the worker applies them again: up to limit of them (0 for no limit) among
+// those match accepts (nil accepts all). It returns the messages replayed.
+//
+// Each message is republished with its original headers and body, and removed from the
+// dead-letter queue only once the broker confirmed it when the channel is in confirm mode, so a
+// failure can at worst leave a message in both queues; applying it twice is a no-op thanks to
+// its idempotency key. Only the messages in the dead-letter queue when the replay starts are
+// considered, so those that are dead-lettered again meanwhile are not replayed in a loop.
+// Messages that are not replayed stay in the dead-letter queue, in order.
+func (p *Publisher) ReplayDeadLetters(ctx context.Context, deadLetterQueue string, limit int, match func(DeadLetter) bool) ([]DeadLetter, error) {
+	q, err := p.ch.QueueDeclarePassive(deadLetterQueue, true, false, false, false, nil)
+	if err != nil {
+		return nil, fmt.Errorf("inspect %s: %w", deadLetterQueue, err)
+	}
+	var (
+		replayed []DeadLetter
+		skipped  *amqp.Delivery
+	)
+	defer func() {
+		// Skipped messages were held unacknowledged so they would not be fetched again.
+		if skipped != nil {
+			_ = skipped.Nack(true, true)
+		}
+	}()
+	for seen := 0; seen < q.Messages && (limit == 0 || len(replayed) < limit); seen++ {
+		if err := ctx.Err(); err != nil {
+			return replayed, err
+		}
+		d, ok, err := p.ch.Get(deadLetterQueue, false)
+		if err != nil {
+			return replayed, fmt.Errorf("get from %s: %w", deadLetterQueue, err)
+		}
+		if !ok {
+			break
+		}
+		dl := ParseDeadLetter(d)
+		if match != nil && !match(dl) {
+			skipped = &d
+			continue
+		}
+		if err := p.republish(ctx, d); err != nil {
+			_ = d.Nack(false, true)
+			return replayed, fmt.Errorf("replay %s: %w", dl.IdempotencyKey, err)
+		}
+		if err := d.Ack(false); err != nil {
+			return replayed, fmt.Errorf("remove %s from %s: %w", dl.IdempotencyKey, deadLetterQueue, err)
+		}
+		slog.InfoContext(ctx, "dead letter replayed", "idempotency_key", dl.IdempotencyKey, "kind", dl.Kind, "reason", dl.Reason)
+		replayed = append(replayed, dl)
+	}
+	return replayed, nil
+}
+
+// republish publishes a delivery's body and headers again to the publisher's exchange and waits
+// for the broker to confirm it, if the channel is in confirm mode.
+func (p *Publisher) republish(ctx context.Context, d amqp.Delivery) error {
+	headers := amqp.Table{}
+	for k, v := range d.Headers {
+		// The broker's dead-lettering history is dropped: the message starts afresh.
+		if k != "x-death" && !strings.HasPrefix(k, "x-first-death-") && !strings.HasPrefix(k, "x-last-death-") {
+			headers[k] = v
+		}
+	}
+	c, err := p.ch.PublishWithDeferredConfirmWithContext(ctx, p.exchange, p.routingKey, false, false, amqp.Publishing{
+		ContentType:  d.ContentType,
+		Headers:      headers,
+		Body:         d.Body,
+		DeliveryMode: amqp.Persistent,
+	})
+	if err != nil || c == nil {
+		return err
+	}
+	ok, err := c.WaitContext(ctx)
+	if err == nil && !ok {
+		err = ErrNotConfirmed
+	}
+	return err
+}
@@ -0,0 +1,47 @@
+package queue_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Bharat0908/ledger/internal/queue"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestParseDeadLetter(t *testing.T) {
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	deaths := amqp.Table{"x-death": []interface{}{
+		amqp.Table{"reason": "rejected", "queue": "tx-queue", "count": int64(2), "time": at},
+		amqp.Table{"reason": "expired", "queue": "other", "count": int64(1)},
+	}}
+	tests := []struct {
+		name string
+		d    amqp.Delivery
+		want queue.DeadLetter
+	}{
+		{
+			name: "transaction",
+			d:    amqp.Delivery{Headers: deaths, Body: []byte(`{"account_id":"a","type":"withdraw","amount":5,"idempotency_key":"k1"}`)},
+			want: queue.DeadLetter{IdempotencyKey: "k1", Kind: "transaction", Reason: "rejected", Queue: "tx-queue", Count: 2, DeadLetteredAt: at},
+		},
+		{
+			name: "transfer",
+			d:    amqp.Delivery{Headers: deaths, Body: []byte(`{"from_account_id":"a","to_account_id":"b","amount":5,"idempotency_key":"k2"}`)},
+			want: queue.DeadLetter{IdempotencyKey: "k2", Kind: "transfer", Reason: "rejected", Queue: "tx-queue", Count: 2, DeadLetteredAt: at},
+		},
+		{
+			name: "unreadable without history",
+			d:    amqp.Delivery{Body: []byte(`not json`)},
+			want: queue.DeadLetter{Kind: "unknown"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := queue.ParseDeadLetter(tt.d)
+			tt.want.Body = string(tt.d.Body)
+			if got != tt.want {
+				t.Errorf("ParseDeadLetter() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
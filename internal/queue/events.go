@@ -0,0 +1,137 @@
+package queue
+
+import (
+	"context"
+	"time"
+
+	"github.com/Bharat0908/ledger/internal/metrics"
+	"github.com/google/uuid"
+)
+
+// Event types published after the worker settles a message.
+const (
+	// EventTransactionApplied reports a transaction or transfer that was applied.
+	EventTransactionApplied = "transaction.applied"
+	// EventTransactionRejected reports a transaction or transfer refused by a business rule, such
+	// as insufficient funds; Reason carries the domain error code.
+	EventTransactionRejected = "transaction.rejected"
+	// EventBalanceChanged reports the new balance of one account; a transfer produces one for
+	// each side.
+	EventBalanceChanged = "account.balance_changed"
+)
+
+// EventTypes lists every event type, for validating subscriptions.
+var EventTypes = []string{EventTransactionApplied, EventTransactionRejected, EventBalanceChanged}
+
+// Event is a ledger event for downstream consumers. Events are delivered at least once: a
+// message that is redelivered produces its events again, with the same ID, so subscribers
+// should deduplicate on ID.
+type Event struct {
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	OccurredAt time.Time `json:"occurred_at"`
+	// AccountID is the account the event is routed by: the account whose balance changed, or
+	// the account of a transaction or the source of a transfer.
+	AccountID      string `json:"account_id"`
+	Kind           string `json:"kind"` // transaction or transfer
+	IdempotencyKey string `json:"idempotency_key"`
+	// TransactionType is deposit or withdraw for transactions.
+	TransactionType string `json:"transaction_type,omitempty"`
+	FromAccountID   string `json:"from_account_id,omitempty"`
+	ToAccountID     string `json:"to_account_id,omitempty"`
+	Amount          int64  `json:"amount"`
+	// Delta is the signed change to AccountID's balance, and BalanceAfter the balance it left,
+	// on account.balance_changed events.
+	Delta        int64  `json:"delta,omitempty"`
+	BalanceAfter *int64 `json:"balance_after,omitempty"`
+	// Reason is the domain error code of a transaction.rejected event.
+	Reason      string    `json:"reason,omitempty"`
+	RequestedAt time.Time `json:"requested_at"`
+}
+
+// RoutingKey returns the event's topic routing key, "<type>.<account id>", so subscribers can
+// bind to one event type ("transaction.applied.*"), one account ("*.*.<id>") or everything ("#").
+func (e Event) RoutingKey() string { return e.Type + "." + e.AccountID }
+
+// EventPublisher publishes ledger events. Consumer and LocalQueue publish the events of a message
+// before settling it, and requeue the message if publishing fails.
+type EventPublisher interface {
+	PublishEvents(ctx context.Context, events []Event) error
+}
+
+// EventPublishers publishes events to each of its publishers in turn, stopping at the first
+// failure. Since the message is then requeued, publishers that already succeeded see the events
+// again, with the same IDs.
+type EventPublishers []EventPublisher
+
+// PublishEvents publishes events to every publisher.
+func (ps EventPublishers) PublishEvents(ctx context.Context, events []Event) error {
+	for _, p := range ps {
+		if err := p.PublishEvents(ctx, events); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// eventNamespace seeds event IDs, which are derived from the message's idempotency key so a
+// redelivered message yields the same IDs.
+var eventNamespace = uuid.MustParse("0f0f4a43-4f1c-4ad5-9d8a-3c5e1f3b6a51")
+
+// newEvent returns an event of type typ routed by account for the message identified by key.
+// Idempotency keys are unique per source account, the account of a transaction or the source of
+// a transfer, so the ID is derived from the source as well: a deposit to an account and a
+// transfer into it may share a key and still get distinct IDs.
+func newEvent(typ, kind, source, account, key string, requestedAt time.Time) Event {
+	return Event{
+		ID:             uuid.NewSHA1(eventNamespace, []byte(typ+"|"+source+"|"+account+"|"+key)).String(),
+		Type:           typ,
+		OccurredAt:     time.Now().UTC(),
+		AccountID:      account,
+		Kind:           kind,
+		IdempotencyKey: key,
+		RequestedAt:    requestedAt,
+	}
+}
+
+// transactionEvents returns the events of an applied transaction: transaction.applied and the
+// account's account.balance_changed.
+func transactionEvents(m TxMessage, balanceAfter int64) []Event {
+	applied := newEvent(EventTransactionApplied, metrics.KindTransaction, m.AccountID, m.AccountID, m.Key, m.CreatedAt)
+	applied.TransactionType, applied.Amount = m.Type, m.Amount
+	changed := newEvent(EventBalanceChanged, metrics.KindTransaction, m.AccountID, m.AccountID, m.Key, m.CreatedAt)
+	changed.TransactionType, changed.Amount = m.Type, m.Amount
+	changed.Delta, changed.BalanceAfter = m.Amount, &balanceAfter
+	if m.Type == "withdraw" {
+		changed.Delta = -m.Amount
+	}
+	return []Event{applied, changed}
+}
+
+// transferEvents returns the events of an applied transfer: transaction.applied, routed by the
+// source account, and an account.balance_changed for each side.
+func transferEvents(t TransferMessage, fromAfter, toAfter int64) []Event {
+	events := []Event{newEvent(EventTransactionApplied, metrics.KindTransfer, t.FromAccountID, t.FromAccountID, t.Key, t.CreatedAt)}
+	for _, side := range []struct {
+		account string
+		delta   int64
+		after   int64
+	}{{t.FromAccountID, -t.Amount, fromAfter}, {t.ToAccountID, t.Amount, toAfter}} {
+		after := side.after
+		e := newEvent(EventBalanceChanged, metrics.KindTransfer, t.FromAccountID, side.account, t.Key, t.CreatedAt)
+		e.Delta, e.BalanceAfter = side.delta, &after
+		events = append(events, e)
+	}
+	for i := range events {
+		events[i].FromAccountID, events[i].ToAccountID, events[i].Amount = t.FromAccountID, t.ToAccountID, t.Amount
+	}
+	return events
+}
+
+// rejectedEvent returns the transaction.rejected event of a message refused with the domain
+// error code reason, routed by account.
+func rejectedEvent(kind, account, key, reason string, requestedAt time.Time) Event {
+	e := newEvent(EventTransactionRejected, kind, account, account, key, requestedAt)
+	e.Reason = reason
+	return e
+}
@@ -0,0 +1,352 @@
+package queue_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Bharat0908/ledger/internal/queue"
+	"github.com/Bharat0908/ledger/internal/repo"
+	"github.com/Bharat0908/ledger/internal/webhook"
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// recordingChannel records what is published to it, failing while err is set.
+type recordingChannel struct {
+	mu   sync.Mutex
+	err  error
+	msgs []published
+}
+
+type published struct {
+	exchange, key string
+	msg           amqp.Publishing
+}
+
+func (c *recordingChannel) PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	c.msgs = append(c.msgs, published{exchange, key, msg})
+	return nil
+}
+
+func (c *recordingChannel) published() []published {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]published(nil), c.msgs...)
+}
+
+// scriptedApplier applies everything, or fails with err.
+type scriptedApplier struct{ err error }
+
+func (a *scriptedApplier) Apply(ctx context.Context, accID, typ string, amount int64, key string) (int64, error) {
+	return 100 + amount, a.err
+}
+
+func (a *scriptedApplier) ApplyTransfer(ctx context.Context, from, to string, amount int64, key string) (int64, int64, error) {
+	return 100 - amount, amount, a.err
+}
+
+// consume runs body through a Consumer publishing events to ch and returns how it was settled.
+func consume(t *testing.T, applier queue.BalanceApplier, ch *recordingChannel, body any) string {
+	t.Helper()
+	return consumeTo(t, applier, queue.NewEventExchange(ch, "ledger.events"), body)
+}
+
+// consumeTo runs body through a Consumer publishing events to events and returns how it was
+// settled.
+func consumeTo(t *testing.T, applier queue.BalanceApplier, events queue.EventPublisher, body any) string {
+	t.Helper()
+	return run(t, &queue.Consumer{Applier: applier, Events: events}, body)
+}
+
+// run delivers body to c, reading from a fake channel, and returns how it was settled.
+func run(t *testing.T, c *queue.Consumer, body any) string {
+	t.Helper()
+	fc := newFakeChannel(1)
+	var s settlements
+	c.Ch, c.Queue = fc, "q"
+	errc := startConsumer(t, context.Background(), c)
+	b, _ := json.Marshal(body)
+	fc.deliveries <- amqp.Delivery{Acknowledger: &s, DeliveryTag: 1, Body: b}
+	for i := 0; s.get(1) == "" && i < 1000; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := c.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() failed: %v", err)
+	}
+	<-errc
+	return s.get(1)
+}
+
+func TestConsumer_PublishesEvents(t *testing.T) {
+	tx := queue.TxMessage{AccountID: "acc-a", Type: "withdraw", Amount: 30, Key: "k1", CreatedAt: time.Now()}
+	tr := queue.TransferMessage{FromAccountID: "acc-a", ToAccountID: "acc-b", Amount: 40, Key: "k2", CreatedAt: time.Now()}
+	tests := []struct {
+		name        string
+		applyErr    error
+		body        any
+		wantSettled string
+		wantKeys    []string
+		check       func(t *testing.T, events []queue.Event)
+	}{
+		{
+			name: "transaction applied", body: tx, wantSettled: "ack",
+			wantKeys: []string{"transaction.applied.acc-a", "account.balance_changed.acc-a"},
+			check: func(t *testing.T, events []queue.Event) {
+				if c := events[1]; c.Delta != -30 || c.BalanceAfter == nil || *c.BalanceAfter != 130 {
+					t.Errorf("balance_changed = %+v, want delta -30 and balance 130", c)
+				}
+			},
+		},
+		{
+			name: "transfer applied", body: tr, wantSettled: "ack",
+			wantKeys: []string{"transaction.applied.acc-a", "account.balance_changed.acc-a", "account.balance_changed.acc-b"},
+			check: func(t *testing.T, events []queue.Event) {
+				from, to := events[1], events[2]
+				if from.Delta != -40 || *from.BalanceAfter != 60 || to.Delta != 40 || *to.BalanceAfter != 40 {
+					t.Errorf("balance_changed = %+v, %+v; want -40 to 60 and +40 to 40", from, to)
+				}
+				if from.ToAccountID != "acc-b" || from.Kind != "transfer" {
+					t.Errorf("balance_changed = %+v, want the transfer's details", from)
+				}
+			},
+		},
+		{
+			name: "transaction rejected", body: tx, applyErr: repo.ErrInsufficientFunds, wantSettled: "drop",
+			wantKeys: []string{"transaction.rejected.acc-a"},
+			check: func(t *testing.T, events []queue.Event) {
+				if events[0].Reason != "insufficient_funds" || events[0].Amount != 30 {
+					t.Errorf("rejected = %+v, want reason insufficient_funds", events[0])
+				}
+			},
+		},
+		{
+			name: "transient failure", body: tr, applyErr: errors.New("connection reset"), wantSettled: "requeue",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch := &recordingChannel{}
+			if got := consume(t, &scriptedApplier{err: tt.applyErr}, ch, tt.body); got != tt.wantSettled {
+				t.Errorf("settled %q, want %q", got, tt.wantSettled)
+			}
+			msgs := ch.published()
+			var events []queue.Event
+			for i, m := range msgs {
+				var e queue.Event
+				if err := json.Unmarshal(m.msg.Body, &e); err != nil {
+					t.Fatalf("event %d: %v", i, err)
+				}
+				if m.exchange != "ledger.events" || m.key != e.RoutingKey() || m.msg.MessageId != e.ID || m.msg.Type != e.Type {
+					t.Errorf("event %d published as %s/%s id %s type %s, want it to match %+v", i, m.exchange, m.key, m.msg.MessageId, m.msg.Type, e)
+				}
+				events = append(events, e)
+			}
+			if fmt.Sprint(keys(msgs)) != fmt.Sprint(tt.wantKeys) {
+				t.Fatalf("routing keys = %v, want %v", keys(msgs), tt.wantKeys)
+			}
+			if tt.check != nil {
+				tt.check(t, events)
+			}
+		})
+	}
+}
+
+func TestConsumer_EventPublishFailureRequeues(t *testing.T) {
+	tx := queue.TxMessage{AccountID: "acc-a", Type: "deposit", Amount: 5, Key: "k3", CreatedAt: time.Now()}
+	ch := &recordingChannel{err: errors.New("channel closed")}
+	if got := consume(t, &scriptedApplier{}, ch, tx); got != "requeue" {
+		t.Errorf("settled %q, want requeue when events cannot be published", got)
+	}
+
+	// The redelivery publishes events with the same IDs, so subscribers can drop duplicates.
+	ch.err = nil
+	consume(t, &scriptedApplier{}, ch, tx)
+	consume(t, &scriptedApplier{}, ch, tx)
+	msgs := ch.published()
+	if len(msgs) != 4 || msgs[0].msg.MessageId != msgs[2].msg.MessageId || msgs[0].msg.MessageId == msgs[1].msg.MessageId {
+		t.Errorf("event IDs = %v, want stable IDs across redeliveries", ids(msgs))
+	}
+}
+
+// entryLedger is a LedgerWriter keeping the first write of every entry, as MongoRepo does.
+type entryLedger struct {
+	mu      sync.Mutex
+	entries map[string]int64 // balance after, by account, source, type and key
+	writes  int
+}
+
+func (l *entryLedger) Write(ctx context.Context, accID, typ string, amount, balanceAfter int64, key string, at time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.write(accID, accID, typ, key, balanceAfter)
+	return nil
+}
+
+func (l *entryLedger) WriteTransfer(ctx context.Context, from, to string, amount, fromAfter, toAfter int64, key string, at time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.write(from, from, "transfer_debit", key, fromAfter)
+	l.write(to, from, "transfer_credit", key, toAfter)
+	return nil
+}
+
+func (l *entryLedger) write(accID, source, typ, key string, balanceAfter int64) {
+	if l.entries == nil {
+		l.entries = map[string]int64{}
+	}
+	l.writes++
+	id := accID + "|" + source + "|" + typ + "|" + key
+	if _, ok := l.entries[id]; !ok {
+		l.entries[id] = balanceAfter
+	}
+}
+
+func TestConsumer_EventPublishFailureWritesLedgerOnce(t *testing.T) {
+	tests := []struct {
+		name string
+		body any
+		want int
+	}{
+		{"transaction", queue.TxMessage{AccountID: "acc-a", Type: "deposit", Amount: 5, Key: "k4", CreatedAt: time.Now()}, 1},
+		{"transfer", queue.TransferMessage{FromAccountID: "acc-a", ToAccountID: "acc-b", Amount: 5, Key: "k4", CreatedAt: time.Now()}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch := &recordingChannel{err: errors.New("channel closed")}
+			ledger := &entryLedger{}
+			c := func() *queue.Consumer {
+				return &queue.Consumer{Applier: &scriptedApplier{}, Ledger: ledger, Events: queue.NewEventExchange(ch, "ledger.events")}
+			}
+			if got := run(t, c(), tt.body); got != "requeue" {
+				t.Fatalf("settled %q, want requeue when events cannot be published", got)
+			}
+			ch.err = nil
+			if got := run(t, c(), tt.body); got != "ack" {
+				t.Fatalf("settled %q on redelivery, want ack", got)
+			}
+			if ledger.writes != 2*tt.want {
+				t.Errorf("ledger got %d writes, want the redelivery written again", ledger.writes)
+			}
+			if len(ledger.entries) != tt.want {
+				t.Errorf("ledger has %d entries, want %d", len(ledger.entries), tt.want)
+			}
+		})
+	}
+}
+
+func TestConsumer_EventsOfSharedKeys(t *testing.T) {
+	// Keys are unique per source account, so a deposit to an account and a transfer into it
+	// may share one; their events must not be taken for redeliveries of each other.
+	ctx := context.Background()
+	store, err := repo.OpenSQLite(ctx, ":memory:")
+	if err != nil {
+		t.Fatalf("OpenSQLite() failed: %v", err)
+	}
+	defer store.DB.Close()
+	acc, other := uuid.New(), uuid.New()
+	hook, err := store.CreateWebhook(ctx, repo.NewWebhook{URL: "http://hook", EventTypes: []string{queue.EventBalanceChanged},
+		AccountIDs: []uuid.UUID{acc}, Secret: []byte("whsec_test")})
+	if err != nil {
+		t.Fatalf("CreateWebhook() failed: %v", err)
+	}
+	ch := &recordingChannel{}
+	events := queue.EventPublishers{queue.NewEventExchange(ch, "ledger.events"), &webhook.Dispatcher{Store: store}}
+	for _, body := range []any{
+		queue.TxMessage{AccountID: acc.String(), Type: "deposit", Amount: 5, Key: "shared", CreatedAt: time.Now()},
+		queue.TransferMessage{FromAccountID: other.String(), ToAccountID: acc.String(), Amount: 7, Key: "shared", CreatedAt: time.Now()},
+	} {
+		if got := consumeTo(t, &scriptedApplier{}, events, body); got != "ack" {
+			t.Fatalf("settled %q, want ack", got)
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, m := range ch.published() {
+		if seen[m.msg.MessageId] {
+			t.Errorf("event ID %s published twice in %v", m.msg.MessageId, ids(ch.published()))
+		}
+		seen[m.msg.MessageId] = true
+	}
+	ds, err := store.ListWebhookDeliveries(ctx, hook.ID, 10)
+	if err != nil {
+		t.Fatalf("ListWebhookDeliveries() failed: %v", err)
+	}
+	if len(ds) != 2 {
+		t.Errorf("webhook got %d deliveries, want the balance changes of the deposit and the transfer", len(ds))
+	}
+}
+
+func keys(msgs []published) []string {
+	var out []string
+	for _, m := range msgs {
+		out = append(out, m.key)
+	}
+	return out
+}
+
+func ids(msgs []published) []string {
+	var out []string
+	for _, m := range msgs {
+		out = append(out, m.msg.MessageId)
+	}
+	return out
+}
+
+// subscriberChannel records queue bindings and hands out deliveries.
+type subscriberChannel struct {
+	bindings   []string
+	deliveries chan amqp.Delivery
+}
+
+func (c *subscriberChannel) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error) {
+	return amqp.Queue{Name: "amq.gen-1"}, nil
+}
+
+func (c *subscriberChannel) QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error {
+	c.bindings = append(c.bindings, exchange+":"+key)
+	return nil
+}
+
+func (c *subscriberChannel) Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error) {
+	return c.deliveries, nil
+}
+
+// eventRecorder is an EventPublisher that records event IDs.
+type eventRecorder struct{ ids chan string }
+
+func (r eventRecorder) PublishEvents(ctx context.Context, events []queue.Event) error {
+	for _, e := range events {
+		r.ids <- e.ID
+	}
+	return nil
+}
+
+func TestSubscribeEvents(t *testing.T) {
+	ch := &subscriberChannel{deliveries: make(chan amqp.Delivery, 2)}
+	rec := eventRecorder{ids: make(chan string, 2)}
+	b, _ := json.Marshal(queue.Event{ID: "e1", Type: queue.EventBalanceChanged})
+	ch.deliveries <- amqp.Delivery{Body: []byte("{")}
+	ch.deliveries <- amqp.Delivery{Body: b}
+	close(ch.deliveries)
+
+	err := queue.SubscribeEvents(context.Background(), ch, "ledger.events", []string{"account.balance_changed.*"}, rec)
+	if !errors.Is(err, queue.ErrDeliveriesClosed) {
+		t.Fatalf("SubscribeEvents() error = %v, want ErrDeliveriesClosed", err)
+	}
+	if fmt.Sprint(ch.bindings) != "[ledger.events:account.balance_changed.*]" {
+		t.Errorf("bindings = %v", ch.bindings)
+	}
+	if len(rec.ids) != 1 || <-rec.ids != "e1" {
+		t.Error("SubscribeEvents() did not pass on exactly the readable event")
+	}
+}
@@ -0,0 +1,63 @@
+package queue
+
+import (
+	"context"
+
+	"github.com/Bharat0908/ledger/internal/logging"
+	"github.com/Bharat0908/ledger/internal/tracing"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// requestIDHeader carries the ID of the API request that enqueued a message, so the worker's log
+// lines for the message can be matched with the API's.
+const requestIDHeader = "x-request-id"
+
+// headerCarrier adapts AMQP message headers to the OpenTelemetry propagation API, so trace
+// context travels with each message from Publisher to Consumer.
+type headerCarrier amqp.Table
+
+func (c headerCarrier) Get(key string) string {
+	v, _ := c[key].(string)
+	return v
+}
+
+func (c headerCarrier) Set(key, value string) { c[key] = value }
+
+func (c headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// Messaging systems recorded on queue spans.
+var (
+	systemRabbitMQ = semconv.MessagingSystemRabbitmq
+	systemLocal    = semconv.MessagingSystemKey.String("local")
+)
+
+// startPublish starts a producer span for a message published to destination and returns the
+// headers carrying its trace context and request ID.
+func startPublish(ctx context.Context, system attribute.KeyValue, destination string) (context.Context, trace.Span, amqp.Table) {
+	ctx, span := tracing.Start(ctx, destination+" publish", trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(system, semconv.MessagingDestinationName(destination)))
+	headers := amqp.Table{}
+	tracing.Inject(ctx, headerCarrier(headers))
+	if id := logging.RequestID(ctx); id != "" {
+		headers[requestIDHeader] = id
+	}
+	return ctx, span, headers
+}
+
+// startProcess starts a consumer span for a message received from queue, continuing the trace
+// and carrying the request ID found in its headers.
+func startProcess(ctx context.Context, system attribute.KeyValue, queue string, headers amqp.Table) (context.Context, trace.Span) {
+	ctx = tracing.Extract(ctx, headerCarrier(headers))
+	ctx = logging.WithRequestID(ctx, headerCarrier(headers).Get(requestIDHeader))
+	return tracing.Start(ctx, queue+" process", trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(system, semconv.MessagingDestinationName(queue)))
+}
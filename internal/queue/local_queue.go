@@ -0,0 +1,99 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/Bharat0908/ledger/internal/metrics"
+	"github.com/Bharat0908/ledger/internal/tracing"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// LocalQueue is an in-process replacement for the RabbitMQ Publisher and Consumer pair.
+// Messages are buffered in a channel and applied by Start using the same processing rules
+// as Consumer, which lets the API run as a single binary for demos, tests and edge sites.
+// Messages are not persisted: anything still buffered when the process exits is lost.
+type LocalQueue struct {
+	Applier BalanceApplier
+	Ledger  LedgerWriter
+	// Events, when set, receives the events of every applied or rejected message.
+	Events EventPublisher
+	// RetryDelay is how long a message that failed transiently waits before being retried.
+	RetryDelay time.Duration
+
+	msgs chan localMessage
+}
+
+// localMessage is a buffered message body with the headers carrying its trace context.
+type localMessage struct {
+	body    []byte
+	headers amqp.Table
+}
+
+// localDestination names the in-process queue in spans.
+const localDestination = "local"
+
+// NewLocalQueue creates a LocalQueue buffering up to size messages. Ledger may be nil when the
+// applier records ledger entries itself (as repo.SQLiteRepo does).
+func NewLocalQueue(size int, applier BalanceApplier, ledger LedgerWriter) *LocalQueue {
+	return &LocalQueue{Applier: applier, Ledger: ledger, RetryDelay: time.Second, msgs: make(chan localMessage, size)}
+}
+
+// Publish enqueues a TxMessage. It blocks while the buffer is full until ctx is done.
+func (q *LocalQueue) Publish(ctx context.Context, msg TxMessage) error {
+	b, _ := json.Marshal(msg)
+	return q.publish(ctx, metrics.KindTransaction, b)
+}
+
+// PublishTransfer enqueues a TransferMessage. It blocks while the buffer is full until ctx is done.
+func (q *LocalQueue) PublishTransfer(ctx context.Context, msg TransferMessage) error {
+	b, _ := json.Marshal(msg)
+	return q.publish(ctx, metrics.KindTransfer, b)
+}
+
+// PublishTransfers enqueues a batch of TransferMessages, returning one error per message, in
+// order. Once ctx is done, the messages not yet buffered fail with its error.
+func (q *LocalQueue) PublishTransfers(ctx context.Context, msgs []TransferMessage) []error {
+	errs := make([]error, len(msgs))
+	for i, msg := range msgs {
+		errs[i] = q.PublishTransfer(ctx, msg)
+	}
+	return errs
+}
+
+func (q *LocalQueue) publish(ctx context.Context, kind string, body []byte) (err error) {
+	ctx, span, headers := startPublish(ctx, systemLocal, localDestination)
+	defer tracing.End(span, &err)
+	return observePublish(kind, q.enqueue(ctx, localMessage{body: body, headers: headers}))
+}
+
+func (q *LocalQueue) enqueue(ctx context.Context, m localMessage) error {
+	select {
+	case q.msgs <- m:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Start processes queued messages until ctx is canceled. Messages that fail transiently are
+// re-enqueued after RetryDelay, mirroring a broker requeue; rejected messages and unknown
+// payloads are dropped.
+func (q *LocalQueue) Start(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case m := <-q.msgs:
+			pctx, span := startProcess(ctx, systemLocal, localDestination, m.headers)
+			o := process(pctx, q.Applier, q.Ledger, q.Events, m.body)
+			span.SetAttributes(attribute.String("ledger.outcome", o.String()))
+			span.End()
+			if o == outcomeRequeue {
+				time.AfterFunc(q.RetryDelay, func() { _ = q.enqueue(ctx, m) })
+			}
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package queue_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Bharat0908/ledger/internal/logging"
+	"github.com/Bharat0908/ledger/internal/metrics"
+	"github.com/Bharat0908/ledger/internal/queue"
+	"github.com/Bharat0908/ledger/internal/tracing"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// flakyApplier fails its first fail calls, then applies everything, reporting each application.
+type flakyApplier struct {
+	fail    int
+	applied chan string
+}
+
+func (a *flakyApplier) Apply(ctx context.Context, accID, typ string, amount int64, key string) (int64, error) {
+	if a.fail > 0 {
+		a.fail--
+		return 0, errors.New("connection reset")
+	}
+	a.applied <- key
+	return amount, nil
+}
+
+func (a *flakyApplier) ApplyTransfer(ctx context.Context, from, to string, amount int64, key string) (int64, int64, error) {
+	a.applied <- key
+	return 0, amount, nil
+}
+
+func TestLocalQueue_Metrics(t *testing.T) {
+	applier := &flakyApplier{fail: 1, applied: make(chan string, 2)}
+	q := queue.NewLocalQueue(4, applier, nil)
+	q.RetryDelay = time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.Start(ctx)
+
+	counter := func(kind, outcome string) float64 {
+		return testutil.ToFloat64(metrics.Consumed.WithLabelValues(kind, outcome))
+	}
+	acks, requeues := counter(metrics.KindTransaction, "ack"), counter(metrics.KindTransaction, "requeue")
+	transferAcks := counter(metrics.KindTransfer, "ack")
+	published := testutil.ToFloat64(metrics.Published.WithLabelValues(metrics.KindTransaction, "ok"))
+
+	created := time.Now().Add(-time.Second)
+	if err := q.Publish(ctx, queue.TxMessage{AccountID: "a", Type: "deposit", Amount: 5, Key: "k1", CreatedAt: created}); err != nil {
+		t.Fatalf("Publish() failed: %v", err)
+	}
+	if err := q.PublishTransfer(ctx, queue.TransferMessage{FromAccountID: "a", ToAccountID: "b", Amount: 5, Key: "k2", CreatedAt: created}); err != nil {
+		t.Fatalf("PublishTransfer() failed: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case <-applier.applied:
+		case <-time.After(5 * time.Second):
+			t.Fatal("messages were not applied")
+		}
+	}
+	// The counters are incremented just after the applier returns.
+	deadline := time.Now().Add(time.Second)
+	for (counter(metrics.KindTransaction, "ack") == acks || counter(metrics.KindTransfer, "ack") == transferAcks) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	if got := testutil.ToFloat64(metrics.Published.WithLabelValues(metrics.KindTransaction, "ok")) - published; got != 1 {
+		t.Errorf("published transactions = %v, want 1", got)
+	}
+	if got := counter(metrics.KindTransaction, "requeue") - requeues; got != 1 {
+		t.Errorf("requeued transactions = %v, want 1", got)
+	}
+	if got := counter(metrics.KindTransaction, "ack") - acks; got != 1 {
+		t.Errorf("acked transactions = %v, want 1", got)
+	}
+	if got := counter(metrics.KindTransfer, "ack") - transferAcks; got != 1 {
+		t.Errorf("acked transfers = %v, want 1", got)
+	}
+}
+
+// contextApplier reports the context each applied message was processed in.
+type contextApplier struct{ ctxs chan context.Context }
+
+func (a contextApplier) Apply(ctx context.Context, accID, typ string, amount int64, key string) (int64, error) {
+	a.ctxs <- ctx
+	return amount, nil
+}
+
+func (a contextApplier) ApplyTransfer(ctx context.Context, from, to string, amount int64, key string) (int64, int64, error) {
+	a.ctxs <- ctx
+	return 0, amount, nil
+}
+
+func TestLocalQueue_PropagatesContext(t *testing.T) {
+	if _, err := tracing.Setup(context.Background(), "test"); err != nil {
+		t.Fatalf("Setup() failed: %v", err)
+	}
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider())
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	applier := contextApplier{ctxs: make(chan context.Context, 1)}
+	q := queue.NewLocalQueue(1, applier, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.Start(ctx)
+
+	reqCtx, span := tracing.Start(logging.WithRequestID(context.Background(), "req-1"), "POST /v1/transfers")
+	defer span.End()
+	if err := q.PublishTransfer(reqCtx, queue.TransferMessage{FromAccountID: "a", ToAccountID: "b", Amount: 5, Key: "k"}); err != nil {
+		t.Fatalf("PublishTransfer() failed: %v", err)
+	}
+	select {
+	case ctx := <-applier.ctxs:
+		if got, want := trace.SpanContextFromContext(ctx).TraceID(), span.SpanContext().TraceID(); got != want {
+			t.Errorf("applied in trace %s, want the publisher's %s", got, want)
+		}
+		if got := logging.RequestID(ctx); got != "req-1" {
+			t.Errorf("applied with request id %q, want the publisher's req-1", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("message was not applied")
+	}
+}
+
+func TestLocalQueue_PublishTransfers(t *testing.T) {
+	q := queue.NewLocalQueue(2, &flakyApplier{applied: make(chan string, 3)}, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	msgs := []queue.TransferMessage{
+		{FromAccountID: "a", ToAccountID: "b", Amount: 1, Key: "b1"},
+		{FromAccountID: "a", ToAccountID: "b", Amount: 2, Key: "b2"},
+		{FromAccountID: "a", ToAccountID: "b", Amount: 3, Key: "b3"},
+	}
+	errs := q.PublishTransfers(ctx, msgs)
+	if len(errs) != 3 || errs[0] != nil || errs[1] != nil || !errors.Is(errs[2], context.DeadlineExceeded) {
+		t.Errorf("PublishTransfers() = %v, want the message that did not fit the buffer to fail", errs)
+	}
+}
@@ -3,9 +3,18 @@ package queue
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/Bharat0908/ledger/internal/metrics"
+	"github.com/Bharat0908/ledger/internal/repo"
+	"github.com/google/uuid"
 	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // Interfaces for dependency injection
@@ -16,37 +25,89 @@ type BalanceApplier interface {
 
 // LedgerWriter defines methods for writing ledger entries, including single account operations
 // and transfers between accounts. Implementations are responsible for persisting these entries
-// with the provided context, account identifiers, transaction details, and timestamps.
+// with the provided context, account identifiers, transaction details, and timestamps. A message
+// is written again when it is redelivered, so writes must be idempotent per account, source
+// account, type and idempotency key.
 type LedgerWriter interface {
 	Write(ctx context.Context, accID, typ string, amount, balanceAfter int64, key string, at time.Time) error
 	WriteTransfer(ctx context.Context, from, to string, amount, fromAfter, toAfter int64, key string, at time.Time) error
 }
 
+// Channel is the part of *amqp.Channel used by Consumer.
+type Channel interface {
+	Qos(prefetchCount, prefetchSize int, global bool) error
+	Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error)
+	Cancel(consumer string, noWait bool) error
+}
+
 // Consumer represents a RabbitMQ consumer that processes messages from a specified queue.
 // It holds a reference to the AMQP channel, the queue name, a BalanceApplier for applying balance changes,
-// and a LedgerWriter for recording ledger entries.
+// and a LedgerWriter for recording ledger entries. Ledger may be nil when the BalanceApplier already
+// records ledger entries in the same transaction as the balance change (Postgres-only mode).
 type Consumer struct {
-	Ch      *amqp.Channel
+	Ch      Channel
 	Queue   string
 	Applier BalanceApplier
 	Ledger  LedgerWriter
+	// Events, when set, receives the events of every applied or rejected message before the
+	// message is acknowledged.
+	Events EventPublisher
+	// Concurrency is how many messages are processed at once, and the channel's prefetch count
+	// (default 1, which applies messages in queue order).
+	Concurrency int
+
+	once     sync.Once
+	tag      string
+	stopping chan struct{} // closed when the consumer stops taking deliveries
+	stopOnce sync.Once
+	done     chan struct{} // closed when Start returns
+	started  atomic.Bool
+	drained  atomic.Int64
+	mu       sync.Mutex
+	cancel   context.CancelFunc // cancels the context of in-flight messages
+}
+
+// ErrDeliveriesClosed is returned by Start when the broker closes the delivery channel, such as
+// when the connection is lost, without the consumer having been stopped.
+var ErrDeliveriesClosed = errors.New("queue: delivery channel closed")
+
+func (c *Consumer) init() {
+	c.once.Do(func() {
+		c.tag = "ledger-worker-" + uuid.NewString()
+		c.stopping = make(chan struct{})
+		c.done = make(chan struct{})
+	})
 }
 
 // Start begins consuming messages from the configured RabbitMQ queue and processes them.
 // It listens for messages of type TxMessage or TransferMessage, applies the corresponding
 // ledger operations, and acknowledges or negatively acknowledges messages based on the
-// processing result. The method runs until the provided context is canceled, at which point
-// it returns. If an error occurs during queue consumption setup, it is returned immediately.
+// processing result. Up to Concurrency messages are processed at once.
 //
-// Parameters:
-//   - ctx: Context for cancellation and timeout control.
+// Start runs until ctx is canceled or Shutdown is called. Either way it stops taking deliveries,
+// cancels the broker consumer and waits for the messages in flight to be settled before it
+// returns. Messages are processed with a context that ctx's cancellation does not reach, so a
+// transaction is never cut off halfway; only Shutdown's deadline interrupts them.
 //
 // Returns:
-//   - error: An error if queue consumption setup fails or if the context is canceled.
+//   - error: nil after Shutdown, ctx.Err() when ctx is canceled, ErrDeliveriesClosed if the
+//     broker closes the delivery channel, or an error if queue consumption setup fails.
 func (c *Consumer) Start(ctx context.Context) error {
+	c.init()
+	if !c.started.CompareAndSwap(false, true) {
+		return errors.New("queue: consumer already started")
+	}
+	defer close(c.done)
+	n := c.Concurrency
+	if n < 1 {
+		n = 1
+	}
+	if err := c.Ch.Qos(n, 0, false); err != nil {
+		return err
+	}
 	deliveries, err := c.Ch.Consume(
 		c.Queue,
-		"",
+		c.tag,
 		false,
 		false,
 		false,
@@ -56,46 +117,262 @@ func (c *Consumer) Start(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
+	if c.stopped() {
+		// Shutdown raced with Consume and may have cancelled nothing.
+		_ = c.Ch.Cancel(c.tag, false)
+	}
+	slog.InfoContext(ctx, "consuming", "queue", c.Queue, "concurrency", n)
 
-	for {
+	work, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancel()
+	c.mu.Lock()
+	c.cancel = cancel
+	c.mu.Unlock()
+	go func() {
 		select {
 		case <-ctx.Done():
-			return ctx.Err()
-		case d := <-deliveries:
-			var m TxMessage
-			if err := json.Unmarshal(d.Body, &m); err == nil && m.AccountID != "" {
-				bal, err := c.Applier.Apply(ctx, m.AccountID, m.Type, m.Amount, m.Key)
-				if err != nil {
-					// requeue (true) for transient errors; if permanent, consider DLQ
-					d.Nack(false, true)
-					continue
-				}
-				if err := c.Ledger.Write(ctx, m.AccountID, m.Type, m.Amount, bal, m.Key, m.CreatedAt); err != nil {
-					d.Nack(false, true)
+			c.stop()
+		case <-c.stopping:
+		case <-c.done:
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// The delivery channel is closed once the broker confirms the cancellation.
+			for d := range deliveries {
+				if c.stopped() {
+					// Prefetched but not started: hand it back to the broker right away.
+					_ = d.Nack(false, true)
 					continue
 				}
-				d.Ack(false)
-				continue
+				c.handle(work, d)
 			}
+		}()
+	}
+	wg.Wait()
 
-			// Try as transfer
-			var t TransferMessage
-			if err := json.Unmarshal(d.Body, &t); err == nil && t.FromAccountID != "" && t.ToAccountID != "" {
-				fromAfter, toAfter, err := c.Applier.ApplyTransfer(ctx, t.FromAccountID, t.ToAccountID, t.Amount, t.Key)
-				if err != nil {
-					d.Nack(false, true)
-					continue
-				}
-				if err := c.Ledger.WriteTransfer(ctx, t.FromAccountID, t.ToAccountID, t.Amount, fromAfter, toAfter, t.Key, t.CreatedAt); err != nil {
-					d.Nack(false, true)
-					continue
-				}
-				d.Ack(false)
-				continue
+	switch {
+	case ctx.Err() != nil:
+		return ctx.Err()
+	case c.stopped():
+		return nil
+	default:
+		return ErrDeliveriesClosed
+	}
+}
+
+// Shutdown stops the consumer taking deliveries and cancels it with the broker, which returns
+// any prefetched messages to the queue, then waits for the messages in flight to be settled. If
+// ctx is done first, in-flight messages are interrupted, their transactions roll back and they
+// are requeued, and ctx.Err() is returned. drained is the number of in-flight messages that were
+// settled after Shutdown was called.
+func (c *Consumer) Shutdown(ctx context.Context) (drained int, err error) {
+	c.init()
+	c.stop()
+	if !c.started.Load() {
+		return 0, nil
+	}
+	select {
+	case <-c.done:
+	case <-ctx.Done():
+		drained = int(c.drained.Load())
+		c.mu.Lock()
+		if c.cancel != nil {
+			c.cancel()
+		}
+		c.mu.Unlock()
+		<-c.done
+		return drained, ctx.Err()
+	}
+	return int(c.drained.Load()), nil
+}
+
+// stop stops the consumer taking deliveries and cancels it with the broker.
+func (c *Consumer) stop() {
+	c.stopOnce.Do(func() {
+		close(c.stopping)
+		if !c.started.Load() {
+			return
+		}
+		if err := c.Ch.Cancel(c.tag, false); err != nil {
+			slog.Warn("cancel consumer", "queue", c.Queue, "error", err)
+		}
+	})
+}
+
+func (c *Consumer) stopped() bool {
+	select {
+	case <-c.stopping:
+		return true
+	default:
+		return false
+	}
+}
+
+// handle processes and settles one delivery.
+func (c *Consumer) handle(ctx context.Context, d amqp.Delivery) {
+	pctx, span := startProcess(ctx, systemRabbitMQ, c.Queue, d.Headers)
+	o := process(pctx, c.Applier, c.Ledger, c.Events, d.Body)
+	span.SetAttributes(attribute.String("ledger.outcome", o.String()))
+	span.End()
+	var err error
+	switch o {
+	case outcomeAck:
+		err = d.Ack(false)
+	case outcomeRequeue:
+		// requeue (true) for transient errors; if permanent, consider DLQ
+		err = d.Nack(false, true)
+	default:
+		err = d.Nack(false, false)
+	}
+	if err != nil {
+		slog.WarnContext(pctx, "settle message", "outcome", o.String(), "delivery_tag", d.DeliveryTag, "error", err)
+	}
+	if c.stopped() && ctx.Err() == nil {
+		c.drained.Add(1)
+	}
+}
+
+// outcome describes how a processed message should be settled with the broker.
+type outcome int
+
+const (
+	outcomeAck     outcome = iota
+	outcomeRequeue         // transient failure: try again
+	outcomeReject          // refused by a business rule: settled without requeueing, so dead-lettered if configured
+	outcomeDrop            // unreadable: settled without requeueing, so dead-lettered if configured
+)
+
+// String returns the outcome's metric label.
+func (o outcome) String() string {
+	switch o {
+	case outcomeAck:
+		return "ack"
+	case outcomeRequeue:
+		return "requeue"
+	case outcomeReject:
+		return "reject"
+	default:
+		return "drop"
+	}
+}
+
+// process decodes a queued message body as a TxMessage or TransferMessage, applies it, writes
+// the ledger entries and publishes its events to events, if set. Messages refused with a domain
+// error are rejected rather than retried. If publishing the events fails the message is
+// requeued; applying it again is a no-op thanks to its idempotency key, and the events are
+// published again with the same IDs. process is shared by Consumer and LocalQueue so both settle
+// messages identically, and records the consumed and processing-latency metrics and a log line
+// for every message.
+func process(ctx context.Context, applier BalanceApplier, ledger LedgerWriter, events EventPublisher, body []byte) outcome {
+	start := time.Now()
+	res := apply(ctx, applier, ledger, body)
+	if events != nil && len(res.events) > 0 {
+		if err := events.PublishEvents(ctx, res.events); err != nil {
+			res.outcome, res.err = outcomeRequeue, fmt.Errorf("publish events: %w", err)
+		}
+	}
+	metrics.Consumed.WithLabelValues(res.kind, res.outcome.String()).Inc()
+
+	attrs := append(res.attrs, "kind", res.kind, "outcome", res.outcome.String(),
+		"duration_ms", float64(time.Since(start).Microseconds())/1000)
+	// Messages without a CreatedAt are left out rather than reported as decades old.
+	if !res.createdAt.IsZero() {
+		latency := time.Since(res.createdAt)
+		attrs = append(attrs, "latency_ms", latency.Milliseconds())
+		if res.outcome == outcomeAck {
+			metrics.ProcessingLatency.WithLabelValues(res.kind).Observe(latency.Seconds())
+		}
+	}
+	switch res.outcome {
+	case outcomeAck:
+		slog.InfoContext(ctx, "message applied", attrs...)
+	case outcomeRequeue:
+		slog.WarnContext(ctx, "message requeued", append(attrs, "error", res.err)...)
+	case outcomeReject:
+		slog.WarnContext(ctx, "message rejected", append(attrs, "reason", res.err)...)
+	default:
+		slog.ErrorContext(ctx, "message dropped", append(attrs, "error", res.err, "bytes", len(body))...)
+	}
+	return res.outcome
+}
+
+// result is how processing one message went.
+type result struct {
+	kind      string
+	outcome   outcome
+	err       error
+	attrs     []any // identifying fields of the message, for logging
+	createdAt time.Time
+	events    []Event
+}
+
+// failed sets res to the outcome of err returned by the applier: a rejection, with its
+// transaction.rejected event, for domain errors, and a requeue otherwise.
+func (res *result) failed(err error, event func(reason string) Event) {
+	res.err = err
+	var de *repo.Error
+	if errors.As(err, &de) {
+		res.outcome = outcomeReject
+		res.events = []Event{event(de.Code)}
+	}
+}
+
+func apply(ctx context.Context, applier BalanceApplier, ledger LedgerWriter, body []byte) result {
+	var m TxMessage
+	if err := json.Unmarshal(body, &m); err == nil && m.AccountID != "" {
+		res := result{kind: metrics.KindTransaction, outcome: outcomeRequeue, createdAt: m.CreatedAt,
+			attrs: []any{"account_id", m.AccountID, "type", m.Type, "amount", m.Amount, "idempotency_key", m.Key}}
+		bal, err := applier.Apply(ctx, m.AccountID, m.Type, m.Amount, m.Key)
+		if err != nil {
+			res.failed(fmt.Errorf("apply: %w", err), func(reason string) Event {
+				e := rejectedEvent(res.kind, m.AccountID, m.Key, reason, m.CreatedAt)
+				e.TransactionType, e.Amount = m.Type, m.Amount
+				return e
+			})
+			return res
+		}
+		if ledger != nil {
+			if err := ledger.Write(ctx, m.AccountID, m.Type, m.Amount, bal, m.Key, m.CreatedAt); err != nil {
+				res.err = fmt.Errorf("write ledger: %w", err)
+				return res
 			}
+		}
+		res.outcome = outcomeAck
+		res.attrs = append(res.attrs, "balance_after", bal)
+		res.events = transactionEvents(m, bal)
+		return res
+	}
 
-			// Unknown payload
-			d.Nack(false, false)
+	// Try as transfer
+	var t TransferMessage
+	if err := json.Unmarshal(body, &t); err == nil && t.FromAccountID != "" && t.ToAccountID != "" {
+		res := result{kind: metrics.KindTransfer, outcome: outcomeRequeue, createdAt: t.CreatedAt,
+			attrs: []any{"from_account_id", t.FromAccountID, "to_account_id", t.ToAccountID, "amount", t.Amount, "idempotency_key", t.Key}}
+		fromAfter, toAfter, err := applier.ApplyTransfer(ctx, t.FromAccountID, t.ToAccountID, t.Amount, t.Key)
+		if err != nil {
+			res.failed(fmt.Errorf("apply transfer: %w", err), func(reason string) Event {
+				e := rejectedEvent(res.kind, t.FromAccountID, t.Key, reason, t.CreatedAt)
+				e.FromAccountID, e.ToAccountID, e.Amount = t.FromAccountID, t.ToAccountID, t.Amount
+				return e
+			})
+			return res
+		}
+		if ledger != nil {
+			if err := ledger.WriteTransfer(ctx, t.FromAccountID, t.ToAccountID, t.Amount, fromAfter, toAfter, t.Key, t.CreatedAt); err != nil {
+				res.err = fmt.Errorf("write ledger: %w", err)
+				return res
+			}
 		}
+		res.outcome = outcomeAck
+		res.events = transferEvents(t, fromAfter, toAfter)
+		return res
 	}
+
+	// Unknown payload
+	return result{kind: metrics.KindUnknown, outcome: outcomeDrop, err: errors.New("unrecognised message payload")}
 }
@@ -0,0 +1,205 @@
+package queue_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Bharat0908/ledger/internal/queue"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// fakeChannel hands out a buffered delivery channel and closes it when the consumer is
+// cancelled, as the broker does.
+type fakeChannel struct {
+	deliveries chan amqp.Delivery
+	cancelled  chan struct{}
+	once       sync.Once
+}
+
+func newFakeChannel(size int) *fakeChannel {
+	return &fakeChannel{deliveries: make(chan amqp.Delivery, size), cancelled: make(chan struct{})}
+}
+
+func (c *fakeChannel) Qos(prefetchCount, prefetchSize int, global bool) error { return nil }
+
+func (c *fakeChannel) Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error) {
+	return c.deliveries, nil
+}
+
+func (c *fakeChannel) Cancel(consumer string, noWait bool) error {
+	c.once.Do(func() {
+		close(c.cancelled)
+		close(c.deliveries)
+	})
+	return nil
+}
+
+// settlements records how each delivery tag was settled: "ack", "requeue" or "drop".
+type settlements struct {
+	mu  sync.Mutex
+	got map[uint64]string
+}
+
+func (s *settlements) set(tag uint64, v string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.got == nil {
+		s.got = map[uint64]string{}
+	}
+	s.got[tag] = v
+	return nil
+}
+
+func (s *settlements) Ack(tag uint64, multiple bool) error { return s.set(tag, "ack") }
+
+func (s *settlements) Nack(tag uint64, multiple, requeue bool) error {
+	if requeue {
+		return s.set(tag, "requeue")
+	}
+	return s.set(tag, "drop")
+}
+
+func (s *settlements) Reject(tag uint64, requeue bool) error { return s.Nack(tag, false, requeue) }
+
+func (s *settlements) get(tag uint64) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.got[tag]
+}
+
+func (s *settlements) delivery(tag uint64) amqp.Delivery {
+	body, _ := json.Marshal(queue.TxMessage{AccountID: "a", Type: "deposit", Amount: 1, Key: fmt.Sprint("k", tag), CreatedAt: time.Now()})
+	return amqp.Delivery{Acknowledger: s, DeliveryTag: tag, Body: body}
+}
+
+// blockingApplier signals started when it begins applying a message, then waits for release,
+// or for its context when honourCtx is set.
+type blockingApplier struct {
+	started   chan string
+	release   chan struct{}
+	honourCtx bool
+}
+
+func (a *blockingApplier) Apply(ctx context.Context, accID, typ string, amount int64, key string) (int64, error) {
+	a.started <- key
+	if a.honourCtx {
+		select {
+		case <-a.release:
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	} else {
+		<-a.release
+	}
+	return amount, nil
+}
+
+func (a *blockingApplier) ApplyTransfer(ctx context.Context, from, to string, amount int64, key string) (int64, int64, error) {
+	return 0, 0, errors.New("unexpected transfer")
+}
+
+func startConsumer(t *testing.T, ctx context.Context, c *queue.Consumer) <-chan error {
+	t.Helper()
+	errc := make(chan error, 1)
+	go func() { errc <- c.Start(ctx) }()
+	return errc
+}
+
+func TestConsumer_ShutdownDrainsInFlight(t *testing.T) {
+	ch := newFakeChannel(2)
+	var s settlements
+	applier := &blockingApplier{started: make(chan string, 2), release: make(chan struct{})}
+	c := &queue.Consumer{Ch: ch, Queue: "q", Applier: applier}
+	errc := startConsumer(t, context.Background(), c)
+
+	ch.deliveries <- s.delivery(1)
+	<-applier.started
+	ch.deliveries <- s.delivery(2) // prefetched, not yet started
+
+	type shutdown struct {
+		drained int
+		err     error
+	}
+	done := make(chan shutdown, 1)
+	go func() {
+		n, err := c.Shutdown(context.Background())
+		done <- shutdown{n, err}
+	}()
+	<-ch.cancelled
+	select {
+	case <-done:
+		t.Fatal("Shutdown() returned while a message was in flight")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(applier.release)
+
+	got := <-done
+	if got.err != nil || got.drained != 1 {
+		t.Errorf("Shutdown() = %d, %v; want 1 drained, no error", got.drained, got.err)
+	}
+	if err := <-errc; err != nil {
+		t.Errorf("Start() = %v, want nil after Shutdown", err)
+	}
+	if s.get(1) != "ack" || s.get(2) != "requeue" {
+		t.Errorf("settlements = %v, want the in-flight message acked and the prefetched one requeued", s.got)
+	}
+}
+
+func TestConsumer_ShutdownDeadline(t *testing.T) {
+	ch := newFakeChannel(1)
+	var s settlements
+	applier := &blockingApplier{started: make(chan string, 1), release: make(chan struct{}), honourCtx: true}
+	c := &queue.Consumer{Ch: ch, Queue: "q", Applier: applier}
+	errc := startConsumer(t, context.Background(), c)
+
+	ch.deliveries <- s.delivery(1)
+	<-applier.started
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	drained, err := c.Shutdown(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) || drained != 0 {
+		t.Errorf("Shutdown() = %d, %v; want 0 drained, deadline exceeded", drained, err)
+	}
+	if err := <-errc; err != nil {
+		t.Errorf("Start() = %v, want nil after Shutdown", err)
+	}
+	if s.get(1) != "requeue" {
+		t.Errorf("interrupted message settled %q, want requeue", s.get(1))
+	}
+}
+
+func TestConsumer_ContextCancelFinishesInFlight(t *testing.T) {
+	ch := newFakeChannel(1)
+	var s settlements
+	applier := &blockingApplier{started: make(chan string, 1), release: make(chan struct{}), honourCtx: true}
+	c := &queue.Consumer{Ch: ch, Queue: "q", Applier: applier}
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := startConsumer(t, ctx, c)
+
+	ch.deliveries <- s.delivery(1)
+	<-applier.started
+	cancel()
+	<-ch.cancelled
+	close(applier.release)
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Errorf("Start() = %v, want context.Canceled", err)
+	}
+	if s.get(1) != "ack" {
+		t.Errorf("in-flight message settled %q, want ack: cancelling Start must not interrupt it", s.get(1))
+	}
+}
+
+func TestConsumer_DeliveriesClosed(t *testing.T) {
+	ch := newFakeChannel(0)
+	c := &queue.Consumer{Ch: ch, Queue: "q", Applier: &blockingApplier{}}
+	errc := startConsumer(t, context.Background(), c)
+	close(ch.deliveries)
+	if err := <-errc; !errors.Is(err, queue.ErrDeliveriesClosed) {
+		t.Errorf("Start() = %v, want ErrDeliveriesClosed", err)
+	}
+}
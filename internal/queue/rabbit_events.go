@@ -0,0 +1,68 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/Bharat0908/ledger/internal/metrics"
+	"github.com/Bharat0908/ledger/internal/tracing"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// EventsExchangeKind is the kind of exchange events are published to; subscribers bind their own
+// queues to it with routing-key patterns (see Event.RoutingKey).
+const EventsExchangeKind = "topic"
+
+// amqpPublisher is the part of *amqp.Channel used to publish.
+type amqpPublisher interface {
+	PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
+}
+
+// EventExchange publishes ledger events to a RabbitMQ topic exchange, one persistent JSON message
+// per event, routed by Event.RoutingKey. The message ID is the event ID and the message type the
+// event type.
+type EventExchange struct {
+	ch       amqpPublisher
+	exchange string
+}
+
+// NewEventExchange returns an EventExchange publishing to exchange on ch. Declaring the exchange,
+// of kind EventsExchangeKind, is left to the caller.
+func NewEventExchange(ch amqpPublisher, exchange string) *EventExchange {
+	return &EventExchange{ch: ch, exchange: exchange}
+}
+
+// PublishEvents publishes events in order, stopping at the first failure.
+func (x *EventExchange) PublishEvents(ctx context.Context, events []Event) error {
+	for _, e := range events {
+		if err := x.publish(ctx, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (x *EventExchange) publish(ctx context.Context, e Event) (err error) {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	ctx, span, headers := startPublish(ctx, systemRabbitMQ, x.exchange)
+	defer tracing.End(span, &err)
+	defer func() {
+		result := "ok"
+		if err != nil {
+			result = "error"
+		}
+		metrics.EventsPublished.WithLabelValues(e.Type, result).Inc()
+	}()
+	return x.ch.PublishWithContext(ctx, x.exchange, e.RoutingKey(), false, false, amqp.Publishing{
+		ContentType:  "application/json",
+		Headers:      headers,
+		MessageId:    e.ID,
+		Type:         e.Type,
+		Timestamp:    e.OccurredAt,
+		Body:         body,
+		DeliveryMode: amqp.Persistent,
+	})
+}
@@ -0,0 +1,23 @@
+package queue
+
+import (
+	"context"
+	"errors"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// CheckAMQP returns a readiness check that fails once the connection or channel used to publish
+// or consume has been closed, for example because the broker went away. The client does not
+// reconnect, so a failing check means the process needs to be restarted.
+func CheckAMQP(conn *amqp.Connection, ch *amqp.Channel) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		switch {
+		case conn.IsClosed():
+			return errors.New("connection closed")
+		case ch.IsClosed():
+			return errors.New("channel closed")
+		}
+		return nil
+	}
+}
@@ -3,7 +3,10 @@ package queue
 import (
 	"context"
 	"encoding/json"
+	"errors"
 
+	"github.com/Bharat0908/ledger/internal/metrics"
+	"github.com/Bharat0908/ledger/internal/tracing"
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
@@ -37,11 +40,7 @@ func NewPublisher(ch *amqp.Channel, exchange, routingKey string) *Publisher {
 // Returns an error if the message could not be published.
 func (p *Publisher) Publish(ctx context.Context, msg TxMessage) error {
 	b, _ := json.Marshal(msg)
-	return p.ch.PublishWithContext(ctx, p.exchange, p.routingKey, false, false, amqp.Publishing{
-		ContentType:  "application/json",
-		Body:         b,
-		DeliveryMode: amqp.Persistent,
-	})
+	return p.publish(ctx, metrics.KindTransaction, b)
 }
 
 // PublishTransfer publishes a TransferMessage to the configured RabbitMQ exchange and routing key.
@@ -56,9 +55,70 @@ func (p *Publisher) Publish(ctx context.Context, msg TxMessage) error {
 //   - error: Non-nil if the message could not be published.
 func (p *Publisher) PublishTransfer(ctx context.Context, msg TransferMessage) error {
 	b, _ := json.Marshal(msg)
-	return p.ch.PublishWithContext(ctx, p.exchange, p.routingKey, false, false, amqp.Publishing{
+	return p.publish(ctx, metrics.KindTransfer, b)
+}
+
+// ErrNotConfirmed is returned for a message the broker refused to take responsibility for.
+var ErrNotConfirmed = errors.New("queue: message not confirmed by the broker")
+
+// PublishTransfers publishes a batch of TransferMessages and waits for the broker to confirm
+// them, returning one error per message, in order. Messages are sent without waiting for each
+// other, so a batch costs about one round trip. Confirmations are only awaited when the channel
+// is in confirm mode (see amqp.Channel.Confirm); otherwise a message counts as published once
+// written, as with PublishTransfer.
+func (p *Publisher) PublishTransfers(ctx context.Context, msgs []TransferMessage) []error {
+	errs := make([]error, len(msgs))
+	confirms := make([]*amqp.DeferredConfirmation, len(msgs))
+	for i, msg := range msgs {
+		b, _ := json.Marshal(msg)
+		confirms[i], errs[i] = p.publishDeferred(ctx, b)
+	}
+	for i, c := range confirms {
+		if errs[i] == nil && c != nil {
+			ok, err := c.WaitContext(ctx)
+			switch {
+			case err != nil:
+				errs[i] = err
+			case !ok:
+				errs[i] = ErrNotConfirmed
+			}
+		}
+		observePublish(metrics.KindTransfer, errs[i])
+	}
+	return errs
+}
+
+// publishDeferred is publish without waiting for the broker confirmation, which it returns.
+func (p *Publisher) publishDeferred(ctx context.Context, body []byte) (c *amqp.DeferredConfirmation, err error) {
+	ctx, span, headers := startPublish(ctx, systemRabbitMQ, p.exchange)
+	defer tracing.End(span, &err)
+	return p.ch.PublishWithDeferredConfirmWithContext(ctx, p.exchange, p.routingKey, false, false, amqp.Publishing{
 		ContentType:  "application/json",
-		Body:         b,
+		Headers:      headers,
+		Body:         body,
 		DeliveryMode: amqp.Persistent,
 	})
 }
+
+// publish sends a JSON message body inside a producer span whose trace context travels in the
+// message headers.
+func (p *Publisher) publish(ctx context.Context, kind string, body []byte) (err error) {
+	ctx, span, headers := startPublish(ctx, systemRabbitMQ, p.exchange)
+	defer tracing.End(span, &err)
+	return observePublish(kind, p.ch.PublishWithContext(ctx, p.exchange, p.routingKey, false, false, amqp.Publishing{
+		ContentType:  "application/json",
+		Headers:      headers,
+		Body:         body,
+		DeliveryMode: amqp.Persistent,
+	}))
+}
+
+// observePublish counts a publish attempt of the given kind and passes its error through.
+func observePublish(kind string, err error) error {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	metrics.Published.WithLabelValues(kind, result).Inc()
+	return err
+}
@@ -0,0 +1,59 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// SubscriberChannel is the part of *amqp.Channel used by SubscribeEvents.
+type SubscriberChannel interface {
+	QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+	QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error
+	Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error)
+}
+
+// SubscribeEvents binds a private, server-named queue to the events exchange with each of the
+// routing-key patterns (see Event.RoutingKey) and hands every event received on it to p, one at a
+// time, until ctx is done. The queue is exclusive and deleted with the channel, and deliveries are
+// acknowledged on receipt: events missed while the process is down are not replayed, so
+// subscribers that need every event must catch up from the ledger. Unreadable messages and
+// failures of p are logged and skipped.
+//
+// It returns ctx.Err() when ctx is done, ErrDeliveriesClosed if the broker closes the delivery
+// channel, or an error if the queue cannot be set up.
+func SubscribeEvents(ctx context.Context, ch SubscriberChannel, exchange string, patterns []string, p EventPublisher) error {
+	q, err := ch.QueueDeclare("", false, true, true, false, nil)
+	if err != nil {
+		return err
+	}
+	for _, pattern := range patterns {
+		if err := ch.QueueBind(q.Name, pattern, exchange, false, nil); err != nil {
+			return err
+		}
+	}
+	deliveries, err := ch.Consume(q.Name, "", true, true, false, false, nil)
+	if err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case d, ok := <-deliveries:
+			if !ok {
+				return ErrDeliveriesClosed
+			}
+			var e Event
+			if err := json.Unmarshal(d.Body, &e); err != nil {
+				slog.WarnContext(ctx, "dropping unreadable event", "message_id", d.MessageId, "error", err)
+				continue
+			}
+			if err := p.PublishEvents(ctx, []Event{e}); err != nil {
+				slog.WarnContext(ctx, "event subscriber failed", "event_id", e.ID, "type", e.Type, "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,201 @@
+// Package reconcile checks that account balances agree with the ledger. Opening balances are
+// booked as transfers, so every account's balance is the sum of its ledger entries, and the
+// balance_after of its latest entry; an account for which either does not hold, or ledger
+// entries for an account that does not exist, point to a lost or duplicated write.
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/Bharat0908/ledger/internal/repo"
+)
+
+// AccountStore reads accounts. It is implemented by repo.PGRepo and repo.SQLiteRepo.
+type AccountStore interface {
+	GetAccount(ctx context.Context, id uuid.UUID) (repo.Account, error)
+	ListAccounts(ctx context.Context, f repo.AccountFilter) (repo.AccountPage, error)
+}
+
+// LedgerStore reads ledger entries. It is implemented by repo.MongoRepo, repo.PGLedgerRepo and
+// repo.SQLiteRepo.
+type LedgerStore interface {
+	ExportLedger(ctx context.Context, f repo.LedgerFilter, fn func(repo.LedgerEntry) error) error
+}
+
+// Totals summarises the ledger entries of an account.
+type Totals struct {
+	// Entries is the number of entries.
+	Entries int64 `json:"entries"`
+	// Sum is the sum of the entries' amounts, withdrawals counting negatively.
+	Sum int64 `json:"sum"`
+	// LastBalanceAfter is the balance_after of the latest entry, 0 without entries.
+	LastBalanceAfter int64 `json:"last_balance_after"`
+}
+
+// add counts e in t. Entries must be added oldest first.
+func (t *Totals) add(e repo.LedgerEntry) {
+	t.Entries++
+	t.Sum += signedAmount(e)
+	t.LastBalanceAfter = e.BalanceAfter
+}
+
+// signedAmount is the change e made to its account's balance: withdrawals are recorded with a
+// positive amount, transfer debits with a negative one.
+func signedAmount(e repo.LedgerEntry) int64 {
+	if e.Type == "withdraw" {
+		return -e.Amount
+	}
+	return e.Amount
+}
+
+// Mismatch is an account whose balance disagrees with its ledger entries.
+type Mismatch struct {
+	AccountID uuid.UUID `json:"account_id"`
+	Currency  string    `json:"currency"`
+	Balance   int64     `json:"balance"`
+	Ledger    Totals    `json:"ledger"`
+	// Difference is Balance minus the ledger's sum.
+	Difference int64 `json:"difference"`
+}
+
+// Orphan is an account ID found in the ledger that has no account.
+type Orphan struct {
+	AccountID string `json:"account_id"`
+	Ledger    Totals `json:"ledger"`
+}
+
+// Report is the result of Run.
+type Report struct {
+	Accounts   int        `json:"accounts"`
+	Entries    int64      `json:"entries"`
+	Mismatches []Mismatch `json:"mismatches"`
+	Orphans    []Orphan   `json:"orphans"`
+}
+
+// OK reports whether every balance agreed with the ledger and no entry was orphaned.
+func (r Report) OK() bool { return len(r.Mismatches) == 0 && len(r.Orphans) == 0 }
+
+// Rechecks bounds how often an account that looks out of balance is checked again before it is
+// reported, and RecheckDelay how long to wait in between, so transactions being applied while
+// the check runs, and ledger entries the worker writes to MongoDB after the balance change, are
+// not mistaken for discrepancies.
+var (
+	Rechecks     = 3
+	RecheckDelay = 200 * time.Millisecond
+)
+
+// Run reconciles every account with the ledger. The ledger is read once, in a single pass, and
+// the accounts are then listed page by page; accounts that look out of balance are checked
+// again on their own (see Account), so the report only lists discrepancies that persist. The
+// stores may be in use meanwhile, so the check needs no downtime.
+func Run(ctx context.Context, accounts AccountStore, ledger LedgerStore) (Report, error) {
+	rep := Report{Mismatches: []Mismatch{}, Orphans: []Orphan{}}
+	totals := map[string]*Totals{}
+	if err := ledger.ExportLedger(ctx, repo.LedgerFilter{}, func(e repo.LedgerEntry) error {
+		t := totals[e.AccountID]
+		if t == nil {
+			t = &Totals{}
+			totals[e.AccountID] = t
+		}
+		t.add(e)
+		rep.Entries++
+		return nil
+	}); err != nil {
+		return rep, err
+	}
+
+	f := repo.AccountFilter{Limit: repo.MaxAccountListLimit}
+	for {
+		page, err := accounts.ListAccounts(ctx, f)
+		if err != nil {
+			return rep, err
+		}
+		for _, acc := range page.Accounts {
+			rep.Accounts++
+			var t Totals
+			if p := totals[acc.ID.String()]; p != nil {
+				t = *p
+				delete(totals, acc.ID.String())
+			}
+			if balanced(acc, t) {
+				continue
+			}
+			m, ok, err := Account(ctx, accounts, ledger, acc.ID)
+			if err != nil {
+				return rep, err
+			}
+			if !ok {
+				rep.Mismatches = append(rep.Mismatches, m)
+			}
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		f.Cursor = page.NextCursor
+	}
+
+	// Entries of accounts created after the listing started are not orphans.
+	for id, t := range totals {
+		uid, err := uuid.Parse(id)
+		if err == nil {
+			_, err = accounts.GetAccount(ctx, uid)
+			if err == nil {
+				continue
+			}
+			if !errors.Is(err, repo.ErrNotFound) {
+				return rep, err
+			}
+		}
+		rep.Orphans = append(rep.Orphans, Orphan{AccountID: id, Ledger: *t})
+	}
+	sort.Slice(rep.Orphans, func(i, j int) bool { return rep.Orphans[i].AccountID < rep.Orphans[j].AccountID })
+	return rep, nil
+}
+
+// Account reconciles one account with its ledger entries, reporting whether they agree, and if
+// not, how. The account is read up to Rechecks times, RecheckDelay apart, until it agrees; its
+// balance is read before and after its entries, and a reading during which it changed does not
+// count as agreeing, so a transaction applied in between is not mistaken for a discrepancy, nor
+// hides one. Unknown accounts are reported as repo.ErrNotFound.
+func Account(ctx context.Context, accounts AccountStore, ledger LedgerStore, id uuid.UUID) (Mismatch, bool, error) {
+	var m Mismatch
+	for attempt := 0; attempt < Rechecks; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(RecheckDelay):
+			case <-ctx.Done():
+				return m, false, ctx.Err()
+			}
+		}
+		before, err := accounts.GetAccount(ctx, id)
+		if err != nil {
+			return m, false, err
+		}
+		var t Totals
+		if err := ledger.ExportLedger(ctx, repo.LedgerFilter{AccountID: id.String()}, func(e repo.LedgerEntry) error {
+			t.add(e)
+			return nil
+		}); err != nil {
+			return m, false, err
+		}
+		after, err := accounts.GetAccount(ctx, id)
+		if err != nil {
+			return m, false, err
+		}
+		if before.Balance == after.Balance && balanced(after, t) {
+			return Mismatch{}, true, nil
+		}
+		m = Mismatch{AccountID: id, Currency: after.Currency, Balance: after.Balance, Ledger: t, Difference: after.Balance - t.Sum}
+	}
+	return m, false, nil
+}
+
+// balanced reports whether acc's balance agrees with the totals of its ledger entries.
+func balanced(acc repo.Account, t Totals) bool {
+	return acc.Balance == t.Sum && acc.Balance == t.LastBalanceAfter
+}
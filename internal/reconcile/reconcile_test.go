@@ -0,0 +1,96 @@
+package reconcile_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/Bharat0908/ledger/internal/reconcile"
+	"github.com/Bharat0908/ledger/internal/repo"
+)
+
+// withEntries is a ledger store with extra entries appended to those of another.
+type withEntries struct {
+	reconcile.LedgerStore
+	extra []repo.LedgerEntry
+}
+
+func (w withEntries) ExportLedger(ctx context.Context, f repo.LedgerFilter, fn func(repo.LedgerEntry) error) error {
+	if err := w.LedgerStore.ExportLedger(ctx, f, fn); err != nil {
+		return err
+	}
+	for _, e := range w.extra {
+		if f.AccountID == "" || f.AccountID == e.AccountID {
+			if err := fn(e); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func TestRun(t *testing.T) {
+	reconcile.RecheckDelay = 0
+	ctx := context.Background()
+	store, err := repo.OpenSQLite(ctx, ":memory:")
+	if err != nil {
+		t.Fatalf("OpenSQLite() failed: %v", err)
+	}
+	defer store.DB.Close()
+
+	var ids []uuid.UUID
+	for _, owner := range []string{"alice", "bob", "carol"} {
+		acc, _, err := store.CreateAccount(ctx, repo.NewAccount{Owner: owner, Currency: "INR"})
+		if err != nil {
+			t.Fatalf("CreateAccount() failed: %v", err)
+		}
+		ids = append(ids, acc.ID)
+	}
+	alice, bob := ids[0], ids[1]
+	if _, err := store.ApplyTransaction(ctx, alice, "deposit", 1000, "k1"); err != nil {
+		t.Fatalf("ApplyTransaction() failed: %v", err)
+	}
+	if _, err := store.ApplyTransaction(ctx, alice, "withdraw", 300, "k2"); err != nil {
+		t.Fatalf("ApplyTransaction() failed: %v", err)
+	}
+	if _, _, err := store.ApplyTransfer(ctx, alice, bob, 200, "k3"); err != nil {
+		t.Fatalf("ApplyTransfer() failed: %v", err)
+	}
+
+	rep, err := reconcile.Run(ctx, store, store)
+	if err != nil {
+		t.Fatalf("Run() failed: %v", err)
+	}
+	if !rep.OK() || rep.Accounts != 3 || rep.Entries != 4 {
+		t.Fatalf("Run() = %+v, want 3 balanced accounts and 4 entries", rep)
+	}
+
+	if _, err := store.DB.ExecContext(ctx, `UPDATE accounts SET balance = balance + 50 WHERE id = ?`, bob.String()); err != nil {
+		t.Fatalf("corrupt balance: %v", err)
+	}
+	// SQLite's foreign keys keep orphans out of its ledger, unlike MongoDB.
+	ghost := uuid.NewString()
+	ledger := withEntries{store, []repo.LedgerEntry{{AccountID: ghost, Type: "deposit", Amount: 5, BalanceAfter: 5, IdempotencyKey: "k4"}}}
+	rep, err = reconcile.Run(ctx, store, ledger)
+	if err != nil {
+		t.Fatalf("Run() failed: %v", err)
+	}
+	if len(rep.Mismatches) != 1 || len(rep.Orphans) != 1 {
+		t.Fatalf("Run() = %+v, want one mismatch and one orphan", rep)
+	}
+	m := rep.Mismatches[0]
+	if m.AccountID != bob || m.Balance != 250 || m.Ledger.Sum != 200 || m.Ledger.LastBalanceAfter != 200 || m.Difference != 50 {
+		t.Errorf("mismatch = %+v, want bob at 250 against a ledger of 200", m)
+	}
+	if o := rep.Orphans[0]; o.AccountID != ghost || o.Ledger.Entries != 1 || o.Ledger.Sum != 5 {
+		t.Errorf("orphan = %+v, want the entry of %s", o, ghost)
+	}
+
+	if _, ok, err := reconcile.Account(ctx, store, store, alice); err != nil || !ok {
+		t.Errorf("Account(alice) = %v, %v; want balanced", ok, err)
+	}
+	if _, _, err := reconcile.Account(ctx, store, store, uuid.New()); err != repo.ErrNotFound {
+		t.Errorf("Account(unknown) error = %v, want ErrNotFound", err)
+	}
+}
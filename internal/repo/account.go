@@ -0,0 +1,153 @@
+package repo
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Account types, following the usual accounting classification. TypeAsset is the default.
+// Equity accounts are the source of opening balances: only the server provisions them (see
+// OpeningAccount), and they are only debited by opening transfers, which unlike other debits may
+// take them below zero. Clients may create accounts of every other type.
+const (
+	TypeAsset     = "asset"
+	TypeLiability = "liability"
+	TypeEquity    = "equity"
+	TypeRevenue   = "revenue"
+	TypeExpense   = "expense"
+)
+
+// accountTypes is the set of accepted account types.
+var accountTypes = map[string]bool{TypeAsset: true, TypeLiability: true, TypeEquity: true, TypeRevenue: true, TypeExpense: true}
+
+// NewAccount holds the attributes of an account to be created. Accounts always start with a zero
+// balance; an opening balance is applied afterwards as a transfer from an equity account so that
+// it appears in the ledger like any other balance change.
+// ExternalRef, when set, is the caller's own identifier for the account and must be unique:
+// creating an account with an ExternalRef that already exists returns the existing account
+// instead of a new one, which makes account provisioning idempotent.
+type NewAccount struct {
+	Owner       string
+	Currency    string
+	ExternalRef string
+	Type        string
+	DisplayName string
+	Metadata    map[string]string
+}
+
+// Account is a stored account and its current balance.
+type Account struct {
+	ID          uuid.UUID         `json:"id"`
+	Owner       string            `json:"owner"`
+	Currency    string            `json:"currency"`
+	Balance     int64             `json:"balance"`
+	Status      string            `json:"status"`
+	Type        string            `json:"type"`
+	ExternalRef string            `json:"external_ref,omitempty"`
+	DisplayName string            `json:"display_name,omitempty"`
+	Metadata    map[string]string `json:"metadata"`
+	CreatedAt   time.Time         `json:"created_at"`
+}
+
+// normalize applies defaults and checks the attributes that do not depend on stored state.
+func (n *NewAccount) normalize() error {
+	if n.Type == "" {
+		n.Type = TypeAsset
+	}
+	if !accountTypes[n.Type] {
+		return ErrInvalidAccountType
+	}
+	if n.Metadata == nil {
+		n.Metadata = map[string]string{}
+	}
+	return nil
+}
+
+// matches reports whether an existing account found by external reference was provisioned with
+// the same identifying attributes, so a retried creation can safely return it.
+func (n *NewAccount) matches(a Account) bool {
+	return a.Owner == n.Owner && a.Currency == n.Currency && a.Type == n.Type
+}
+
+// openingRefPrefix starts the external references of the system equity accounts, by which
+// OpeningAccount finds them.
+const openingRefPrefix = "opening-equity:"
+
+// CheckClient checks the attributes of an account a client asked to create with an opening
+// balance of initialBalance, before CreateAccount: clients may not create accounts of unknown
+// types or equity accounts, which fund opening balances, nor use the external references
+// reserved for the latter. A positive opening
+// balance needs an external reference, so that a request whose opening transfer failed to be
+// queued can be retried without creating a second account.
+func (n NewAccount) CheckClient(initialBalance int64) error {
+	if initialBalance < 0 {
+		return ErrInvalidAmount
+	}
+	if initialBalance > 0 && n.ExternalRef == "" {
+		return ErrExternalRefRequired
+	}
+	if n.Type == TypeEquity || n.Type != "" && !accountTypes[n.Type] {
+		return ErrInvalidAccountType
+	}
+	if strings.HasPrefix(n.ExternalRef, openingRefPrefix) {
+		return ErrReservedExternalRef
+	}
+	return nil
+}
+
+// checkDebit returns the error refusing a debit of amount from an account of type typ holding
+// balance, or nil. Equity accounts may only be debited by an opening transfer, which may take
+// them below zero; other accounts need the funds.
+func checkDebit(typ string, balance, amount int64, opening bool) error {
+	if typ == TypeEquity {
+		if !opening {
+			return ErrOpeningAccount
+		}
+		return nil
+	}
+	if balance < amount {
+		return ErrInsufficientFunds
+	}
+	return nil
+}
+
+// openingKeyPrefix starts the idempotency keys of opening transfers, which clients may not use.
+const openingKeyPrefix = "opening:"
+
+// OpeningBalanceKey is the idempotency key of the transfer that funds an account's opening
+// balance. It is derived from the account ID so a retried account creation can never fund the
+// account twice.
+func OpeningBalanceKey(id uuid.UUID) string { return openingKeyPrefix + id.String() }
+
+// OpeningBalanceAccount returns the account whose opening balance is funded by the transfer with
+// the key, if it is an opening transfer's key.
+func OpeningBalanceAccount(key string) (uuid.UUID, bool) {
+	rest, ok := strings.CutPrefix(key, openingKeyPrefix)
+	if !ok {
+		return uuid.Nil, false
+	}
+	id, err := uuid.Parse(rest)
+	return id, err == nil
+}
+
+// CheckSubmission checks a transaction or transfer submitted by a client before it is queued.
+// debit is the account it takes money from, or "" for a deposit, and opening the configured
+// opening accounts: clients may debit none of them, nor use an idempotency key reserved for
+// opening transfers. Debits of the system equity accounts, which are not configured, are refused
+// by ApplyTransaction and ApplyTransfer.
+func CheckSubmission(debit, key string, opening map[string]uuid.UUID) error {
+	if strings.HasPrefix(key, openingKeyPrefix) {
+		return ErrReservedKey
+	}
+	if debit == "" {
+		return nil
+	}
+	for _, id := range opening {
+		if id.String() == strings.ToLower(debit) {
+			return ErrOpeningAccount
+		}
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package repo
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Account list defaults. Limits above MaxAccountListLimit are rejected.
+const (
+	DefaultAccountListLimit = 50
+	MaxAccountListLimit     = 500
+)
+
+// accountSortColumns maps the sort fields accepted by ListAccounts to their column.
+var accountSortColumns = map[string]string{
+	"created_at": "created_at",
+	"balance":    "balance",
+	"owner":      "owner",
+}
+
+// AccountFilter selects and orders the accounts returned by ListAccounts. Zero-valued fields
+// do not filter. CreatedFrom is inclusive and CreatedTo exclusive. Every Metadata pair must be
+// present on the account. A non-empty IDs restricts the result to those accounts, which is how
+// callers limited to particular accounts are scoped.
+//
+// Sort is one of created_at, balance or owner, optionally prefixed with "-" for descending order;
+// it defaults to "created_at". Ties are broken by account ID so pages are stable. Cursor is the
+// NextCursor of the previous page and must be used with the same filter and sort.
+type AccountFilter struct {
+	Owner       string
+	Currency    string
+	Status      string
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+	Metadata    map[string]string
+	IDs         []uuid.UUID
+	Sort        string
+	Limit       int
+	Cursor      string
+}
+
+// AccountPage is one page of a ListAccounts result. Total counts every account matching the
+// filter, regardless of pagination. NextCursor is empty on the last page.
+type AccountPage struct {
+	Accounts   []Account `json:"accounts"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+	Total      int64     `json:"total"`
+}
+
+// accountCursor is the decoded form of AccountPage.NextCursor: the sort it belongs to and the sort
+// key and ID of the last account on the page.
+type accountCursor struct {
+	Sort  string    `json:"s"`
+	Value string    `json:"v"`
+	ID    uuid.UUID `json:"id"`
+}
+
+// accountListQuery is a validated AccountFilter ready to be turned into SQL.
+type accountListQuery struct {
+	AccountFilter
+	column string
+	desc   bool
+	after  *accountCursor
+}
+
+// normalize applies defaults and validates f.
+func (f AccountFilter) normalize() (accountListQuery, error) {
+	q := accountListQuery{AccountFilter: f}
+	if q.Sort == "" {
+		q.Sort = "created_at"
+	}
+	field := strings.TrimPrefix(q.Sort, "-")
+	col, ok := accountSortColumns[field]
+	if !ok {
+		return q, ErrInvalidSort
+	}
+	q.column, q.desc = col, strings.HasPrefix(q.Sort, "-")
+	switch {
+	case q.Limit == 0:
+		q.Limit = DefaultAccountListLimit
+	case q.Limit < 0 || q.Limit > MaxAccountListLimit:
+		return q, ErrInvalidLimit
+	}
+	if q.Status != "" && q.Status != StatusActive && q.Status != StatusFrozen {
+		return q, ErrInvalidStatus
+	}
+	if q.Cursor != "" {
+		c, err := decodeAccountCursor(q.Cursor)
+		if err != nil || c.Sort != q.Sort {
+			return q, ErrInvalidCursor
+		}
+		if _, err := c.arg(); err != nil {
+			return q, ErrInvalidCursor
+		}
+		q.after = &c
+	}
+	return q, nil
+}
+
+// nextCursor returns the cursor for the page after one ending with last.
+func (q accountListQuery) nextCursor(last Account) string {
+	c := accountCursor{Sort: q.Sort, ID: last.ID}
+	switch q.column {
+	case "created_at":
+		c.Value = last.CreatedAt.UTC().Format(time.RFC3339Nano)
+	case "balance":
+		c.Value = strconv.FormatInt(last.Balance, 10)
+	case "owner":
+		c.Value = last.Owner
+	}
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeAccountCursor(s string) (accountCursor, error) {
+	var c accountCursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, err
+	}
+	err = json.Unmarshal(b, &c)
+	return c, err
+}
+
+// arg converts the cursor's sort key back to the column's Go type.
+func (c accountCursor) arg() (interface{}, error) {
+	switch strings.TrimPrefix(c.Sort, "-") {
+	case "created_at":
+		return time.Parse(time.RFC3339Nano, c.Value)
+	case "balance":
+		return strconv.ParseInt(c.Value, 10, 64)
+	default:
+		return c.Value, nil
+	}
+}
+
+// accountListSQL builds the WHERE clause shared by the count and page queries, and the keyset
+// condition and ORDER BY of the page query. bind appends an argument and returns its placeholder;
+// metadata returns the condition matching one metadata pair. Both are backend specific.
+type accountListSQL struct {
+	bind     func(v interface{}) string
+	metadata func(key, value string) string
+}
+
+// where returns the filter conditions joined with AND, or "TRUE" when there are none.
+func (b accountListSQL) where(q accountListQuery) string {
+	var conds []string
+	if q.Owner != "" {
+		conds = append(conds, "owner = "+b.bind(q.Owner))
+	}
+	if q.Currency != "" {
+		conds = append(conds, "currency = "+b.bind(q.Currency))
+	}
+	if q.Status != "" {
+		conds = append(conds, "status = "+b.bind(q.Status))
+	}
+	if !q.CreatedFrom.IsZero() {
+		conds = append(conds, "created_at >= "+b.bind(q.CreatedFrom))
+	}
+	if !q.CreatedTo.IsZero() {
+		conds = append(conds, "created_at < "+b.bind(q.CreatedTo))
+	}
+	if len(q.IDs) > 0 {
+		ph := make([]string, len(q.IDs))
+		for i, id := range q.IDs {
+			ph[i] = b.bind(id)
+		}
+		conds = append(conds, "id IN ("+strings.Join(ph, ", ")+")")
+	}
+	keys := make([]string, 0, len(q.Metadata))
+	for k := range q.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		conds = append(conds, b.metadata(k, q.Metadata[k]))
+	}
+	if len(conds) == 0 {
+		return "TRUE"
+	}
+	return strings.Join(conds, " AND ")
+}
+
+// page returns the keyset condition (or "TRUE") and the ORDER BY list for q.
+func (b accountListSQL) page(q accountListQuery) (cond, order string) {
+	dir, op := "ASC", ">"
+	if q.desc {
+		dir, op = "DESC", "<"
+	}
+	cond = "TRUE"
+	if q.after != nil {
+		v, _ := q.after.arg()
+		cond = fmt.Sprintf("(%s, id) %s (%s, %s)", q.column, op, b.bind(v), b.bind(q.after.ID))
+	}
+	return cond, fmt.Sprintf("%s %s, id %s", q.column, dir, dir)
+}
@@ -0,0 +1,55 @@
+package repo
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// NewAPIKey holds the attributes of an API key to be stored. Only the SHA-256 hash of the key
+// is persisted; Prefix is the first characters of the key, kept so operators can recognise it.
+// An empty AccountIDs list means the key is not restricted to particular accounts.
+//
+// A non-empty SigningSecret makes the key require HMAC-signed requests. Unlike the key itself
+// the secret must be stored as is, since the server needs it to recompute signatures.
+type NewAPIKey struct {
+	Name          string
+	Prefix        string
+	Hash          []byte
+	Scopes        []string
+	AccountIDs    []uuid.UUID
+	SigningSecret []byte
+}
+
+// APIKey is a stored API key. RevokedAt is set once the key has been revoked; revoked keys are
+// kept so their issuance remains auditable but no longer authenticate. SignedRequests reports
+// whether the key has a SigningSecret and so only accepts signed requests.
+type APIKey struct {
+	ID             uuid.UUID   `json:"id"`
+	Name           string      `json:"name"`
+	Prefix         string      `json:"prefix"`
+	Hash           []byte      `json:"-"`
+	Scopes         []string    `json:"scopes"`
+	AccountIDs     []uuid.UUID `json:"account_ids"`
+	SigningSecret  []byte      `json:"-"`
+	SignedRequests bool        `json:"signed_requests"`
+	CreatedAt      time.Time   `json:"created_at"`
+	RevokedAt      *time.Time  `json:"revoked_at,omitempty"`
+}
+
+// Revoked reports whether the key has been revoked.
+func (k APIKey) Revoked() bool { return k.RevokedAt != nil }
+
+// normalize checks the attributes of a key to be stored.
+func (n *NewAPIKey) normalize() error {
+	if n.Name == "" || len(n.Hash) == 0 || len(n.Scopes) == 0 {
+		return ErrInvalidAPIKey
+	}
+	if n.AccountIDs == nil {
+		n.AccountIDs = []uuid.UUID{}
+	}
+	if len(n.SigningSecret) == 0 {
+		n.SigningSecret = nil
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package repo
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Transfer batch item statuses. Items are queued once published, or rejected when they never
+// reach the queue; the worker marks a queued item failed when it refuses the transfer. Queued
+// items whose idempotency key has been applied to their source account are counted as applied.
+const (
+	BatchItemQueued   = "queued"
+	BatchItemRejected = "rejected"
+	BatchItemFailed   = "failed"
+)
+
+// ErrBatchNotFound is returned when a transfer batch does not exist.
+var ErrBatchNotFound = &Error{Code: "batch_not_found", Message: "transfer batch not found"}
+
+// NewBatchItem is one transfer of a batch, in submission order. AccountID is its source
+// account, as submitted, which scopes the idempotency key. Error is the code of the reason a
+// rejected item was refused.
+type NewBatchItem struct {
+	IdempotencyKey string
+	AccountID      string
+	Status         string
+	Error          string
+}
+
+// NewTransferBatch holds a bulk transfer submission to be stored. Owner identifies the client
+// that submitted it.
+type NewTransferBatch struct {
+	Owner string
+	Items []NewBatchItem
+}
+
+// BatchItemFailure is a queued batch item the worker refused, identified by its idempotency key
+// and source account, with the domain code of the reason.
+type BatchItemFailure struct {
+	IdempotencyKey string
+	AccountID      string
+	Reason         string
+}
+
+// TransferBatch is the aggregate progress of a bulk transfer submission. Accepted items were
+// queued; of those, Applied have been applied, Failed were refused by the worker and Pending
+// are still waiting in the queue. Rejected items never reached the queue.
+type TransferBatch struct {
+	ID        uuid.UUID `json:"id"`
+	Owner     string    `json:"-"`
+	Total     int       `json:"total"`
+	Accepted  int       `json:"accepted"`
+	Rejected  int       `json:"rejected"`
+	Applied   int       `json:"applied"`
+	Failed    int       `json:"failed"`
+	Pending   int       `json:"pending"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// complete derives the counts that are not stored.
+func (b *TransferBatch) complete() {
+	b.Accepted = b.Total - b.Rejected
+	b.Pending = b.Accepted - b.Applied - b.Failed
+}
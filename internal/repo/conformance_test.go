@@ -0,0 +1,839 @@
+package repo_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Bharat0908/ledger/internal/metrics"
+	"github.com/Bharat0908/ledger/internal/repo"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// conformanceRepo is the behaviour every storage backend must provide: the account store used
+// by the API, the balance applier used by the worker, and the ledger read path.
+type conformanceRepo interface {
+	CreateAccount(ctx context.Context, in repo.NewAccount) (repo.Account, bool, error)
+	GetAccount(ctx context.Context, id uuid.UUID) (repo.Account, error)
+	ListAccounts(ctx context.Context, f repo.AccountFilter) (repo.AccountPage, error)
+	CreateAPIKey(ctx context.Context, in repo.NewAPIKey) (repo.APIKey, error)
+	APIKeyByHash(ctx context.Context, hash []byte) (repo.APIKey, error)
+	ListAPIKeys(ctx context.Context) ([]repo.APIKey, error)
+	RevokeAPIKey(ctx context.Context, id uuid.UUID) (repo.APIKey, error)
+	CreateWebhook(ctx context.Context, in repo.NewWebhook) (repo.Webhook, error)
+	GetWebhook(ctx context.Context, id uuid.UUID) (repo.Webhook, error)
+	ListWebhooks(ctx context.Context, owner string) ([]repo.Webhook, error)
+	DeleteWebhook(ctx context.Context, id uuid.UUID) error
+	EnqueueWebhookDeliveries(ctx context.Context, ds []repo.NewWebhookDelivery) error
+	ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]repo.DueWebhookDelivery, error)
+	RecordWebhookAttempt(ctx context.Context, id uuid.UUID, res repo.WebhookAttemptResult) error
+	ListWebhookDeliveries(ctx context.Context, webhookID uuid.UUID, limit int) ([]repo.WebhookDelivery, error)
+	RedeliverWebhookDelivery(ctx context.Context, webhookID, id uuid.UUID) (repo.WebhookDelivery, error)
+	CreateTransferBatch(ctx context.Context, in repo.NewTransferBatch) (repo.TransferBatch, error)
+	RejectBatchItems(ctx context.Context, id uuid.UUID, keys []string, code string) error
+	FailBatchItems(ctx context.Context, fs []repo.BatchItemFailure) error
+	GetTransferBatch(ctx context.Context, id uuid.UUID) (repo.TransferBatch, error)
+	ConsumeQuota(ctx context.Context, client string, at time.Time, amount int64, lim repo.QuotaLimits) (repo.QuotaUsage, error)
+	ConsumeQuotaBatch(ctx context.Context, client string, at time.Time, count, amount int64, lim repo.QuotaLimits) (repo.QuotaUsage, error)
+	RefundQuota(ctx context.Context, client string, at time.Time, count, amount int64) error
+	ApplyTransaction(ctx context.Context, accountID uuid.UUID, typ string, amount int64, key string) (int64, error)
+	ApplyTransfer(ctx context.Context, from, to uuid.UUID, amount int64, key string) (int64, int64, error)
+	GetProcessedTransactions(ctx context.Context, key string) ([]repo.ProcessedTransaction, error)
+	GetTransactions(ctx context.Context, accountID string, limit int) ([]map[string]interface{}, error)
+	GetTransactionsAfter(ctx context.Context, accountID, key string, limit int) ([]map[string]interface{}, error)
+	ExportLedger(ctx context.Context, f repo.LedgerFilter, fn func(repo.LedgerEntry) error) error
+}
+
+// runRepoConformance runs the shared backend test suite. newRepo must return an empty store.
+func runRepoConformance(t *testing.T, newRepo func(t *testing.T) conformanceRepo) {
+	ctx := context.Background()
+
+	mustCreate := func(t *testing.T, r conformanceRepo, initial int64) uuid.UUID {
+		t.Helper()
+		acc, _, err := r.CreateAccount(ctx, repo.NewAccount{Owner: "alice", Currency: "USD"})
+		if err != nil {
+			t.Fatalf("CreateAccount() failed: %v", err)
+		}
+		if acc.Balance != 0 {
+			t.Fatalf("CreateAccount().Balance = %v, want 0", acc.Balance)
+		}
+		if initial > 0 {
+			if _, err := r.ApplyTransaction(ctx, acc.ID, "deposit", initial, "fund-"+acc.ID.String()); err != nil {
+				t.Fatalf("funding deposit failed: %v", err)
+			}
+		}
+		return acc.ID
+	}
+	wantBalance := func(t *testing.T, r conformanceRepo, id uuid.UUID, want int64) {
+		t.Helper()
+		got, err := r.GetAccount(ctx, id)
+		if err != nil {
+			t.Fatalf("GetAccount() failed: %v", err)
+		}
+		if got.Balance != want {
+			t.Errorf("GetAccount().Balance = %v, want %v", got.Balance, want)
+		}
+	}
+
+	t.Run("create and get", func(t *testing.T) {
+		r := newRepo(t)
+		id := mustCreate(t, r, 1000)
+		wantBalance(t, r, id, 1000)
+	})
+
+	t.Run("stores account attributes", func(t *testing.T) {
+		r := newRepo(t)
+		in := repo.NewAccount{
+			Owner: "acme", Currency: "INR", ExternalRef: "ext-" + uuid.NewString(), Type: repo.TypeLiability,
+			DisplayName: "Acme payroll", Metadata: map[string]string{"region": "south"},
+		}
+		created, ok, err := r.CreateAccount(ctx, in)
+		if err != nil || !ok {
+			t.Fatalf("CreateAccount() = %v, %v; want created", ok, err)
+		}
+		got, err := r.GetAccount(ctx, created.ID)
+		if err != nil {
+			t.Fatalf("GetAccount() failed: %v", err)
+		}
+		if got.Owner != in.Owner || got.Currency != in.Currency || got.ExternalRef != in.ExternalRef || got.Type != in.Type ||
+			got.DisplayName != in.DisplayName || got.Metadata["region"] != "south" || got.Status != repo.StatusActive {
+			t.Errorf("GetAccount() = %+v, want attributes of %+v", got, in)
+		}
+		if def := mustCreate(t, r, 0); def == uuid.Nil {
+			t.Fatal("mustCreate returned nil id")
+		} else if a, _ := r.GetAccount(ctx, def); a.Type != repo.TypeAsset || a.Metadata == nil {
+			t.Errorf("default account = %+v, want type asset and empty metadata", a)
+		}
+	})
+
+	t.Run("external ref makes creation idempotent", func(t *testing.T) {
+		r := newRepo(t)
+		in := repo.NewAccount{Owner: "acme", Currency: "USD", ExternalRef: "ext-" + uuid.NewString()}
+		first, created, err := r.CreateAccount(ctx, in)
+		if err != nil || !created {
+			t.Fatalf("first CreateAccount() = %v, %v; want created", created, err)
+		}
+		again, created, err := r.CreateAccount(ctx, in)
+		if err != nil || created || again.ID != first.ID {
+			t.Fatalf("second CreateAccount() = %v, %v, %v; want existing %v", again.ID, created, err, first.ID)
+		}
+		in.Currency = "EUR"
+		if _, _, err := r.CreateAccount(ctx, in); !errors.Is(err, repo.ErrExternalRefConflict) {
+			t.Errorf("conflicting CreateAccount() error = %v, want %v", err, repo.ErrExternalRefConflict)
+		}
+		if _, _, err := r.CreateAccount(ctx, repo.NewAccount{Owner: "acme", Currency: "USD", Type: "equity-ish"}); !errors.Is(err, repo.ErrInvalidAccountType) {
+			t.Errorf("invalid type CreateAccount() error = %v, want %v", err, repo.ErrInvalidAccountType)
+		}
+	})
+
+	t.Run("list accounts filters, sorts and paginates", func(t *testing.T) {
+		r := newRepo(t)
+		owner := "lister-" + uuid.NewString()
+		var ids []uuid.UUID
+		for i, cur := range []string{"USD", "USD", "EUR", "USD", "USD"} {
+			meta := map[string]string{"tier": "basic"}
+			if i%2 == 0 {
+				meta["tier"] = "gold"
+			}
+			acc, _, err := r.CreateAccount(ctx, repo.NewAccount{Owner: owner, Currency: cur, Metadata: meta})
+			if err != nil {
+				t.Fatalf("CreateAccount() failed: %v", err)
+			}
+			if _, err := r.ApplyTransaction(ctx, acc.ID, "deposit", int64(100*(5-i)), uuid.NewString()); err != nil {
+				t.Fatalf("deposit failed: %v", err)
+			}
+			ids = append(ids, acc.ID)
+		}
+
+		tests := []struct {
+			name   string
+			filter repo.AccountFilter
+			want   []uuid.UUID
+		}{
+			{"owner by balance", repo.AccountFilter{Owner: owner, Sort: "balance"}, []uuid.UUID{ids[4], ids[3], ids[2], ids[1], ids[0]}},
+			{"owner by balance desc", repo.AccountFilter{Owner: owner, Sort: "-balance"}, ids},
+			{"currency", repo.AccountFilter{Owner: owner, Currency: "EUR"}, []uuid.UUID{ids[2]}},
+			{"metadata", repo.AccountFilter{Owner: owner, Currency: "USD", Metadata: map[string]string{"tier": "gold"}, Sort: "-balance"}, []uuid.UUID{ids[0], ids[4]}},
+			{"status", repo.AccountFilter{Owner: owner, Status: repo.StatusFrozen}, nil},
+			{"ids", repo.AccountFilter{IDs: []uuid.UUID{ids[3], ids[1]}}, []uuid.UUID{ids[1], ids[3]}},
+			{"created range", repo.AccountFilter{Owner: owner, CreatedTo: time.Now().Add(-time.Hour)}, nil},
+		}
+		for _, tt := range tests {
+			page, err := r.ListAccounts(ctx, tt.filter)
+			if err != nil {
+				t.Fatalf("%s: ListAccounts() failed: %v", tt.name, err)
+			}
+			var got []uuid.UUID
+			for _, a := range page.Accounts {
+				got = append(got, a.ID)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) || page.Total != int64(len(tt.want)) || page.NextCursor != "" {
+				t.Errorf("%s: ListAccounts() = %v (total %d, cursor %q), want %v", tt.name, got, page.Total, page.NextCursor, tt.want)
+			}
+		}
+
+		var walked []uuid.UUID
+		f := repo.AccountFilter{Owner: owner, Sort: "-balance", Limit: 2}
+		for pages := 0; ; pages++ {
+			if pages > 3 {
+				t.Fatal("pagination did not terminate")
+			}
+			page, err := r.ListAccounts(ctx, f)
+			if err != nil {
+				t.Fatalf("ListAccounts(page %d) failed: %v", pages, err)
+			}
+			if page.Total != 5 {
+				t.Errorf("page %d total = %d, want 5", pages, page.Total)
+			}
+			for _, a := range page.Accounts {
+				walked = append(walked, a.ID)
+			}
+			if page.NextCursor == "" {
+				break
+			}
+			f.Cursor = page.NextCursor
+		}
+		if fmt.Sprint(walked) != fmt.Sprint(ids) {
+			t.Errorf("paginated walk = %v, want %v", walked, ids)
+		}
+
+		for _, bad := range []struct {
+			f    repo.AccountFilter
+			want error
+		}{
+			{repo.AccountFilter{Sort: "id"}, repo.ErrInvalidSort},
+			{repo.AccountFilter{Limit: repo.MaxAccountListLimit + 1}, repo.ErrInvalidLimit},
+			{repo.AccountFilter{Status: "closed"}, repo.ErrInvalidStatus},
+			{repo.AccountFilter{Cursor: "not-a-cursor"}, repo.ErrInvalidCursor},
+			{repo.AccountFilter{Sort: "balance", Cursor: f.Cursor}, repo.ErrInvalidCursor},
+		} {
+			if _, err := r.ListAccounts(ctx, bad.f); !errors.Is(err, bad.want) {
+				t.Errorf("ListAccounts(%+v) error = %v, want %v", bad.f, err, bad.want)
+			}
+		}
+	})
+
+	t.Run("api keys are stored hashed and revocable", func(t *testing.T) {
+		r := newRepo(t)
+		hash := []byte("hash-" + uuid.NewString())
+		acc := uuid.New()
+		created, err := r.CreateAPIKey(ctx, repo.NewAPIKey{Name: "ops", Prefix: "lk_abcd", Hash: hash, Scopes: []string{"accounts:read"}, AccountIDs: []uuid.UUID{acc}})
+		if err != nil {
+			t.Fatalf("CreateAPIKey() failed: %v", err)
+		}
+		got, err := r.APIKeyByHash(ctx, hash)
+		if err != nil || got.ID != created.ID || got.Name != "ops" || fmt.Sprint(got.Scopes) != "[accounts:read]" ||
+			len(got.AccountIDs) != 1 || got.AccountIDs[0] != acc || got.Revoked() {
+			t.Fatalf("APIKeyByHash() = %+v, %v; want the created key", got, err)
+		}
+		if got.SignedRequests {
+			t.Error("key without signing secret reports signed requests")
+		}
+		signedHash := []byte("hash-" + uuid.NewString())
+		if _, err := r.CreateAPIKey(ctx, repo.NewAPIKey{Name: "partner", Hash: signedHash, Scopes: []string{"accounts:read"}, SigningSecret: []byte("s3cret")}); err != nil {
+			t.Fatalf("CreateAPIKey(signed) failed: %v", err)
+		}
+		if signed, err := r.APIKeyByHash(ctx, signedHash); err != nil || string(signed.SigningSecret) != "s3cret" || !signed.SignedRequests {
+			t.Errorf("APIKeyByHash(signed) = %+v, %v; want the signing secret", signed, err)
+		}
+		if _, err := r.APIKeyByHash(ctx, []byte("other")); !errors.Is(err, repo.ErrAPIKeyNotFound) {
+			t.Errorf("APIKeyByHash(unknown) error = %v, want %v", err, repo.ErrAPIKeyNotFound)
+		}
+		if _, err := r.CreateAPIKey(ctx, repo.NewAPIKey{Name: "noscope", Hash: []byte("h2")}); !errors.Is(err, repo.ErrInvalidAPIKey) {
+			t.Errorf("CreateAPIKey(no scopes) error = %v, want %v", err, repo.ErrInvalidAPIKey)
+		}
+		revoked, err := r.RevokeAPIKey(ctx, created.ID)
+		if err != nil || !revoked.Revoked() {
+			t.Fatalf("RevokeAPIKey() = %+v, %v; want revoked", revoked, err)
+		}
+		again, err := r.RevokeAPIKey(ctx, created.ID)
+		if err != nil || !again.RevokedAt.Equal(*revoked.RevokedAt) {
+			t.Errorf("second RevokeAPIKey() = %v, %v; want original revocation time %v", again.RevokedAt, err, revoked.RevokedAt)
+		}
+		if _, err := r.RevokeAPIKey(ctx, uuid.New()); !errors.Is(err, repo.ErrAPIKeyNotFound) {
+			t.Errorf("RevokeAPIKey(unknown) error = %v, want %v", err, repo.ErrAPIKeyNotFound)
+		}
+		keys, err := r.ListAPIKeys(ctx)
+		if err != nil {
+			t.Fatalf("ListAPIKeys() failed: %v", err)
+		}
+		listed := false
+		for _, k := range keys {
+			listed = listed || (k.ID == created.ID && k.Revoked())
+		}
+		if !listed {
+			t.Errorf("ListAPIKeys() = %+v; want it to include the revoked key %v", keys, created.ID)
+		}
+	})
+
+	t.Run("webhooks queue deliveries and log attempts", func(t *testing.T) {
+		r := newRepo(t)
+		owner := "tenant:" + uuid.NewString()
+		acc := uuid.New()
+		hook, err := r.CreateWebhook(ctx, repo.NewWebhook{Owner: owner, URL: "https://example.com/hook", EventTypes: []string{"transaction.applied"},
+			AccountIDs: []uuid.UUID{acc}, Description: "payments", Secret: []byte("whsec")})
+		if err != nil {
+			t.Fatalf("CreateWebhook() failed: %v", err)
+		}
+		if got, err := r.GetWebhook(ctx, hook.ID); err != nil || got.URL != hook.URL || string(got.Secret) != "whsec" ||
+			len(got.AccountIDs) != 1 || got.AccountIDs[0] != acc || fmt.Sprint(got.EventTypes) != "[transaction.applied]" {
+			t.Fatalf("GetWebhook() = %+v, %v; want the created webhook", got, err)
+		}
+		if hooks, err := r.ListWebhooks(ctx, owner); err != nil || len(hooks) != 1 || hooks[0].ID != hook.ID {
+			t.Errorf("ListWebhooks(owner) = %+v, %v; want the created webhook", hooks, err)
+		}
+		if _, err := r.CreateWebhook(ctx, repo.NewWebhook{URL: "https://example.com", Secret: []byte("s")}); !errors.Is(err, repo.ErrInvalidWebhook) {
+			t.Errorf("CreateWebhook(no event types) error = %v, want %v", err, repo.ErrInvalidWebhook)
+		}
+
+		event := repo.NewWebhookDelivery{WebhookID: hook.ID, EventID: uuid.NewString(), EventType: "transaction.applied", Payload: []byte(`{"amount":5}`)}
+		for i := 0; i < 2; i++ {
+			if err := r.EnqueueWebhookDeliveries(ctx, []repo.NewWebhookDelivery{event}); err != nil {
+				t.Fatalf("EnqueueWebhookDeliveries() failed: %v", err)
+			}
+		}
+		claim := func(now time.Time) []repo.DueWebhookDelivery {
+			t.Helper()
+			due, err := r.ClaimWebhookDeliveries(ctx, now, time.Minute, 100)
+			if err != nil {
+				t.Fatalf("ClaimWebhookDeliveries() failed: %v", err)
+			}
+			var ours []repo.DueWebhookDelivery
+			for _, d := range due {
+				if d.WebhookID == hook.ID {
+					ours = append(ours, d)
+				}
+			}
+			return ours
+		}
+		now := time.Now().Add(time.Second)
+		due := claim(now)
+		if len(due) != 1 || due[0].EventID != event.EventID || due[0].URL != hook.URL || string(due[0].Secret) != "whsec" {
+			t.Fatalf("claimed %+v, want the event queued once", due)
+		}
+		if again := claim(now); len(again) != 0 {
+			t.Errorf("claimed %+v again within the lease", again)
+		}
+
+		retry := now.Add(time.Hour)
+		if err := r.RecordWebhookAttempt(ctx, due[0].ID, repo.WebhookAttemptResult{
+			Attempt: repo.WebhookAttempt{At: now, StatusCode: 500, DurationMS: 12}, Status: repo.DeliveryPending, NextAttemptAt: &retry,
+		}); err != nil {
+			t.Fatalf("RecordWebhookAttempt(retry) failed: %v", err)
+		}
+		if err := r.RecordWebhookAttempt(ctx, due[0].ID, repo.WebhookAttemptResult{
+			Attempt: repo.WebhookAttempt{At: now.Add(time.Second), Error: "connection refused"}, Status: repo.DeliveryFailed,
+		}); err != nil {
+			t.Fatalf("RecordWebhookAttempt(failed) failed: %v", err)
+		}
+		if err := r.RecordWebhookAttempt(ctx, uuid.New(), repo.WebhookAttemptResult{Status: repo.DeliveryFailed}); !errors.Is(err, repo.ErrWebhookDeliveryNotFound) {
+			t.Errorf("RecordWebhookAttempt(unknown) error = %v, want %v", err, repo.ErrWebhookDeliveryNotFound)
+		}
+		ds, err := r.ListWebhookDeliveries(ctx, hook.ID, 10)
+		if err != nil || len(ds) != 1 {
+			t.Fatalf("ListWebhookDeliveries() = %+v, %v; want one delivery", ds, err)
+		}
+		d := ds[0]
+		if d.Status != repo.DeliveryFailed || d.Attempts != 2 || d.NextAttemptAt != nil || len(d.AttemptLog) != 2 ||
+			d.AttemptLog[0].StatusCode != 500 || d.AttemptLog[1].Error != "connection refused" {
+			t.Errorf("delivery = %+v, want failed after two logged attempts", d)
+		}
+		if string(d.Payload) != `{"amount": 5}` && string(d.Payload) != `{"amount":5}` {
+			t.Errorf("payload = %s, want the enqueued event", d.Payload)
+		}
+
+		if _, err := r.RedeliverWebhookDelivery(ctx, uuid.New(), d.ID); !errors.Is(err, repo.ErrWebhookDeliveryNotFound) {
+			t.Errorf("RedeliverWebhookDelivery(other webhook) error = %v, want %v", err, repo.ErrWebhookDeliveryNotFound)
+		}
+		re, err := r.RedeliverWebhookDelivery(ctx, hook.ID, d.ID)
+		if err != nil || re.Status != repo.DeliveryPending || re.Attempts != 0 {
+			t.Fatalf("RedeliverWebhookDelivery() = %+v, %v; want pending with a fresh attempt budget", re, err)
+		}
+		if due := claim(time.Now().Add(time.Second)); len(due) != 1 || due[0].ID != d.ID {
+			t.Errorf("claimed %+v after redelivery, want the delivery again", due)
+		}
+
+		if err := r.DeleteWebhook(ctx, hook.ID); err != nil {
+			t.Fatalf("DeleteWebhook() failed: %v", err)
+		}
+		if _, err := r.GetWebhook(ctx, hook.ID); !errors.Is(err, repo.ErrWebhookNotFound) {
+			t.Errorf("GetWebhook(deleted) error = %v, want %v", err, repo.ErrWebhookNotFound)
+		}
+		if ds, err := r.ListWebhookDeliveries(ctx, hook.ID, 10); err != nil || len(ds) != 0 {
+			t.Errorf("ListWebhookDeliveries(deleted) = %+v, %v; want the deliveries deleted too", ds, err)
+		}
+		if err := r.DeleteWebhook(ctx, hook.ID); !errors.Is(err, repo.ErrWebhookNotFound) {
+			t.Errorf("DeleteWebhook(deleted) error = %v, want %v", err, repo.ErrWebhookNotFound)
+		}
+	})
+
+	t.Run("transfer batches track item progress", func(t *testing.T) {
+		r := newRepo(t)
+		from := mustCreate(t, r, 100)
+		to := mustCreate(t, r, 0)
+		owner := "tenant:" + uuid.NewString()
+		keys := make([]string, 5)
+		for i := range keys {
+			keys[i] = "bulk-" + uuid.NewString()
+		}
+		items := []repo.NewBatchItem{
+			{IdempotencyKey: keys[0], AccountID: from.String(), Status: repo.BatchItemQueued},
+			{IdempotencyKey: keys[1], AccountID: from.String(), Status: repo.BatchItemQueued},
+			{IdempotencyKey: keys[2], AccountID: from.String(), Status: repo.BatchItemQueued},
+			{IdempotencyKey: keys[3], AccountID: from.String(), Status: repo.BatchItemQueued},
+			{IdempotencyKey: keys[4], Status: repo.BatchItemRejected, Error: "invalid_amount"},
+		}
+		b, err := r.CreateTransferBatch(ctx, repo.NewTransferBatch{Owner: owner, Items: items})
+		if err != nil {
+			t.Fatalf("CreateTransferBatch() failed: %v", err)
+		}
+		if b.Total != 5 || b.Accepted != 4 || b.Rejected != 1 || b.Pending != 4 {
+			t.Errorf("CreateTransferBatch() = %+v, want 4 of 5 items pending", b)
+		}
+
+		if _, _, err := r.ApplyTransfer(ctx, from, to, 10, keys[0]); err != nil {
+			t.Fatalf("transfer failed: %v", err)
+		}
+		// The same key used on another account neither applies nor fails the item.
+		other := mustCreate(t, r, 100)
+		if _, _, err := r.ApplyTransfer(ctx, other, to, 10, keys[3]); err != nil {
+			t.Fatalf("transfer from another account failed: %v", err)
+		}
+		if err := r.FailBatchItems(ctx, []repo.BatchItemFailure{{IdempotencyKey: keys[3], AccountID: other.String(), Reason: "insufficient_funds"}}); err != nil {
+			t.Fatalf("FailBatchItems(another account) failed: %v", err)
+		}
+		for i := 0; i < 2; i++ {
+			if err := r.FailBatchItems(ctx, []repo.BatchItemFailure{{IdempotencyKey: keys[1], AccountID: from.String(), Reason: "insufficient_funds"}}); err != nil {
+				t.Fatalf("FailBatchItems() failed: %v", err)
+			}
+		}
+		if err := r.RejectBatchItems(ctx, b.ID, []string{keys[2]}, "publish_failed"); err != nil {
+			t.Fatalf("RejectBatchItems() failed: %v", err)
+		}
+		got, err := r.GetTransferBatch(ctx, b.ID)
+		if err != nil {
+			t.Fatalf("GetTransferBatch() failed: %v", err)
+		}
+		if got.ID != b.ID || got.Owner != owner || got.Total != 5 || got.Accepted != 3 || got.Rejected != 2 ||
+			got.Applied != 1 || got.Failed != 1 || got.Pending != 1 || got.CreatedAt.IsZero() {
+			t.Errorf("GetTransferBatch() = %+v, want 1 applied, 1 failed and 1 pending of 3 accepted", got)
+		}
+		if _, err := r.GetTransferBatch(ctx, uuid.New()); !errors.Is(err, repo.ErrBatchNotFound) {
+			t.Errorf("GetTransferBatch(unknown) error = %v, want %v", err, repo.ErrBatchNotFound)
+		}
+	})
+
+	t.Run("deposit and withdraw", func(t *testing.T) {
+		r := newRepo(t)
+		id := mustCreate(t, r, 1000)
+		if got, err := r.ApplyTransaction(ctx, id, "deposit", 200, uuid.NewString()); err != nil || got != 1200 {
+			t.Fatalf("deposit = %v, %v; want 1200, nil", got, err)
+		}
+		if got, err := r.ApplyTransaction(ctx, id, "withdraw", 300, uuid.NewString()); err != nil || got != 900 {
+			t.Fatalf("withdraw = %v, %v; want 900, nil", got, err)
+		}
+		wantBalance(t, r, id, 900)
+	})
+
+	t.Run("rejects invalid transactions with domain errors", func(t *testing.T) {
+		r := newRepo(t)
+		id := mustCreate(t, r, 100)
+		tests := []struct {
+			name   string
+			id     uuid.UUID
+			typ    string
+			amount int64
+			want   error
+		}{
+			{"overdraft", id, "withdraw", 101, repo.ErrInsufficientFunds},
+			{"unknown type", id, "refund", 10, repo.ErrInvalidType},
+			{"zero amount", id, "deposit", 0, repo.ErrInvalidAmount},
+			{"missing account", uuid.New(), "deposit", 10, repo.ErrNotFound},
+		}
+		for _, tt := range tests {
+			if _, err := r.ApplyTransaction(ctx, tt.id, tt.typ, tt.amount, uuid.NewString()); !errors.Is(err, tt.want) {
+				t.Errorf("%s: ApplyTransaction() error = %v, want %v", tt.name, err, tt.want)
+			}
+		}
+		wantBalance(t, r, id, 100)
+		if _, err := r.GetAccount(ctx, uuid.New()); !errors.Is(err, repo.ErrNotFound) {
+			t.Errorf("GetAccount(missing) error = %v, want %v", err, repo.ErrNotFound)
+		}
+	})
+
+	t.Run("transaction is idempotent", func(t *testing.T) {
+		r := newRepo(t)
+		id := mustCreate(t, r, 0)
+		key := uuid.NewString()
+		for i := 0; i < 3; i++ {
+			if got, err := r.ApplyTransaction(ctx, id, "deposit", 50, key); err != nil || got != 50 {
+				t.Fatalf("deposit #%d = %v, %v; want 50, nil", i, got, err)
+			}
+		}
+		wantBalance(t, r, id, 50)
+	})
+
+	t.Run("transfer moves funds once", func(t *testing.T) {
+		r := newRepo(t)
+		from := mustCreate(t, r, 500)
+		to := mustCreate(t, r, 0)
+		key := uuid.NewString()
+		for i := 0; i < 2; i++ {
+			fa, ta, err := r.ApplyTransfer(ctx, from, to, 200, key)
+			if err != nil || fa != 300 || ta != 200 {
+				t.Fatalf("transfer #%d = %v, %v, %v; want 300, 200, nil", i, fa, ta, err)
+			}
+		}
+		wantBalance(t, r, from, 300)
+		wantBalance(t, r, to, 200)
+		if _, _, err := r.ApplyTransfer(ctx, from, to, 301, uuid.NewString()); !errors.Is(err, repo.ErrInsufficientFunds) {
+			t.Errorf("transfer beyond balance error = %v, want %v", err, repo.ErrInsufficientFunds)
+		}
+	})
+
+	t.Run("equity account funds opening balances", func(t *testing.T) {
+		r := newRepo(t)
+		eq, _, err := r.CreateAccount(ctx, repo.NewAccount{Owner: "system", Currency: "USD", Type: repo.TypeEquity})
+		if err != nil {
+			t.Fatalf("CreateAccount(equity) failed: %v", err)
+		}
+		to := mustCreate(t, r, 0)
+		key := repo.OpeningBalanceKey(to)
+		for i := 0; i < 2; i++ {
+			fa, ta, err := r.ApplyTransfer(ctx, eq.ID, to, 400, key)
+			if err != nil || fa != -400 || ta != 400 {
+				t.Fatalf("opening transfer #%d = %v, %v, %v; want -400, 400, nil", i, fa, ta, err)
+			}
+		}
+		wantBalance(t, r, eq.ID, -400)
+		wantBalance(t, r, to, 400)
+		entries, err := r.GetTransactions(ctx, to.String(), 10)
+		if err != nil || len(entries) != 1 || entries[0]["type"] != "transfer_credit" {
+			t.Errorf("GetTransactions(to) = %v, %v; want one transfer_credit", entries, err)
+		}
+
+		other := mustCreate(t, r, 0)
+		if _, _, err := r.ApplyTransfer(ctx, eq.ID, other, 100, uuid.NewString()); !errors.Is(err, repo.ErrOpeningAccount) {
+			t.Errorf("transfer out of equity error = %v, want %v", err, repo.ErrOpeningAccount)
+		}
+		if _, _, err := r.ApplyTransfer(ctx, eq.ID, other, 100, repo.OpeningBalanceKey(uuid.New())); !errors.Is(err, repo.ErrOpeningAccount) {
+			t.Errorf("transfer under another account's opening key error = %v, want %v", err, repo.ErrOpeningAccount)
+		}
+		if _, err := r.ApplyTransaction(ctx, eq.ID, "withdraw", 100, uuid.NewString()); !errors.Is(err, repo.ErrOpeningAccount) {
+			t.Errorf("withdrawal from equity error = %v, want %v", err, repo.ErrOpeningAccount)
+		}
+		wantBalance(t, r, eq.ID, -400)
+	})
+
+	t.Run("configured opening accounts must be equity accounts", func(t *testing.T) {
+		r := newRepo(t)
+		eq, _, err := r.CreateAccount(ctx, repo.NewAccount{Owner: "system", Currency: "USD", Type: repo.TypeEquity})
+		if err != nil {
+			t.Fatalf("CreateAccount(equity) failed: %v", err)
+		}
+		asset := mustCreate(t, r, 0)
+		tests := []struct {
+			name       string
+			configured map[string]uuid.UUID
+			wantErr    bool
+		}{
+			{"equity account", map[string]uuid.UUID{"USD": eq.ID}, false},
+			{"asset account", map[string]uuid.UUID{"USD": asset}, true},
+			{"other currency", map[string]uuid.UUID{"EUR": eq.ID}, true},
+			{"unknown account", map[string]uuid.UUID{"USD": uuid.New()}, true},
+		}
+		for _, tt := range tests {
+			if err := repo.CheckOpeningAccounts(ctx, r, tt.configured); (err != nil) != tt.wantErr {
+				t.Errorf("CheckOpeningAccounts(%s) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			}
+		}
+	})
+
+	t.Run("rejects invalid transfers with domain errors", func(t *testing.T) {
+		r := newRepo(t)
+		from := mustCreate(t, r, 500)
+		eurAcc, _, err := r.CreateAccount(ctx, repo.NewAccount{Owner: "bob", Currency: "EUR"})
+		if err != nil {
+			t.Fatalf("CreateAccount() failed: %v", err)
+		}
+		eur := eurAcc.ID
+		tests := []struct {
+			name     string
+			from, to uuid.UUID
+			want     error
+		}{
+			{"same account", from, from, repo.ErrSameAccount},
+			{"missing destination", from, uuid.New(), repo.ErrNotFound},
+			{"currency mismatch", from, eur, repo.ErrCurrencyMismatch},
+		}
+		for _, tt := range tests {
+			if _, _, err := r.ApplyTransfer(ctx, tt.from, tt.to, 10, uuid.NewString()); !errors.Is(err, tt.want) {
+				t.Errorf("%s: ApplyTransfer() error = %v, want %v", tt.name, err, tt.want)
+			}
+		}
+		wantBalance(t, r, from, 500)
+	})
+
+	t.Run("ledger follows balance changes", func(t *testing.T) {
+		r := newRepo(t)
+		from := mustCreate(t, r, 0)
+		to := mustCreate(t, r, 0)
+		if _, err := r.ApplyTransaction(ctx, from, "deposit", 700, "dep-"+uuid.NewString()); err != nil {
+			t.Fatalf("deposit failed: %v", err)
+		}
+		if _, _, err := r.ApplyTransfer(ctx, from, to, 250, "xfer-"+uuid.NewString()); err != nil {
+			t.Fatalf("transfer failed: %v", err)
+		}
+		entries, err := r.GetTransactions(ctx, from.String(), 10)
+		if err != nil {
+			t.Fatalf("GetTransactions() failed: %v", err)
+		}
+		if len(entries) != 2 {
+			t.Fatalf("GetTransactions() returned %d entries, want 2", len(entries))
+		}
+		if entries[0]["type"] != "transfer_debit" || entries[0]["balance_after"] != int64(450) {
+			t.Errorf("newest entry = %v, want transfer_debit with balance_after 450", entries[0])
+		}
+		if entries[1]["type"] != "deposit" || entries[1]["balance_after"] != int64(700) {
+			t.Errorf("oldest entry = %v, want deposit with balance_after 700", entries[1])
+		}
+		credit, err := r.GetTransactions(ctx, to.String(), 10)
+		if err != nil || len(credit) != 1 || credit[0]["amount"] != int64(250) {
+			t.Errorf("GetTransactions(to) = %v, %v; want one credit of 250", credit, err)
+		}
+	})
+
+	t.Run("processed transactions are looked up by key", func(t *testing.T) {
+		r := newRepo(t)
+		from := mustCreate(t, r, 100)
+		to := mustCreate(t, r, 0)
+		key := "xfer-" + uuid.NewString()
+		if _, _, err := r.ApplyTransfer(ctx, from, to, 40, key); err != nil {
+			t.Fatalf("transfer failed: %v", err)
+		}
+		got, err := r.GetProcessedTransactions(ctx, key)
+		if err != nil || len(got) != 1 || got[0].AccountID != from || got[0].Type != "transfer" || got[0].Amount != 40 || got[0].ProcessedAt.IsZero() {
+			t.Errorf("GetProcessedTransactions() = %+v, %v; want the transfer of 40 from %s", got, err, from)
+		}
+		if _, err := r.GetProcessedTransactions(ctx, "never-"+uuid.NewString()); !errors.Is(err, repo.ErrTransactionNotFound) {
+			t.Errorf("GetProcessedTransactions(unknown) error = %v, want ErrTransactionNotFound", err)
+		}
+	})
+
+	t.Run("idempotency keys are scoped to their account", func(t *testing.T) {
+		r := newRepo(t)
+		mine, theirs := mustCreate(t, r, 100), mustCreate(t, r, 100)
+		key := "shared-" + uuid.NewString()
+		// A key used first on another account does not block, or apply, this account's transaction.
+		if _, err := r.ApplyTransaction(ctx, theirs, "deposit", 5, key); err != nil {
+			t.Fatalf("deposit to theirs failed: %v", err)
+		}
+		if _, _, err := r.ApplyTransfer(ctx, mine, theirs, 30, key); err != nil {
+			t.Fatalf("transfer from mine failed: %v", err)
+		}
+		if _, _, err := r.ApplyTransfer(ctx, mine, theirs, 30, key); err != nil {
+			t.Fatalf("retried transfer failed: %v", err)
+		}
+		wantBalance(t, r, mine, 70)
+		wantBalance(t, r, theirs, 135)
+		got, err := r.GetProcessedTransactions(ctx, key)
+		if err != nil || len(got) != 2 {
+			t.Fatalf("GetProcessedTransactions() = %+v, %v; want the deposit and the transfer", got, err)
+		}
+		accounts := map[uuid.UUID]string{got[0].AccountID: got[0].Type, got[1].AccountID: got[1].Type}
+		if accounts[theirs] != "deposit" || accounts[mine] != "transfer" {
+			t.Errorf("GetProcessedTransactions() = %+v, want a deposit to %s and a transfer from %s", got, theirs, mine)
+		}
+	})
+
+	t.Run("ledger resumes after an entry", func(t *testing.T) {
+		r := newRepo(t)
+		acc := mustCreate(t, r, 0)
+		var keys []string
+		for i := 0; i < 4; i++ {
+			key := fmt.Sprintf("dep-%d-%s", i, uuid.NewString())
+			if _, err := r.ApplyTransaction(ctx, acc, "deposit", 10, key); err != nil {
+				t.Fatalf("deposit failed: %v", err)
+			}
+			keys = append(keys, key)
+		}
+		entries, err := r.GetTransactionsAfter(ctx, acc.String(), repo.EntryID(acc.String(), keys[0]), 2)
+		if err != nil {
+			t.Fatalf("GetTransactionsAfter() failed: %v", err)
+		}
+		if len(entries) != 2 || entries[0]["idempotency_key"] != keys[1] || entries[1]["idempotency_key"] != keys[2] {
+			t.Fatalf("GetTransactionsAfter() = %v, want the entries of %v oldest first", entries, keys[1:3])
+		}
+		if entries[0]["id"] != repo.EntryID(acc.String(), keys[1]) {
+			t.Errorf("entry id = %v, want %s", entries[0]["id"], repo.EntryID(acc.String(), keys[1]))
+		}
+		if entries, err := r.GetTransactionsAfter(ctx, acc.String(), repo.EntryID(acc.String(), keys[3]), 10); err != nil || len(entries) != 0 {
+			t.Errorf("GetTransactionsAfter(newest) = %v, %v; want no entries", entries, err)
+		}
+		if entries, err := r.GetTransactionsAfter(ctx, acc.String(), keys[2], 10); err != nil || len(entries) != 1 {
+			t.Errorf("GetTransactionsAfter(bare key) = %v, %v; want the entry after it", entries, err)
+		}
+		other := mustCreate(t, r, 0)
+		if _, err := r.GetTransactionsAfter(ctx, other.String(), repo.EntryID(acc.String(), keys[0]), 10); !errors.Is(err, repo.ErrInvalidEventID) {
+			t.Errorf("GetTransactionsAfter(other account) error = %v, want ErrInvalidEventID", err)
+		}
+	})
+
+	t.Run("ledger entries sharing a key have distinct ids", func(t *testing.T) {
+		r := newRepo(t)
+		acc, payer := mustCreate(t, r, 0), mustCreate(t, r, 100)
+		if _, err := r.ApplyTransaction(ctx, acc, "deposit", 10, "shared"); err != nil {
+			t.Fatalf("deposit failed: %v", err)
+		}
+		if _, _, err := r.ApplyTransfer(ctx, payer, acc, 20, "shared"); err != nil {
+			t.Fatalf("transfer failed: %v", err)
+		}
+		if _, err := r.ApplyTransaction(ctx, acc, "deposit", 30, "last"); err != nil {
+			t.Fatalf("deposit failed: %v", err)
+		}
+		deposit, credit := repo.EntryID(acc.String(), "shared"), repo.EntryID(payer.String(), "shared")
+		entries, err := r.GetTransactionsAfter(ctx, acc.String(), deposit, 10)
+		if err != nil || len(entries) != 2 || entries[0]["id"] != credit || entries[0]["type"] != "transfer_credit" {
+			t.Fatalf("GetTransactionsAfter(deposit) = %v, %v; want the credit %s and the last deposit", entries, err, credit)
+		}
+		entries, err = r.GetTransactionsAfter(ctx, acc.String(), credit, 10)
+		if err != nil || len(entries) != 1 || entries[0]["idempotency_key"] != "last" {
+			t.Errorf("GetTransactionsAfter(credit) = %v, %v; want the last deposit", entries, err)
+		}
+	})
+
+	t.Run("ledger exports by account and time range", func(t *testing.T) {
+		r := newRepo(t)
+		from := mustCreate(t, r, 0)
+		to := mustCreate(t, r, 0)
+		start := time.Now()
+		if _, err := r.ApplyTransaction(ctx, from, "deposit", 700, "dep-"+uuid.NewString()); err != nil {
+			t.Fatalf("deposit failed: %v", err)
+		}
+		if _, _, err := r.ApplyTransfer(ctx, from, to, 250, "xfer-"+uuid.NewString()); err != nil {
+			t.Fatalf("transfer failed: %v", err)
+		}
+		export := func(f repo.LedgerFilter) []repo.LedgerEntry {
+			t.Helper()
+			var out []repo.LedgerEntry
+			if err := r.ExportLedger(ctx, f, func(e repo.LedgerEntry) error {
+				out = append(out, e)
+				return nil
+			}); err != nil {
+				t.Fatalf("ExportLedger() failed: %v", err)
+			}
+			return out
+		}
+		got := export(repo.LedgerFilter{AccountID: from.String()})
+		if len(got) != 2 || got[0].Type != "deposit" || got[1].Type != "transfer_debit" || got[1].BalanceAfter != 450 || got[1].AccountID != from.String() {
+			t.Errorf("ExportLedger(account) = %+v, want the deposit then the debit", got)
+		}
+		if got := export(repo.LedgerFilter{From: start.Add(-time.Second), To: time.Now().Add(time.Second)}); len(got) < 3 {
+			t.Errorf("ExportLedger(range) = %d entries, want at least the 3 just written", len(got))
+		}
+		if got := export(repo.LedgerFilter{AccountID: to.String(), To: start.Add(-time.Second)}); len(got) != 0 {
+			t.Errorf("ExportLedger(before) = %+v, want no entries", got)
+		}
+		stop := errors.New("stop")
+		n := 0
+		if err := r.ExportLedger(ctx, repo.LedgerFilter{AccountID: from.String()}, func(repo.LedgerEntry) error {
+			n++
+			return stop
+		}); !errors.Is(err, stop) || n != 1 {
+			t.Errorf("ExportLedger() = %v after %d entries, want to stop at the first", err, n)
+		}
+	})
+
+	t.Run("quotas cap daily count and amount per client", func(t *testing.T) {
+		r := newRepo(t)
+		client, other := "api-key:"+uuid.NewString(), "api-key:"+uuid.NewString()
+		day := time.Date(2024, 3, 1, 23, 0, 0, 0, time.UTC)
+		lim := repo.QuotaLimits{DailyCount: 3, DailyAmount: 1000}
+		steps := []struct {
+			client  string
+			at      time.Time
+			amount  int64
+			wantErr error
+			want    int64
+		}{
+			{client, day, 400, nil, 1},
+			{client, day, 500, nil, 2},
+			{client, day, 200, repo.ErrQuotaExceeded, 0},
+			{client, day, 2000, repo.ErrQuotaExceeded, 0},
+			{client, day, 100, nil, 3},
+			{client, day, 0, repo.ErrQuotaExceeded, 0},
+			{other, day, 1000, nil, 1},
+			{client, day.Add(2 * time.Hour), 1000, nil, 1},
+		}
+		for i, s := range steps {
+			u, err := r.ConsumeQuota(ctx, s.client, s.at, s.amount, lim)
+			if !errors.Is(err, s.wantErr) || (s.wantErr == nil && err != nil) {
+				t.Fatalf("step %d: ConsumeQuota() error = %v, want %v", i, err, s.wantErr)
+			}
+			if err == nil && u.Count != s.want {
+				t.Errorf("step %d: ConsumeQuota().Count = %d, want %d", i, u.Count, s.want)
+			}
+		}
+		if u, err := r.ConsumeQuota(ctx, other, day, 5000, repo.QuotaLimits{DailyCount: 10}); err != nil || u.Amount != 6000 {
+			t.Errorf("ConsumeQuota(no amount cap) = %+v, %v; want amount 6000", u, err)
+		}
+
+		batch := "api-key:" + uuid.NewString()
+		if _, err := r.ConsumeQuotaBatch(ctx, batch, day, 4, 800, lim); !errors.Is(err, repo.ErrQuotaExceeded) {
+			t.Errorf("ConsumeQuotaBatch(over the count) error = %v, want %v", err, repo.ErrQuotaExceeded)
+		}
+		if u, err := r.ConsumeQuotaBatch(ctx, batch, day, 2, 800, lim); err != nil || u.Count != 2 || u.Amount != 800 {
+			t.Errorf("ConsumeQuotaBatch() = %+v, %v; want count 2 and amount 800", u, err)
+		}
+		if _, err := r.ConsumeQuotaBatch(ctx, batch, day, 1, 300, lim); !errors.Is(err, repo.ErrQuotaExceeded) {
+			t.Errorf("ConsumeQuotaBatch(over the amount) error = %v, want %v", err, repo.ErrQuotaExceeded)
+		}
+		if u, err := r.ConsumeQuota(ctx, batch, day, 200, lim); err != nil || u.Count != 3 || u.Amount != 1000 {
+			t.Errorf("ConsumeQuota() after a refused batch = %+v, %v; want count 3 and amount 1000", u, err)
+		}
+
+		// Refunds make room again, on the day they were charged, and never go below zero.
+		if err := r.RefundQuota(ctx, batch, day, 2, 700); err != nil {
+			t.Fatalf("RefundQuota() failed: %v", err)
+		}
+		if err := r.RefundQuota(ctx, batch, day.Add(2*time.Hour), 1, 100); err != nil {
+			t.Fatalf("RefundQuota(next day) failed: %v", err)
+		}
+		if u, err := r.ConsumeQuotaBatch(ctx, batch, day, 2, 700, lim); err != nil || u.Count != 3 || u.Amount != 1000 {
+			t.Errorf("ConsumeQuotaBatch() after a refund = %+v, %v; want count 3 and amount 1000", u, err)
+		}
+		if err := r.RefundQuota(ctx, batch, day, 5, 5000); err != nil {
+			t.Fatalf("RefundQuota(more than used) failed: %v", err)
+		}
+		if u, err := r.ConsumeQuota(ctx, batch, day, 100, lim); err != nil || u.Count != 1 || u.Amount != 100 {
+			t.Errorf("ConsumeQuota() after refunding everything = %+v, %v; want count 1 and amount 100", u, err)
+		}
+	})
+
+	t.Run("records duplicate and insufficient funds metrics", func(t *testing.T) {
+		r := newRepo(t)
+		from, to := mustCreate(t, r, 100), mustCreate(t, r, 0)
+		dups := metrics.IdempotentDuplicates.WithLabelValues("apply_transfer")
+		short := metrics.InsufficientFunds.WithLabelValues("apply_transaction")
+		dupsBefore, shortBefore := testutil.ToFloat64(dups), testutil.ToFloat64(short)
+
+		key := uuid.NewString()
+		for i := 0; i < 3; i++ {
+			if _, _, err := r.ApplyTransfer(ctx, from, to, 10, key); err != nil {
+				t.Fatalf("ApplyTransfer() failed: %v", err)
+			}
+		}
+		if _, err := r.ApplyTransaction(ctx, from, "withdraw", 1000, uuid.NewString()); !errors.Is(err, repo.ErrInsufficientFunds) {
+			t.Fatalf("overdraw error = %v, want %v", err, repo.ErrInsufficientFunds)
+		}
+		if got := testutil.ToFloat64(dups) - dupsBefore; got != 2 {
+			t.Errorf("idempotent duplicates = %v, want 2", got)
+		}
+		if got := testutil.ToFloat64(short) - shortBefore; got != 1 {
+			t.Errorf("insufficient funds rejections = %v, want 1", got)
+		}
+	})
+}
@@ -0,0 +1,60 @@
+package repo
+
+import "errors"
+
+// Error is a domain error returned by the repositories. Code is a stable, machine-readable
+// identifier that the HTTP layer exposes to clients; callers should match errors with errors.Is
+// against the sentinels below, or use errors.As to read the code.
+type Error struct {
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string { return e.Code }
+
+// Domain errors shared by all storage backends.
+var (
+	ErrNotFound          = &Error{Code: "not_found", Message: "account not found"}
+	ErrInsufficientFunds = &Error{Code: "insufficient_funds", Message: "insufficient funds"}
+	ErrInvalidType       = &Error{Code: "invalid_type", Message: "transaction type must be deposit or withdraw"}
+	ErrInvalidAmount     = &Error{Code: "invalid_amount", Message: "amount must be positive"}
+	ErrAccountFrozen     = &Error{Code: "account_frozen", Message: "account is frozen"}
+	ErrSameAccount       = &Error{Code: "same_account", Message: "cannot transfer to the same account"}
+	ErrCurrencyMismatch  = &Error{Code: "currency_mismatch", Message: "accounts have different currencies"}
+	ErrOpeningAccount    = &Error{Code: "opening_account", Message: "opening balance accounts can only fund opening balances"}
+	ErrReservedKey       = &Error{Code: "reserved_idempotency_key", Message: "idempotency keys starting with opening: are reserved for opening balances"}
+
+	ErrInvalidAccountType  = &Error{Code: "invalid_account_type", Message: "account type must be asset, liability, revenue or expense"}
+	ErrExternalRefConflict = &Error{Code: "external_ref_conflict", Message: "external_ref is already used by an account with different owner, currency or type"}
+	ErrExternalRefRequired = &Error{Code: "external_ref_required", Message: "external_ref is required with a positive initial_balance, so the request can be retried safely"}
+	ErrReservedExternalRef = &Error{Code: "reserved_external_ref", Message: "external_refs starting with opening-equity: are reserved for the system equity accounts"}
+
+	ErrInvalidSort   = &Error{Code: "invalid_sort", Message: "sort must be created_at, balance or owner, optionally prefixed with -"}
+	ErrInvalidLimit  = &Error{Code: "invalid_limit", Message: "limit must be between 1 and 500"}
+	ErrInvalidStatus = &Error{Code: "invalid_status", Message: "status must be active or frozen"}
+	ErrInvalidCursor = &Error{Code: "invalid_cursor", Message: "cursor is malformed or belongs to a different sort"}
+
+	ErrInvalidEventID = &Error{Code: "invalid_event_id", Message: "Last-Event-ID does not name a ledger entry of the account"}
+
+	ErrAPIKeyNotFound = &Error{Code: "api_key_not_found", Message: "API key not found"}
+	ErrInvalidAPIKey  = &Error{Code: "invalid_api_key", Message: "API key needs a name, a hash and at least one scope"}
+
+	ErrWebhookNotFound         = &Error{Code: "webhook_not_found", Message: "webhook not found"}
+	ErrWebhookDeliveryNotFound = &Error{Code: "webhook_delivery_not_found", Message: "webhook delivery not found"}
+	ErrInvalidWebhook          = &Error{Code: "invalid_webhook", Message: "webhook needs a URL, at least one event type and a secret"}
+
+	ErrQuotaExceeded = &Error{Code: "quota_exceeded", Message: "daily transaction quota exceeded"}
+)
+
+// Account statuses. Only active accounts accept balance changes.
+const (
+	StatusActive = "active"
+	StatusFrozen = "frozen"
+)
+
+// IsDomainError reports whether err is one of the repository's domain errors, i.e. a business
+// rule rejection rather than an infrastructure failure.
+func IsDomainError(err error) bool {
+	var de *Error
+	return errors.As(err, &de)
+}
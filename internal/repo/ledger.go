@@ -0,0 +1,51 @@
+package repo
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// LedgerEntry is one entry of an account's history, as exported. Entries are written by the
+// balance store (or the worker, with MongoDB) and never change.
+type LedgerEntry struct {
+	AccountID      string    `json:"account_id" bson:"account_id" parquet:"account_id,dict"`
+	Type           string    `json:"type" bson:"type" parquet:"type,dict"`
+	Amount         int64     `json:"amount" bson:"amount" parquet:"amount"`
+	BalanceAfter   int64     `json:"balance_after" bson:"balance_after" parquet:"balance_after"`
+	IdempotencyKey string    `json:"idempotency_key" bson:"idempotency_key" parquet:"idempotency_key"`
+	CreatedAt      time.Time `json:"created_at" bson:"created_at" parquet:"created_at,timestamp(microsecond)"`
+}
+
+// EntryID returns the ID of an account's ledger entry: the source account, which is the account
+// of a transaction or the source of a transfer, and the idempotency key, separated by a colon.
+// Keys are unique per source account, so unlike the key the ID names one entry of an account
+// even when a deposit to it and transfers into it share a key. Account event streams use it as
+// the event ID to resume from.
+func EntryID(source, key string) string { return source + ":" + key }
+
+// splitEntryID returns the source account and idempotency key of an entry ID. IDs that do not
+// start with an account ID, such as the bare keys streams used as event IDs before entries had
+// IDs, are returned as the key with ok false.
+func splitEntryID(id string) (source, key string, ok bool) {
+	source, key, ok = strings.Cut(id, ":")
+	if !ok || len(source) != 36 {
+		return "", id, false
+	}
+	if _, err := uuid.Parse(source); err != nil {
+		return "", id, false
+	}
+	return strings.ToLower(source), key, true
+}
+
+// LedgerFilter selects the ledger entries to export: those of AccountID, or of every account
+// when it is empty, created at or after From and before To. Zero times leave the range open.
+type LedgerFilter struct {
+	AccountID string
+	From, To  time.Time
+}
+
+// exportPage is the number of ledger entries read at a time by stores that page through an
+// export rather than holding a cursor open.
+const exportPage = 1000
@@ -0,0 +1,40 @@
+package repo
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Bharat0908/ledger/internal/metrics"
+)
+
+// Backend labels for metrics.DBTxDuration.
+const (
+	backendPostgres = "postgres"
+	backendSQLite   = "sqlite"
+)
+
+// Operation labels for the transaction metrics.
+const (
+	opCreateAccount    = "create_account"
+	opApplyTransaction = "apply_transaction"
+	opApplyTransfer    = "apply_transfer"
+)
+
+// observeTx records how long a write transaction took and how it ended. It is deferred at the
+// top of each operation with a pointer to the named error result, so it sees the final error:
+// the result label is "ok", the domain error code, or "error" for infrastructure failures.
+func observeTx(backend, op string, start time.Time, errp *error) {
+	result := "ok"
+	var de *Error
+	switch err := *errp; {
+	case err == nil:
+	case errors.As(err, &de):
+		result = de.Code
+	default:
+		result = "error"
+	}
+	metrics.DBTxDuration.WithLabelValues(backend, op, result).Observe(time.Since(start).Seconds())
+	if errors.Is(*errp, ErrInsufficientFunds) {
+		metrics.InsufficientFunds.WithLabelValues(op).Inc()
+	}
+}
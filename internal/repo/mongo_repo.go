@@ -3,7 +3,7 @@
 // and retrieving transaction histories.
 //
 // InsertLedger inserts a single ledger entry for a given account, specifying the type, amount,
-// resulting balance, idempotency key, and creation timestamp.
+// resulting balance, idempotency key, and creation timestamp, unless the entry already exists.
 //
 // InsertTransferLedger inserts two ledger entries in a single operation to represent a transfer
 // between two accounts: a debit from the sender and a credit to the receiver, each with their
@@ -15,10 +15,13 @@ package repo
 
 import (
 	"context"
+	"errors"
 	"time"
 
+	"github.com/Bharat0908/ledger/internal/tracing"
 	"github.com/google/uuid"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -27,22 +30,33 @@ import (
 // It embeds a mongo.Collection to perform database operations.
 type MongoRepo struct{ C *mongo.Collection }
 
-func (m *MongoRepo) InsertLedger(ctx context.Context, accountID uuid.UUID, typ string, amount, balanceAfter int64, key string, at time.Time) error {
-	_, err := m.C.InsertOne(ctx, bson.M{
-		"account_id":      accountID.String(),
-		"type":            typ,
-		"amount":          amount,
-		"balance_after":   balanceAfter,
-		"idempotency_key": key,
-		"created_at":      at,
-	})
+func (m *MongoRepo) InsertLedger(ctx context.Context, accountID uuid.UUID, typ string, amount, balanceAfter int64, key string, at time.Time) (err error) {
+	ctx, span := startSpan(ctx, "MongoRepo.InsertLedger", spanMongo)
+	defer tracing.End(span, &err)
+	_, err = m.C.UpdateOne(ctx, ledgerEntryFilter(accountID, accountID, typ, key), bson.M{"$setOnInsert": bson.M{
+		"amount":        amount,
+		"balance_after": balanceAfter,
+		"created_at":    at,
+	}}, options.Update().SetUpsert(true))
 	return err
 }
 
+// ledgerEntryFilter matches the ledger entry of an account for the message of source with the
+// given idempotency key. Entries are upserted on it, so a redelivered message, which is applied
+// idempotently, writes the entry it already wrote rather than another one.
+func ledgerEntryFilter(accountID, source uuid.UUID, typ, key string) bson.M {
+	return bson.M{
+		"account_id":        accountID.String(),
+		"source_account_id": source.String(),
+		"type":              typ,
+		"idempotency_key":   key,
+	}
+}
+
 // InsertTransferLedger inserts two ledger entries representing a transfer between accounts.
 // It creates a debit entry for the source account and a credit entry for the destination account,
-// both associated with the same idempotency key and timestamp. The operation is performed as a single
-// insert of two documents to ensure atomicity at the database level.
+// both associated with the same idempotency key and timestamp. Both entries are upserted in a single
+// bulk write, so writing a redelivered transfer again leaves its entries as they are.
 //
 // Parameters:
 //   - ctx: Context for controlling cancellation and deadlines.
@@ -56,13 +70,17 @@ func (m *MongoRepo) InsertLedger(ctx context.Context, accountID uuid.UUID, typ s
 //
 // Returns:
 //   - error: Non-nil if the insert operation fails.
-func (m *MongoRepo) InsertTransferLedger(ctx context.Context, from, to uuid.UUID, amount, fromAfter, toAfter int64, key string, at time.Time) error {
-	// insert two documents in a single operation
-	docs := []interface{}{
-		bson.M{"account_id": from.String(), "type": "transfer_debit", "amount": -amount, "balance_after": fromAfter, "idempotency_key": key, "created_at": at},
-		bson.M{"account_id": to.String(), "type": "transfer_credit", "amount": amount, "balance_after": toAfter, "idempotency_key": key, "created_at": at},
+func (m *MongoRepo) InsertTransferLedger(ctx context.Context, from, to uuid.UUID, amount, fromAfter, toAfter int64, key string, at time.Time) (err error) {
+	ctx, span := startSpan(ctx, "MongoRepo.InsertTransferLedger", spanMongo)
+	defer tracing.End(span, &err)
+	// upsert both entries in a single operation
+	models := []mongo.WriteModel{
+		mongo.NewUpdateOneModel().SetFilter(ledgerEntryFilter(from, from, "transfer_debit", key)).SetUpsert(true).
+			SetUpdate(bson.M{"$setOnInsert": bson.M{"amount": -amount, "balance_after": fromAfter, "created_at": at}}),
+		mongo.NewUpdateOneModel().SetFilter(ledgerEntryFilter(to, from, "transfer_credit", key)).SetUpsert(true).
+			SetUpdate(bson.M{"$setOnInsert": bson.M{"amount": amount, "balance_after": toAfter, "created_at": at}}),
 	}
-	_, err := m.C.InsertMany(ctx, docs)
+	_, err = m.C.BulkWrite(ctx, models)
 	return err
 }
 
@@ -80,11 +98,90 @@ func (m *MongoRepo) InsertTransferLedger(ctx context.Context, from, to uuid.UUID
 //   - error: An error if the retrieval fails, otherwise nil.
 func (m *MongoRepo) GetTransactions(ctx context.Context, accountID string, limit int) ([]map[string]interface{}, error) {
 	filter := bson.M{"account_id": accountID}
-	opts := options.Find().SetSort(bson.D{{"created_at", -1}}).SetLimit(int64(limit))
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(int64(limit))
 	cur, err := m.C.Find(ctx, filter, opts)
 	if err != nil {
 		return nil, err
 	}
+	return decodeEntries(ctx, cur)
+}
+
+// GetTransactionsAfter retrieves up to limit ledger entries for the specified account that were
+// inserted after its entry with the given ID (see EntryID), oldest first; a bare idempotency key
+// names the account's latest entry with the key. Entries are ordered by their ObjectID, which
+// follows insertion order. It returns ErrInvalidEventID if the account has no such entry.
+func (m *MongoRepo) GetTransactionsAfter(ctx context.Context, accountID, entryID string, limit int) ([]map[string]interface{}, error) {
+	var anchor struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	source, key, ok := splitEntryID(entryID)
+	filter := bson.M{"account_id": accountID, "idempotency_key": key}
+	if ok {
+		// Entries inserted before they recorded their source have the account as source.
+		filter["$or"] = bson.A{
+			bson.M{"source_account_id": source},
+			bson.M{"source_account_id": bson.M{"$exists": false}, "account_id": source},
+		}
+	}
+	err := m.C.FindOne(ctx, filter,
+		options.FindOne().SetSort(bson.D{{Key: "_id", Value: -1}})).Decode(&anchor)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrInvalidEventID
+	}
+	if err != nil {
+		return nil, err
+	}
+	filter = bson.M{"account_id": accountID, "_id": bson.M{"$gt": anchor.ID}}
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(int64(limit))
+	cur, err := m.C.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	return decodeEntries(ctx, cur)
+}
+
+// ExportLedger calls fn with every ledger entry matching f, oldest first, and stops at the first
+// error fn returns. Entries are read from a cursor a batch at a time, so exports of any size run
+// in constant memory.
+func (m *MongoRepo) ExportLedger(ctx context.Context, f LedgerFilter, fn func(LedgerEntry) error) (err error) {
+	ctx, span := startSpan(ctx, "MongoRepo.ExportLedger", spanMongo)
+	defer tracing.End(span, &err)
+	filter := bson.M{}
+	if f.AccountID != "" {
+		filter["account_id"] = f.AccountID
+	}
+	created := bson.M{}
+	if !f.From.IsZero() {
+		created["$gte"] = f.From
+	}
+	if !f.To.IsZero() {
+		created["$lt"] = f.To
+	}
+	if len(created) > 0 {
+		filter["created_at"] = created
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}).SetBatchSize(exportPage)
+	cur, err := m.C.Find(ctx, filter, opts)
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		var e LedgerEntry
+		if err := cur.Decode(&e); err != nil {
+			return err
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return cur.Err()
+}
+
+// decodeEntries reads every ledger entry document of cur as a map, with its ID (see EntryID) in
+// place of the source account. Entries inserted before they recorded their source are given the
+// account as source.
+func decodeEntries(ctx context.Context, cur *mongo.Cursor) ([]map[string]interface{}, error) {
 	defer cur.Close(ctx)
 	var out []map[string]interface{}
 	for cur.Next(ctx) {
@@ -92,7 +189,14 @@ func (m *MongoRepo) GetTransactions(ctx context.Context, accountID string, limit
 		if err := cur.Decode(&doc); err != nil {
 			return nil, err
 		}
+		source, ok := doc["source_account_id"].(string)
+		if !ok {
+			source, _ = doc["account_id"].(string)
+		}
+		key, _ := doc["idempotency_key"].(string)
+		doc["id"] = EntryID(source, key)
+		delete(doc, "source_account_id")
 		out = append(out, doc)
 	}
-	return out, nil
+	return out, cur.Err()
 }
@@ -2,11 +2,14 @@ package repo_test
 
 import (
 	"context"
+	"reflect"
 	"testing"
 	"time"
 
 	"github.com/Bharat0908/ledger/internal/repo"
 	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
 )
 
 func TestMongoRepo_InsertLedger(t *testing.T) {
@@ -74,6 +77,61 @@ func TestMongoRepo_InsertTransferLedger(t *testing.T) {
 	}
 }
 
+func TestMongoRepo_LedgerWritesUpsert(t *testing.T) {
+	// A redelivered message is written again; entries are upserted so it is not recorded twice.
+	from, to := uuid.New(), uuid.New()
+	tests := []struct {
+		name  string
+		write func(m *repo.MongoRepo) error
+		want  []bson.M // filters of the upserted entries
+	}{
+		{
+			name: "transaction",
+			write: func(m *repo.MongoRepo) error {
+				return m.InsertLedger(context.Background(), from, "deposit", 5, 105, "k1", time.Now())
+			},
+			want: []bson.M{{"account_id": from.String(), "source_account_id": from.String(), "type": "deposit", "idempotency_key": "k1"}},
+		},
+		{
+			name: "transfer",
+			write: func(m *repo.MongoRepo) error {
+				return m.InsertTransferLedger(context.Background(), from, to, 5, 95, 5, "k1", time.Now())
+			},
+			want: []bson.M{
+				{"account_id": from.String(), "source_account_id": from.String(), "type": "transfer_debit", "idempotency_key": "k1"},
+				{"account_id": to.String(), "source_account_id": from.String(), "type": "transfer_credit", "idempotency_key": "k1"},
+			},
+		},
+	}
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: len(tt.want)}))
+			if err := tt.write(&repo.MongoRepo{C: mt.Coll}); err != nil {
+				mt.Fatalf("write failed: %v", err)
+			}
+			cmd := mt.GetStartedEvent().Command
+			updates, _ := cmd.Lookup("updates").Array().Values()
+			if len(updates) != len(tt.want) {
+				mt.Fatalf("%s command has %d updates, want %d upserts: %v", cmd.Index(0).Key(), len(updates), len(tt.want), cmd)
+			}
+			for i, u := range updates {
+				var got struct {
+					Q      bson.M
+					U      bson.M
+					Upsert bool
+				}
+				if err := bson.Unmarshal(u.Document(), &got); err != nil {
+					mt.Fatalf("Unmarshal() failed: %v", err)
+				}
+				if !got.Upsert || got.U["$setOnInsert"] == nil || !reflect.DeepEqual(got.Q, tt.want[i]) {
+					mt.Errorf("update %d = %v, want an upsert of the entry %v", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
 func TestMongoRepo_GetTransactions(t *testing.T) {
 	tests := []struct {
 		name string // description of this test case
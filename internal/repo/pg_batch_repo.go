@@ -0,0 +1,100 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PGBatchRepo stores bulk transfer batches in Postgres. Progress is derived from the items and
+// from processed_messages, so it needs the same database as the balance store.
+type PGBatchRepo struct{ DB *pgxpool.Pool }
+
+// CreateTransferBatch stores a batch and its items and returns the batch.
+func (r *PGBatchRepo) CreateTransferBatch(ctx context.Context, in NewTransferBatch) (TransferBatch, error) {
+	n := len(in.Items)
+	positions := make([]int32, n)
+	keys := make([]string, n)
+	accounts := make([]string, n)
+	statuses := make([]string, n)
+	codes := make([]string, n)
+	for i, it := range in.Items {
+		positions[i], keys[i], accounts[i], statuses[i], codes[i] = int32(i), it.IdempotencyKey, it.AccountID, it.Status, it.Error
+	}
+	b := TransferBatch{ID: uuid.New(), Owner: in.Owner, CreatedAt: time.Now()}
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return TransferBatch{}, err
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, `INSERT INTO transfer_batches(id, owner, created_at) VALUES($1,$2,$3)`, b.ID, b.Owner, b.CreatedAt); err != nil {
+		return TransferBatch{}, err
+	}
+	if _, err := tx.Exec(ctx, `INSERT INTO transfer_batch_items(batch_id, position, idempotency_key, account_id, status, error)
+		SELECT $1, * FROM unnest($2::int[], $3::text[], $4::text[], $5::text[], $6::text[])`, b.ID, positions, keys, accounts, statuses, codes); err != nil {
+		return TransferBatch{}, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return TransferBatch{}, err
+	}
+	b.Total = n
+	for _, it := range in.Items {
+		if it.Status == BatchItemRejected {
+			b.Rejected++
+		}
+	}
+	b.complete()
+	return b, nil
+}
+
+// RejectBatchItems marks the queued items of a batch with the given keys rejected with code,
+// for transfers that could not be published after the batch was stored.
+func (r *PGBatchRepo) RejectBatchItems(ctx context.Context, id uuid.UUID, keys []string, code string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	_, err := r.DB.Exec(ctx, `UPDATE transfer_batch_items SET status=$3, error=$4
+		WHERE batch_id=$1 AND idempotency_key = ANY($2) AND status=$5`, id, keys, BatchItemRejected, code, BatchItemQueued)
+	return err
+}
+
+// FailBatchItems marks queued items refused by the worker failed, in every batch that holds
+// their key for the same source account (items stored before batches recorded it match on the
+// key alone). Items that are not queued are left alone, so redelivered events are harmless.
+func (r *PGBatchRepo) FailBatchItems(ctx context.Context, fs []BatchItemFailure) error {
+	if len(fs) == 0 {
+		return nil
+	}
+	b := &pgx.Batch{}
+	for _, f := range fs {
+		b.Queue(`UPDATE transfer_batch_items SET status=$3, error=$4
+			WHERE idempotency_key=$1 AND (account_id='' OR account_id=$2) AND status=$5`,
+			f.IdempotencyKey, f.AccountID, BatchItemFailed, f.Reason, BatchItemQueued)
+	}
+	return r.DB.SendBatch(ctx, b).Close()
+}
+
+// GetTransferBatch returns the progress of a batch or ErrBatchNotFound.
+func (r *PGBatchRepo) GetTransferBatch(ctx context.Context, id uuid.UUID) (TransferBatch, error) {
+	var b TransferBatch
+	err := r.DB.QueryRow(ctx, `SELECT b.id, b.owner, b.created_at,
+			count(i.position),
+			count(*) FILTER (WHERE i.status = $2),
+			count(*) FILTER (WHERE i.status = $3),
+			count(p.idempotency_key) FILTER (WHERE i.status = $4)
+		FROM transfer_batches b
+		LEFT JOIN transfer_batch_items i ON i.batch_id = b.id
+		LEFT JOIN processed_messages p ON p.idempotency_key = i.idempotency_key
+			AND (i.account_id = '' OR p.account_id::text = i.account_id)
+		WHERE b.id = $1
+		GROUP BY b.id`, id, BatchItemRejected, BatchItemFailed, BatchItemQueued).
+		Scan(&b.ID, &b.Owner, &b.CreatedAt, &b.Total, &b.Rejected, &b.Failed, &b.Applied)
+	if err != nil {
+		return TransferBatch{}, notFoundAs(err, ErrBatchNotFound)
+	}
+	b.complete()
+	return b, nil
+}
@@ -0,0 +1,155 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PGLedgerRepo reads ledger entries from the Postgres ledger_entries table.
+// It is the Postgres-only counterpart of MongoRepo: the entries themselves are
+// written by PGRepo (with WriteLedger set) in the same transaction as the balance
+// change, so history is always consistent with the account balance.
+type PGLedgerRepo struct{ DB *pgxpool.Pool }
+
+// insertLedgerEntry records a single ledger entry inside an open transaction. source is the
+// account the idempotency key belongs to: the account of a transaction or the source of a
+// transfer.
+func insertLedgerEntry(ctx context.Context, tx pgx.Tx, accountID, source uuid.UUID, typ string, amount, balanceAfter int64, key string) error {
+	_, err := tx.Exec(ctx, `INSERT INTO ledger_entries(account_id,source_account_id,type,amount,balance_after,idempotency_key,created_at) VALUES($1,$2,$3,$4,$5,$6,$7)`,
+		accountID, source, typ, amount, balanceAfter, key, time.Now())
+	return err
+}
+
+// pgEntryColumns are the columns pgLedgerEntries reads. Entries written before they recorded
+// their source account were transactions and debits, whose source is the account itself, or
+// credits, whose source is unknown; both are given the account as source.
+const pgEntryColumns = `account_id, COALESCE(source_account_id, account_id), type, amount, balance_after, idempotency_key, created_at`
+
+// GetTransactions retrieves up to limit ledger entries for the given account, newest first.
+// Entries are returned with the same keys as MongoRepo.GetTransactions so callers do not
+// need to know which store backs the ledger.
+func (r *PGLedgerRepo) GetTransactions(ctx context.Context, accountID string, limit int) ([]map[string]interface{}, error) {
+	id, err := uuid.Parse(accountID)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.DB.Query(ctx, `SELECT `+pgEntryColumns+`
+		FROM ledger_entries WHERE account_id=$1 ORDER BY created_at DESC, id DESC LIMIT $2`, id, limit)
+	if err != nil {
+		return nil, err
+	}
+	return pgLedgerEntries(rows)
+}
+
+// GetTransactionsAfter retrieves up to limit ledger entries for the given account that were
+// written after its entry with the ID (see EntryID), oldest first, or ErrInvalidEventID if the
+// account has no such entry. A bare idempotency key names the account's latest entry with the
+// key. Entries are ordered by their sequence number, which concurrent writers may commit
+// slightly out of order.
+func (r *PGLedgerRepo) GetTransactionsAfter(ctx context.Context, accountID, entryID string, limit int) ([]map[string]interface{}, error) {
+	id, err := uuid.Parse(accountID)
+	if err != nil {
+		return nil, err
+	}
+	source, key, _ := splitEntryID(entryID)
+	var after int64
+	err = r.DB.QueryRow(ctx, `SELECT id FROM ledger_entries WHERE account_id=$1 AND idempotency_key=$2
+		AND ($3='' OR COALESCE(source_account_id, account_id)::text=$3) ORDER BY id DESC LIMIT 1`,
+		id, key, source).Scan(&after)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrInvalidEventID
+	}
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.DB.Query(ctx, `SELECT `+pgEntryColumns+`
+		FROM ledger_entries WHERE account_id=$1 AND id>$2 ORDER BY id LIMIT $3`, id, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	return pgLedgerEntries(rows)
+}
+
+// ExportLedger calls fn with every ledger entry matching f, oldest first, and stops at the first
+// error fn returns. Rows are streamed from a single query, so exports of any size run in
+// constant memory.
+func (r *PGLedgerRepo) ExportLedger(ctx context.Context, f LedgerFilter, fn func(LedgerEntry) error) error {
+	var (
+		where []string
+		args  []interface{}
+	)
+	if f.AccountID != "" {
+		id, err := uuid.Parse(f.AccountID)
+		if err != nil {
+			return err
+		}
+		args = append(args, id)
+		where = append(where, fmt.Sprintf("account_id=$%d", len(args)))
+	}
+	if !f.From.IsZero() {
+		args = append(args, f.From)
+		where = append(where, fmt.Sprintf("created_at>=$%d", len(args)))
+	}
+	if !f.To.IsZero() {
+		args = append(args, f.To)
+		where = append(where, fmt.Sprintf("created_at<$%d", len(args)))
+	}
+	q := `SELECT account_id, type, amount, balance_after, idempotency_key, created_at FROM ledger_entries`
+	if len(where) > 0 {
+		q += " WHERE " + strings.Join(where, " AND ")
+	}
+	rows, err := r.DB.Query(ctx, q+" ORDER BY created_at, id", args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			e   LedgerEntry
+			acc uuid.UUID
+		)
+		if err := rows.Scan(&acc, &e.Type, &e.Amount, &e.BalanceAfter, &e.IdempotencyKey, &e.CreatedAt); err != nil {
+			return err
+		}
+		e.AccountID = acc.String()
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// pgLedgerEntries reads ledger entry rows of pgEntryColumns into maps with the keys of
+// MongoRepo.GetTransactions.
+func pgLedgerEntries(rows pgx.Rows) ([]map[string]interface{}, error) {
+	defer rows.Close()
+	var out []map[string]interface{}
+	for rows.Next() {
+		var (
+			acc, source      uuid.UUID
+			typ, key         string
+			amount, balAfter int64
+			createdAt        time.Time
+		)
+		if err := rows.Scan(&acc, &source, &typ, &amount, &balAfter, &key, &createdAt); err != nil {
+			return nil, err
+		}
+		out = append(out, map[string]interface{}{
+			"id":              EntryID(source.String(), key),
+			"account_id":      acc.String(),
+			"type":            typ,
+			"amount":          amount,
+			"balance_after":   balAfter,
+			"idempotency_key": key,
+			"created_at":      createdAt,
+		})
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,50 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PGQuotaRepo tracks daily per-client transaction usage in the Postgres quota_usage table, so
+// every API instance enforces the same quotas.
+type PGQuotaRepo struct{ DB *pgxpool.Pool }
+
+// ConsumeQuota records one transaction of amount for client on the UTC day of at, unless that
+// would take the client's usage past lim, in which case it returns ErrQuotaExceeded and records
+// nothing. The check and the increment are a single statement, so concurrent requests cannot
+// overshoot the limits.
+func (r *PGQuotaRepo) ConsumeQuota(ctx context.Context, client string, at time.Time, amount int64, lim QuotaLimits) (QuotaUsage, error) {
+	return r.ConsumeQuotaBatch(ctx, client, at, 1, amount, lim)
+}
+
+// ConsumeQuotaBatch records count transactions totalling amount for client, like ConsumeQuota:
+// either all of them fit within lim and are recorded, or none is.
+func (r *PGQuotaRepo) ConsumeQuotaBatch(ctx context.Context, client string, at time.Time, count, amount int64, lim QuotaLimits) (QuotaUsage, error) {
+	if !lim.allows(count, amount) {
+		return QuotaUsage{}, ErrQuotaExceeded
+	}
+	u := QuotaUsage{Client: client, Day: quotaDay(at)}
+	err := r.DB.QueryRow(ctx, `INSERT INTO quota_usage(client, day, tx_count, amount) VALUES($1,$2,$3,$4)
+		ON CONFLICT (client, day) DO UPDATE SET tx_count = quota_usage.tx_count + EXCLUDED.tx_count, amount = quota_usage.amount + EXCLUDED.amount
+		WHERE ($5 <= 0 OR quota_usage.tx_count + EXCLUDED.tx_count <= $5) AND ($6 <= 0 OR quota_usage.amount + EXCLUDED.amount <= $6)
+		RETURNING tx_count, amount`, client, u.Day, count, amount, lim.DailyCount, lim.DailyAmount).Scan(&u.Count, &u.Amount)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return QuotaUsage{}, ErrQuotaExceeded
+	}
+	if err != nil {
+		return QuotaUsage{}, err
+	}
+	return u, nil
+}
+
+// RefundQuota gives back count transactions totalling amount that were recorded for client on the
+// UTC day of at but could not be queued after all. Usage never drops below zero.
+func (r *PGQuotaRepo) RefundQuota(ctx context.Context, client string, at time.Time, count, amount int64) error {
+	_, err := r.DB.Exec(ctx, `UPDATE quota_usage SET tx_count = GREATEST(tx_count - $3, 0), amount = GREATEST(amount - $4, 0)
+		WHERE client = $1 AND day = $2`, client, quotaDay(at), count, amount)
+	return err
+}
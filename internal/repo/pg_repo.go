@@ -3,8 +3,12 @@ package repo
 import (
 	"context"
 	"errors"
+	"fmt"
+	"strconv"
 	"time"
 
+	"github.com/Bharat0908/ledger/internal/metrics"
+	"github.com/Bharat0908/ledger/internal/tracing"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -14,13 +18,17 @@ import (
 //
 // Methods:
 //
-//   - CreateAccount(ctx, owner, currency, initial):
-//     Creates a new account with the specified owner, currency, and initial balance.
-//     Returns the generated account UUID or an error.
+//   - CreateAccount(ctx, in):
+//     Creates a new account with the given attributes and a zero balance, idempotently on in.ExternalRef.
+//     Returns the stored account, whether it was newly created, or an error.
 //
 //   - GetAccount(ctx, id):
-//     Retrieves the balance of the account with the given UUID.
-//     Returns the balance or an error.
+//     Retrieves the account with the given UUID, including its balance.
+//     Returns the account or an error.
+//
+//   - ListAccounts(ctx, filter):
+//     Lists accounts matching the filter with keyset (cursor) pagination.
+//     Returns one page of accounts and the total number of matches, or an error.
 //
 //   - ApplyTransaction(ctx, accountID, typ, amount, key):
 //     Applies a deposit or withdrawal transaction to the specified account, using an idempotency key to ensure the operation is not repeated.
@@ -29,31 +37,63 @@ import (
 //   - ApplyTransfer(ctx, from, to, amount, key):
 //     Transfers the specified amount from one account to another, using an idempotency key to ensure the operation is not repeated.
 //     Returns the new balances of both accounts or an error.
-type PGRepo struct{ DB *pgxpool.Pool }
+//
+// When WriteLedger is set, ApplyTransaction and ApplyTransfer also record ledger entries in the
+// ledger_entries table within the same transaction as the balance change (see PGLedgerRepo).
+type PGRepo struct {
+	DB          *pgxpool.Pool
+	WriteLedger bool
+}
 
-// CreateAccount creates a new account in the database with the specified owner, currency, and initial balance.
+// accountColumns is the column list scanned by scanAccount.
+const accountColumns = `id, owner, currency, balance, status, type, COALESCE(external_ref, ''), display_name, metadata, created_at`
+
+// CreateAccount creates a new account in the database with the specified attributes and a zero balance.
 // It generates a new UUID for the account, inserts the account record into the "accounts" table within a transaction,
-// and returns the generated account UUID upon success. If any error occurs during the process, it returns uuid.Nil and the error.
-// The operation is performed within the provided context for cancellation and timeout control.
-func (r *PGRepo) CreateAccount(ctx context.Context, owner, currency string, initial int64) (uuid.UUID, error) {
-	id := uuid.New()
+// and returns the stored account. If in.ExternalRef is already in use, the existing account is returned with
+// created=false (or ErrExternalRefConflict if it was created with a different owner, currency or type), so
+// retried provisioning requests are idempotent. The operation is performed within the provided context for
+// cancellation and timeout control.
+func (r *PGRepo) CreateAccount(ctx context.Context, in NewAccount) (acc Account, created bool, err error) {
+	defer observeTx(backendPostgres, opCreateAccount, time.Now(), &err)
+	ctx, span := startSpan(ctx, "PGRepo.CreateAccount", spanPostgres)
+	defer tracing.End(span, &err)
+	if err := in.normalize(); err != nil {
+		return Account{}, false, err
+	}
 	tx, err := r.DB.BeginTx(ctx, pgx.TxOptions{})
 	if err != nil {
-		return uuid.Nil, err
+		return Account{}, false, err
 	}
 	defer tx.Rollback(ctx)
 
-	if _, err := tx.Exec(ctx, `INSERT INTO accounts(id, owner, currency, balance, created_at) VALUES($1,$2,$3,$4,$5)`, id, owner, currency, initial, time.Now()); err != nil {
-		return uuid.Nil, err
+	acc, err = scanAccount(tx.QueryRow(ctx, `INSERT INTO accounts(id, owner, currency, balance, created_at, type, external_ref, display_name, metadata)
+		VALUES($1,$2,$3,$4,$5,$6,NULLIF($7,''),$8,$9)
+		ON CONFLICT (external_ref) WHERE external_ref IS NOT NULL DO NOTHING
+		RETURNING `+accountColumns,
+		uuid.New(), in.Owner, in.Currency, 0, time.Now(), in.Type, in.ExternalRef, in.DisplayName, in.Metadata))
+	switch {
+	case err == nil:
+		created = true
+	case errors.Is(err, pgx.ErrNoRows):
+		// external_ref already taken; return the account it belongs to
+		acc, err = scanAccount(tx.QueryRow(ctx, `SELECT `+accountColumns+` FROM accounts WHERE external_ref=$1`, in.ExternalRef))
+		if err != nil {
+			return Account{}, false, err
+		}
+		if !in.matches(acc) {
+			return Account{}, false, ErrExternalRefConflict
+		}
+	default:
+		return Account{}, false, err
 	}
 	if err := tx.Commit(ctx); err != nil {
-		return uuid.Nil, err
+		return Account{}, false, err
 	}
-	return id, nil
+	return acc, created, nil
 }
 
-// GetAccount retrieves the balance of an account with the specified UUID from the database.
-// It returns the account balance as an int64 and an error if the query fails or the account does not exist.
+// GetAccount retrieves the account with the specified UUID, including its current balance.
 //
 // Parameters:
 //
@@ -62,14 +102,104 @@ func (r *PGRepo) CreateAccount(ctx context.Context, owner, currency string, init
 //
 // Returns:
 //
-//	int64 - The balance of the account.
-//	error - An error if the account could not be retrieved.
-func (r *PGRepo) GetAccount(ctx context.Context, id uuid.UUID) (int64, error) {
-	var bal int64
-	if err := r.DB.QueryRow(ctx, `SELECT balance FROM accounts WHERE id=$1`, id).Scan(&bal); err != nil {
-		return 0, err
+//	Account - The stored account.
+//	error   - ErrNotFound if the account does not exist, or the underlying error if the query fails.
+func (r *PGRepo) GetAccount(ctx context.Context, id uuid.UUID) (Account, error) {
+	acc, err := scanAccount(r.DB.QueryRow(ctx, `SELECT `+accountColumns+` FROM accounts WHERE id=$1`, id))
+	if err != nil {
+		return Account{}, notFound(err)
+	}
+	return acc, nil
+}
+
+// GetProcessedTransactions returns the transactions and transfers applied with the idempotency
+// key, oldest first, or ErrTransactionNotFound if none has been. Keys are unique per account, so
+// different accounts may each have applied one with the same key.
+func (r *PGRepo) GetProcessedTransactions(ctx context.Context, key string) ([]ProcessedTransaction, error) {
+	rows, err := r.DB.Query(ctx, `SELECT account_id, type, amount, processed_at FROM processed_messages
+		WHERE idempotency_key=$1 ORDER BY processed_at, account_id`, key)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []ProcessedTransaction
+	for rows.Next() {
+		t := ProcessedTransaction{IdempotencyKey: key}
+		if err := rows.Scan(&t.AccountID, &t.Type, &t.Amount, &t.ProcessedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(out) == 0 {
+		return nil, ErrTransactionNotFound
 	}
-	return bal, nil
+	return out, nil
+}
+
+// ListAccounts returns the page of accounts matching f, in the order given by f.Sort, together
+// with the total number of matching accounts. Owner and creation-time filters are served by
+// idx_accounts_owner_created and idx_accounts_created; metadata pairs are matched with JSONB
+// containment, which uses idx_accounts_metadata.
+// Invalid sorts, limits, statuses and cursors are reported as domain errors.
+func (r *PGRepo) ListAccounts(ctx context.Context, f AccountFilter) (AccountPage, error) {
+	q, err := f.normalize()
+	if err != nil {
+		return AccountPage{}, err
+	}
+	build := func(args *[]interface{}) accountListSQL {
+		b := accountListSQL{bind: func(v interface{}) string {
+			*args = append(*args, v)
+			return fmt.Sprintf("$%d", len(*args))
+		}}
+		b.metadata = func(k, v string) string {
+			return "metadata @> " + b.bind(map[string]string{k: v}) + "::jsonb"
+		}
+		return b
+	}
+
+	var page AccountPage
+	var countArgs []interface{}
+	where := build(&countArgs).where(q)
+	if err := r.DB.QueryRow(ctx, `SELECT count(*) FROM accounts WHERE `+where, countArgs...).Scan(&page.Total); err != nil {
+		return AccountPage{}, err
+	}
+
+	var args []interface{}
+	b := build(&args)
+	where = b.where(q)
+	cond, order := b.page(q)
+	rows, err := r.DB.Query(ctx, `SELECT `+accountColumns+` FROM accounts WHERE `+where+` AND `+cond+
+		` ORDER BY `+order+` LIMIT `+strconv.Itoa(q.Limit+1), args...)
+	if err != nil {
+		return AccountPage{}, err
+	}
+	defer rows.Close()
+	page.Accounts = []Account{}
+	for rows.Next() {
+		a, err := scanAccount(rows)
+		if err != nil {
+			return AccountPage{}, err
+		}
+		page.Accounts = append(page.Accounts, a)
+	}
+	if err := rows.Err(); err != nil {
+		return AccountPage{}, err
+	}
+	if len(page.Accounts) > q.Limit {
+		page.Accounts = page.Accounts[:q.Limit]
+		page.NextCursor = q.nextCursor(page.Accounts[q.Limit-1])
+	}
+	return page, nil
+}
+
+// scanAccount scans a row selected with accountColumns.
+func scanAccount(row pgx.Row) (Account, error) {
+	var a Account
+	err := row.Scan(&a.ID, &a.Owner, &a.Currency, &a.Balance, &a.Status, &a.Type, &a.ExternalRef, &a.DisplayName, &a.Metadata, &a.CreatedAt)
+	return a, err
 }
 
 // ApplyTransaction applies a deposit or withdrawal transaction to the specified account in a transactional manner.
@@ -83,13 +213,21 @@ func (r *PGRepo) GetAccount(ctx context.Context, id uuid.UUID) (int64, error) {
 //	accountID - UUID of the account to apply the transaction to
 //	typ       - transaction type: "deposit" or "withdraw"
 //	amount    - amount to deposit or withdraw
-//	key       - idempotency key to ensure transaction uniqueness
+//	key       - idempotency key to ensure transaction uniqueness, scoped to the account
 //
 // Returns:
 //
 //	balanceAfter - the account balance after the transaction
-//	err          - error if the transaction failed or was invalid
+//	err          - a domain error (ErrNotFound, ErrAccountFrozen, ErrInsufficientFunds, ErrOpeningAccount,
+//	               ErrInvalidType, ErrInvalidAmount) if the transaction was rejected, or the underlying
+//	               error if it failed
 func (r *PGRepo) ApplyTransaction(ctx context.Context, accountID uuid.UUID, typ string, amount int64, key string) (balanceAfter int64, err error) {
+	defer observeTx(backendPostgres, opApplyTransaction, time.Now(), &err)
+	ctx, span := startSpan(ctx, "PGRepo.ApplyTransaction", spanPostgres)
+	defer tracing.End(span, &err)
+	if amount <= 0 {
+		return 0, ErrInvalidAmount
+	}
 	tx, err := r.DB.BeginTx(ctx, pgx.TxOptions{})
 	if err != nil {
 		return 0, err
@@ -98,30 +236,37 @@ func (r *PGRepo) ApplyTransaction(ctx context.Context, accountID uuid.UUID, typ
 
 	// idempotency check
 	var existing string
-	err = tx.QueryRow(ctx, `SELECT idempotency_key FROM processed_messages WHERE idempotency_key=$1`, key).Scan(&existing)
+	err = tx.QueryRow(ctx, `SELECT idempotency_key FROM processed_messages WHERE account_id=$1 AND idempotency_key=$2`, accountID, key).Scan(&existing)
 	if err == nil {
 		var bal int64
 		if err := tx.QueryRow(ctx, `SELECT balance FROM accounts WHERE id=$1`, accountID).Scan(&bal); err != nil {
-			return 0, err
+			return 0, notFound(err)
 		}
+		metrics.IdempotentDuplicates.WithLabelValues(opApplyTransaction).Inc()
 		return bal, tx.Commit(ctx)
 	}
 
-	var balance int64
-	if err = tx.QueryRow(ctx, `SELECT balance FROM accounts WHERE id=$1 FOR UPDATE`, accountID).Scan(&balance); err != nil {
-		return 0, err
+	var (
+		balance       int64
+		status, atype string
+	)
+	if err = tx.QueryRow(ctx, `SELECT balance, status, type FROM accounts WHERE id=$1 FOR UPDATE`, accountID).Scan(&balance, &status, &atype); err != nil {
+		return 0, notFound(err)
+	}
+	if status == StatusFrozen {
+		return 0, ErrAccountFrozen
 	}
 
 	switch typ {
 	case "deposit":
 		balance += amount
 	case "withdraw":
-		if balance < amount {
-			return 0, errors.New("insufficient_funds")
+		if err := checkDebit(atype, balance, amount, false); err != nil {
+			return 0, err
 		}
 		balance -= amount
 	default:
-		return 0, errors.New("invalid_type")
+		return 0, ErrInvalidType
 	}
 
 	if _, err = tx.Exec(ctx, `UPDATE accounts SET balance=$1 WHERE id=$2`, balance, accountID); err != nil {
@@ -130,6 +275,11 @@ func (r *PGRepo) ApplyTransaction(ctx context.Context, accountID uuid.UUID, typ
 	if _, err = tx.Exec(ctx, `INSERT INTO processed_messages(idempotency_key,account_id,type,amount,processed_at) VALUES($1,$2,$3,$4,$5)`, key, accountID, typ, amount, time.Now()); err != nil {
 		return 0, err
 	}
+	if r.WriteLedger {
+		if err = insertLedgerEntry(ctx, tx, accountID, accountID, typ, amount, balance, key); err != nil {
+			return 0, err
+		}
+	}
 	if err = tx.Commit(ctx); err != nil {
 		return 0, err
 	}
@@ -137,12 +287,24 @@ func (r *PGRepo) ApplyTransaction(ctx context.Context, accountID uuid.UUID, typ
 }
 
 // ApplyTransfer performs a transfer of the specified amount from one account to another within a database transaction.
-// It ensures idempotency using the provided key, so repeated calls with the same key will not result in duplicate transfers.
+// It ensures idempotency using the provided key, scoped to the source account, so repeated calls with the same key will not result in duplicate transfers.
 // The function locks both accounts to prevent race conditions and deadlocks, and checks for sufficient funds before proceeding.
 // On success, it returns the updated balances of the source and destination accounts.
 // If the transfer has already been processed (as determined by the idempotency key), it returns the current balances without applying the transfer.
-// Returns an error if the transaction fails, the accounts cannot be locked, or there are insufficient funds.
+// Equity accounts are only debited by the opening transfer to an account, keyed by OpeningBalanceKey, which may
+// take them below zero; any other transfer out of them is rejected with ErrOpeningAccount.
+// Returns ErrNotFound, ErrSameAccount, ErrCurrencyMismatch, ErrAccountFrozen, ErrInsufficientFunds or ErrOpeningAccount
+// when a business rule rejects the transfer, or the underlying error if the transaction fails.
 func (r *PGRepo) ApplyTransfer(ctx context.Context, from, to uuid.UUID, amount int64, key string) (fromAfter, toAfter int64, err error) {
+	defer observeTx(backendPostgres, opApplyTransfer, time.Now(), &err)
+	ctx, span := startSpan(ctx, "PGRepo.ApplyTransfer", spanPostgres)
+	defer tracing.End(span, &err)
+	if amount <= 0 {
+		return 0, 0, ErrInvalidAmount
+	}
+	if from == to {
+		return 0, 0, ErrSameAccount
+	}
 	tx, err := r.DB.BeginTx(ctx, pgx.TxOptions{})
 	if err != nil {
 		return 0, 0, err
@@ -150,15 +312,16 @@ func (r *PGRepo) ApplyTransfer(ctx context.Context, from, to uuid.UUID, amount i
 	defer tx.Rollback(ctx)
 
 	var existing string
-	if err = tx.QueryRow(ctx, `SELECT idempotency_key FROM processed_messages WHERE idempotency_key=$1`, key).Scan(&existing); err == nil {
+	if err = tx.QueryRow(ctx, `SELECT idempotency_key FROM processed_messages WHERE account_id=$1 AND idempotency_key=$2`, from, key).Scan(&existing); err == nil {
 		// already processed
 		var fb, tb int64
 		if err := tx.QueryRow(ctx, `SELECT balance FROM accounts WHERE id=$1`, from).Scan(&fb); err != nil {
-			return 0, 0, err
+			return 0, 0, notFound(err)
 		}
 		if err := tx.QueryRow(ctx, `SELECT balance FROM accounts WHERE id=$1`, to).Scan(&tb); err != nil {
-			return 0, 0, err
+			return 0, 0, notFound(err)
 		}
+		metrics.IdempotentDuplicates.WithLabelValues(opApplyTransfer).Inc()
 		return fb, tb, tx.Commit(ctx)
 	}
 
@@ -168,25 +331,42 @@ func (r *PGRepo) ApplyTransfer(ctx context.Context, from, to uuid.UUID, amount i
 		first, second = to, from
 	}
 
-	rows, err := tx.Query(ctx, `SELECT id, balance FROM accounts WHERE id IN ($1,$2) FOR UPDATE`, first, second)
+	rows, err := tx.Query(ctx, `SELECT id, balance, currency, status, type FROM accounts WHERE id IN ($1,$2) ORDER BY id FOR UPDATE`, first, second)
 	if err != nil {
 		return 0, 0, err
 	}
 	defer rows.Close()
-	balances := map[string]int64{}
+	type lockedAccount struct {
+		balance                 int64
+		currency, status, atype string
+	}
+	accounts := map[uuid.UUID]lockedAccount{}
 	for rows.Next() {
 		var id uuid.UUID
-		var bal int64
-		if err := rows.Scan(&id, &bal); err != nil {
+		var a lockedAccount
+		if err := rows.Scan(&id, &a.balance, &a.currency, &a.status, &a.atype); err != nil {
 			return 0, 0, err
 		}
-		balances[id.String()] = bal
+		accounts[id] = a
+	}
+	if err := rows.Err(); err != nil {
+		return 0, 0, err
 	}
 
-	fromBal := balances[from.String()]
-	toBal := balances[to.String()]
-	if fromBal < amount {
-		return 0, 0, errors.New("insufficient_funds")
+	src, okFrom := accounts[from]
+	dst, okTo := accounts[to]
+	if !okFrom || !okTo {
+		return 0, 0, ErrNotFound
+	}
+	if src.status == StatusFrozen || dst.status == StatusFrozen {
+		return 0, 0, ErrAccountFrozen
+	}
+	if src.currency != dst.currency {
+		return 0, 0, ErrCurrencyMismatch
+	}
+	fromBal, toBal := src.balance, dst.balance
+	if err := checkDebit(src.atype, fromBal, amount, key == OpeningBalanceKey(to)); err != nil {
+		return 0, 0, err
 	}
 	fromBal -= amount
 	toBal += amount
@@ -201,9 +381,25 @@ func (r *PGRepo) ApplyTransfer(ctx context.Context, from, to uuid.UUID, amount i
 	if _, err := tx.Exec(ctx, `INSERT INTO processed_messages(idempotency_key,account_id,type,amount,processed_at) VALUES($1,$2,$3,$4,$5)`, key, from, "transfer", amount, time.Now()); err != nil {
 		return 0, 0, err
 	}
+	if r.WriteLedger {
+		if err := insertLedgerEntry(ctx, tx, from, from, "transfer_debit", -amount, fromBal, key); err != nil {
+			return 0, 0, err
+		}
+		if err := insertLedgerEntry(ctx, tx, to, from, "transfer_credit", amount, toBal, key); err != nil {
+			return 0, 0, err
+		}
+	}
 
 	if err := tx.Commit(ctx); err != nil {
 		return 0, 0, err
 	}
 	return fromBal, toBal, nil
 }
+
+// notFound translates a missing row into ErrNotFound and passes other errors through.
+func notFound(err error) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}
@@ -2,21 +2,22 @@ package repo_test
 
 import (
 	"context"
+	"os"
 	"testing"
 
 	"github.com/Bharat0908/ledger/internal/repo"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 func TestPGRepo_CreateAccount(t *testing.T) {
 	tests := []struct {
 		name string // description of this test case
 		// Named input parameters for target function.
-		owner    string
-		currency string
-		initial  int64
-		want     uuid.UUID
-		wantErr  bool
+		in          repo.NewAccount
+		want        repo.Account
+		wantCreated bool
+		wantErr     bool
 	}{
 		// TODO: Add test cases.
 	}
@@ -24,7 +25,7 @@ func TestPGRepo_CreateAccount(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			// TODO: construct the receiver type.
 			var r repo.PGRepo
-			got, gotErr := r.CreateAccount(context.Background(), tt.owner, tt.currency, tt.initial)
+			got, gotCreated, gotErr := r.CreateAccount(context.Background(), tt.in)
 			if gotErr != nil {
 				if !tt.wantErr {
 					t.Errorf("CreateAccount() failed: %v", gotErr)
@@ -38,6 +39,9 @@ func TestPGRepo_CreateAccount(t *testing.T) {
 			if true {
 				t.Errorf("CreateAccount() = %v, want %v", got, tt.want)
 			}
+			if gotCreated != tt.wantCreated {
+				t.Errorf("CreateAccount() created = %v, want %v", gotCreated, tt.wantCreated)
+			}
 		})
 	}
 }
@@ -47,7 +51,7 @@ func TestPGRepo_GetAccount(t *testing.T) {
 		name string // description of this test case
 		// Named input parameters for target function.
 		id      uuid.UUID
-		want    int64
+		want    repo.Account
 		wantErr bool
 	}{
 		// TODO: Add test cases.
@@ -147,3 +151,31 @@ func TestPGRepo_ApplyTransfer(t *testing.T) {
 		})
 	}
 }
+
+// pgConformanceRepo combines the Postgres balance store, ledger read path, API key store, quota
+// store, webhook store and batch store.
+type pgConformanceRepo struct {
+	*repo.PGRepo
+	*repo.PGLedgerRepo
+	*repo.PGAPIKeyRepo
+	*repo.PGQuotaRepo
+	*repo.PGWebhookRepo
+	*repo.PGBatchRepo
+}
+
+// TestPGRepo_Conformance runs the shared backend suite against a migrated Postgres database.
+// It is skipped unless LEDGER_TEST_POSTGRES_DSN is set.
+func TestPGRepo_Conformance(t *testing.T) {
+	dsn := os.Getenv("LEDGER_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("LEDGER_TEST_POSTGRES_DSN not set")
+	}
+	pool, err := pgxpool.New(context.Background(), dsn)
+	if err != nil {
+		t.Fatalf("pgxpool.New() failed: %v", err)
+	}
+	t.Cleanup(pool.Close)
+	runRepoConformance(t, func(t *testing.T) conformanceRepo {
+		return pgConformanceRepo{&repo.PGRepo{DB: pool, WriteLedger: true}, &repo.PGLedgerRepo{DB: pool}, &repo.PGAPIKeyRepo{DB: pool}, &repo.PGQuotaRepo{DB: pool}, &repo.PGWebhookRepo{DB: pool}, &repo.PGBatchRepo{DB: pool}}
+	})
+}
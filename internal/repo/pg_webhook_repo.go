@@ -0,0 +1,238 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PGWebhookRepo stores webhook subscriptions, their deliveries and the delivery attempt log in
+// Postgres. Deliveries are claimed with FOR UPDATE SKIP LOCKED, so several workers can deliver
+// from the same tables.
+type PGWebhookRepo struct{ DB *pgxpool.Pool }
+
+// webhookColumns is the column list scanned by scanWebhook.
+const webhookColumns = `id, owner, url, event_types, account_ids::text[], description, secret, created_at`
+
+// deliveryColumns is the column list scanned by scanDelivery.
+const deliveryColumns = `id, webhook_id, event_id, event_type, payload, status, attempts, next_attempt_at, created_at`
+
+// CreateWebhook stores a new webhook subscription and returns it.
+func (r *PGWebhookRepo) CreateWebhook(ctx context.Context, in NewWebhook) (Webhook, error) {
+	if err := in.normalize(); err != nil {
+		return Webhook{}, err
+	}
+	accounts := make([]string, len(in.AccountIDs))
+	for i, id := range in.AccountIDs {
+		accounts[i] = id.String()
+	}
+	return scanWebhook(r.DB.QueryRow(ctx, `INSERT INTO webhooks(id, owner, url, event_types, account_ids, description, secret, created_at)
+		VALUES($1,$2,$3,$4,$5::uuid[],$6,$7,$8) RETURNING `+webhookColumns,
+		uuid.New(), in.Owner, in.URL, in.EventTypes, accounts, in.Description, in.Secret, time.Now()))
+}
+
+// GetWebhook returns the webhook with the given ID or ErrWebhookNotFound.
+func (r *PGWebhookRepo) GetWebhook(ctx context.Context, id uuid.UUID) (Webhook, error) {
+	w, err := scanWebhook(r.DB.QueryRow(ctx, `SELECT `+webhookColumns+` FROM webhooks WHERE id=$1`, id))
+	if err != nil {
+		return Webhook{}, notFoundAs(err, ErrWebhookNotFound)
+	}
+	return w, nil
+}
+
+// ListWebhooks returns the webhooks of owner, or every webhook when owner is empty, oldest first.
+func (r *PGWebhookRepo) ListWebhooks(ctx context.Context, owner string) ([]Webhook, error) {
+	rows, err := r.DB.Query(ctx, `SELECT `+webhookColumns+` FROM webhooks WHERE $1 = '' OR owner = $1 ORDER BY created_at, id`, owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Webhook{}
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, w)
+	}
+	return out, rows.Err()
+}
+
+// DeleteWebhook deletes a webhook together with its deliveries and their attempt log.
+func (r *PGWebhookRepo) DeleteWebhook(ctx context.Context, id uuid.UUID) error {
+	tag, err := r.DB.Exec(ctx, `DELETE FROM webhooks WHERE id=$1`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+// EnqueueWebhookDeliveries queues deliveries due now. Events already queued for a webhook are
+// skipped, so enqueueing the events of a redelivered message is harmless.
+func (r *PGWebhookRepo) EnqueueWebhookDeliveries(ctx context.Context, ds []NewWebhookDelivery) error {
+	if len(ds) == 0 {
+		return nil
+	}
+	now := time.Now()
+	b := &pgx.Batch{}
+	for _, d := range ds {
+		b.Queue(`INSERT INTO webhook_deliveries(id, webhook_id, event_id, event_type, payload, status, next_attempt_at, created_at)
+			VALUES($1,$2,$3,$4,$5,$6,$7,$7) ON CONFLICT (webhook_id, event_id) DO NOTHING`,
+			uuid.New(), d.WebhookID, d.EventID, d.EventType, string(d.Payload), DeliveryPending, now)
+	}
+	return r.DB.SendBatch(ctx, b).Close()
+}
+
+// ClaimWebhookDeliveries returns up to limit pending deliveries due at now, oldest first, and
+// pushes their next attempt lease into the future so no other deliverer claims them meanwhile.
+// A deliverer that dies mid-attempt thus only delays the delivery by lease.
+func (r *PGWebhookRepo) ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]DueWebhookDelivery, error) {
+	rows, err := r.DB.Query(ctx, `UPDATE webhook_deliveries d SET next_attempt_at = $2
+		FROM webhooks w
+		WHERE w.id = d.webhook_id AND d.id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = '`+DeliveryPending+`' AND next_attempt_at <= $1
+			ORDER BY next_attempt_at, id LIMIT $3 FOR UPDATE SKIP LOCKED)
+		RETURNING d.id, d.webhook_id, d.event_id, d.event_type, d.payload, d.status, d.attempts, d.next_attempt_at, d.created_at, w.url, w.secret`,
+		now, now.Add(lease), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []DueWebhookDelivery{}
+	for rows.Next() {
+		var d DueWebhookDelivery
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.EventID, &d.EventType, &d.Payload, &d.Status, &d.Attempts, &d.NextAttemptAt, &d.CreatedAt, &d.URL, &d.Secret); err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+// RecordWebhookAttempt appends an attempt to a delivery's log and moves the delivery to the
+// attempt's resulting status. It returns ErrWebhookDeliveryNotFound if the delivery was
+// deleted meanwhile, with its webhook.
+func (r *PGWebhookRepo) RecordWebhookAttempt(ctx context.Context, id uuid.UUID, res WebhookAttemptResult) error {
+	if !validAttemptResult(res) {
+		return fmt.Errorf("invalid webhook attempt result %q", res.Status)
+	}
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	tag, err := tx.Exec(ctx, `UPDATE webhook_deliveries SET status=$2, attempts=attempts+1, next_attempt_at=$3 WHERE id=$1`,
+		id, res.Status, res.NextAttemptAt)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrWebhookDeliveryNotFound
+	}
+	a := res.Attempt
+	if _, err := tx.Exec(ctx, `INSERT INTO webhook_attempts(delivery_id, attempted_at, status_code, error, duration_ms) VALUES($1,$2,$3,$4,$5)`,
+		id, a.At, a.StatusCode, a.Error, a.DurationMS); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// ListWebhookDeliveries returns the latest limit deliveries of a webhook, newest first, with
+// their attempt logs.
+func (r *PGWebhookRepo) ListWebhookDeliveries(ctx context.Context, webhookID uuid.UUID, limit int) ([]WebhookDelivery, error) {
+	rows, err := r.DB.Query(ctx, `SELECT `+deliveryColumns+` FROM webhook_deliveries WHERE webhook_id=$1 ORDER BY created_at DESC, id LIMIT $2`, webhookID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []WebhookDelivery{}
+	index := map[uuid.UUID]int{}
+	ids := []uuid.UUID{}
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		index[d.ID] = len(out)
+		ids = append(ids, d.ID)
+		out = append(out, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return out, nil
+	}
+	attempts, err := r.DB.Query(ctx, `SELECT delivery_id, attempted_at, status_code, error, duration_ms FROM webhook_attempts
+		WHERE delivery_id = ANY($1) ORDER BY attempted_at, id`, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer attempts.Close()
+	for attempts.Next() {
+		var (
+			id uuid.UUID
+			a  WebhookAttempt
+		)
+		if err := attempts.Scan(&id, &a.At, &a.StatusCode, &a.Error, &a.DurationMS); err != nil {
+			return nil, err
+		}
+		d := &out[index[id]]
+		d.AttemptLog = append(d.AttemptLog, a)
+	}
+	return out, attempts.Err()
+}
+
+// RedeliverWebhookDelivery makes a delivery of the webhook pending again, due now, with a fresh
+// budget of attempts. Its attempt log is kept.
+func (r *PGWebhookRepo) RedeliverWebhookDelivery(ctx context.Context, webhookID, id uuid.UUID) (WebhookDelivery, error) {
+	d, err := scanDelivery(r.DB.QueryRow(ctx, `UPDATE webhook_deliveries SET status=$3, attempts=0, next_attempt_at=$4
+		WHERE webhook_id=$1 AND id=$2 RETURNING `+deliveryColumns, webhookID, id, DeliveryPending, time.Now()))
+	if err != nil {
+		return WebhookDelivery{}, notFoundAs(err, ErrWebhookDeliveryNotFound)
+	}
+	return d, nil
+}
+
+// scanWebhook scans a row selected with webhookColumns.
+func scanWebhook(row pgx.Row) (Webhook, error) {
+	var (
+		w        Webhook
+		accounts []string
+	)
+	if err := row.Scan(&w.ID, &w.Owner, &w.URL, &w.EventTypes, &accounts, &w.Description, &w.Secret, &w.CreatedAt); err != nil {
+		return Webhook{}, err
+	}
+	var err error
+	if w.AccountIDs, err = parseUUIDs(accounts); err != nil {
+		return Webhook{}, err
+	}
+	return w, nil
+}
+
+// scanDelivery scans a row selected with deliveryColumns.
+func scanDelivery(row pgx.Row) (WebhookDelivery, error) {
+	var d WebhookDelivery
+	if err := row.Scan(&d.ID, &d.WebhookID, &d.EventID, &d.EventType, &d.Payload, &d.Status, &d.Attempts, &d.NextAttemptAt, &d.CreatedAt); err != nil {
+		return WebhookDelivery{}, err
+	}
+	d.AttemptLog = []WebhookAttempt{}
+	return d, nil
+}
+
+// notFoundAs maps a missing row to the domain error notFound.
+func notFoundAs(err error, notFound *Error) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return notFound
+	}
+	return err
+}
@@ -0,0 +1,74 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ProcessedTransaction is a transaction or transfer that has been applied, as recorded under its
+// idempotency key. AccountID is the account of a transaction or the source of a transfer, and
+// Type is deposit, withdraw or transfer.
+type ProcessedTransaction struct {
+	IdempotencyKey string    `json:"idempotency_key"`
+	AccountID      uuid.UUID `json:"account_id"`
+	Type           string    `json:"type"`
+	Amount         int64     `json:"amount"`
+	ProcessedAt    time.Time `json:"processed_at"`
+}
+
+// ErrTransactionNotFound is returned when no transaction has been applied with an idempotency
+// key: it may still be queued, have been rejected, or never have been submitted.
+var ErrTransactionNotFound = &Error{Code: "transaction_not_found", Message: "no transaction has been applied with this idempotency key"}
+
+// AccountCreator creates accounts. It is implemented by PGRepo and SQLiteRepo.
+type AccountCreator interface {
+	CreateAccount(ctx context.Context, in NewAccount) (Account, bool, error)
+}
+
+// AccountGetter looks up accounts. It is implemented by PGRepo and SQLiteRepo.
+type AccountGetter interface {
+	GetAccount(ctx context.Context, id uuid.UUID) (Account, error)
+}
+
+// CheckOpeningAccounts verifies that every configured opening account exists, is an equity
+// account and holds the currency it is configured for, so a typo fails at startup rather than
+// in the worker.
+func CheckOpeningAccounts(ctx context.Context, accounts AccountGetter, configured map[string]uuid.UUID) error {
+	for cur, id := range configured {
+		acc, err := accounts.GetAccount(ctx, id)
+		if err != nil {
+			return fmt.Errorf("%s account %s: %w", cur, id, err)
+		}
+		if acc.Type != TypeEquity {
+			return fmt.Errorf("%s account %s is a %s account, not %s", cur, id, acc.Type, TypeEquity)
+		}
+		if acc.Currency != cur {
+			return fmt.Errorf("%s account %s holds %s", cur, id, acc.Currency)
+		}
+	}
+	return nil
+}
+
+// OpeningAccount returns the equity account that funds opening balances in currency: the one
+// configured for it, or the system equity account with the external reference
+// "opening-equity:<CURRENCY>", which is created on first use. Clients cannot create accounts
+// with that reference (see NewAccount.CheckClient), so it always names the system account.
+func OpeningAccount(ctx context.Context, accounts AccountCreator, configured map[string]uuid.UUID, currency string) (uuid.UUID, error) {
+	if id, ok := configured[currency]; ok {
+		return id, nil
+	}
+	acc, _, err := accounts.CreateAccount(ctx, NewAccount{
+		Owner:       "system",
+		Currency:    currency,
+		Type:        TypeEquity,
+		ExternalRef: openingRefPrefix + currency,
+		DisplayName: fmt.Sprintf("Opening balance equity (%s)", currency),
+	})
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("opening equity account for %s: %w", currency, err)
+	}
+	return acc.ID, nil
+}
@@ -0,0 +1,32 @@
+package repo
+
+import "time"
+
+// QuotaLimits caps how many transactions a client may enqueue per UTC day and their total
+// amount. A zero limit means no cap.
+type QuotaLimits struct {
+	DailyCount  int64
+	DailyAmount int64
+}
+
+// Enabled reports whether any limit is set.
+func (l QuotaLimits) Enabled() bool { return l.DailyCount > 0 || l.DailyAmount > 0 }
+
+// allows reports whether usage of count transactions totalling amount is within the limits.
+func (l QuotaLimits) allows(count, amount int64) bool {
+	return (l.DailyCount <= 0 || count <= l.DailyCount) && (l.DailyAmount <= 0 || amount <= l.DailyAmount)
+}
+
+// QuotaUsage is a client's usage on one UTC day, after the consumption that returned it.
+type QuotaUsage struct {
+	Client string    `json:"client"`
+	Day    time.Time `json:"day"`
+	Count  int64     `json:"count"`
+	Amount int64     `json:"amount"`
+}
+
+// quotaDay returns the UTC day containing t.
+func quotaDay(t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
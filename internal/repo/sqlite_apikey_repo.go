@@ -0,0 +1,117 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// sqliteAPIKeyColumns is the column list scanned by sqliteScanAPIKey. Scopes and account IDs
+// are stored as JSON arrays.
+const sqliteAPIKeyColumns = `id, name, prefix, key_hash, scopes, account_ids, signing_secret, created_at, revoked_at`
+
+// CreateAPIKey stores a new API key and returns it, like PGAPIKeyRepo.CreateAPIKey.
+func (r *SQLiteRepo) CreateAPIKey(ctx context.Context, in NewAPIKey) (APIKey, error) {
+	if err := in.normalize(); err != nil {
+		return APIKey{}, err
+	}
+	scopes, err := json.Marshal(in.Scopes)
+	if err != nil {
+		return APIKey{}, err
+	}
+	accounts, err := json.Marshal(in.AccountIDs)
+	if err != nil {
+		return APIKey{}, err
+	}
+	id := uuid.New()
+	if _, err := r.DB.ExecContext(ctx, `INSERT INTO api_keys(id, name, prefix, key_hash, scopes, account_ids, signing_secret, created_at) VALUES(?,?,?,?,?,?,?,?)`,
+		id.String(), in.Name, in.Prefix, in.Hash, string(scopes), string(accounts), in.SigningSecret, sqliteTime(time.Now())); err != nil {
+		return APIKey{}, err
+	}
+	return sqliteScanAPIKey(r.DB.QueryRowContext(ctx, `SELECT `+sqliteAPIKeyColumns+` FROM api_keys WHERE id=?`, id.String()))
+}
+
+// APIKeyByHash returns the key with the given hash, including revoked keys, or ErrAPIKeyNotFound.
+func (r *SQLiteRepo) APIKeyByHash(ctx context.Context, hash []byte) (APIKey, error) {
+	k, err := sqliteScanAPIKey(r.DB.QueryRowContext(ctx, `SELECT `+sqliteAPIKeyColumns+` FROM api_keys WHERE key_hash=?`, hash))
+	if err != nil {
+		return APIKey{}, sqliteAPIKeyNotFound(err)
+	}
+	return k, nil
+}
+
+// ListAPIKeys returns every key, newest first.
+func (r *SQLiteRepo) ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	rows, err := r.DB.QueryContext(ctx, `SELECT `+sqliteAPIKeyColumns+` FROM api_keys ORDER BY created_at DESC, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []APIKey{}
+	for rows.Next() {
+		k, err := sqliteScanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, k)
+	}
+	return out, rows.Err()
+}
+
+// RevokeAPIKey marks the key as revoked and returns it, keeping an earlier revocation time.
+func (r *SQLiteRepo) RevokeAPIKey(ctx context.Context, id uuid.UUID) (APIKey, error) {
+	res, err := r.DB.ExecContext(ctx, `UPDATE api_keys SET revoked_at = COALESCE(revoked_at, ?) WHERE id=?`, sqliteTime(time.Now()), id.String())
+	if err != nil {
+		return APIKey{}, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return APIKey{}, ErrAPIKeyNotFound
+	}
+	return sqliteScanAPIKey(r.DB.QueryRowContext(ctx, `SELECT `+sqliteAPIKeyColumns+` FROM api_keys WHERE id=?`, id.String()))
+}
+
+// sqliteScanAPIKey scans a row selected with sqliteAPIKeyColumns.
+func sqliteScanAPIKey(row interface{ Scan(...any) error }) (APIKey, error) {
+	var (
+		k                        APIKey
+		id, scopes, accounts, at string
+		revoked                  sql.NullString
+	)
+	if err := row.Scan(&id, &k.Name, &k.Prefix, &k.Hash, &scopes, &accounts, &k.SigningSecret, &at, &revoked); err != nil {
+		return APIKey{}, err
+	}
+	k.SignedRequests = len(k.SigningSecret) > 0
+	var err error
+	if k.ID, err = uuid.Parse(id); err != nil {
+		return APIKey{}, err
+	}
+	if err := json.Unmarshal([]byte(scopes), &k.Scopes); err != nil {
+		return APIKey{}, err
+	}
+	if err := json.Unmarshal([]byte(accounts), &k.AccountIDs); err != nil {
+		return APIKey{}, err
+	}
+	if k.CreatedAt, err = time.Parse(sqliteTimeLayout, at); err != nil {
+		return APIKey{}, err
+	}
+	if revoked.Valid {
+		t, err := time.Parse(sqliteTimeLayout, revoked.String)
+		if err != nil {
+			return APIKey{}, err
+		}
+		k.RevokedAt = &t
+	}
+	return k, nil
+}
+
+// sqliteAPIKeyNotFound maps a missing row to ErrAPIKeyNotFound.
+func sqliteAPIKeyNotFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrAPIKeyNotFound
+	}
+	return err
+}
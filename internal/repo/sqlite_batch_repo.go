@@ -0,0 +1,114 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CreateTransferBatch stores a batch and its items and returns the batch, like
+// PGBatchRepo.CreateTransferBatch.
+func (r *SQLiteRepo) CreateTransferBatch(ctx context.Context, in NewTransferBatch) (TransferBatch, error) {
+	b := TransferBatch{ID: uuid.New(), Owner: in.Owner, CreatedAt: time.Now()}
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return TransferBatch{}, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `INSERT INTO transfer_batches(id, owner, created_at) VALUES(?,?,?)`,
+		b.ID.String(), b.Owner, sqliteTime(b.CreatedAt)); err != nil {
+		return TransferBatch{}, err
+	}
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO transfer_batch_items(batch_id, position, idempotency_key, account_id, status, error) VALUES(?,?,?,?,?,?)`)
+	if err != nil {
+		return TransferBatch{}, err
+	}
+	defer stmt.Close()
+	for i, it := range in.Items {
+		if _, err := stmt.ExecContext(ctx, b.ID.String(), i, it.IdempotencyKey, it.AccountID, it.Status, it.Error); err != nil {
+			return TransferBatch{}, err
+		}
+		if it.Status == BatchItemRejected {
+			b.Rejected++
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return TransferBatch{}, err
+	}
+	b.Total = len(in.Items)
+	b.complete()
+	return b, nil
+}
+
+// RejectBatchItems marks the queued items of a batch with the given keys rejected with code.
+func (r *SQLiteRepo) RejectBatchItems(ctx context.Context, id uuid.UUID, keys []string, code string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, key := range keys {
+		if _, err := tx.ExecContext(ctx, `UPDATE transfer_batch_items SET status=?, error=? WHERE batch_id=? AND idempotency_key=? AND status=?`,
+			BatchItemRejected, code, id.String(), key, BatchItemQueued); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// FailBatchItems marks queued items refused by the worker failed, in every batch that holds
+// their key for the same source account, like PGBatchRepo.FailBatchItems.
+func (r *SQLiteRepo) FailBatchItems(ctx context.Context, fs []BatchItemFailure) error {
+	if len(fs) == 0 {
+		return nil
+	}
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, f := range fs {
+		if _, err := tx.ExecContext(ctx, `UPDATE transfer_batch_items SET status=?, error=?
+			WHERE idempotency_key=? AND (account_id='' OR account_id=?) AND status=?`,
+			BatchItemFailed, f.Reason, f.IdempotencyKey, f.AccountID, BatchItemQueued); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetTransferBatch returns the progress of a batch or ErrBatchNotFound.
+func (r *SQLiteRepo) GetTransferBatch(ctx context.Context, id uuid.UUID) (TransferBatch, error) {
+	var (
+		b   TransferBatch
+		bid string
+		at  string
+	)
+	err := r.DB.QueryRowContext(ctx, `SELECT b.id, b.owner, b.created_at,
+			count(i.position),
+			count(CASE WHEN i.status = ? THEN 1 END),
+			count(CASE WHEN i.status = ? THEN 1 END),
+			count(CASE WHEN i.status = ? THEN p.idempotency_key END)
+		FROM transfer_batches b
+		LEFT JOIN transfer_batch_items i ON i.batch_id = b.id
+		LEFT JOIN processed_messages p ON p.idempotency_key = i.idempotency_key
+			AND (i.account_id = '' OR p.account_id = i.account_id)
+		WHERE b.id = ?
+		GROUP BY b.id`, BatchItemRejected, BatchItemFailed, BatchItemQueued, id.String()).
+		Scan(&bid, &b.Owner, &at, &b.Total, &b.Rejected, &b.Failed, &b.Applied)
+	if err != nil {
+		return TransferBatch{}, sqliteNotFoundAs(err, ErrBatchNotFound)
+	}
+	if b.ID, err = uuid.Parse(bid); err != nil {
+		return TransferBatch{}, err
+	}
+	if b.CreatedAt, err = time.Parse(sqliteTimeLayout, at); err != nil {
+		return TransferBatch{}, err
+	}
+	b.complete()
+	return b, nil
+}
@@ -0,0 +1,41 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ConsumeQuota records one transaction of amount for client, like PGQuotaRepo.ConsumeQuota.
+func (r *SQLiteRepo) ConsumeQuota(ctx context.Context, client string, at time.Time, amount int64, lim QuotaLimits) (QuotaUsage, error) {
+	return r.ConsumeQuotaBatch(ctx, client, at, 1, amount, lim)
+}
+
+// ConsumeQuotaBatch records count transactions totalling amount for client, like
+// PGQuotaRepo.ConsumeQuotaBatch.
+func (r *SQLiteRepo) ConsumeQuotaBatch(ctx context.Context, client string, at time.Time, count, amount int64, lim QuotaLimits) (QuotaUsage, error) {
+	if !lim.allows(count, amount) {
+		return QuotaUsage{}, ErrQuotaExceeded
+	}
+	u := QuotaUsage{Client: client, Day: quotaDay(at)}
+	err := r.DB.QueryRowContext(ctx, `INSERT INTO quota_usage(client, day, tx_count, amount) VALUES(?1,?2,?3,?4)
+		ON CONFLICT (client, day) DO UPDATE SET tx_count = quota_usage.tx_count + excluded.tx_count, amount = quota_usage.amount + excluded.amount
+		WHERE (?5 <= 0 OR quota_usage.tx_count + excluded.tx_count <= ?5) AND (?6 <= 0 OR quota_usage.amount + excluded.amount <= ?6)
+		RETURNING tx_count, amount`, client, u.Day.Format("2006-01-02"), count, amount, lim.DailyCount, lim.DailyAmount).Scan(&u.Count, &u.Amount)
+	if errors.Is(err, sql.ErrNoRows) {
+		return QuotaUsage{}, ErrQuotaExceeded
+	}
+	if err != nil {
+		return QuotaUsage{}, err
+	}
+	return u, nil
+}
+
+// RefundQuota gives back count transactions totalling amount for client, like
+// PGQuotaRepo.RefundQuota.
+func (r *SQLiteRepo) RefundQuota(ctx context.Context, client string, at time.Time, count, amount int64) error {
+	_, err := r.DB.ExecContext(ctx, `UPDATE quota_usage SET tx_count = MAX(tx_count - ?3, 0), amount = MAX(amount - ?4, 0)
+		WHERE client = ?1 AND day = ?2`, client, quotaDay(at).Format("2006-01-02"), count, amount)
+	return err
+}
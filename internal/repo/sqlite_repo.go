@@ -0,0 +1,695 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Bharat0908/ledger/internal/metrics"
+	"github.com/Bharat0908/ledger/internal/tracing"
+	"github.com/google/uuid"
+	_ "modernc.org/sqlite" // registers the "sqlite" database/sql driver
+)
+
+// sqliteTimeLayout stores timestamps as fixed-width UTC text so they sort lexically.
+const sqliteTimeLayout = "2006-01-02T15:04:05.000000000Z07:00"
+
+// sqliteMigrations mirror migrations/init.sql for the embedded SQLite backend. They are applied
+// in order and tracked with PRAGMA user_version, so new schema changes must be appended.
+var sqliteMigrations = []string{`
+CREATE TABLE IF NOT EXISTS accounts (
+  id TEXT PRIMARY KEY,
+  owner TEXT NOT NULL,
+  currency TEXT NOT NULL,
+  balance INTEGER NOT NULL,
+  created_at TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS processed_messages (
+  idempotency_key TEXT PRIMARY KEY,
+  account_id TEXT NOT NULL,
+  type TEXT NOT NULL,
+  amount INTEGER NOT NULL,
+  processed_at TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_accounts_owner ON accounts(owner);
+
+CREATE TABLE IF NOT EXISTS ledger_entries (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  account_id TEXT NOT NULL REFERENCES accounts(id),
+  type TEXT NOT NULL,
+  amount INTEGER NOT NULL,
+  balance_after INTEGER NOT NULL,
+  idempotency_key TEXT NOT NULL,
+  created_at TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_account ON ledger_entries(account_id, created_at DESC);
+`,
+	`ALTER TABLE accounts ADD COLUMN status TEXT NOT NULL DEFAULT 'active';`,
+	`
+ALTER TABLE accounts ADD COLUMN type TEXT NOT NULL DEFAULT 'asset';
+ALTER TABLE accounts ADD COLUMN external_ref TEXT;
+ALTER TABLE accounts ADD COLUMN display_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE accounts ADD COLUMN metadata TEXT NOT NULL DEFAULT '{}';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_accounts_external_ref ON accounts(external_ref) WHERE external_ref IS NOT NULL;
+`,
+	`
+CREATE INDEX IF NOT EXISTS idx_accounts_created ON accounts(created_at, id);
+CREATE INDEX IF NOT EXISTS idx_accounts_owner_created ON accounts(owner, created_at, id);
+`,
+	`
+CREATE TABLE IF NOT EXISTS api_keys (
+  id TEXT PRIMARY KEY,
+  name TEXT NOT NULL,
+  prefix TEXT NOT NULL,
+  key_hash BLOB NOT NULL UNIQUE,
+  scopes TEXT NOT NULL,
+  account_ids TEXT NOT NULL DEFAULT '[]',
+  created_at TEXT NOT NULL,
+  revoked_at TEXT
+);
+`,
+	`ALTER TABLE api_keys ADD COLUMN signing_secret BLOB;`,
+	`
+CREATE TABLE IF NOT EXISTS quota_usage (
+  client TEXT NOT NULL,
+  day TEXT NOT NULL,
+  tx_count INTEGER NOT NULL,
+  amount INTEGER NOT NULL,
+  PRIMARY KEY (client, day)
+);
+`,
+	`
+CREATE TABLE IF NOT EXISTS webhooks (
+  id TEXT PRIMARY KEY,
+  owner TEXT NOT NULL DEFAULT '',
+  url TEXT NOT NULL,
+  event_types TEXT NOT NULL,
+  account_ids TEXT NOT NULL DEFAULT '[]',
+  description TEXT NOT NULL DEFAULT '',
+  secret BLOB NOT NULL,
+  created_at TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+  id TEXT PRIMARY KEY,
+  webhook_id TEXT NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+  event_id TEXT NOT NULL,
+  event_type TEXT NOT NULL,
+  payload TEXT NOT NULL,
+  status TEXT NOT NULL DEFAULT 'pending',
+  attempts INTEGER NOT NULL DEFAULT 0,
+  next_attempt_at TEXT,
+  created_at TEXT NOT NULL,
+  UNIQUE (webhook_id, event_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook ON webhook_deliveries(webhook_id, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS webhook_attempts (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  delivery_id TEXT NOT NULL REFERENCES webhook_deliveries(id) ON DELETE CASCADE,
+  attempted_at TEXT NOT NULL,
+  status_code INTEGER NOT NULL DEFAULT 0,
+  error TEXT NOT NULL DEFAULT '',
+  duration_ms INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_attempts_delivery ON webhook_attempts(delivery_id, attempted_at);
+`,
+	`CREATE INDEX IF NOT EXISTS idx_ledger_entries_key ON ledger_entries(account_id, idempotency_key);`,
+	`
+CREATE TABLE IF NOT EXISTS transfer_batches (
+  id TEXT PRIMARY KEY,
+  owner TEXT NOT NULL DEFAULT '',
+  created_at TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS transfer_batch_items (
+  batch_id TEXT NOT NULL REFERENCES transfer_batches(id) ON DELETE CASCADE,
+  position INTEGER NOT NULL,
+  idempotency_key TEXT NOT NULL,
+  status TEXT NOT NULL,
+  error TEXT NOT NULL DEFAULT '',
+  PRIMARY KEY (batch_id, position)
+);
+
+CREATE INDEX IF NOT EXISTS idx_transfer_batch_items_key ON transfer_batch_items(idempotency_key);
+`,
+	`
+CREATE TABLE processed_messages_by_account (
+  idempotency_key TEXT NOT NULL,
+  account_id TEXT NOT NULL,
+  type TEXT NOT NULL,
+  amount INTEGER NOT NULL,
+  processed_at TEXT NOT NULL,
+  PRIMARY KEY (account_id, idempotency_key)
+);
+INSERT INTO processed_messages_by_account SELECT idempotency_key, account_id, type, amount, processed_at FROM processed_messages;
+DROP TABLE processed_messages;
+ALTER TABLE processed_messages_by_account RENAME TO processed_messages;
+CREATE INDEX idx_processed_messages_key ON processed_messages(idempotency_key);
+
+ALTER TABLE transfer_batch_items ADD COLUMN account_id TEXT NOT NULL DEFAULT '';
+`,
+	`ALTER TABLE ledger_entries ADD COLUMN source_account_id TEXT;`,
+}
+
+// SQLiteRepo is an embedded, single-file implementation of the account store, the balance
+// applier and the ledger store. It exposes the same methods as PGRepo and PGLedgerRepo so the
+// API can run as a single binary without Postgres, MongoDB or RabbitMQ (see queue.LocalQueue).
+//
+// Ledger entries are always written in the same transaction as the balance change. The
+// connection pool is limited to a single connection, which serializes writers and makes
+// the row locking done by PGRepo unnecessary.
+type SQLiteRepo struct{ DB *sql.DB }
+
+// OpenSQLite opens (creating if needed) the SQLite database at path and applies the schema.
+// Use ":memory:" for a throwaway in-memory database.
+func OpenSQLite(ctx context.Context, path string) (*SQLiteRepo, error) {
+	dsn := path
+	if path != ":memory:" && !strings.HasPrefix(path, "file:") {
+		dsn = "file:" + path
+	}
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	dsn += sep + "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	if err := sqliteMigrate(ctx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SQLiteRepo{DB: db}, nil
+}
+
+// sqliteMigrate applies the migrations the database has not seen yet.
+func sqliteMigrate(ctx context.Context, db *sql.DB) error {
+	var version int
+	if err := db.QueryRowContext(ctx, `PRAGMA user_version`).Scan(&version); err != nil {
+		return err
+	}
+	for i := version; i < len(sqliteMigrations); i++ {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, sqliteMigrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("sqlite migration %d: %w", i+1, err)
+		}
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf(`PRAGMA user_version = %d`, i+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the underlying database.
+func (r *SQLiteRepo) Close() error { return r.DB.Close() }
+
+// CreateAccount creates a new account with the given attributes and a zero balance. Like
+// PGRepo.CreateAccount it is idempotent on in.ExternalRef: an existing account with the same
+// reference is returned with created=false.
+func (r *SQLiteRepo) CreateAccount(ctx context.Context, in NewAccount) (acc Account, created bool, err error) {
+	defer observeTx(backendSQLite, opCreateAccount, time.Now(), &err)
+	ctx, span := startSpan(ctx, "SQLiteRepo.CreateAccount", spanSQLite)
+	defer tracing.End(span, &err)
+	if err := in.normalize(); err != nil {
+		return Account{}, false, err
+	}
+	meta, err := json.Marshal(in.Metadata)
+	if err != nil {
+		return Account{}, false, err
+	}
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return Account{}, false, err
+	}
+	defer tx.Rollback()
+
+	id := uuid.New()
+	res, err := tx.ExecContext(ctx, `INSERT INTO accounts(id, owner, currency, balance, created_at, type, external_ref, display_name, metadata)
+		VALUES(?,?,?,?,?,?,NULLIF(?,''),?,?)
+		ON CONFLICT (external_ref) WHERE external_ref IS NOT NULL DO NOTHING`,
+		id.String(), in.Owner, in.Currency, 0, sqliteTime(time.Now()), in.Type, in.ExternalRef, in.DisplayName, string(meta))
+	if err != nil {
+		return Account{}, false, err
+	}
+	if n, _ := res.RowsAffected(); n == 1 {
+		acc, err = sqliteScanAccount(tx.QueryRowContext(ctx, `SELECT `+sqliteAccountColumns+` FROM accounts WHERE id=?`, id.String()))
+		created = true
+	} else {
+		acc, err = sqliteScanAccount(tx.QueryRowContext(ctx, `SELECT `+sqliteAccountColumns+` FROM accounts WHERE external_ref=?`, in.ExternalRef))
+		if err == nil && !in.matches(acc) {
+			err = ErrExternalRefConflict
+		}
+	}
+	if err != nil {
+		return Account{}, false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Account{}, false, err
+	}
+	return acc, created, nil
+}
+
+// GetAccount retrieves the account with the given UUID, including its current balance.
+func (r *SQLiteRepo) GetAccount(ctx context.Context, id uuid.UUID) (Account, error) {
+	acc, err := sqliteScanAccount(r.DB.QueryRowContext(ctx, `SELECT `+sqliteAccountColumns+` FROM accounts WHERE id=?`, id.String()))
+	if err != nil {
+		return Account{}, sqliteNotFound(err)
+	}
+	return acc, nil
+}
+
+// GetProcessedTransactions returns the transactions and transfers applied with the idempotency
+// key, oldest first, like PGRepo.GetProcessedTransactions.
+func (r *SQLiteRepo) GetProcessedTransactions(ctx context.Context, key string) ([]ProcessedTransaction, error) {
+	rows, err := r.DB.QueryContext(ctx, `SELECT account_id, type, amount, processed_at FROM processed_messages
+		WHERE idempotency_key=? ORDER BY processed_at, account_id`, key)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []ProcessedTransaction
+	for rows.Next() {
+		t := ProcessedTransaction{IdempotencyKey: key}
+		var id, at string
+		if err := rows.Scan(&id, &t.Type, &t.Amount, &at); err != nil {
+			return nil, err
+		}
+		if t.AccountID, err = uuid.Parse(id); err != nil {
+			return nil, err
+		}
+		if t.ProcessedAt, err = time.Parse(sqliteTimeLayout, at); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(out) == 0 {
+		return nil, ErrTransactionNotFound
+	}
+	return out, nil
+}
+
+// ListAccounts returns the page of accounts matching f together with the total number of
+// matching accounts, like PGRepo.ListAccounts. Metadata pairs are matched with json_each.
+func (r *SQLiteRepo) ListAccounts(ctx context.Context, f AccountFilter) (AccountPage, error) {
+	q, err := f.normalize()
+	if err != nil {
+		return AccountPage{}, err
+	}
+	build := func(args *[]interface{}) accountListSQL {
+		b := accountListSQL{bind: func(v interface{}) string {
+			switch v := v.(type) {
+			case time.Time:
+				*args = append(*args, sqliteTime(v))
+			case uuid.UUID:
+				*args = append(*args, v.String())
+			default:
+				*args = append(*args, v)
+			}
+			return "?"
+		}}
+		b.metadata = func(k, v string) string {
+			return "EXISTS (SELECT 1 FROM json_each(accounts.metadata) WHERE key = " + b.bind(k) + " AND value = " + b.bind(v) + ")"
+		}
+		return b
+	}
+
+	var page AccountPage
+	var countArgs []interface{}
+	where := build(&countArgs).where(q)
+	if err := r.DB.QueryRowContext(ctx, `SELECT count(*) FROM accounts WHERE `+where, countArgs...).Scan(&page.Total); err != nil {
+		return AccountPage{}, err
+	}
+
+	var args []interface{}
+	b := build(&args)
+	where = b.where(q)
+	cond, order := b.page(q)
+	rows, err := r.DB.QueryContext(ctx, `SELECT `+sqliteAccountColumns+` FROM accounts WHERE `+where+` AND `+cond+
+		` ORDER BY `+order+` LIMIT `+strconv.Itoa(q.Limit+1), args...)
+	if err != nil {
+		return AccountPage{}, err
+	}
+	defer rows.Close()
+	page.Accounts = []Account{}
+	for rows.Next() {
+		a, err := sqliteScanAccount(rows)
+		if err != nil {
+			return AccountPage{}, err
+		}
+		page.Accounts = append(page.Accounts, a)
+	}
+	if err := rows.Err(); err != nil {
+		return AccountPage{}, err
+	}
+	if len(page.Accounts) > q.Limit {
+		page.Accounts = page.Accounts[:q.Limit]
+		page.NextCursor = q.nextCursor(page.Accounts[q.Limit-1])
+	}
+	return page, nil
+}
+
+// sqliteAccountColumns is the column list scanned by sqliteScanAccount.
+const sqliteAccountColumns = `id, owner, currency, balance, status, type, COALESCE(external_ref, ''), display_name, metadata, created_at`
+
+// sqliteScanAccount scans a row selected with sqliteAccountColumns.
+func sqliteScanAccount(row interface{ Scan(...any) error }) (Account, error) {
+	var (
+		a            Account
+		id, meta, at string
+	)
+	if err := row.Scan(&id, &a.Owner, &a.Currency, &a.Balance, &a.Status, &a.Type, &a.ExternalRef, &a.DisplayName, &meta, &at); err != nil {
+		return Account{}, err
+	}
+	var err error
+	if a.ID, err = uuid.Parse(id); err != nil {
+		return Account{}, err
+	}
+	if err := json.Unmarshal([]byte(meta), &a.Metadata); err != nil {
+		return Account{}, err
+	}
+	if a.CreatedAt, err = time.Parse(sqliteTimeLayout, at); err != nil {
+		return Account{}, err
+	}
+	return a, nil
+}
+
+// ApplyTransaction applies a deposit or withdrawal to the account, recording the ledger entry in
+// the same transaction. Like PGRepo.ApplyTransaction it is idempotent on key: a repeated key
+// returns the current balance without applying the change again.
+func (r *SQLiteRepo) ApplyTransaction(ctx context.Context, accountID uuid.UUID, typ string, amount int64, key string) (balanceAfter int64, err error) {
+	defer observeTx(backendSQLite, opApplyTransaction, time.Now(), &err)
+	ctx, span := startSpan(ctx, "SQLiteRepo.ApplyTransaction", spanSQLite)
+	defer tracing.End(span, &err)
+	if amount <= 0 {
+		return 0, ErrInvalidAmount
+	}
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	a, err := sqliteLoadAccount(ctx, tx, accountID)
+	if err != nil {
+		return 0, err
+	}
+	done, err := sqliteProcessed(ctx, tx, accountID, key)
+	if err != nil {
+		return 0, err
+	}
+	if done {
+		metrics.IdempotentDuplicates.WithLabelValues(opApplyTransaction).Inc()
+		return a.balance, tx.Commit()
+	}
+	if a.status == StatusFrozen {
+		return 0, ErrAccountFrozen
+	}
+
+	balance := a.balance
+	switch typ {
+	case "deposit":
+		balance += amount
+	case "withdraw":
+		if err := checkDebit(a.atype, balance, amount, false); err != nil {
+			return 0, err
+		}
+		balance -= amount
+	default:
+		return 0, ErrInvalidType
+	}
+
+	now := time.Now()
+	if _, err := tx.ExecContext(ctx, `UPDATE accounts SET balance=? WHERE id=?`, balance, accountID.String()); err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO processed_messages(idempotency_key,account_id,type,amount,processed_at) VALUES(?,?,?,?,?)`,
+		key, accountID.String(), typ, amount, sqliteTime(now)); err != nil {
+		return 0, err
+	}
+	if err := sqliteLedgerEntry(ctx, tx, accountID, accountID, typ, amount, balance, key, now); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return balance, nil
+}
+
+// ApplyTransfer moves amount from one account to another in a single transaction, recording a
+// debit and a credit ledger entry. It is idempotent on key like PGRepo.ApplyTransfer.
+func (r *SQLiteRepo) ApplyTransfer(ctx context.Context, from, to uuid.UUID, amount int64, key string) (fromAfter, toAfter int64, err error) {
+	defer observeTx(backendSQLite, opApplyTransfer, time.Now(), &err)
+	ctx, span := startSpan(ctx, "SQLiteRepo.ApplyTransfer", spanSQLite)
+	defer tracing.End(span, &err)
+	if amount <= 0 {
+		return 0, 0, ErrInvalidAmount
+	}
+	if from == to {
+		return 0, 0, ErrSameAccount
+	}
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	src, err := sqliteLoadAccount(ctx, tx, from)
+	if err != nil {
+		return 0, 0, err
+	}
+	dst, err := sqliteLoadAccount(ctx, tx, to)
+	if err != nil {
+		return 0, 0, err
+	}
+	fromBal, toBal := src.balance, dst.balance
+	done, err := sqliteProcessed(ctx, tx, from, key)
+	if err != nil {
+		return 0, 0, err
+	}
+	if done {
+		metrics.IdempotentDuplicates.WithLabelValues(opApplyTransfer).Inc()
+		return fromBal, toBal, tx.Commit()
+	}
+
+	if src.status == StatusFrozen || dst.status == StatusFrozen {
+		return 0, 0, ErrAccountFrozen
+	}
+	if src.currency != dst.currency {
+		return 0, 0, ErrCurrencyMismatch
+	}
+	if err := checkDebit(src.atype, fromBal, amount, key == OpeningBalanceKey(to)); err != nil {
+		return 0, 0, err
+	}
+	fromBal -= amount
+	toBal += amount
+
+	now := time.Now()
+	if _, err := tx.ExecContext(ctx, `UPDATE accounts SET balance=? WHERE id=?`, fromBal, from.String()); err != nil {
+		return 0, 0, err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE accounts SET balance=? WHERE id=?`, toBal, to.String()); err != nil {
+		return 0, 0, err
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO processed_messages(idempotency_key,account_id,type,amount,processed_at) VALUES(?,?,?,?,?)`,
+		key, from.String(), "transfer", amount, sqliteTime(now)); err != nil {
+		return 0, 0, err
+	}
+	if err := sqliteLedgerEntry(ctx, tx, from, from, "transfer_debit", -amount, fromBal, key, now); err != nil {
+		return 0, 0, err
+	}
+	if err := sqliteLedgerEntry(ctx, tx, to, from, "transfer_credit", amount, toBal, key, now); err != nil {
+		return 0, 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, 0, err
+	}
+	return fromBal, toBal, nil
+}
+
+// GetTransactions retrieves up to limit ledger entries for the given account, newest first,
+// using the same keys as MongoRepo.GetTransactions.
+func (r *SQLiteRepo) GetTransactions(ctx context.Context, accountID string, limit int) ([]map[string]interface{}, error) {
+	rows, err := r.DB.QueryContext(ctx, `SELECT `+sqliteEntryColumns+`
+		FROM ledger_entries WHERE account_id=? ORDER BY created_at DESC, id DESC LIMIT ?`, accountID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return sqliteLedgerEntries(rows)
+}
+
+// GetTransactionsAfter retrieves up to limit ledger entries for the given account that were
+// written after its entry with the ID (see EntryID), oldest first, or ErrInvalidEventID if the
+// account has no such entry. A bare idempotency key names the account's latest entry with the
+// key.
+func (r *SQLiteRepo) GetTransactionsAfter(ctx context.Context, accountID, entryID string, limit int) ([]map[string]interface{}, error) {
+	source, key, _ := splitEntryID(entryID)
+	var after int64
+	err := r.DB.QueryRowContext(ctx, `SELECT id FROM ledger_entries WHERE account_id=? AND idempotency_key=?
+		AND (?='' OR COALESCE(source_account_id, account_id)=?) ORDER BY id DESC LIMIT 1`,
+		accountID, key, source, source).Scan(&after)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidEventID
+	}
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.DB.QueryContext(ctx, `SELECT `+sqliteEntryColumns+`
+		FROM ledger_entries WHERE account_id=? AND id>? ORDER BY id LIMIT ?`, accountID, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	return sqliteLedgerEntries(rows)
+}
+
+// ExportLedger calls fn with every ledger entry matching f, oldest first, and stops at the first
+// error fn returns. Entries are read a page at a time, in the order they were written, so a slow
+// consumer never holds the single connection the worker writes through.
+func (r *SQLiteRepo) ExportLedger(ctx context.Context, f LedgerFilter, fn func(LedgerEntry) error) error {
+	from, to := "", "9999"
+	if !f.From.IsZero() {
+		from = sqliteTime(f.From)
+	}
+	if !f.To.IsZero() {
+		to = sqliteTime(f.To)
+	}
+	var after int64
+	for {
+		rows, err := r.DB.QueryContext(ctx, `SELECT id, account_id, type, amount, balance_after, idempotency_key, created_at
+			FROM ledger_entries WHERE id>? AND (?='' OR account_id=?) AND created_at>=? AND created_at<?
+			ORDER BY id LIMIT ?`, after, f.AccountID, f.AccountID, from, to, exportPage)
+		if err != nil {
+			return err
+		}
+		var page []LedgerEntry
+		for rows.Next() {
+			var (
+				e  LedgerEntry
+				at string
+			)
+			if err := rows.Scan(&after, &e.AccountID, &e.Type, &e.Amount, &e.BalanceAfter, &e.IdempotencyKey, &at); err != nil {
+				rows.Close()
+				return err
+			}
+			if e.CreatedAt, err = time.Parse(sqliteTimeLayout, at); err != nil {
+				rows.Close()
+				return err
+			}
+			page = append(page, e)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		for _, e := range page {
+			if err := fn(e); err != nil {
+				return err
+			}
+		}
+		if len(page) < exportPage {
+			return nil
+		}
+	}
+}
+
+// sqliteEntryColumns are the columns sqliteLedgerEntries reads. Entries written before they
+// recorded their source account are given the account as source, as in PGLedgerRepo.
+const sqliteEntryColumns = `account_id, COALESCE(source_account_id, account_id), type, amount, balance_after, idempotency_key, created_at`
+
+// sqliteLedgerEntries reads ledger entry rows of sqliteEntryColumns into maps with the keys of
+// MongoRepo.GetTransactions.
+func sqliteLedgerEntries(rows *sql.Rows) ([]map[string]interface{}, error) {
+	defer rows.Close()
+	var out []map[string]interface{}
+	for rows.Next() {
+		var (
+			acc, source, typ, key, at string
+			amount, balAfter          int64
+		)
+		if err := rows.Scan(&acc, &source, &typ, &amount, &balAfter, &key, &at); err != nil {
+			return nil, err
+		}
+		createdAt, err := time.Parse(sqliteTimeLayout, at)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, map[string]interface{}{
+			"id":              EntryID(source, key),
+			"account_id":      acc,
+			"type":            typ,
+			"amount":          amount,
+			"balance_after":   balAfter,
+			"idempotency_key": key,
+			"created_at":      createdAt,
+		})
+	}
+	return out, rows.Err()
+}
+
+// sqliteAccount is the subset of an account row needed to apply a balance change.
+type sqliteAccount struct {
+	balance                 int64
+	currency, status, atype string
+}
+
+// sqliteLoadAccount reads an account inside an open transaction, returning ErrNotFound if it is
+// missing.
+func sqliteLoadAccount(ctx context.Context, tx *sql.Tx, id uuid.UUID) (sqliteAccount, error) {
+	var a sqliteAccount
+	err := tx.QueryRowContext(ctx, `SELECT balance, currency, status, type FROM accounts WHERE id=?`, id.String()).Scan(&a.balance, &a.currency, &a.status, &a.atype)
+	return a, sqliteNotFound(err)
+}
+
+// sqliteNotFound translates a missing row into ErrNotFound and passes other errors through.
+func sqliteNotFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// sqliteProcessed reports whether the idempotency key has already been applied to the account,
+// the account of a transaction or the source of a transfer.
+func sqliteProcessed(ctx context.Context, tx *sql.Tx, accountID uuid.UUID, key string) (bool, error) {
+	var existing string
+	err := tx.QueryRowContext(ctx, `SELECT idempotency_key FROM processed_messages WHERE account_id=? AND idempotency_key=?`, accountID.String(), key).Scan(&existing)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// sqliteLedgerEntry records a single ledger entry inside an open transaction. source is the
+// account the idempotency key belongs to, as in insertLedgerEntry.
+func sqliteLedgerEntry(ctx context.Context, tx *sql.Tx, accountID, source uuid.UUID, typ string, amount, balanceAfter int64, key string, at time.Time) error {
+	_, err := tx.ExecContext(ctx, `INSERT INTO ledger_entries(account_id,source_account_id,type,amount,balance_after,idempotency_key,created_at) VALUES(?,?,?,?,?,?,?)`,
+		accountID.String(), source.String(), typ, amount, balanceAfter, key, sqliteTime(at))
+	return err
+}
+
+func sqliteTime(t time.Time) string { return t.UTC().Format(sqliteTimeLayout) }
@@ -0,0 +1,19 @@
+package repo_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Bharat0908/ledger/internal/repo"
+)
+
+func TestSQLiteRepo_Conformance(t *testing.T) {
+	runRepoConformance(t, func(t *testing.T) conformanceRepo {
+		r, err := repo.OpenSQLite(context.Background(), ":memory:")
+		if err != nil {
+			t.Fatalf("OpenSQLite() failed: %v", err)
+		}
+		t.Cleanup(func() { r.Close() })
+		return r
+	})
+}
@@ -0,0 +1,306 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// sqliteWebhookColumns is the column list scanned by sqliteScanWebhook. Event types and
+// account IDs are stored as JSON arrays.
+const sqliteWebhookColumns = `id, owner, url, event_types, account_ids, description, secret, created_at`
+
+// sqliteDeliveryColumns is the column list scanned by sqliteScanDelivery.
+const sqliteDeliveryColumns = `id, webhook_id, event_id, event_type, payload, status, attempts, next_attempt_at, created_at`
+
+// CreateWebhook stores a new webhook subscription and returns it, like PGWebhookRepo.CreateWebhook.
+func (r *SQLiteRepo) CreateWebhook(ctx context.Context, in NewWebhook) (Webhook, error) {
+	if err := in.normalize(); err != nil {
+		return Webhook{}, err
+	}
+	types, err := json.Marshal(in.EventTypes)
+	if err != nil {
+		return Webhook{}, err
+	}
+	accounts, err := json.Marshal(in.AccountIDs)
+	if err != nil {
+		return Webhook{}, err
+	}
+	id := uuid.New()
+	if _, err := r.DB.ExecContext(ctx, `INSERT INTO webhooks(id, owner, url, event_types, account_ids, description, secret, created_at) VALUES(?,?,?,?,?,?,?,?)`,
+		id.String(), in.Owner, in.URL, string(types), string(accounts), in.Description, in.Secret, sqliteTime(time.Now())); err != nil {
+		return Webhook{}, err
+	}
+	return r.GetWebhook(ctx, id)
+}
+
+// GetWebhook returns the webhook with the given ID or ErrWebhookNotFound.
+func (r *SQLiteRepo) GetWebhook(ctx context.Context, id uuid.UUID) (Webhook, error) {
+	w, err := sqliteScanWebhook(r.DB.QueryRowContext(ctx, `SELECT `+sqliteWebhookColumns+` FROM webhooks WHERE id=?`, id.String()))
+	if err != nil {
+		return Webhook{}, sqliteNotFoundAs(err, ErrWebhookNotFound)
+	}
+	return w, nil
+}
+
+// ListWebhooks returns the webhooks of owner, or every webhook when owner is empty, oldest first.
+func (r *SQLiteRepo) ListWebhooks(ctx context.Context, owner string) ([]Webhook, error) {
+	rows, err := r.DB.QueryContext(ctx, `SELECT `+sqliteWebhookColumns+` FROM webhooks WHERE ? = '' OR owner = ? ORDER BY created_at, id`, owner, owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Webhook{}
+	for rows.Next() {
+		w, err := sqliteScanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, w)
+	}
+	return out, rows.Err()
+}
+
+// DeleteWebhook deletes a webhook together with its deliveries and their attempt log.
+func (r *SQLiteRepo) DeleteWebhook(ctx context.Context, id uuid.UUID) error {
+	res, err := r.DB.ExecContext(ctx, `DELETE FROM webhooks WHERE id=?`, id.String())
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+// EnqueueWebhookDeliveries queues deliveries due now, skipping events already queued for a webhook.
+func (r *SQLiteRepo) EnqueueWebhookDeliveries(ctx context.Context, ds []NewWebhookDelivery) error {
+	if len(ds) == 0 {
+		return nil
+	}
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	now := sqliteTime(time.Now())
+	for _, d := range ds {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO webhook_deliveries(id, webhook_id, event_id, event_type, payload, status, next_attempt_at, created_at)
+			VALUES(?,?,?,?,?,?,?,?) ON CONFLICT (webhook_id, event_id) DO NOTHING`,
+			uuid.NewString(), d.WebhookID.String(), d.EventID, d.EventType, string(d.Payload), DeliveryPending, now, now); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ClaimWebhookDeliveries returns up to limit pending deliveries due at now, oldest first, and
+// pushes their next attempt lease into the future. The single connection serializes claims.
+func (r *SQLiteRepo) ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]DueWebhookDelivery, error) {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	rows, err := tx.QueryContext(ctx, `SELECT d.id, d.webhook_id, d.event_id, d.event_type, d.payload, d.status, d.attempts, d.next_attempt_at, d.created_at, w.url, w.secret
+		FROM webhook_deliveries d JOIN webhooks w ON w.id = d.webhook_id
+		WHERE d.status = ? AND d.next_attempt_at <= ? ORDER BY d.next_attempt_at, d.id LIMIT ?`,
+		DeliveryPending, sqliteTime(now), limit)
+	if err != nil {
+		return nil, err
+	}
+	out := []DueWebhookDelivery{}
+	for rows.Next() {
+		var (
+			d           DueWebhookDelivery
+			url, secret = new(string), new([]byte)
+		)
+		if d.WebhookDelivery, err = sqliteScanDelivery(rows, url, secret); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		d.URL, d.Secret = *url, *secret
+		out = append(out, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	until := now.Add(lease)
+	for i := range out {
+		if _, err := tx.ExecContext(ctx, `UPDATE webhook_deliveries SET next_attempt_at=? WHERE id=?`, sqliteTime(until), out[i].ID.String()); err != nil {
+			return nil, err
+		}
+		out[i].NextAttemptAt = &until
+	}
+	return out, tx.Commit()
+}
+
+// RecordWebhookAttempt appends an attempt to a delivery's log and moves the delivery to the
+// attempt's resulting status, or returns ErrWebhookDeliveryNotFound.
+func (r *SQLiteRepo) RecordWebhookAttempt(ctx context.Context, id uuid.UUID, res WebhookAttemptResult) error {
+	if !validAttemptResult(res) {
+		return fmt.Errorf("invalid webhook attempt result %q", res.Status)
+	}
+	var next *string
+	if res.NextAttemptAt != nil {
+		s := sqliteTime(*res.NextAttemptAt)
+		next = &s
+	}
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	out, err := tx.ExecContext(ctx, `UPDATE webhook_deliveries SET status=?, attempts=attempts+1, next_attempt_at=? WHERE id=?`, res.Status, next, id.String())
+	if err != nil {
+		return err
+	}
+	if n, _ := out.RowsAffected(); n == 0 {
+		return ErrWebhookDeliveryNotFound
+	}
+	a := res.Attempt
+	if _, err := tx.ExecContext(ctx, `INSERT INTO webhook_attempts(delivery_id, attempted_at, status_code, error, duration_ms) VALUES(?,?,?,?,?)`,
+		id.String(), sqliteTime(a.At), a.StatusCode, a.Error, a.DurationMS); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ListWebhookDeliveries returns the latest limit deliveries of a webhook, newest first, with
+// their attempt logs.
+func (r *SQLiteRepo) ListWebhookDeliveries(ctx context.Context, webhookID uuid.UUID, limit int) ([]WebhookDelivery, error) {
+	rows, err := r.DB.QueryContext(ctx, `SELECT `+sqliteDeliveryColumns+` FROM webhook_deliveries WHERE webhook_id=? ORDER BY created_at DESC, id LIMIT ?`, webhookID.String(), limit)
+	if err != nil {
+		return nil, err
+	}
+	out := []WebhookDelivery{}
+	for rows.Next() {
+		d, err := sqliteScanDelivery(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i := range out {
+		if out[i].AttemptLog, err = r.webhookAttempts(ctx, out[i].ID); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// RedeliverWebhookDelivery makes a delivery of the webhook pending again, due now, with a fresh
+// budget of attempts. Its attempt log is kept.
+func (r *SQLiteRepo) RedeliverWebhookDelivery(ctx context.Context, webhookID, id uuid.UUID) (WebhookDelivery, error) {
+	res, err := r.DB.ExecContext(ctx, `UPDATE webhook_deliveries SET status=?, attempts=0, next_attempt_at=? WHERE webhook_id=? AND id=?`,
+		DeliveryPending, sqliteTime(time.Now()), webhookID.String(), id.String())
+	if err != nil {
+		return WebhookDelivery{}, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return WebhookDelivery{}, ErrWebhookDeliveryNotFound
+	}
+	return sqliteScanDelivery(r.DB.QueryRowContext(ctx, `SELECT `+sqliteDeliveryColumns+` FROM webhook_deliveries WHERE id=?`, id.String()))
+}
+
+// webhookAttempts returns the attempt log of a delivery, oldest first.
+func (r *SQLiteRepo) webhookAttempts(ctx context.Context, deliveryID uuid.UUID) ([]WebhookAttempt, error) {
+	rows, err := r.DB.QueryContext(ctx, `SELECT attempted_at, status_code, error, duration_ms FROM webhook_attempts WHERE delivery_id=? ORDER BY attempted_at, id`, deliveryID.String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []WebhookAttempt{}
+	for rows.Next() {
+		var (
+			a  WebhookAttempt
+			at string
+		)
+		if err := rows.Scan(&at, &a.StatusCode, &a.Error, &a.DurationMS); err != nil {
+			return nil, err
+		}
+		if a.At, err = time.Parse(sqliteTimeLayout, at); err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+// sqliteScanWebhook scans a row selected with sqliteWebhookColumns.
+func sqliteScanWebhook(row interface{ Scan(...any) error }) (Webhook, error) {
+	var (
+		w                       Webhook
+		id, types, accounts, at string
+	)
+	if err := row.Scan(&id, &w.Owner, &w.URL, &types, &accounts, &w.Description, &w.Secret, &at); err != nil {
+		return Webhook{}, err
+	}
+	var err error
+	if w.ID, err = uuid.Parse(id); err != nil {
+		return Webhook{}, err
+	}
+	if err := json.Unmarshal([]byte(types), &w.EventTypes); err != nil {
+		return Webhook{}, err
+	}
+	if err := json.Unmarshal([]byte(accounts), &w.AccountIDs); err != nil {
+		return Webhook{}, err
+	}
+	if w.CreatedAt, err = time.Parse(sqliteTimeLayout, at); err != nil {
+		return Webhook{}, err
+	}
+	return w, nil
+}
+
+// sqliteScanDelivery scans a row selected with sqliteDeliveryColumns, followed by extra columns.
+func sqliteScanDelivery(row interface{ Scan(...any) error }, extra ...any) (WebhookDelivery, error) {
+	var (
+		d                    WebhookDelivery
+		id, webhook, payload string
+		at                   string
+		next                 sql.NullString
+	)
+	dest := append([]any{&id, &webhook, &d.EventID, &d.EventType, &payload, &d.Status, &d.Attempts, &next, &at}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return WebhookDelivery{}, err
+	}
+	var err error
+	if d.ID, err = uuid.Parse(id); err != nil {
+		return WebhookDelivery{}, err
+	}
+	if d.WebhookID, err = uuid.Parse(webhook); err != nil {
+		return WebhookDelivery{}, err
+	}
+	d.Payload = json.RawMessage(payload)
+	if d.CreatedAt, err = time.Parse(sqliteTimeLayout, at); err != nil {
+		return WebhookDelivery{}, err
+	}
+	if next.Valid {
+		t, err := time.Parse(sqliteTimeLayout, next.String)
+		if err != nil {
+			return WebhookDelivery{}, err
+		}
+		d.NextAttemptAt = &t
+	}
+	d.AttemptLog = []WebhookAttempt{}
+	return d, nil
+}
+
+// sqliteNotFoundAs maps a missing row to the domain error notFound.
+func sqliteNotFoundAs(err error, notFound *Error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return notFound
+	}
+	return err
+}
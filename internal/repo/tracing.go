@@ -0,0 +1,22 @@
+package repo
+
+import (
+	"context"
+
+	"github.com/Bharat0908/ledger/internal/tracing"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// startSpan starts a client span for a store operation such as "PGRepo.ApplyTransfer". Callers
+// end it with tracing.End so rejections and failures are recorded on the span.
+func startSpan(ctx context.Context, name string, system trace.SpanStartOption) (context.Context, trace.Span) {
+	return tracing.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), system)
+}
+
+// Database systems recorded on store spans.
+var (
+	spanPostgres = trace.WithAttributes(semconv.DBSystemPostgreSQL)
+	spanSQLite   = trace.WithAttributes(semconv.DBSystemSqlite)
+	spanMongo    = trace.WithAttributes(semconv.DBSystemMongoDB)
+)
@@ -0,0 +1,130 @@
+package repo
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Webhook delivery statuses. A delivery is pending until an attempt succeeds or it runs out of
+// attempts and fails; redelivering makes it pending again.
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// NewWebhook holds the attributes of a webhook subscription to be stored. Owner identifies the
+// client that manages the subscription. An empty AccountIDs list subscribes to events about
+// every account. Like an API key's signing secret, Secret is stored as is because the
+// deliverer needs it to sign payloads.
+type NewWebhook struct {
+	Owner       string
+	URL         string
+	EventTypes  []string
+	AccountIDs  []uuid.UUID
+	Description string
+	Secret      []byte
+}
+
+// Webhook is a stored webhook subscription.
+type Webhook struct {
+	ID          uuid.UUID   `json:"id"`
+	Owner       string      `json:"owner"`
+	URL         string      `json:"url"`
+	EventTypes  []string    `json:"event_types"`
+	AccountIDs  []uuid.UUID `json:"account_ids"`
+	Description string      `json:"description"`
+	Secret      []byte      `json:"-"`
+	CreatedAt   time.Time   `json:"created_at"`
+}
+
+// Matches reports whether the webhook subscribes to events of type typ about account.
+func (w Webhook) Matches(typ, account string) bool {
+	matched := false
+	for _, t := range w.EventTypes {
+		matched = matched || t == typ
+	}
+	if !matched || len(w.AccountIDs) == 0 {
+		return matched
+	}
+	for _, id := range w.AccountIDs {
+		if id.String() == account {
+			return true
+		}
+	}
+	return false
+}
+
+// NewWebhookDelivery is an event to be delivered to a webhook. A webhook receives each event ID
+// at most once, so enqueueing an event again is a no-op.
+type NewWebhookDelivery struct {
+	WebhookID uuid.UUID
+	EventID   string
+	EventType string
+	Payload   []byte
+}
+
+// WebhookDelivery is an event queued for a webhook together with its attempt log. Attempts
+// counts the attempts since the delivery was created or last redelivered; AttemptLog keeps
+// every attempt, oldest first. NextAttemptAt is set while the delivery is pending.
+type WebhookDelivery struct {
+	ID            uuid.UUID        `json:"id"`
+	WebhookID     uuid.UUID        `json:"webhook_id"`
+	EventID       string           `json:"event_id"`
+	EventType     string           `json:"event_type"`
+	Payload       json.RawMessage  `json:"payload"`
+	Status        string           `json:"status"`
+	Attempts      int              `json:"attempts"`
+	NextAttemptAt *time.Time       `json:"next_attempt_at,omitempty"`
+	CreatedAt     time.Time        `json:"created_at"`
+	AttemptLog    []WebhookAttempt `json:"attempt_log"`
+}
+
+// DueWebhookDelivery is a pending delivery claimed by the deliverer, with the URL and secret
+// of its webhook.
+type DueWebhookDelivery struct {
+	WebhookDelivery
+	URL    string
+	Secret []byte
+}
+
+// WebhookAttempt records one delivery attempt: the HTTP status the receiver answered with, or
+// the error that prevented an answer.
+type WebhookAttempt struct {
+	At         time.Time `json:"at"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMS int64     `json:"duration_ms"`
+}
+
+// WebhookAttemptResult is the outcome of an attempt: the delivery's new status and, while it
+// stays pending, when to retry.
+type WebhookAttemptResult struct {
+	Attempt       WebhookAttempt
+	Status        string
+	NextAttemptAt *time.Time
+}
+
+// normalize checks the attributes of a webhook to be stored.
+func (n *NewWebhook) normalize() error {
+	if n.URL == "" || len(n.EventTypes) == 0 || len(n.Secret) == 0 {
+		return ErrInvalidWebhook
+	}
+	if n.AccountIDs == nil {
+		n.AccountIDs = []uuid.UUID{}
+	}
+	return nil
+}
+
+// validAttemptResult reports whether r is a status a delivery can move to after an attempt.
+func validAttemptResult(r WebhookAttemptResult) bool {
+	switch r.Status {
+	case DeliveryPending:
+		return r.NextAttemptAt != nil
+	case DeliverySucceeded, DeliveryFailed:
+		return r.NextAttemptAt == nil
+	}
+	return false
+}
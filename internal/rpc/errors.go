@@ -0,0 +1,165 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/Bharat0908/ledger/internal/http/auth"
+	"github.com/Bharat0908/ledger/internal/repo"
+)
+
+// errorDomain is the domain of the ErrorInfo details attached to domain errors.
+const errorDomain = "ledger"
+
+// domainCodes maps repository domain error codes to gRPC status codes, following the HTTP
+// statuses of handlers: 404 is NotFound, 400 InvalidArgument, 409 FailedPrecondition or
+// AlreadyExists and 422 FailedPrecondition. Codes not listed are FailedPrecondition.
+var domainCodes = map[string]codes.Code{
+	repo.ErrNotFound.Code:          codes.NotFound,
+	repo.ErrInsufficientFunds.Code: codes.FailedPrecondition,
+	repo.ErrInvalidType.Code:       codes.InvalidArgument,
+	repo.ErrInvalidAmount.Code:     codes.InvalidArgument,
+	repo.ErrAccountFrozen.Code:     codes.FailedPrecondition,
+	repo.ErrSameAccount.Code:       codes.InvalidArgument,
+	repo.ErrCurrencyMismatch.Code:  codes.FailedPrecondition,
+	repo.ErrOpeningAccount.Code:    codes.FailedPrecondition,
+	repo.ErrReservedKey.Code:       codes.InvalidArgument,
+
+	repo.ErrInvalidAccountType.Code:  codes.InvalidArgument,
+	repo.ErrExternalRefConflict.Code: codes.AlreadyExists,
+	repo.ErrExternalRefRequired.Code: codes.InvalidArgument,
+	repo.ErrReservedExternalRef.Code: codes.InvalidArgument,
+
+	repo.ErrInvalidEventID.Code: codes.InvalidArgument,
+
+	repo.ErrQuotaExceeded.Code: codes.ResourceExhausted,
+}
+
+// statusError maps err to a gRPC status. Repository domain errors keep their message and carry
+// their stable code as the reason of an ErrorInfo detail; anything else is logged and reported
+// as Internal so driver messages never reach the client.
+func statusError(ctx context.Context, err error) error {
+	var de *repo.Error
+	if errors.As(err, &de) {
+		code, ok := domainCodes[de.Code]
+		if !ok {
+			code = codes.FailedPrecondition
+		}
+		st := status.New(code, de.Message)
+		if withInfo, err := st.WithDetails(&errdetails.ErrorInfo{Reason: de.Code, Domain: errorDomain}); err == nil {
+			st = withInfo
+		}
+		return st.Err()
+	}
+	slog.ErrorContext(ctx, "rpc failed", "error", err)
+	return status.Error(codes.Internal, "internal server error")
+}
+
+// publishError reports a failure to enqueue a message as Unavailable, so clients retry.
+func publishError(ctx context.Context, err error) error {
+	slog.ErrorContext(ctx, "publish failed", "error", err)
+	return status.Error(codes.Unavailable, "transaction queue unavailable, retry later")
+}
+
+// allowAccount returns nil if the caller may act on the account, and PermissionDenied if not.
+// Callers bound to a tenant may only act on accounts owned by that tenant, which requires
+// loading the account; unknown accounts pass so the caller gets the usual NotFound.
+func (s *Server) allowAccount(ctx context.Context, id uuid.UUID) error {
+	p := auth.FromContext(ctx)
+	if p == nil {
+		return nil
+	}
+	if !p.CanAccess(id) {
+		return status.Error(codes.PermissionDenied, "API credentials are not allowed to access this account")
+	}
+	if p.Tenant == "" {
+		return nil
+	}
+	acc, err := s.Repo.GetAccount(ctx, id)
+	if errors.Is(err, repo.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return statusError(ctx, err)
+	}
+	if acc.Owner != p.Tenant {
+		return status.Error(codes.PermissionDenied, "account belongs to another tenant")
+	}
+	return nil
+}
+
+// allowAccountID is allowAccount for an account ID taken from a request message. Restricted
+// callers are refused IDs that do not parse; for others, validation is left to the worker.
+func (s *Server) allowAccountID(ctx context.Context, v string) error {
+	id, err := uuid.Parse(v)
+	if err != nil {
+		if p := auth.FromContext(ctx); p != nil && (p.Restricted() || p.Tenant != "") {
+			return status.Error(codes.PermissionDenied, "API credentials are not allowed to access this account")
+		}
+		return nil
+	}
+	return s.allowAccount(ctx, id)
+}
+
+// consumeQuota charges one transaction of amount to the caller's daily quota, shared with the
+// REST API, and returns a function giving the charge back should the call fail to queue it after
+// all. An exhausted quota is reported as ResourceExhausted with a RetryInfo detail pointing at the
+// next UTC midnight, when usage resets. Without Quotas or limits every call passes.
+func (s *Server) consumeQuota(ctx context.Context, amount int64) (refund func(), err error) {
+	if s.Quotas == nil || !s.QuotaLimits.Enabled() {
+		return func() {}, nil
+	}
+	if amount < 0 {
+		// Negative amounts are rejected by the worker; they must not free up quota.
+		amount = 0
+	}
+	client, now := clientKey(ctx), time.Now()
+	_, err = s.Quotas.ConsumeQuota(ctx, client, now, amount, s.QuotaLimits)
+	if errors.Is(err, repo.ErrQuotaExceeded) {
+		midnight := now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+		st := status.New(codes.ResourceExhausted, repo.ErrQuotaExceeded.Message)
+		if withInfo, err := st.WithDetails(
+			&errdetails.ErrorInfo{Reason: repo.ErrQuotaExceeded.Code, Domain: errorDomain},
+			&errdetails.RetryInfo{RetryDelay: durationpb.New(midnight.Sub(now).Round(time.Second))},
+		); err == nil {
+			st = withInfo
+		}
+		return nil, st.Err()
+	}
+	if err != nil {
+		return nil, statusError(ctx, err)
+	}
+	return func() {
+		// The call may have failed because it was canceled; the refund must go through anyway.
+		if err := s.Quotas.RefundQuota(context.WithoutCancel(ctx), client, now, 1, amount); err != nil {
+			slog.ErrorContext(ctx, "refund quota", "client", client, "amount", amount, "error", err)
+		}
+	}, nil
+}
+
+// clientKey identifies the caller for quotas and rate limits like ratelimit.ClientKey: by
+// principal, or by peer address when authentication is off.
+func clientKey(ctx context.Context) string {
+	if p := auth.FromContext(ctx); p != nil && p.Subject != "" {
+		return p.Subject
+	}
+	addr := ""
+	if pr, ok := peer.FromContext(ctx); ok && pr.Addr != nil {
+		addr = pr.Addr.String()
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	return "ip:" + host
+}
@@ -0,0 +1,266 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/Bharat0908/ledger/internal/http/auth"
+	"github.com/Bharat0908/ledger/internal/http/problem"
+	"github.com/Bharat0908/ledger/internal/http/ratelimit"
+	"github.com/Bharat0908/ledger/internal/logging"
+	"github.com/Bharat0908/ledger/internal/metrics"
+	"github.com/Bharat0908/ledger/internal/rpc/ledgerpb"
+)
+
+// requestIDKey is the metadata key carrying request IDs, the gRPC spelling of
+// logging.RequestIDHeader.
+const requestIDKey = "x-request-id"
+
+// methodScopes is the scope each LedgerService method requires, matching its REST route.
+var methodScopes = map[string]string{
+	ledgerpb.LedgerService_CreateAccount_FullMethodName:        auth.ScopeAccountsWrite,
+	ledgerpb.LedgerService_GetAccount_FullMethodName:           auth.ScopeAccountsRead,
+	ledgerpb.LedgerService_ListLedger_FullMethodName:           auth.ScopeAccountsRead,
+	ledgerpb.LedgerService_SubmitTransaction_FullMethodName:    auth.ScopeTransactionsWrite,
+	ledgerpb.LedgerService_SubmitTransfer_FullMethodName:       auth.ScopeTransactionsWrite,
+	ledgerpb.LedgerService_GetTransactionStatus_FullMethodName: auth.ScopeAccountsRead,
+	ledgerpb.LedgerService_WatchAccount_FullMethodName:         auth.ScopeAccountsRead,
+}
+
+// NewGRPCServer returns a gRPC server serving svc. Calls pass through the metrics, logging,
+// authentication (when svc.Auth is set) and rate-limit (when svc.ReadLimit or svc.WriteLimit is
+// set) interceptors, in that order.
+func NewGRPCServer(svc *Server, opts ...grpc.ServerOption) *grpc.Server {
+	unary := []grpc.UnaryServerInterceptor{UnaryMetrics, UnaryLogging}
+	streams := []grpc.StreamServerInterceptor{StreamMetrics, StreamLogging}
+	if svc.Auth != nil {
+		unary = append(unary, UnaryAuth(svc.Auth))
+		streams = append(streams, StreamAuth(svc.Auth))
+	}
+	if svc.ReadLimit != nil || svc.WriteLimit != nil {
+		unary = append(unary, UnaryRateLimit(svc.ReadLimit, svc.WriteLimit))
+		streams = append(streams, StreamRateLimit(svc.ReadLimit, svc.WriteLimit))
+	}
+	opts = append(opts, grpc.ChainUnaryInterceptor(unary...), grpc.ChainStreamInterceptor(streams...))
+	s := grpc.NewServer(opts...)
+	ledgerpb.RegisterLedgerServiceServer(s, svc)
+	return s
+}
+
+// serverStream is a grpc.ServerStream with a replaced context.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context { return s.ctx }
+
+// UnaryMetrics records metrics.GRPCRequestDuration for every unary call.
+func UnaryMetrics(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	observe(info.FullMethod, err, start)
+	return resp, err
+}
+
+// StreamMetrics records metrics.GRPCRequestDuration for every streaming call, over the whole
+// stream.
+func StreamMetrics(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, ss)
+	observe(info.FullMethod, err, start)
+	return err
+}
+
+// observe records a call of method that started at start and ended with err. Methods the
+// server does not know are labelled "unknown" so arbitrary names cannot create new series.
+func observe(method string, err error, start time.Time) {
+	if _, ok := methodScopes[method]; !ok {
+		method = "unknown"
+	}
+	metrics.GRPCRequestDuration.WithLabelValues(method, status.Code(err).String()).Observe(time.Since(start).Seconds())
+}
+
+// UnaryLogging is the gRPC counterpart of logging.Middleware: it gives every call a request ID,
+// taken from valid x-request-id metadata or generated, sends it back in the response header and
+// stores it in the context, then logs the method, status code and latency when the call
+// completes. Server-side failures are logged at error level.
+func UnaryLogging(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	ctx = withRequestID(ctx)
+	resp, err := handler(ctx, req)
+	logCall(ctx, info.FullMethod, err, start)
+	return resp, err
+}
+
+// StreamLogging is UnaryLogging for streaming calls.
+func StreamLogging(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	ctx := withRequestID(ss.Context())
+	err := handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	logCall(ctx, info.FullMethod, err, start)
+	return err
+}
+
+// withRequestID returns ctx carrying the call's request ID and sets it as response metadata.
+func withRequestID(ctx context.Context) context.Context {
+	var id string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get(requestIDKey); len(v) > 0 {
+			id = v[0]
+		}
+	}
+	if !logging.ValidRequestID(id) {
+		id = uuid.NewString()
+	}
+	_ = grpc.SetHeader(ctx, metadata.Pairs(requestIDKey, id))
+	return logging.WithRequestID(ctx, id)
+}
+
+// logCall logs a completed call.
+func logCall(ctx context.Context, method string, err error, start time.Time) {
+	code := status.Code(err)
+	level := slog.LevelInfo
+	switch code {
+	case codes.Internal, codes.Unknown, codes.DataLoss, codes.Unavailable:
+		level = slog.LevelError
+	}
+	slog.Log(ctx, level, "rpc", "method", method, "code", code.String(),
+		"latency_ms", float64(time.Since(start).Microseconds())/1000)
+}
+
+// UnaryAuth is the gRPC counterpart of auth.Middleware and auth.Require: it authenticates every
+// call with a, refuses callers without the scope of the method (see methodScopes) and stores the
+// principal in the context.
+func UnaryAuth(a auth.Authenticator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := authenticate(ctx, a, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamAuth is UnaryAuth for streaming calls.
+func StreamAuth(a auth.Authenticator) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticate(ss.Context(), a, info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// authenticate resolves the caller of a call to method and returns ctx carrying its principal.
+// Authenticators work on HTTP requests, so they are given one with the call's metadata as
+// headers and an empty body: API keys (x-api-key) and bearer tokens (authorization) work as over
+// HTTP, but request signatures, which cover the body, cannot be verified, so keys that require
+// signed requests are refused. Missing or rejected credentials are reported as Unauthenticated,
+// a missing scope as PermissionDenied and other authenticator errors as Internal.
+func authenticate(ctx context.Context, a auth.Authenticator, method string) (context.Context, error) {
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, method, http.NoBody)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "internal server error")
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for k, vs := range md {
+			if strings.HasPrefix(k, ":") || strings.HasSuffix(k, "-bin") {
+				continue
+			}
+			for _, v := range vs {
+				r.Header.Add(k, v)
+			}
+		}
+	}
+	if pr, ok := peer.FromContext(ctx); ok && pr.Addr != nil {
+		r.RemoteAddr = pr.Addr.String()
+	}
+	p, err := a.Authenticate(r)
+	switch {
+	case err == nil:
+	case errors.Is(err, auth.ErrNoCredentials):
+		return nil, status.Error(codes.Unauthenticated, "missing credentials")
+	case errors.Is(err, auth.ErrInvalidCredentials):
+		slog.WarnContext(ctx, "authentication failed", "error", err)
+		return nil, status.Error(codes.Unauthenticated, "invalid credentials")
+	default:
+		slog.ErrorContext(ctx, "authenticate", "error", err)
+		return nil, status.Error(codes.Internal, "internal server error")
+	}
+	scope, ok := methodScopes[method]
+	if !ok {
+		return nil, status.Error(codes.Unimplemented, "unknown method")
+	}
+	if !p.HasScope(scope) {
+		slog.WarnContext(ctx, "access denied", "subject", p.Subject, "reason", "missing scope "+scope)
+		return nil, status.Error(codes.PermissionDenied, "missing scope "+scope)
+	}
+	return auth.NewContext(ctx, p), nil
+}
+
+// UnaryRateLimit is the gRPC counterpart of ratelimit.Middleware on the REST routes: it takes a
+// token for the caller, keyed by principal like ratelimit.ClientKey, from write for methods that
+// require a write scope and from read for the others, and refuses callers with an empty bucket
+// with ResourceExhausted and a RetryInfo detail saying when to retry. A nil limiter lets its
+// methods through. It must run after UnaryAuth so callers are keyed by principal; sharing the
+// limiters with the REST API makes a client's calls over both count against the same rates.
+func UnaryRateLimit(read, write *ratelimit.Limiter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := allowCall(ctx, read, write, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamRateLimit is UnaryRateLimit for streaming calls, which take one token when they open.
+func StreamRateLimit(read, write *ratelimit.Limiter) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := allowCall(ss.Context(), read, write, info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+// allowCall takes a token for a call to method from the limiter matching its scope, returning
+// ResourceExhausted when the caller has none left.
+func allowCall(ctx context.Context, read, write *ratelimit.Limiter, method string) error {
+	l := read
+	if scope := methodScopes[method]; scope == auth.ScopeAccountsWrite || scope == auth.ScopeTransactionsWrite {
+		l = write
+	}
+	if l == nil {
+		return nil
+	}
+	client := clientKey(ctx)
+	ok, wait := l.Allow(client)
+	if ok {
+		return nil
+	}
+	wait = wait.Round(time.Millisecond)
+	slog.InfoContext(ctx, "request throttled", "client", client, "code", problem.CodeRateLimited, "retry_after_ms", wait.Milliseconds())
+	st := status.New(codes.ResourceExhausted, "rate limit exceeded")
+	if withInfo, err := st.WithDetails(
+		&errdetails.ErrorInfo{Reason: problem.CodeRateLimited, Domain: errorDomain},
+		&errdetails.RetryInfo{RetryDelay: durationpb.New(wait)},
+	); err == nil {
+		st = withInfo
+	}
+	return st.Err()
+}
@@ -0,0 +1,388 @@
+// The gRPC interface of the ledger service. It mirrors the REST API: accounts are created and
+// read synchronously, while transactions and transfers are queued and applied by the worker.
+// Callers authenticate with the same API keys or bearer tokens as over HTTP, sent as the
+// x-api-key or authorization metadata, and need the same scopes.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: ledger/v1/ledger.proto
+
+package ledgerpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	LedgerService_CreateAccount_FullMethodName        = "/ledger.v1.LedgerService/CreateAccount"
+	LedgerService_GetAccount_FullMethodName           = "/ledger.v1.LedgerService/GetAccount"
+	LedgerService_ListLedger_FullMethodName           = "/ledger.v1.LedgerService/ListLedger"
+	LedgerService_SubmitTransaction_FullMethodName    = "/ledger.v1.LedgerService/SubmitTransaction"
+	LedgerService_SubmitTransfer_FullMethodName       = "/ledger.v1.LedgerService/SubmitTransfer"
+	LedgerService_GetTransactionStatus_FullMethodName = "/ledger.v1.LedgerService/GetTransactionStatus"
+	LedgerService_WatchAccount_FullMethodName         = "/ledger.v1.LedgerService/WatchAccount"
+)
+
+// LedgerServiceClient is the client API for LedgerService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type LedgerServiceClient interface {
+	// CreateAccount creates an account with a zero balance, or returns the existing account with
+	// the same external_ref. A positive initial_balance is queued as an opening transfer from the
+	// currency's equity account. Requires accounts:write.
+	CreateAccount(ctx context.Context, in *CreateAccountRequest, opts ...grpc.CallOption) (*CreateAccountResponse, error)
+	// GetAccount returns an account with its balance. Requires accounts:read.
+	GetAccount(ctx context.Context, in *GetAccountRequest, opts ...grpc.CallOption) (*GetAccountResponse, error)
+	// ListLedger returns the latest ledger entries of an account, newest first. Requires
+	// accounts:read.
+	ListLedger(ctx context.Context, in *ListLedgerRequest, opts ...grpc.CallOption) (*ListLedgerResponse, error)
+	// SubmitTransaction queues a deposit or withdrawal. Requires transactions:write.
+	SubmitTransaction(ctx context.Context, in *SubmitTransactionRequest, opts ...grpc.CallOption) (*SubmitResponse, error)
+	// SubmitTransfer queues a transfer between two accounts. Requires transactions:write.
+	SubmitTransfer(ctx context.Context, in *SubmitTransferRequest, opts ...grpc.CallOption) (*SubmitResponse, error)
+	// GetTransactionStatus reports whether the transaction or transfer submitted with an
+	// idempotency key has been applied. Requires accounts:read.
+	GetTransactionStatus(ctx context.Context, in *GetTransactionStatusRequest, opts ...grpc.CallOption) (*GetTransactionStatusResponse, error)
+	// WatchAccount streams the ledger entries of an account as the worker commits them, first
+	// replaying those written after last_event_id when it is set. Requires accounts:read.
+	WatchAccount(ctx context.Context, in *WatchAccountRequest, opts ...grpc.CallOption) (LedgerService_WatchAccountClient, error)
+}
+
+type ledgerServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewLedgerServiceClient(cc grpc.ClientConnInterface) LedgerServiceClient {
+	return &ledgerServiceClient{cc}
+}
+
+func (c *ledgerServiceClient) CreateAccount(ctx context.Context, in *CreateAccountRequest, opts ...grpc.CallOption) (*CreateAccountResponse, error) {
+	out := new(CreateAccountResponse)
+	err := c.cc.Invoke(ctx, LedgerService_CreateAccount_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ledgerServiceClient) GetAccount(ctx context.Context, in *GetAccountRequest, opts ...grpc.CallOption) (*GetAccountResponse, error) {
+	out := new(GetAccountResponse)
+	err := c.cc.Invoke(ctx, LedgerService_GetAccount_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ledgerServiceClient) ListLedger(ctx context.Context, in *ListLedgerRequest, opts ...grpc.CallOption) (*ListLedgerResponse, error) {
+	out := new(ListLedgerResponse)
+	err := c.cc.Invoke(ctx, LedgerService_ListLedger_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ledgerServiceClient) SubmitTransaction(ctx context.Context, in *SubmitTransactionRequest, opts ...grpc.CallOption) (*SubmitResponse, error) {
+	out := new(SubmitResponse)
+	err := c.cc.Invoke(ctx, LedgerService_SubmitTransaction_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ledgerServiceClient) SubmitTransfer(ctx context.Context, in *SubmitTransferRequest, opts ...grpc.CallOption) (*SubmitResponse, error) {
+	out := new(SubmitResponse)
+	err := c.cc.Invoke(ctx, LedgerService_SubmitTransfer_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ledgerServiceClient) GetTransactionStatus(ctx context.Context, in *GetTransactionStatusRequest, opts ...grpc.CallOption) (*GetTransactionStatusResponse, error) {
+	out := new(GetTransactionStatusResponse)
+	err := c.cc.Invoke(ctx, LedgerService_GetTransactionStatus_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ledgerServiceClient) WatchAccount(ctx context.Context, in *WatchAccountRequest, opts ...grpc.CallOption) (LedgerService_WatchAccountClient, error) {
+	stream, err := c.cc.NewStream(ctx, &LedgerService_ServiceDesc.Streams[0], LedgerService_WatchAccount_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &ledgerServiceWatchAccountClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type LedgerService_WatchAccountClient interface {
+	Recv() (*LedgerEntry, error)
+	grpc.ClientStream
+}
+
+type ledgerServiceWatchAccountClient struct {
+	grpc.ClientStream
+}
+
+func (x *ledgerServiceWatchAccountClient) Recv() (*LedgerEntry, error) {
+	m := new(LedgerEntry)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// LedgerServiceServer is the server API for LedgerService service.
+// All implementations must embed UnimplementedLedgerServiceServer
+// for forward compatibility
+type LedgerServiceServer interface {
+	// CreateAccount creates an account with a zero balance, or returns the existing account with
+	// the same external_ref. A positive initial_balance is queued as an opening transfer from the
+	// currency's equity account. Requires accounts:write.
+	CreateAccount(context.Context, *CreateAccountRequest) (*CreateAccountResponse, error)
+	// GetAccount returns an account with its balance. Requires accounts:read.
+	GetAccount(context.Context, *GetAccountRequest) (*GetAccountResponse, error)
+	// ListLedger returns the latest ledger entries of an account, newest first. Requires
+	// accounts:read.
+	ListLedger(context.Context, *ListLedgerRequest) (*ListLedgerResponse, error)
+	// SubmitTransaction queues a deposit or withdrawal. Requires transactions:write.
+	SubmitTransaction(context.Context, *SubmitTransactionRequest) (*SubmitResponse, error)
+	// SubmitTransfer queues a transfer between two accounts. Requires transactions:write.
+	SubmitTransfer(context.Context, *SubmitTransferRequest) (*SubmitResponse, error)
+	// GetTransactionStatus reports whether the transaction or transfer submitted with an
+	// idempotency key has been applied. Requires accounts:read.
+	GetTransactionStatus(context.Context, *GetTransactionStatusRequest) (*GetTransactionStatusResponse, error)
+	// WatchAccount streams the ledger entries of an account as the worker commits them, first
+	// replaying those written after last_event_id when it is set. Requires accounts:read.
+	WatchAccount(*WatchAccountRequest, LedgerService_WatchAccountServer) error
+	mustEmbedUnimplementedLedgerServiceServer()
+}
+
+// UnimplementedLedgerServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedLedgerServiceServer struct {
+}
+
+func (UnimplementedLedgerServiceServer) CreateAccount(context.Context, *CreateAccountRequest) (*CreateAccountResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateAccount not implemented")
+}
+func (UnimplementedLedgerServiceServer) GetAccount(context.Context, *GetAccountRequest) (*GetAccountResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetAccount not implemented")
+}
+func (UnimplementedLedgerServiceServer) ListLedger(context.Context, *ListLedgerRequest) (*ListLedgerResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListLedger not implemented")
+}
+func (UnimplementedLedgerServiceServer) SubmitTransaction(context.Context, *SubmitTransactionRequest) (*SubmitResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SubmitTransaction not implemented")
+}
+func (UnimplementedLedgerServiceServer) SubmitTransfer(context.Context, *SubmitTransferRequest) (*SubmitResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SubmitTransfer not implemented")
+}
+func (UnimplementedLedgerServiceServer) GetTransactionStatus(context.Context, *GetTransactionStatusRequest) (*GetTransactionStatusResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetTransactionStatus not implemented")
+}
+func (UnimplementedLedgerServiceServer) WatchAccount(*WatchAccountRequest, LedgerService_WatchAccountServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchAccount not implemented")
+}
+func (UnimplementedLedgerServiceServer) mustEmbedUnimplementedLedgerServiceServer() {}
+
+// UnsafeLedgerServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to LedgerServiceServer will
+// result in compilation errors.
+type UnsafeLedgerServiceServer interface {
+	mustEmbedUnimplementedLedgerServiceServer()
+}
+
+func RegisterLedgerServiceServer(s grpc.ServiceRegistrar, srv LedgerServiceServer) {
+	s.RegisterService(&LedgerService_ServiceDesc, srv)
+}
+
+func _LedgerService_CreateAccount_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateAccountRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LedgerServiceServer).CreateAccount(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LedgerService_CreateAccount_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LedgerServiceServer).CreateAccount(ctx, req.(*CreateAccountRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LedgerService_GetAccount_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetAccountRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LedgerServiceServer).GetAccount(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LedgerService_GetAccount_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LedgerServiceServer).GetAccount(ctx, req.(*GetAccountRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LedgerService_ListLedger_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListLedgerRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LedgerServiceServer).ListLedger(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LedgerService_ListLedger_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LedgerServiceServer).ListLedger(ctx, req.(*ListLedgerRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LedgerService_SubmitTransaction_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SubmitTransactionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LedgerServiceServer).SubmitTransaction(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LedgerService_SubmitTransaction_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LedgerServiceServer).SubmitTransaction(ctx, req.(*SubmitTransactionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LedgerService_SubmitTransfer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SubmitTransferRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LedgerServiceServer).SubmitTransfer(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LedgerService_SubmitTransfer_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LedgerServiceServer).SubmitTransfer(ctx, req.(*SubmitTransferRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LedgerService_GetTransactionStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetTransactionStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LedgerServiceServer).GetTransactionStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LedgerService_GetTransactionStatus_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LedgerServiceServer).GetTransactionStatus(ctx, req.(*GetTransactionStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LedgerService_WatchAccount_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchAccountRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(LedgerServiceServer).WatchAccount(m, &ledgerServiceWatchAccountServer{stream})
+}
+
+type LedgerService_WatchAccountServer interface {
+	Send(*LedgerEntry) error
+	grpc.ServerStream
+}
+
+type ledgerServiceWatchAccountServer struct {
+	grpc.ServerStream
+}
+
+func (x *ledgerServiceWatchAccountServer) Send(m *LedgerEntry) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// LedgerService_ServiceDesc is the grpc.ServiceDesc for LedgerService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var LedgerService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "ledger.v1.LedgerService",
+	HandlerType: (*LedgerServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateAccount",
+			Handler:    _LedgerService_CreateAccount_Handler,
+		},
+		{
+			MethodName: "GetAccount",
+			Handler:    _LedgerService_GetAccount_Handler,
+		},
+		{
+			MethodName: "ListLedger",
+			Handler:    _LedgerService_ListLedger_Handler,
+		},
+		{
+			MethodName: "SubmitTransaction",
+			Handler:    _LedgerService_SubmitTransaction_Handler,
+		},
+		{
+			MethodName: "SubmitTransfer",
+			Handler:    _LedgerService_SubmitTransfer_Handler,
+		},
+		{
+			MethodName: "GetTransactionStatus",
+			Handler:    _LedgerService_GetTransactionStatus_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchAccount",
+			Handler:       _LedgerService_WatchAccount_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "ledger/v1/ledger.proto",
+}
@@ -0,0 +1,381 @@
+// Package rpc serves the ledger API over gRPC, as defined in proto/ledger/v1/ledger.proto.
+//
+// Server implements ledgerpb.LedgerServiceServer on the same repositories, publisher and event
+// stream as handlers.Handlers, so both APIs see the same accounts and queue the same messages.
+// NewGRPCServer wraps it with the metrics, logging, authentication and rate-limit interceptors.
+package rpc
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/Bharat0908/ledger/internal/http/auth"
+	"github.com/Bharat0908/ledger/internal/http/handlers"
+	"github.com/Bharat0908/ledger/internal/http/ratelimit"
+	"github.com/Bharat0908/ledger/internal/queue"
+	"github.com/Bharat0908/ledger/internal/repo"
+	"github.com/Bharat0908/ledger/internal/rpc/ledgerpb"
+)
+
+// defaultLimit and maxLimit bound ListLedger, as the limit parameter of the REST ledger route.
+const (
+	defaultLimit = 50
+	maxLimit     = 500
+)
+
+// replayPage is the number of ledger entries read at a time when resuming a WatchAccount stream.
+const replayPage = 500
+
+// Server implements the LedgerService. Auth, when set, authenticates every call (see UnaryAuth);
+// without it the service is open, like the REST API in auth mode none. Pub, Repo, LedgerRepo,
+// ReadLimit, WriteLimit, Quotas, QuotaLimits and OpeningAccounts have the meaning of the Handlers
+// fields of the same name. Transactions backs GetTransactionStatus, and Stream WatchAccount;
+// without them those calls fail with Unimplemented.
+//
+// Callers are authorized from the principal the authentication interceptor stores in the
+// context: those restricted to particular accounts or bound to a tenant are refused other
+// accounts with PermissionDenied, as over HTTP.
+type Server struct {
+	ledgerpb.UnimplementedLedgerServiceServer
+
+	Auth            auth.Authenticator
+	Pub             handlers.Publisher
+	Repo            handlers.AccountRepo
+	LedgerRepo      handlers.LedgerRepo
+	Transactions    handlers.TransactionRepo
+	Stream          handlers.Streamer
+	ReadLimit       *ratelimit.Limiter
+	WriteLimit      *ratelimit.Limiter
+	Quotas          handlers.QuotaRepo
+	QuotaLimits     repo.QuotaLimits
+	OpeningAccounts map[string]uuid.UUID
+}
+
+// New returns a Server serving the accounts and ledgers of h, with its publisher, event stream,
+// transaction lookups, rate limiters, quotas and opening accounts. Auth is left unset: h.Auth is
+// HTTP middleware, so the authenticator behind it must be set separately.
+func New(h *handlers.Handlers) *Server {
+	return &Server{
+		Pub:             h.Pub,
+		Repo:            h.Repo,
+		LedgerRepo:      h.LedgerRepo,
+		Transactions:    h.Transactions,
+		Stream:          h.Stream,
+		ReadLimit:       h.ReadLimit,
+		WriteLimit:      h.WriteLimit,
+		Quotas:          h.Quotas,
+		QuotaLimits:     h.QuotaLimits,
+		OpeningAccounts: h.OpeningAccounts,
+	}
+}
+
+// CreateAccount creates an account with a zero balance, or returns the one with the same
+// external_ref, and queues a positive initial_balance as an opening transfer keyed by
+// repo.OpeningBalanceKey, like the REST createAccount handler: the request is validated like its
+// body, equity accounts cannot be created, and a positive initial_balance requires an
+// external_ref.
+func (s *Server) CreateAccount(ctx context.Context, req *ledgerpb.CreateAccountRequest) (*ledgerpb.CreateAccountResponse, error) {
+	if err := validateCreateAccount(req); err != nil {
+		return nil, err
+	}
+	in := repo.NewAccount{
+		Owner:       req.GetOwner(),
+		Currency:    req.GetCurrency(),
+		ExternalRef: req.GetExternalRef(),
+		Type:        req.GetType(),
+		DisplayName: req.GetDisplayName(),
+		Metadata:    req.GetMetadata(),
+	}
+	if err := in.CheckClient(req.GetInitialBalance()); err != nil {
+		return nil, statusError(ctx, err)
+	}
+	if p := auth.FromContext(ctx); p != nil && p.Tenant != "" && req.GetOwner() != p.Tenant {
+		return nil, status.Error(codes.PermissionDenied, "cannot create accounts for another tenant")
+	}
+	acc, created, err := s.Repo.CreateAccount(ctx, in)
+	if err != nil {
+		return nil, statusError(ctx, err)
+	}
+	slog.InfoContext(ctx, "account provisioned", "account_id", acc.ID, "created", created, "external_ref", acc.ExternalRef)
+	out := &ledgerpb.CreateAccountResponse{Account: accountProto(acc), Created: created}
+	if amount := req.GetInitialBalance(); amount > 0 {
+		from, err := repo.OpeningAccount(ctx, s.Repo, s.OpeningAccounts, acc.Currency)
+		if err != nil {
+			return nil, statusError(ctx, err)
+		}
+		key := repo.OpeningBalanceKey(acc.ID)
+		msg := queue.TransferMessage{FromAccountID: from.String(), ToAccountID: acc.ID.String(), Amount: amount, Key: key, CreatedAt: time.Now()}
+		if err := s.Pub.PublishTransfer(ctx, msg); err != nil {
+			return nil, publishError(ctx, err)
+		}
+		slog.InfoContext(ctx, "opening transfer queued",
+			"from_account_id", from, "to_account_id", acc.ID, "amount", amount, "idempotency_key", key)
+		out.OpeningTransfer = &ledgerpb.OpeningTransfer{IdempotencyKey: key, FromAccountId: from.String(), Amount: amount}
+	}
+	return out, nil
+}
+
+// GetAccount returns an account with its balance.
+func (s *Server) GetAccount(ctx context.Context, req *ledgerpb.GetAccountRequest) (*ledgerpb.GetAccountResponse, error) {
+	id, err := uuid.Parse(req.GetId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid account id")
+	}
+	if err := s.allowAccount(ctx, id); err != nil {
+		return nil, err
+	}
+	acc, err := s.Repo.GetAccount(ctx, id)
+	if err != nil {
+		return nil, statusError(ctx, err)
+	}
+	return &ledgerpb.GetAccountResponse{Account: accountProto(acc)}, nil
+}
+
+// ListLedger returns up to limit (default 50, max 500) of the latest ledger entries of an
+// account, newest first.
+func (s *Server) ListLedger(ctx context.Context, req *ledgerpb.ListLedgerRequest) (*ledgerpb.ListLedgerResponse, error) {
+	id, err := uuid.Parse(req.GetAccountId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid account id")
+	}
+	limit := int(req.GetLimit())
+	switch {
+	case limit == 0:
+		limit = defaultLimit
+	case limit < 0 || limit > maxLimit:
+		return nil, status.Errorf(codes.InvalidArgument, "limit must be between 1 and %d", maxLimit)
+	}
+	if err := s.allowAccount(ctx, id); err != nil {
+		return nil, err
+	}
+	entries, err := s.LedgerRepo.GetTransactions(ctx, id.String(), limit)
+	if err != nil {
+		return nil, statusError(ctx, err)
+	}
+	out := &ledgerpb.ListLedgerResponse{Entries: make([]*ledgerpb.LedgerEntry, 0, len(entries))}
+	for _, e := range entries {
+		out.Entries = append(out.Entries, entryProto(e))
+	}
+	return out, nil
+}
+
+// SubmitTransaction queues a deposit or withdrawal, under a generated idempotency key when the
+// request has none. Requests are validated like REST bodies, and withdrawals from opening
+// accounts and keys reserved for opening transfers are refused (see repo.CheckSubmission); the
+// worker checks the account itself when it applies the transaction.
+func (s *Server) SubmitTransaction(ctx context.Context, req *ledgerpb.SubmitTransactionRequest) (*ledgerpb.SubmitResponse, error) {
+	if err := validateSubmitTransaction(req); err != nil {
+		return nil, err
+	}
+	if err := s.allowAccountID(ctx, req.GetAccountId()); err != nil {
+		return nil, err
+	}
+	key := req.GetIdempotencyKey()
+	if key == "" {
+		key = uuid.NewString()
+	}
+	debit := ""
+	if req.GetType() == "withdraw" {
+		debit = req.GetAccountId()
+	}
+	if err := repo.CheckSubmission(debit, key, s.OpeningAccounts); err != nil {
+		return nil, statusError(ctx, err)
+	}
+	refund, err := s.consumeQuota(ctx, req.GetAmount())
+	if err != nil {
+		return nil, err
+	}
+	msg := queue.TxMessage{AccountID: req.GetAccountId(), Type: req.GetType(), Amount: req.GetAmount(), Key: key, CreatedAt: time.Now()}
+	if err := s.Pub.Publish(ctx, msg); err != nil {
+		refund()
+		return nil, publishError(ctx, err)
+	}
+	slog.InfoContext(ctx, "transaction queued",
+		"account_id", msg.AccountID, "type", msg.Type, "amount", msg.Amount, "idempotency_key", key)
+	return &ledgerpb.SubmitResponse{IdempotencyKey: key}, nil
+}
+
+// SubmitTransfer queues a transfer, under a generated idempotency key when the request has none,
+// after validating it like a REST body. Callers restricted to particular accounts may only transfer
+// out of those accounts, and nobody out of an opening account.
+func (s *Server) SubmitTransfer(ctx context.Context, req *ledgerpb.SubmitTransferRequest) (*ledgerpb.SubmitResponse, error) {
+	if err := validateSubmitTransfer(req); err != nil {
+		return nil, err
+	}
+	if err := s.allowAccountID(ctx, req.GetFromAccountId()); err != nil {
+		return nil, err
+	}
+	key := req.GetIdempotencyKey()
+	if key == "" {
+		key = uuid.NewString()
+	}
+	if err := repo.CheckSubmission(req.GetFromAccountId(), key, s.OpeningAccounts); err != nil {
+		return nil, statusError(ctx, err)
+	}
+	refund, err := s.consumeQuota(ctx, req.GetAmount())
+	if err != nil {
+		return nil, err
+	}
+	msg := queue.TransferMessage{FromAccountID: req.GetFromAccountId(), ToAccountID: req.GetToAccountId(), Amount: req.GetAmount(), Key: key, CreatedAt: time.Now()}
+	if err := s.Pub.PublishTransfer(ctx, msg); err != nil {
+		refund()
+		return nil, publishError(ctx, err)
+	}
+	slog.InfoContext(ctx, "transfer queued",
+		"from_account_id", msg.FromAccountID, "to_account_id", msg.ToAccountID, "amount", msg.Amount, "idempotency_key", key)
+	return &ledgerpb.SubmitResponse{IdempotencyKey: key}, nil
+}
+
+// GetTransactionStatus reports whether a transaction or transfer has been applied with the
+// idempotency key. As over REST, only transactions on accounts the caller may access are
+// reported, and opening transfers to them; keys applied on other accounts are NOT_APPLIED.
+func (s *Server) GetTransactionStatus(ctx context.Context, req *ledgerpb.GetTransactionStatusRequest) (*ledgerpb.GetTransactionStatusResponse, error) {
+	if s.Transactions == nil {
+		return nil, status.Error(codes.Unimplemented, "transaction status lookups are not available")
+	}
+	key := req.GetIdempotencyKey()
+	if key == "" {
+		return nil, status.Error(codes.InvalidArgument, "idempotency_key is required")
+	}
+	txs, err := s.Transactions.GetProcessedTransactions(ctx, key)
+	if err != nil && !errors.Is(err, repo.ErrTransactionNotFound) {
+		return nil, statusError(ctx, err)
+	}
+	for _, tx := range txs {
+		id := tx.AccountID
+		if opened, ok := repo.OpeningBalanceAccount(tx.IdempotencyKey); ok {
+			id = opened
+		}
+		if err := s.allowAccount(ctx, id); status.Code(err) == codes.PermissionDenied {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		return &ledgerpb.GetTransactionStatusResponse{
+			IdempotencyKey: key,
+			Status:         ledgerpb.TransactionStatus_TRANSACTION_STATUS_APPLIED,
+			AccountId:      tx.AccountID.String(),
+			Type:           tx.Type,
+			Amount:         tx.Amount,
+			AppliedAt:      timestamppb.New(tx.ProcessedAt),
+		}, nil
+	}
+	return &ledgerpb.GetTransactionStatusResponse{IdempotencyKey: key, Status: ledgerpb.TransactionStatus_TRANSACTION_STATUS_NOT_APPLIED}, nil
+}
+
+// WatchAccount streams the ledger entries of an account as they are committed, like the REST
+// event stream: it subscribes first, then replays the entries written after last_event_id, and
+// sends live entries that were not replayed. The stream ends with Unavailable when the
+// subscription does, because the client fell behind or the server is shutting down; clients
+// resume by calling again with the id of the last entry they received.
+func (s *Server) WatchAccount(req *ledgerpb.WatchAccountRequest, stream ledgerpb.LedgerService_WatchAccountServer) error {
+	ctx := stream.Context()
+	if s.Stream == nil {
+		return status.Error(codes.Unimplemented, "account streams are not available")
+	}
+	id, err := uuid.Parse(req.GetAccountId())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, "invalid account id")
+	}
+	if err := s.allowAccount(ctx, id); err != nil {
+		return err
+	}
+	live, cancel := s.Stream.Subscribe(id.String())
+	defer cancel()
+	slog.DebugContext(ctx, "account watch opened", "account_id", id, "last_event_id", req.GetLastEventId())
+
+	replayed := map[string]bool{}
+	for after := req.GetLastEventId(); after != ""; {
+		replay, err := s.LedgerRepo.GetTransactionsAfter(ctx, id.String(), after, replayPage)
+		if err != nil {
+			return statusError(ctx, err)
+		}
+		for _, e := range replay {
+			entryID, _ := e["id"].(string)
+			replayed[entryID] = true
+			if err := stream.Send(entryProto(e)); err != nil {
+				return err
+			}
+		}
+		if len(replay) < replayPage {
+			break
+		}
+		after, _ = replay[len(replay)-1]["id"].(string)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case e, ok := <-live:
+			if !ok {
+				return status.Error(codes.Unavailable, "stream closed, resume with last_event_id")
+			}
+			if entryID, _ := e["id"].(string); replayed[entryID] {
+				continue
+			}
+			if err := stream.Send(entryProto(e)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// accountProto converts an account to its protobuf message.
+func accountProto(a repo.Account) *ledgerpb.Account {
+	return &ledgerpb.Account{
+		Id:          a.ID.String(),
+		Owner:       a.Owner,
+		Currency:    a.Currency,
+		Balance:     a.Balance,
+		Status:      a.Status,
+		Type:        a.Type,
+		ExternalRef: a.ExternalRef,
+		DisplayName: a.DisplayName,
+		Metadata:    a.Metadata,
+		CreatedAt:   timestamppb.New(a.CreatedAt),
+	}
+}
+
+// entryProto converts a ledger entry, as returned by the ledger repositories and the event
+// stream, to its protobuf message. Numbers may be decoded as any integer type, and Mongo
+// returns created_at as a primitive.DateTime.
+func entryProto(e map[string]interface{}) *ledgerpb.LedgerEntry {
+	out := &ledgerpb.LedgerEntry{
+		Amount:       toInt64(e["amount"]),
+		BalanceAfter: toInt64(e["balance_after"]),
+	}
+	out.Id, _ = e["id"].(string)
+	out.AccountId, _ = e["account_id"].(string)
+	out.Type, _ = e["type"].(string)
+	out.IdempotencyKey, _ = e["idempotency_key"].(string)
+	switch t := e["created_at"].(type) {
+	case time.Time:
+		out.CreatedAt = timestamppb.New(t)
+	case interface{ Time() time.Time }:
+		out.CreatedAt = timestamppb.New(t.Time())
+	}
+	return out
+}
+
+// toInt64 returns the integer v, or 0 if v is not a number.
+func toInt64(v interface{}) int64 {
+	switch n := v.(type) {
+	case int64:
+		return n
+	case int32:
+		return int64(n)
+	case int:
+		return int64(n)
+	case float64:
+		return int64(n)
+	}
+	return 0
+}
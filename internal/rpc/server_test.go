@@ -0,0 +1,605 @@
+package rpc_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/Bharat0908/ledger/internal/http/auth"
+	"github.com/Bharat0908/ledger/internal/http/ratelimit"
+	"github.com/Bharat0908/ledger/internal/queue"
+	"github.com/Bharat0908/ledger/internal/repo"
+	"github.com/Bharat0908/ledger/internal/rpc"
+	"github.com/Bharat0908/ledger/internal/rpc/ledgerpb"
+	"github.com/Bharat0908/ledger/internal/stream"
+)
+
+// fakeRepo is an in-memory AccountRepo, LedgerRepo and TransactionRepo.
+type fakeRepo struct {
+	accounts  map[uuid.UUID]repo.Account
+	entries   []map[string]interface{}
+	processed map[string][]repo.ProcessedTransaction
+}
+
+func (f *fakeRepo) CreateAccount(ctx context.Context, in repo.NewAccount) (repo.Account, bool, error) {
+	for _, a := range f.accounts {
+		if in.ExternalRef != "" && a.ExternalRef == in.ExternalRef {
+			return a, false, nil
+		}
+	}
+	a := repo.Account{ID: uuid.New(), Owner: in.Owner, Currency: in.Currency, Status: repo.StatusActive, Type: in.Type, ExternalRef: in.ExternalRef}
+	f.accounts[a.ID] = a
+	return a, true, nil
+}
+
+func (f *fakeRepo) GetAccount(ctx context.Context, id uuid.UUID) (repo.Account, error) {
+	a, ok := f.accounts[id]
+	if !ok {
+		return repo.Account{}, repo.ErrNotFound
+	}
+	return a, nil
+}
+
+func (f *fakeRepo) ListAccounts(ctx context.Context, filter repo.AccountFilter) (repo.AccountPage, error) {
+	return repo.AccountPage{}, nil
+}
+
+func (f *fakeRepo) GetTransactions(ctx context.Context, accountID string, limit int) ([]map[string]interface{}, error) {
+	var out []map[string]interface{}
+	for i := len(f.entries) - 1; i >= 0 && len(out) < limit; i-- {
+		if f.entries[i]["account_id"] == accountID {
+			out = append(out, f.entries[i])
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeRepo) GetTransactionsAfter(ctx context.Context, accountID, entryID string, limit int) ([]map[string]interface{}, error) {
+	for i, e := range f.entries {
+		if e["account_id"] == accountID && e["id"] == entryID {
+			return f.entries[i+1:], nil
+		}
+	}
+	return nil, repo.ErrInvalidEventID
+}
+
+func (f *fakeRepo) ExportLedger(ctx context.Context, filter repo.LedgerFilter, fn func(repo.LedgerEntry) error) error {
+	return nil
+}
+
+func (f *fakeRepo) GetProcessedTransactions(ctx context.Context, key string) ([]repo.ProcessedTransaction, error) {
+	txs, ok := f.processed[key]
+	if !ok {
+		return nil, repo.ErrTransactionNotFound
+	}
+	return txs, nil
+}
+
+// fakePublisher records published messages.
+type fakePublisher struct {
+	txs       []queue.TxMessage
+	transfers []queue.TransferMessage
+	err       error
+}
+
+func (p *fakePublisher) Publish(ctx context.Context, msg queue.TxMessage) error {
+	p.txs = append(p.txs, msg)
+	return p.err
+}
+
+func (p *fakePublisher) PublishTransfer(ctx context.Context, msg queue.TransferMessage) error {
+	p.transfers = append(p.transfers, msg)
+	return p.err
+}
+
+func (p *fakePublisher) PublishTransfers(ctx context.Context, msgs []queue.TransferMessage) []error {
+	errs := make([]error, len(msgs))
+	for i, msg := range msgs {
+		errs[i] = p.PublishTransfer(ctx, msg)
+	}
+	return errs
+}
+
+// keyAuth authenticates the x-api-key metadata against a fixed set of principals.
+type keyAuth map[string]*auth.Principal
+
+func (a keyAuth) Authenticate(r *http.Request) (*auth.Principal, error) {
+	key := r.Header.Get("X-API-Key")
+	if key == "" {
+		return nil, auth.ErrNoCredentials
+	}
+	p, ok := a[key]
+	if !ok {
+		return nil, auth.ErrInvalidCredentials
+	}
+	return p, nil
+}
+
+// dial serves svc over an in-memory connection and returns a client for it.
+func dial(t *testing.T, svc *rpc.Server) ledgerpb.LedgerServiceClient {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	gs := rpc.NewGRPCServer(svc)
+	go gs.Serve(lis)
+	t.Cleanup(gs.Stop)
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return ledgerpb.NewLedgerServiceClient(conn)
+}
+
+func newTestServer() (*rpc.Server, *fakeRepo, *fakePublisher) {
+	r := &fakeRepo{accounts: map[uuid.UUID]repo.Account{}, processed: map[string][]repo.ProcessedTransaction{}}
+	p := &fakePublisher{}
+	return &rpc.Server{Pub: p, Repo: r, LedgerRepo: r, Transactions: r}, r, p
+}
+
+func withKey(key string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "x-api-key", key)
+}
+
+func TestServer_Accounts(t *testing.T) {
+	svc, _, pub := newTestServer()
+	c := dial(t, svc)
+	ctx := context.Background()
+
+	created, err := c.CreateAccount(ctx, &ledgerpb.CreateAccountRequest{Owner: "alice", Currency: "USD", InitialBalance: 100, ExternalRef: "alice-usd"})
+	if err != nil {
+		t.Fatalf("CreateAccount() failed: %v", err)
+	}
+	if !created.GetCreated() || created.GetOpeningTransfer().GetAmount() != 100 {
+		t.Errorf("CreateAccount() = %v, want a new account with an opening transfer of 100", created)
+	}
+	if len(pub.transfers) != 1 || pub.transfers[0].ToAccountID != created.GetAccount().GetId() ||
+		pub.transfers[0].Key != repo.OpeningBalanceKey(uuid.MustParse(created.GetAccount().GetId())) {
+		t.Errorf("published %+v, want the opening transfer", pub.transfers)
+	}
+
+	got, err := c.GetAccount(ctx, &ledgerpb.GetAccountRequest{Id: created.GetAccount().GetId()})
+	if err != nil || got.GetAccount().GetOwner() != "alice" {
+		t.Errorf("GetAccount() = %v, %v; want alice's account", got, err)
+	}
+
+	sub, err := c.SubmitTransaction(ctx, &ledgerpb.SubmitTransactionRequest{AccountId: created.GetAccount().GetId(), Type: "deposit", Amount: 5})
+	if err != nil || sub.GetIdempotencyKey() == "" || len(pub.txs) != 1 || pub.txs[0].Key != sub.GetIdempotencyKey() {
+		t.Errorf("SubmitTransaction() = %v, %v with %+v published; want a generated key", sub, err, pub.txs)
+	}
+}
+
+func TestServer_Errors(t *testing.T) {
+	svc, _, pub := newTestServer()
+	opening := uuid.New()
+	svc.OpeningAccounts = map[string]uuid.UUID{"USD": opening}
+	c := dial(t, svc)
+	ctx := context.Background()
+
+	tests := []struct {
+		name       string
+		call       func() error
+		wantCode   codes.Code
+		wantReason string
+	}{
+		{"invalid id", func() error {
+			_, err := c.GetAccount(ctx, &ledgerpb.GetAccountRequest{Id: "nope"})
+			return err
+		}, codes.InvalidArgument, ""},
+		{"unknown account", func() error {
+			_, err := c.GetAccount(ctx, &ledgerpb.GetAccountRequest{Id: uuid.NewString()})
+			return err
+		}, codes.NotFound, repo.ErrNotFound.Code},
+		{"negative opening balance", func() error {
+			_, err := c.CreateAccount(ctx, &ledgerpb.CreateAccountRequest{Owner: "a", Currency: "USD", InitialBalance: -1})
+			return err
+		}, codes.InvalidArgument, repo.ErrInvalidAmount.Code},
+		{"equity account", func() error {
+			_, err := c.CreateAccount(ctx, &ledgerpb.CreateAccountRequest{Owner: "a", Currency: "USD", Type: repo.TypeEquity})
+			return err
+		}, codes.InvalidArgument, repo.ErrInvalidAccountType.Code},
+		{"opening balance without external ref", func() error {
+			_, err := c.CreateAccount(ctx, &ledgerpb.CreateAccountRequest{Owner: "a", Currency: "USD", InitialBalance: 10})
+			return err
+		}, codes.InvalidArgument, repo.ErrExternalRefRequired.Code},
+		{"reserved external ref", func() error {
+			_, err := c.CreateAccount(ctx, &ledgerpb.CreateAccountRequest{Owner: "system", Currency: "USD", ExternalRef: "opening-equity:USD"})
+			return err
+		}, codes.InvalidArgument, repo.ErrReservedExternalRef.Code},
+		{"transfer out of an opening account", func() error {
+			_, err := c.SubmitTransfer(ctx, &ledgerpb.SubmitTransferRequest{FromAccountId: opening.String(), ToAccountId: uuid.NewString(), Amount: 1})
+			return err
+		}, codes.FailedPrecondition, repo.ErrOpeningAccount.Code},
+		{"reserved key", func() error {
+			_, err := c.SubmitTransaction(ctx, &ledgerpb.SubmitTransactionRequest{AccountId: uuid.NewString(), Type: "deposit", Amount: 1, IdempotencyKey: repo.OpeningBalanceKey(uuid.New())})
+			return err
+		}, codes.InvalidArgument, repo.ErrReservedKey.Code},
+		{"limit too large", func() error {
+			_, err := c.ListLedger(ctx, &ledgerpb.ListLedgerRequest{AccountId: uuid.NewString(), Limit: 501})
+			return err
+		}, codes.InvalidArgument, ""},
+		{"queue down", func() error {
+			pub.err = errors.New("broker down")
+			defer func() { pub.err = nil }()
+			_, err := c.SubmitTransfer(ctx, &ledgerpb.SubmitTransferRequest{FromAccountId: uuid.NewString(), ToAccountId: uuid.NewString(), Amount: 1})
+			return err
+		}, codes.Unavailable, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := status.Convert(tt.call())
+			if st.Code() != tt.wantCode {
+				t.Fatalf("code = %v (%s), want %v", st.Code(), st.Message(), tt.wantCode)
+			}
+			var reason string
+			for _, d := range st.Details() {
+				if info, ok := d.(*errdetails.ErrorInfo); ok {
+					reason = info.GetReason()
+				}
+			}
+			if reason != tt.wantReason {
+				t.Errorf("ErrorInfo reason = %q, want %q", reason, tt.wantReason)
+			}
+		})
+	}
+}
+
+// countingQuotas is a QuotaRepo that counts charges, less refunds, and never runs out.
+type countingQuotas struct{ charges int }
+
+func (q *countingQuotas) ConsumeQuota(ctx context.Context, client string, at time.Time, amount int64, lim repo.QuotaLimits) (repo.QuotaUsage, error) {
+	q.charges++
+	return repo.QuotaUsage{}, nil
+}
+
+func (q *countingQuotas) ConsumeQuotaBatch(ctx context.Context, client string, at time.Time, count, amount int64, lim repo.QuotaLimits) (repo.QuotaUsage, error) {
+	q.charges += int(count)
+	return repo.QuotaUsage{}, nil
+}
+
+func (q *countingQuotas) RefundQuota(ctx context.Context, client string, at time.Time, count, amount int64) error {
+	q.charges -= int(count)
+	return nil
+}
+
+func TestServer_Validation(t *testing.T) {
+	svc, r, pub := newTestServer()
+	quotas := &countingQuotas{}
+	svc.Quotas, svc.QuotaLimits = quotas, repo.QuotaLimits{DailyCount: 100}
+	c := dial(t, svc)
+	ctx := context.Background()
+
+	id, long := uuid.NewString(), strings.Repeat("k", 256)
+	account := func(mod func(*ledgerpb.CreateAccountRequest)) func() error {
+		return func() error {
+			req := &ledgerpb.CreateAccountRequest{Owner: "alice", Currency: "USD"}
+			mod(req)
+			_, err := c.CreateAccount(ctx, req)
+			return err
+		}
+	}
+	transaction := func(mod func(*ledgerpb.SubmitTransactionRequest)) func() error {
+		return func() error {
+			req := &ledgerpb.SubmitTransactionRequest{AccountId: id, Type: "deposit", Amount: 1}
+			mod(req)
+			_, err := c.SubmitTransaction(ctx, req)
+			return err
+		}
+	}
+	transfer := func(mod func(*ledgerpb.SubmitTransferRequest)) func() error {
+		return func() error {
+			req := &ledgerpb.SubmitTransferRequest{FromAccountId: id, ToAccountId: uuid.NewString(), Amount: 1}
+			mod(req)
+			_, err := c.SubmitTransfer(ctx, req)
+			return err
+		}
+	}
+	tests := []struct {
+		name      string
+		call      func() error
+		wantField string
+	}{
+		{"empty owner", account(func(r *ledgerpb.CreateAccountRequest) { r.Owner = "" }), "owner"},
+		{"long owner", account(func(r *ledgerpb.CreateAccountRequest) { r.Owner = long }), "owner"},
+		{"lower-case currency", account(func(r *ledgerpb.CreateAccountRequest) { r.Currency = "usd" }), "currency"},
+		{"missing currency", account(func(r *ledgerpb.CreateAccountRequest) { r.Currency = "" }), "currency"},
+		{"long external ref", account(func(r *ledgerpb.CreateAccountRequest) { r.ExternalRef = long }), "external_ref"},
+		{"long display name", account(func(r *ledgerpb.CreateAccountRequest) { r.DisplayName = long }), "display_name"},
+		{"long metadata value", account(func(r *ledgerpb.CreateAccountRequest) { r.Metadata = map[string]string{"k": strings.Repeat("v", 1025)} }), "metadata.k"},
+		{"unknown account type", account(func(r *ledgerpb.CreateAccountRequest) { r.Type = "savings" }), ""},
+		{"transaction account id", transaction(func(r *ledgerpb.SubmitTransactionRequest) { r.AccountId = "nope" }), "account_id"},
+		{"transaction type", transaction(func(r *ledgerpb.SubmitTransactionRequest) { r.Type = "refund" }), "type"},
+		{"zero transaction amount", transaction(func(r *ledgerpb.SubmitTransactionRequest) { r.Amount = 0 }), "amount"},
+		{"negative transaction amount", transaction(func(r *ledgerpb.SubmitTransactionRequest) { r.Amount = -5 }), "amount"},
+		{"long transaction key", transaction(func(r *ledgerpb.SubmitTransactionRequest) { r.IdempotencyKey = long }), "idempotency_key"},
+		{"transfer source", transfer(func(r *ledgerpb.SubmitTransferRequest) { r.FromAccountId = "" }), "from_account_id"},
+		{"transfer destination", transfer(func(r *ledgerpb.SubmitTransferRequest) { r.ToAccountId = "nope" }), "to_account_id"},
+		{"zero transfer amount", transfer(func(r *ledgerpb.SubmitTransferRequest) { r.Amount = 0 }), "amount"},
+		{"long transfer key", transfer(func(r *ledgerpb.SubmitTransferRequest) { r.IdempotencyKey = long }), "idempotency_key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := status.Convert(tt.call())
+			if st.Code() != codes.InvalidArgument {
+				t.Fatalf("code = %v (%s), want %v", st.Code(), st.Message(), codes.InvalidArgument)
+			}
+			var fields []string
+			for _, d := range st.Details() {
+				if br, ok := d.(*errdetails.BadRequest); ok {
+					for _, fv := range br.GetFieldViolations() {
+						fields = append(fields, fv.GetField())
+					}
+				}
+			}
+			if tt.wantField != "" && (len(fields) != 1 || fields[0] != tt.wantField) {
+				t.Errorf("field violations = %v, want %s", fields, tt.wantField)
+			}
+		})
+	}
+	if quotas.charges != 0 || len(r.accounts) != 0 || len(pub.txs) != 0 || len(pub.transfers) != 0 {
+		t.Errorf("invalid requests charged %d quotas, created %d accounts and published %d messages; want none",
+			quotas.charges, len(r.accounts), len(pub.txs)+len(pub.transfers))
+	}
+
+	if err := transaction(func(*ledgerpb.SubmitTransactionRequest) {})(); err != nil {
+		t.Fatalf("valid SubmitTransaction() failed: %v", err)
+	}
+	if quotas.charges != 1 {
+		t.Errorf("valid request charged %d quotas, want 1", quotas.charges)
+	}
+
+	pub.err = errors.New("broker down")
+	for name, call := range map[string]func() error{
+		"SubmitTransaction": transaction(func(*ledgerpb.SubmitTransactionRequest) {}),
+		"SubmitTransfer":    transfer(func(*ledgerpb.SubmitTransferRequest) {}),
+	} {
+		if err := call(); status.Code(err) != codes.Unavailable {
+			t.Errorf("%s() with the queue down = %v, want %v", name, err, codes.Unavailable)
+		}
+	}
+	if quotas.charges != 1 {
+		t.Errorf("requests with the queue down left %d quotas charged, want them given back", quotas.charges-1)
+	}
+}
+
+func TestServer_Auth(t *testing.T) {
+	svc, r, _ := newTestServer()
+	mine, _, _ := r.CreateAccount(context.Background(), repo.NewAccount{Owner: "alice", Currency: "USD"})
+	other, _, _ := r.CreateAccount(context.Background(), repo.NewAccount{Owner: "bob", Currency: "USD"})
+	svc.Stream = &stream.Broker{}
+	svc.Auth = keyAuth{
+		"reader":     {Subject: "reader", Scopes: []string{auth.ScopeAccountsRead}},
+		"restricted": {Subject: "restricted", Scopes: []string{auth.ScopeAccountsRead, auth.ScopeTransactionsWrite}, Accounts: []uuid.UUID{mine.ID}},
+	}
+	c := dial(t, svc)
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		call func(ctx context.Context) error
+		want codes.Code
+	}{
+		{"no credentials", context.Background(), func(ctx context.Context) error {
+			_, err := c.GetAccount(ctx, &ledgerpb.GetAccountRequest{Id: mine.ID.String()})
+			return err
+		}, codes.Unauthenticated},
+		{"unknown key", withKey("nope"), func(ctx context.Context) error {
+			_, err := c.GetAccount(ctx, &ledgerpb.GetAccountRequest{Id: mine.ID.String()})
+			return err
+		}, codes.Unauthenticated},
+		{"read scope", withKey("reader"), func(ctx context.Context) error {
+			_, err := c.GetAccount(ctx, &ledgerpb.GetAccountRequest{Id: other.ID.String()})
+			return err
+		}, codes.OK},
+		{"missing write scope", withKey("reader"), func(ctx context.Context) error {
+			_, err := c.SubmitTransaction(ctx, &ledgerpb.SubmitTransactionRequest{AccountId: mine.ID.String(), Type: "deposit", Amount: 1})
+			return err
+		}, codes.PermissionDenied},
+		{"restricted to another account", withKey("restricted"), func(ctx context.Context) error {
+			_, err := c.GetAccount(ctx, &ledgerpb.GetAccountRequest{Id: other.ID.String()})
+			return err
+		}, codes.PermissionDenied},
+		{"restricted transfer out of another account", withKey("restricted"), func(ctx context.Context) error {
+			_, err := c.SubmitTransfer(ctx, &ledgerpb.SubmitTransferRequest{FromAccountId: other.ID.String(), ToAccountId: mine.ID.String(), Amount: 1})
+			return err
+		}, codes.PermissionDenied},
+		{"restricted watch of another account", withKey("restricted"), func(ctx context.Context) error {
+			s, err := c.WatchAccount(ctx, &ledgerpb.WatchAccountRequest{AccountId: other.ID.String()})
+			if err != nil {
+				return err
+			}
+			_, err = s.Recv()
+			return err
+		}, codes.PermissionDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := status.Code(tt.call(tt.ctx)); got != tt.want {
+				t.Errorf("code = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	var header metadata.MD
+	ctx := metadata.AppendToOutgoingContext(withKey("reader"), "x-request-id", "req-42")
+	if _, err := c.GetAccount(ctx, &ledgerpb.GetAccountRequest{Id: mine.ID.String()}, grpc.Header(&header)); err != nil {
+		t.Fatal(err)
+	}
+	if got := header.Get("x-request-id"); len(got) != 1 || got[0] != "req-42" {
+		t.Errorf("x-request-id header = %v, want the client's request ID", got)
+	}
+}
+
+func TestServer_RateLimit(t *testing.T) {
+	svc, r, _ := newTestServer()
+	acc, _, _ := r.CreateAccount(context.Background(), repo.NewAccount{Owner: "alice", Currency: "USD"})
+	svc.Stream = &stream.Broker{}
+	scopes := []string{auth.ScopeAccountsRead, auth.ScopeTransactionsWrite}
+	svc.Auth = keyAuth{"a": {Subject: "a", Scopes: scopes}, "b": {Subject: "b", Scopes: scopes}}
+	svc.ReadLimit = &ratelimit.Limiter{Rate: 0.001, Burst: 2}
+	svc.WriteLimit = &ratelimit.Limiter{Rate: 0.001, Burst: 1}
+	c := dial(t, svc)
+
+	read := func(ctx context.Context) error {
+		_, err := c.GetAccount(ctx, &ledgerpb.GetAccountRequest{Id: acc.ID.String()})
+		return err
+	}
+	write := func(ctx context.Context) error {
+		_, err := c.SubmitTransaction(ctx, &ledgerpb.SubmitTransactionRequest{AccountId: acc.ID.String(), Type: "deposit", Amount: 1})
+		return err
+	}
+	watch := func(ctx context.Context) error {
+		_, err := recvOne(ctx, c, &ledgerpb.WatchAccountRequest{AccountId: acc.ID.String()})
+		return err
+	}
+	steps := []struct {
+		name string
+		key  string
+		call func(context.Context) error
+		want codes.Code
+	}{
+		{"first write", "a", write, codes.OK},
+		{"second write", "a", write, codes.ResourceExhausted},
+		{"read after writes", "a", read, codes.OK},
+		{"other client", "b", write, codes.OK},
+		{"stream takes a read token", "a", watch, codes.DeadlineExceeded},
+		{"reads used up", "a", read, codes.ResourceExhausted},
+	}
+	for _, s := range steps {
+		ctx, cancel := context.WithTimeout(withKey(s.key), 200*time.Millisecond)
+		st := status.Convert(s.call(ctx))
+		cancel()
+		if st.Code() != s.want {
+			t.Fatalf("%s: code = %v (%s), want %v", s.name, st.Code(), st.Message(), s.want)
+		}
+		if st.Code() != codes.ResourceExhausted {
+			continue
+		}
+		var retry *errdetails.RetryInfo
+		var reason string
+		for _, d := range st.Details() {
+			switch d := d.(type) {
+			case *errdetails.RetryInfo:
+				retry = d
+			case *errdetails.ErrorInfo:
+				reason = d.GetReason()
+			}
+		}
+		if retry == nil || retry.GetRetryDelay().AsDuration() <= 0 || reason != "rate_limited" {
+			t.Errorf("%s: details = %v, want a RetryInfo delay and reason rate_limited", s.name, st.Details())
+		}
+	}
+}
+
+func TestServer_GetTransactionStatus(t *testing.T) {
+	svc, r, _ := newTestServer()
+	acc, other := uuid.New(), uuid.New()
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	r.processed["k1"] = []repo.ProcessedTransaction{{IdempotencyKey: "k1", AccountID: acc, Type: "deposit", Amount: 10, ProcessedAt: at}}
+	r.processed["k3"] = []repo.ProcessedTransaction{{IdempotencyKey: "k3", AccountID: other, Type: "deposit", Amount: 5, ProcessedAt: at}}
+	svc.Auth = keyAuth{"restricted": {Subject: "restricted", Scopes: []string{auth.ScopeAccountsRead}, Accounts: []uuid.UUID{acc}}}
+	c := dial(t, svc)
+	ctx := withKey("restricted")
+
+	got, err := c.GetTransactionStatus(ctx, &ledgerpb.GetTransactionStatusRequest{IdempotencyKey: "k1"})
+	if err != nil || got.GetStatus() != ledgerpb.TransactionStatus_TRANSACTION_STATUS_APPLIED ||
+		got.GetAccountId() != acc.String() || got.GetAmount() != 10 || !got.GetAppliedAt().AsTime().Equal(at) {
+		t.Errorf("GetTransactionStatus(k1) = %v, %v; want the applied deposit", got, err)
+	}
+	got, err = c.GetTransactionStatus(ctx, &ledgerpb.GetTransactionStatusRequest{IdempotencyKey: "k2"})
+	if err != nil || got.GetStatus() != ledgerpb.TransactionStatus_TRANSACTION_STATUS_NOT_APPLIED {
+		t.Errorf("GetTransactionStatus(k2) = %v, %v; want not applied", got, err)
+	}
+	got, err = c.GetTransactionStatus(ctx, &ledgerpb.GetTransactionStatusRequest{IdempotencyKey: "k3"})
+	if err != nil || got.GetStatus() != ledgerpb.TransactionStatus_TRANSACTION_STATUS_NOT_APPLIED || got.GetAccountId() != "" {
+		t.Errorf("GetTransactionStatus(other account's k3) = %v, %v; want not applied", got, err)
+	}
+	if _, err := c.GetTransactionStatus(ctx, &ledgerpb.GetTransactionStatusRequest{}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("GetTransactionStatus(\"\") error = %v, want InvalidArgument", err)
+	}
+}
+
+func TestServer_WatchAccount(t *testing.T) {
+	svc, r, _ := newTestServer()
+	broker := &stream.Broker{}
+	svc.Stream = broker
+	acc := uuid.NewString()
+	entry := func(key string, after int64) map[string]interface{} {
+		return map[string]interface{}{
+			"id": repo.EntryID(acc, key), "account_id": acc, "type": "deposit", "amount": int64(10), "balance_after": after,
+			"idempotency_key": key, "created_at": time.Now(),
+		}
+	}
+	r.entries = []map[string]interface{}{entry("k1", 10), entry("k2", 20), entry("k3", 30)}
+	c := dial(t, svc)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := recvOne(ctx, c, &ledgerpb.WatchAccountRequest{AccountId: acc, LastEventId: "nope"}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("WatchAccount(unknown last_event_id) error = %v, want InvalidArgument", err)
+	}
+
+	s, err := c.WatchAccount(ctx, &ledgerpb.WatchAccountRequest{AccountId: acc, LastEventId: repo.EntryID(acc, "k1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for len(ids) < 2 {
+		e, err := s.Recv()
+		if err != nil {
+			t.Fatalf("Recv() failed after %v: %v", ids, err)
+		}
+		ids = append(ids, e.GetId())
+	}
+	// k3 was replayed, so receiving it live again is skipped; a transfer into the account that
+	// shares its key and k4 are new.
+	after, payer := int64(40), uuid.NewString()
+	broker.PublishEvents(ctx, []queue.Event{
+		{Type: queue.EventBalanceChanged, AccountID: acc, Kind: "transaction", TransactionType: "deposit", IdempotencyKey: "k3", Amount: 10, BalanceAfter: &after},
+		{Type: queue.EventBalanceChanged, AccountID: acc, Kind: "transfer", FromAccountID: payer, ToAccountID: acc, IdempotencyKey: "k3", Amount: 5, Delta: 5, BalanceAfter: &after},
+		{Type: queue.EventBalanceChanged, AccountID: acc, Kind: "transaction", TransactionType: "deposit", IdempotencyKey: "k4", Amount: 10, BalanceAfter: &after},
+	})
+	var e *ledgerpb.LedgerEntry
+	for len(ids) < 4 {
+		if e, err = s.Recv(); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, e.GetId())
+	}
+	want := []string{repo.EntryID(acc, "k2"), repo.EntryID(acc, "k3"), repo.EntryID(payer, "k3"), repo.EntryID(acc, "k4")}
+	if fmt.Sprint(ids) != fmt.Sprint(want) {
+		t.Errorf("received %v, want %v", ids, want)
+	}
+	if e.GetBalanceAfter() != 40 || e.GetAmount() != 10 {
+		t.Errorf("live entry = %v, want a deposit of 10 leaving 40", e)
+	}
+
+	broker.Close()
+	if _, err := s.Recv(); status.Code(err) != codes.Unavailable {
+		t.Errorf("Recv() after broker close error = %v, want Unavailable", err)
+	}
+}
+
+// recvOne opens a WatchAccount stream and returns its first entry or error.
+func recvOne(ctx context.Context, c ledgerpb.LedgerServiceClient, req *ledgerpb.WatchAccountRequest) (*ledgerpb.LedgerEntry, error) {
+	s, err := c.WatchAccount(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return s.Recv()
+}
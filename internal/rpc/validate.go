@@ -0,0 +1,116 @@
+package rpc
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/Bharat0908/ledger/internal/rpc/ledgerpb"
+)
+
+// Field limits, mirroring the schemas of the OpenAPI document that the validation middleware
+// enforces on the matching REST bodies.
+const (
+	maxTextLen          = 255
+	maxMetadataValueLen = 1024
+)
+
+// currencyPattern mirrors the Currency schema of the OpenAPI document.
+var currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// violations collects the fields of a request message that break the constraints REST puts on
+// the same fields, so both APIs accept the same input. Calls are validated before anything is
+// charged to the caller's quota or published.
+type violations []*errdetails.BadRequest_FieldViolation
+
+func (v *violations) add(field, format string, args ...interface{}) {
+	*v = append(*v, &errdetails.BadRequest_FieldViolation{Field: field, Description: fmt.Sprintf(format, args...)})
+}
+
+// text checks a string field of at most maxTextLen characters, which must be set if required.
+func (v *violations) text(field, s string, required bool) {
+	switch {
+	case s == "" && required:
+		v.add(field, "is required")
+	case len(s) > maxTextLen:
+		v.add(field, "must be at most %d characters", maxTextLen)
+	}
+}
+
+// uuid checks a field holding an account ID.
+func (v *violations) uuid(field, s string) {
+	if _, err := uuid.Parse(s); err != nil {
+		v.add(field, "must be a UUID")
+	}
+}
+
+// amount checks a field holding the amount of a transaction or transfer.
+func (v *violations) amount(field string, n int64) {
+	if n < 1 {
+		v.add(field, "must be at least 1")
+	}
+}
+
+// err returns nil without violations, and otherwise InvalidArgument with a BadRequest detail
+// listing them, like the invalid_params of a REST invalid_request problem.
+func (v violations) err() error {
+	if len(v) == 0 {
+		return nil
+	}
+	msgs := make([]string, len(v))
+	for i, fv := range v {
+		msgs[i] = fv.GetField() + " " + fv.GetDescription()
+	}
+	st := status.New(codes.InvalidArgument, "invalid request: "+strings.Join(msgs, "; "))
+	if withDetails, err := st.WithDetails(&errdetails.BadRequest{FieldViolations: v}); err == nil {
+		st = withDetails
+	}
+	return st.Err()
+}
+
+// validateCreateAccount checks a CreateAccount request. The account type and opening balance
+// are checked by repo.NewAccount.CheckClient, as over REST.
+func validateCreateAccount(req *ledgerpb.CreateAccountRequest) error {
+	var v violations
+	v.text("owner", req.GetOwner(), true)
+	if !currencyPattern.MatchString(req.GetCurrency()) {
+		v.add("currency", "must be an ISO 4217 code of three capital letters")
+	}
+	v.text("external_ref", req.GetExternalRef(), false)
+	v.text("display_name", req.GetDisplayName(), false)
+	for k, val := range req.GetMetadata() {
+		if len(val) > maxMetadataValueLen {
+			v.add("metadata."+k, "must be at most %d characters", maxMetadataValueLen)
+		}
+	}
+	return v.err()
+}
+
+// validateSubmitTransaction checks a SubmitTransaction request. An empty idempotency key is
+// replaced by a generated one.
+func validateSubmitTransaction(req *ledgerpb.SubmitTransactionRequest) error {
+	var v violations
+	v.uuid("account_id", req.GetAccountId())
+	if t := req.GetType(); t != "deposit" && t != "withdraw" {
+		v.add("type", "must be deposit or withdraw")
+	}
+	v.amount("amount", req.GetAmount())
+	v.text("idempotency_key", req.GetIdempotencyKey(), false)
+	return v.err()
+}
+
+// validateSubmitTransfer checks a SubmitTransfer request. An empty idempotency key is replaced
+// by a generated one.
+func validateSubmitTransfer(req *ledgerpb.SubmitTransferRequest) error {
+	var v violations
+	v.uuid("from_account_id", req.GetFromAccountId())
+	v.uuid("to_account_id", req.GetToAccountId())
+	v.amount("amount", req.GetAmount())
+	v.text("idempotency_key", req.GetIdempotencyKey(), false)
+	return v.err()
+}
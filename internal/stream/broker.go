@@ -0,0 +1,146 @@
+// Package stream fans ledger activity out to the API's account streams: Server-Sent Events and
+// gRPC WatchAccount calls.
+//
+// A Broker is fed the account.balance_changed events of applied transactions and transfers,
+// either by queue.SubscribeEvents from the events exchange or, with sqlite storage, directly by
+// the in-process queue, and turns each into the ledger entry the worker committed for it.
+package stream
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/Bharat0908/ledger/internal/metrics"
+	"github.com/Bharat0908/ledger/internal/queue"
+	"github.com/Bharat0908/ledger/internal/repo"
+)
+
+// EventPatterns are the routing-key patterns a Broker needs from the events exchange.
+var EventPatterns = []string{queue.EventBalanceChanged + ".*"}
+
+// defaultBuffer is the number of entries held for a subscriber when Broker.Buffer is unset.
+const defaultBuffer = 64
+
+// Broker is a queue.EventPublisher that passes the ledger entry of every balance change to the
+// subscribers of its account. Publishing never blocks: a subscriber that falls Buffer entries
+// behind is dropped, its channel closed, and is expected to resubscribe and catch up from the
+// ledger.
+type Broker struct {
+	// Buffer is the number of entries held for each subscriber (default 64).
+	Buffer int
+
+	mu     sync.Mutex
+	subs   map[string]map[chan map[string]interface{}]struct{}
+	closed bool
+}
+
+// Subscribe returns a channel receiving the ledger entries of accountID as they are committed,
+// and a function that ends the subscription. The channel is closed when the subscription ends,
+// whether by cancel, because the subscriber fell behind or because the broker was closed.
+func (b *Broker) Subscribe(accountID string) (<-chan map[string]interface{}, func()) {
+	n := b.Buffer
+	if n < 1 {
+		n = defaultBuffer
+	}
+	c := make(chan map[string]interface{}, n)
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		close(c)
+		return c, func() {}
+	}
+	if b.subs == nil {
+		b.subs = map[string]map[chan map[string]interface{}]struct{}{}
+	}
+	if b.subs[accountID] == nil {
+		b.subs[accountID] = map[chan map[string]interface{}]struct{}{}
+	}
+	b.subs[accountID][c] = struct{}{}
+	b.mu.Unlock()
+	metrics.StreamSubscribers.Inc()
+	var once sync.Once
+	return c, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			b.remove(accountID, c)
+		})
+	}
+}
+
+// remove ends the subscription c of accountID, if it has not ended yet. b.mu must be held.
+func (b *Broker) remove(accountID string, c chan map[string]interface{}) {
+	if _, ok := b.subs[accountID][c]; !ok {
+		return
+	}
+	delete(b.subs[accountID], c)
+	if len(b.subs[accountID]) == 0 {
+		delete(b.subs, accountID)
+	}
+	close(c)
+	metrics.StreamSubscribers.Dec()
+}
+
+// Close ends every subscription and makes later ones end immediately, so open streams finish
+// and the server can shut down.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for accountID, cs := range b.subs {
+		for c := range cs {
+			b.remove(accountID, c)
+		}
+	}
+}
+
+// PublishEvents passes the entries of the account.balance_changed events among events to their
+// accounts' subscribers. Other events are ignored. It never fails.
+func (b *Broker) PublishEvents(ctx context.Context, events []queue.Event) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, e := range events {
+		entry, ok := Entry(e)
+		if !ok {
+			continue
+		}
+		for c := range b.subs[e.AccountID] {
+			select {
+			case c <- entry:
+			default:
+				metrics.StreamDropped.Inc()
+				b.remove(e.AccountID, c)
+			}
+		}
+	}
+	return nil
+}
+
+// Entry returns the ledger entry recorded for an account.balance_changed event, with the keys of
+// repo.MongoRepo.GetTransactions, and false for events of any other type. Transactions keep their
+// type (deposit or withdraw) and unsigned amount; transfers become a transfer_debit or
+// transfer_credit with the signed delta as amount, and the ID of both sides has the source
+// account (see repo.EntryID). created_at is the time the event occurred, which follows the
+// entry's own timestamp by the time it took to commit.
+func Entry(e queue.Event) (map[string]interface{}, bool) {
+	if e.Type != queue.EventBalanceChanged || e.BalanceAfter == nil {
+		return nil, false
+	}
+	typ, amount, source := e.TransactionType, e.Amount, e.AccountID
+	if e.Kind == metrics.KindTransfer {
+		typ, amount, source = "transfer_credit", e.Delta, e.FromAccountID
+		if e.Delta < 0 {
+			typ = "transfer_debit"
+		}
+	}
+	return map[string]interface{}{
+		"id":              repo.EntryID(strings.ToLower(source), e.IdempotencyKey),
+		"account_id":      e.AccountID,
+		"type":            typ,
+		"amount":          amount,
+		"balance_after":   *e.BalanceAfter,
+		"idempotency_key": e.IdempotencyKey,
+		"created_at":      e.OccurredAt,
+	}, true
+}
@@ -0,0 +1,89 @@
+package stream_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Bharat0908/ledger/internal/queue"
+	"github.com/Bharat0908/ledger/internal/stream"
+)
+
+func balanceChanged(account, kind, key string, delta, after int64) queue.Event {
+	e := queue.Event{
+		Type: queue.EventBalanceChanged, AccountID: account, Kind: kind, IdempotencyKey: key,
+		Amount: delta, Delta: delta, BalanceAfter: &after, OccurredAt: time.Now(),
+	}
+	if kind == "transaction" {
+		e.TransactionType, e.Amount = "deposit", delta
+	}
+	if delta < 0 {
+		e.Amount = -delta
+	}
+	return e
+}
+
+func TestEntry(t *testing.T) {
+	tests := []struct {
+		name       string
+		e          queue.Event
+		wantType   string
+		wantAmount int64
+	}{
+		{"deposit", balanceChanged("a", "transaction", "k", 10, 10), "deposit", 10},
+		{"transfer debit", balanceChanged("a", "transfer", "k", -5, 5), "transfer_debit", -5},
+		{"transfer credit", balanceChanged("b", "transfer", "k", 5, 5), "transfer_credit", 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := stream.Entry(tt.e)
+			if !ok || got["type"] != tt.wantType || got["amount"] != tt.wantAmount || got["balance_after"] != *tt.e.BalanceAfter {
+				t.Errorf("Entry() = %v, %v; want %s of %d", got, ok, tt.wantType, tt.wantAmount)
+			}
+		})
+	}
+	if _, ok := stream.Entry(queue.Event{Type: queue.EventTransactionApplied}); ok {
+		t.Error("Entry(transaction.applied) succeeded, want only balance changes")
+	}
+}
+
+func TestBroker(t *testing.T) {
+	ctx := context.Background()
+	b := &stream.Broker{Buffer: 1}
+	a, cancelA := b.Subscribe("a")
+	defer cancelA()
+	other, cancelOther := b.Subscribe("b")
+	defer cancelOther()
+
+	b.PublishEvents(ctx, []queue.Event{balanceChanged("a", "transaction", "k1", 10, 10)})
+	if e := <-a; e["idempotency_key"] != "k1" {
+		t.Fatalf("received %v, want k1", e)
+	}
+	select {
+	case e := <-other:
+		t.Fatalf("other account received %v", e)
+	default:
+	}
+
+	// A subscriber that falls behind is dropped after what it has buffered.
+	b.PublishEvents(ctx, []queue.Event{
+		balanceChanged("a", "transaction", "k2", 10, 20),
+		balanceChanged("a", "transaction", "k3", 10, 30),
+	})
+	if e := <-a; e["idempotency_key"] != "k2" {
+		t.Fatalf("received %v, want k2", e)
+	}
+	if e, ok := <-a; ok {
+		t.Fatalf("received %v, want the channel closed", e)
+	}
+
+	b.Close()
+	if _, ok := <-other; ok {
+		t.Error("subscription open after Close")
+	}
+	if c, _ := b.Subscribe("a"); c != nil {
+		if _, ok := <-c; ok {
+			t.Error("Subscribe after Close returned an open channel")
+		}
+	}
+}
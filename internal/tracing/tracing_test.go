@@ -0,0 +1,92 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Bharat0908/ledger/internal/tracing"
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// record installs a tracer provider that keeps finished spans in memory.
+func record(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	if _, err := tracing.Setup(context.Background(), "test"); err != nil {
+		t.Fatalf("Setup() failed: %v", err)
+	}
+	rec := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+	return rec
+}
+
+func TestMiddleware(t *testing.T) {
+	rec := record(t)
+	api := chi.NewRouter()
+	api.Get("/v1/accounts/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if !trace.SpanContextFromContext(r.Context()).IsValid() {
+			t.Error("handler context carries no span")
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	r := chi.NewRouter()
+	r.Use(tracing.Middleware)
+	r.Mount("/", api)
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodGet, "/v1/accounts/0b6f", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := rec.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("ended spans = %d, want 1", len(spans))
+	}
+	s := spans[0]
+	if s.Name() != "GET /v1/accounts/{id}" || s.SpanKind() != trace.SpanKindServer {
+		t.Errorf("span = %q (%v), want server span named after the route", s.Name(), s.SpanKind())
+	}
+	if got := s.SpanContext().TraceID().String(); got != traceID || !s.Parent().IsRemote() {
+		t.Errorf("trace id = %s (remote parent %v), want the caller's %s", got, s.Parent().IsRemote(), traceID)
+	}
+	if s.Status().Code != codes.Error {
+		t.Errorf("status = %v, want error for a 503", s.Status())
+	}
+}
+
+func TestEnd(t *testing.T) {
+	rec := record(t)
+	f := func(fail bool) (err error) {
+		_, span := tracing.Start(context.Background(), "op")
+		defer tracing.End(span, &err)
+		if fail {
+			return errors.New("boom")
+		}
+		return nil
+	}
+	f(false)
+	f(true)
+	spans := rec.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("ended spans = %d, want 2", len(spans))
+	}
+	if spans[0].Status().Code != codes.Unset || spans[1].Status().Code != codes.Error || spans[1].Status().Description != "boom" {
+		t.Errorf("statuses = %v, %v; want unset then error boom", spans[0].Status(), spans[1].Status())
+	}
+}
+
+func TestSetup_UnknownExporter(t *testing.T) {
+	t.Setenv("OTEL_TRACES_EXPORTER", "zipkin")
+	if _, err := tracing.Setup(context.Background(), "test"); err == nil {
+		t.Error("Setup() accepted an unknown exporter")
+	}
+}
@@ -0,0 +1,221 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Bharat0908/ledger/internal/metrics"
+	"github.com/Bharat0908/ledger/internal/repo"
+	"github.com/Bharat0908/ledger/internal/tracing"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Deliverer defaults, used for zero fields.
+const (
+	DefaultMaxAttempts    = 8
+	DefaultInitialBackoff = 30 * time.Second
+	DefaultMaxBackoff     = time.Hour
+	DefaultTimeout        = 10 * time.Second
+	DefaultPollInterval   = time.Second
+	DefaultBatch          = 10
+)
+
+// maxErrorLen bounds the error text kept in the attempt log.
+const maxErrorLen = 512
+
+// Store is the webhook storage used by the Deliverer.
+type Store interface {
+	ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]repo.DueWebhookDelivery, error)
+	RecordWebhookAttempt(ctx context.Context, id uuid.UUID, res repo.WebhookAttemptResult) error
+}
+
+// Deliverer POSTs queued deliveries to their webhooks. A delivery succeeds when the receiver
+// answers with a 2xx status; otherwise it is retried after InitialBackoff, doubling up to
+// MaxBackoff, until MaxAttempts attempts have failed. Every attempt is recorded in the delivery
+// log. Several deliverers may share a store: claimed deliveries are leased to one of them.
+//
+// Without a Client, deliveries go through NewClient(AllowedNetworks): they are only sent to
+// public addresses, or to the internal networks explicitly allowed, and redirects are not
+// followed.
+type Deliverer struct {
+	Store           Store
+	Client          *http.Client // Timeout bounds each attempt
+	AllowedNetworks []netip.Prefix
+
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Timeout        time.Duration
+	PollInterval   time.Duration
+	// Batch is how many deliveries are claimed, and attempted concurrently, at a time.
+	Batch int
+
+	clientOnce    sync.Once
+	defaultClient *http.Client
+}
+
+// Run delivers due deliveries every PollInterval until ctx is done, then returns ctx.Err().
+// Attempts interrupted by ctx are not recorded; the deliveries are retried once their lease
+// expires.
+func (d *Deliverer) Run(ctx context.Context) error {
+	t := time.NewTicker(or(d.PollInterval, DefaultPollInterval))
+	defer t.Stop()
+	for {
+		// Keep going while full batches are due, so a backlog drains without waiting a tick.
+		for {
+			n, err := d.DeliverDue(ctx)
+			if err != nil && ctx.Err() == nil {
+				slog.ErrorContext(ctx, "deliver webhooks", "error", err)
+			}
+			if err != nil || n < or(d.Batch, DefaultBatch) {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// DeliverDue claims one batch of due deliveries, attempts them and returns how many it claimed.
+func (d *Deliverer) DeliverDue(ctx context.Context) (int, error) {
+	timeout := or(d.Timeout, DefaultTimeout)
+	// The lease outlasts the attempt so a slow receiver cannot get the delivery twice at once.
+	due, err := d.Store.ClaimWebhookDeliveries(ctx, time.Now(), 2*timeout, or(d.Batch, DefaultBatch))
+	if err != nil {
+		return 0, err
+	}
+	var wg sync.WaitGroup
+	for _, del := range due {
+		wg.Add(1)
+		go func(del repo.DueWebhookDelivery) {
+			defer wg.Done()
+			d.deliver(ctx, del, timeout)
+		}(del)
+	}
+	wg.Wait()
+	return len(due), nil
+}
+
+// deliver makes one attempt at del and records it.
+func (d *Deliverer) deliver(ctx context.Context, del repo.DueWebhookDelivery, timeout time.Duration) {
+	ctx, span := tracing.Start(ctx, "webhook deliver", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("webhook.id", del.WebhookID.String()), attribute.String("webhook.delivery_id", del.ID.String()),
+			attribute.String("webhook.event_type", del.EventType)))
+	var err error
+	defer tracing.End(span, &err)
+
+	start := time.Now()
+	status, err := d.post(ctx, del, timeout)
+	if ctx.Err() != nil {
+		return
+	}
+	res := d.result(del.Attempts+1, start, status, err)
+	span.SetAttributes(attribute.Int("http.response.status_code", status), attribute.String("webhook.result", res.Status))
+	result := res.Status
+	if result == repo.DeliveryPending {
+		result = "retry"
+	}
+	metrics.WebhookDeliveries.WithLabelValues(result).Inc()
+	attrs := []any{"webhook_id", del.WebhookID, "delivery_id", del.ID, "event_id", del.EventID, "attempt", del.Attempts + 1, "status_code", status}
+	switch result {
+	case repo.DeliverySucceeded:
+		slog.InfoContext(ctx, "webhook delivered", attrs...)
+	case "retry":
+		slog.WarnContext(ctx, "webhook delivery failed, will retry", append(attrs, "error", err, "next_attempt_at", res.NextAttemptAt)...)
+	default:
+		slog.ErrorContext(ctx, "webhook delivery failed", append(attrs, "error", err)...)
+	}
+	if rerr := d.Store.RecordWebhookAttempt(ctx, del.ID, res); rerr != nil && !errors.Is(rerr, repo.ErrWebhookDeliveryNotFound) {
+		slog.ErrorContext(ctx, "record webhook attempt", append(attrs, "error", rerr)...)
+	}
+}
+
+// post sends del to its webhook and returns the response status.
+func (d *Deliverer) post(ctx context.Context, del repo.DueWebhookDelivery, timeout time.Duration) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, del.URL, bytes.NewReader(del.Payload))
+	if err != nil {
+		return 0, err
+	}
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ledger-webhooks/1")
+	req.Header.Set(HeaderEventID, del.EventID)
+	req.Header.Set(HeaderEventType, del.EventType)
+	req.Header.Set(HeaderDelivery, del.ID.String())
+	req.Header.Set(HeaderTimestamp, ts)
+	req.Header.Set(HeaderSignature, Signature(del.Secret, ts, del.Payload))
+	client := d.Client
+	if client == nil {
+		d.clientOnce.Do(func() { d.defaultClient = NewClient(d.AllowedNetworks) })
+		client = d.defaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10)) // lets the connection be reused
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver answered %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// result returns the outcome of the given attempt, numbered from 1, started at start.
+func (d *Deliverer) result(attempt int, start time.Time, status int, err error) repo.WebhookAttemptResult {
+	res := repo.WebhookAttemptResult{
+		Attempt: repo.WebhookAttempt{At: start, StatusCode: status, DurationMS: time.Since(start).Milliseconds()},
+		Status:  repo.DeliverySucceeded,
+	}
+	if err == nil {
+		return res
+	}
+	res.Attempt.Error = attemptError(err)
+	if len(res.Attempt.Error) > maxErrorLen {
+		res.Attempt.Error = res.Attempt.Error[:maxErrorLen]
+	}
+	res.Status = repo.DeliveryFailed
+	if attempt < or(d.MaxAttempts, DefaultMaxAttempts) {
+		next := time.Now().Add(d.Backoff(attempt))
+		res.Status, res.NextAttemptAt = repo.DeliveryPending, &next
+	}
+	return res
+}
+
+// Backoff returns how long to wait after the given failed attempt, numbered from 1:
+// InitialBackoff doubled for each earlier attempt, at most MaxBackoff.
+func (d *Deliverer) Backoff(attempt int) time.Duration {
+	b, max := or(d.InitialBackoff, DefaultInitialBackoff), or(d.MaxBackoff, DefaultMaxBackoff)
+	for i := 1; i < attempt && b < max; i++ {
+		b *= 2
+	}
+	if b > max {
+		b = max
+	}
+	return b
+}
+
+// or returns v, or def if v is zero.
+func or[T comparable](v, def T) T {
+	var zero T
+	if v == zero {
+		return def
+	}
+	return v
+}
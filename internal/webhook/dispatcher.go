@@ -0,0 +1,46 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/Bharat0908/ledger/internal/queue"
+	"github.com/Bharat0908/ledger/internal/repo"
+)
+
+// Subscriptions is the webhook storage used by the Dispatcher.
+type Subscriptions interface {
+	ListWebhooks(ctx context.Context, owner string) ([]repo.Webhook, error)
+	EnqueueWebhookDeliveries(ctx context.Context, ds []repo.NewWebhookDelivery) error
+}
+
+// Dispatcher is a queue.EventPublisher that queues a delivery of each event for every webhook
+// subscribed to it. Deliveries are keyed by webhook and event ID, so the events of a redelivered
+// message are not delivered twice.
+type Dispatcher struct {
+	Store Subscriptions
+}
+
+// PublishEvents queues the deliveries of events. The payload of a delivery is the event itself.
+func (d *Dispatcher) PublishEvents(ctx context.Context, events []queue.Event) error {
+	hooks, err := d.Store.ListWebhooks(ctx, "")
+	if err != nil || len(hooks) == 0 {
+		return err
+	}
+	var ds []repo.NewWebhookDelivery
+	for _, e := range events {
+		var payload []byte
+		for _, h := range hooks {
+			if !h.Matches(e.Type, e.AccountID) {
+				continue
+			}
+			if payload == nil {
+				if payload, err = json.Marshal(e); err != nil {
+					return err
+				}
+			}
+			ds = append(ds, repo.NewWebhookDelivery{WebhookID: h.ID, EventID: e.ID, EventType: e.Type, Payload: payload})
+		}
+	}
+	return d.Store.EnqueueWebhookDeliveries(ctx, ds)
+}
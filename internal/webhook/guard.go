@@ -0,0 +1,104 @@
+package webhook
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrAddressNotAllowed is returned for deliveries to addresses that are not public, such as
+// loopback, private and link-local ones, outside the allowed networks.
+var ErrAddressNotAllowed = errors.New("receiver address is not allowed")
+
+// reserved are the IPv4 and IPv6 ranges that the net/netip predicates do not cover but that are
+// not reachable on the public internet either, or may lead back into private networks.
+var reserved = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// AddressAllowed reports whether deliveries may be sent to ip: public addresses always, other
+// addresses (loopback, private, link-local such as 169.254.169.254, multicast, unspecified and
+// reserved ones) only within the allowed networks.
+func AddressAllowed(ip netip.Addr, allowed []netip.Prefix) bool {
+	ip = ip.Unmap()
+	for _, p := range allowed {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return false
+	}
+	for _, p := range reserved {
+		if p.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// HostAllowed reports whether a webhook URL with the given host may be registered. Hosts that
+// are IP addresses are checked with AddressAllowed, and localhost is refused unless loopback
+// addresses are allowed. Other names are checked when deliveries connect, after they resolve.
+func HostAllowed(host string, allowed []netip.Prefix) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return AddressAllowed(netip.MustParseAddr("127.0.0.1"), allowed)
+	}
+	if ip, err := netip.ParseAddr(host); err == nil {
+		return AddressAllowed(ip, allowed)
+	}
+	return true
+}
+
+// NewClient returns the HTTP client deliveries are sent with when the Deliverer has none. It
+// connects only to addresses that AddressAllowed accepts, checked after DNS resolution so a
+// public name cannot point deliveries at internal services, and ignores proxy settings, which
+// would hide the address. Redirects are not followed: a 3xx answer is a failed attempt.
+func NewClient(allowed []netip.Prefix) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			ap, err := netip.ParseAddrPort(address)
+			if err != nil || !AddressAllowed(ap.Addr(), allowed) {
+				return ErrAddressNotAllowed
+			}
+			return nil
+		},
+	}
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.Proxy = nil
+	tr.DialContext = dialer.DialContext
+	return &http.Client{
+		Transport:     tr,
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+}
+
+// attemptError returns the error text kept in the attempt log for err, which callers can read
+// back. Failures to reach the receiver are reduced to whether its address was refused or it did
+// not answer in time, so the log cannot be used to probe which hosts and ports are open; the full
+// error is only logged.
+func attemptError(err error) string {
+	var urlErr *url.Error
+	switch {
+	case errors.Is(err, ErrAddressNotAllowed):
+		return ErrAddressNotAllowed.Error()
+	case !errors.As(err, &urlErr):
+		return err.Error()
+	case urlErr.Timeout():
+		return "receiver did not answer in time"
+	}
+	return "could not reach the receiver"
+}
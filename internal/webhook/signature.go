@@ -0,0 +1,70 @@
+// Package webhook delivers ledger events to subscribers' HTTP endpoints. A Dispatcher queues a
+// delivery for every webhook subscribed to an event and a Deliverer POSTs the queued deliveries,
+// signed with the webhook's secret, retrying failures with exponential backoff.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Headers sent with every delivery. See Signature for how the signature is computed.
+const (
+	HeaderEventID   = "X-Ledger-Event-Id"
+	HeaderEventType = "X-Ledger-Event-Type"
+	HeaderDelivery  = "X-Ledger-Delivery"
+	HeaderTimestamp = "X-Ledger-Timestamp"
+	HeaderSignature = "X-Ledger-Signature"
+)
+
+// SecretPrefix starts every generated webhook secret.
+const SecretPrefix = "whsec_"
+
+// ErrBadSignature is returned by Verify for a delivery that was not signed with the secret.
+var ErrBadSignature = errors.New("webhook: bad signature")
+
+// GenerateSecret returns a new random webhook secret. The secret is used as the HMAC key exactly
+// as returned, prefix included.
+func GenerateSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return SecretPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Signature returns the hex HMAC-SHA256, keyed by secret, of the string to sign:
+//
+//	TIMESTAMP \n hex(SHA-256(body))
+//
+// TIMESTAMP is the X-Ledger-Timestamp header, in Unix seconds. Every attempt is signed afresh,
+// so receivers can reject old deliveries by their timestamp.
+func Signature(secret []byte, timestamp string, body []byte) string {
+	digest := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%s\n%s", timestamp, hex.EncodeToString(digest[:]))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks, for a receiver, the timestamp and signature headers of a delivery with the
+// given body. The timestamp must be within skew of now.
+func Verify(secret []byte, timestamp, signature string, body []byte, now time.Time, skew time.Duration) error {
+	sec, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: malformed timestamp", ErrBadSignature)
+	}
+	if ts := time.Unix(sec, 0); ts.Before(now.Add(-skew)) || ts.After(now.Add(skew)) {
+		return fmt.Errorf("%w: timestamp outside the allowed clock skew", ErrBadSignature)
+	}
+	if !hmac.Equal([]byte(signature), []byte(Signature(secret, timestamp, body))) {
+		return ErrBadSignature
+	}
+	return nil
+}
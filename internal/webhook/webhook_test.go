@@ -0,0 +1,307 @@
+package webhook_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Bharat0908/ledger/internal/queue"
+	"github.com/Bharat0908/ledger/internal/repo"
+	"github.com/Bharat0908/ledger/internal/webhook"
+	"github.com/google/uuid"
+)
+
+// loopback lets deliveries reach the httptest receivers, which listen on 127.0.0.1.
+var loopback = []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")}
+
+func newStore(t *testing.T) *repo.SQLiteRepo {
+	t.Helper()
+	r, err := repo.OpenSQLite(context.Background(), ":memory:")
+	if err != nil {
+		t.Fatalf("OpenSQLite() failed: %v", err)
+	}
+	t.Cleanup(func() { r.DB.Close() })
+	return r
+}
+
+// receiver is a webhook endpoint that answers with the next of its statuses, then 200, and
+// verifies every delivery's signature.
+type receiver struct {
+	t        *testing.T
+	secret   []byte
+	mu       sync.Mutex
+	statuses []int
+	got      []*http.Request
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	if err := webhook.Verify(rc.secret, r.Header.Get(webhook.HeaderTimestamp), r.Header.Get(webhook.HeaderSignature), body, time.Now(), time.Minute); err != nil {
+		rc.t.Errorf("delivery %s: %v", r.Header.Get(webhook.HeaderDelivery), err)
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.got = append(rc.got, r)
+	status := http.StatusOK
+	if len(rc.statuses) > 0 {
+		status, rc.statuses = rc.statuses[0], rc.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func (rc *receiver) count() int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return len(rc.got)
+}
+
+// subscribe creates a webhook for the receiver served at url.
+func subscribe(t *testing.T, store *repo.SQLiteRepo, url string, types []string, accounts ...uuid.UUID) repo.Webhook {
+	t.Helper()
+	h, err := store.CreateWebhook(context.Background(), repo.NewWebhook{URL: url, EventTypes: types, AccountIDs: accounts, Secret: []byte("whsec_test")})
+	if err != nil {
+		t.Fatalf("CreateWebhook() failed: %v", err)
+	}
+	return h
+}
+
+func event(typ, account string) queue.Event {
+	return queue.Event{ID: uuid.NewString(), Type: typ, AccountID: account, Amount: 10}
+}
+
+// deliverUntil runs the deliverer until done reports true or a second has passed.
+func deliverUntil(t *testing.T, d *webhook.Deliverer, done func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); !done(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("deliveries did not settle in time")
+		}
+		if _, err := d.DeliverDue(context.Background()); err != nil {
+			t.Fatalf("DeliverDue() failed: %v", err)
+		}
+	}
+}
+
+func deliveries(t *testing.T, store *repo.SQLiteRepo, h repo.Webhook) []repo.WebhookDelivery {
+	t.Helper()
+	ds, err := store.ListWebhookDeliveries(context.Background(), h.ID, 10)
+	if err != nil {
+		t.Fatalf("ListWebhookDeliveries() failed: %v", err)
+	}
+	return ds
+}
+
+func TestDispatcher_QueuesMatchingEvents(t *testing.T) {
+	ctx := context.Background()
+	store := newStore(t)
+	acc := uuid.New()
+	all := subscribe(t, store, "http://all", []string{queue.EventTransactionApplied})
+	one := subscribe(t, store, "http://one", []string{queue.EventTransactionApplied, queue.EventBalanceChanged}, acc)
+
+	d := &webhook.Dispatcher{Store: store}
+	events := []queue.Event{
+		event(queue.EventTransactionApplied, acc.String()),
+		event(queue.EventBalanceChanged, acc.String()),
+		event(queue.EventTransactionApplied, uuid.NewString()),
+		event(queue.EventTransactionRejected, acc.String()),
+	}
+	for i := 0; i < 2; i++ { // a redelivered message publishes the same events again
+		if err := d.PublishEvents(ctx, events); err != nil {
+			t.Fatalf("PublishEvents() failed: %v", err)
+		}
+	}
+	if got := len(deliveries(t, store, all)); got != 2 {
+		t.Errorf("webhook for every account got %d deliveries, want 2 transaction.applied", got)
+	}
+	if got := len(deliveries(t, store, one)); got != 2 {
+		t.Errorf("webhook for one account got %d deliveries, want its applied and balance_changed events", got)
+	}
+}
+
+func TestDeliverer_RetriesUntilDelivered(t *testing.T) {
+	ctx := context.Background()
+	store := newStore(t)
+	rc := &receiver{t: t, secret: []byte("whsec_test"), statuses: []int{http.StatusInternalServerError, http.StatusServiceUnavailable}}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+	h := subscribe(t, store, srv.URL, []string{queue.EventTransactionApplied})
+	e := event(queue.EventTransactionApplied, uuid.NewString())
+	if err := (&webhook.Dispatcher{Store: store}).PublishEvents(ctx, []queue.Event{e}); err != nil {
+		t.Fatalf("PublishEvents() failed: %v", err)
+	}
+
+	d := &webhook.Deliverer{Store: store, AllowedNetworks: loopback, InitialBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond}
+	deliverUntil(t, d, func() bool { return deliveries(t, store, h)[0].Status != repo.DeliveryPending })
+
+	got := deliveries(t, store, h)[0]
+	if got.Status != repo.DeliverySucceeded || got.Attempts != 3 || len(got.AttemptLog) != 3 {
+		t.Fatalf("delivery = %+v, want succeeded on the third attempt", got)
+	}
+	if log := got.AttemptLog; log[0].StatusCode != 500 || log[0].Error == "" || log[1].StatusCode != 503 || log[2].StatusCode != 200 || log[2].Error != "" {
+		t.Errorf("attempt log = %+v, want 500, 503, then 200", log)
+	}
+	if rc.count() != 3 {
+		t.Errorf("receiver got %d requests, want 3", rc.count())
+	}
+	r := rc.got[2]
+	if r.Header.Get(webhook.HeaderEventID) != e.ID || r.Header.Get(webhook.HeaderEventType) != e.Type || r.Header.Get(webhook.HeaderDelivery) != got.ID.String() {
+		t.Errorf("headers = %v, want the event and delivery IDs", r.Header)
+	}
+}
+
+func TestDeliverer_GivesUpAndRedelivers(t *testing.T) {
+	ctx := context.Background()
+	store := newStore(t)
+	rc := &receiver{t: t, secret: []byte("whsec_test"), statuses: []int{http.StatusGone, http.StatusGone}}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+	h := subscribe(t, store, srv.URL, []string{queue.EventTransactionApplied})
+	if err := (&webhook.Dispatcher{Store: store}).PublishEvents(ctx, []queue.Event{event(queue.EventTransactionApplied, "acc")}); err != nil {
+		t.Fatalf("PublishEvents() failed: %v", err)
+	}
+
+	d := &webhook.Deliverer{Store: store, AllowedNetworks: loopback, MaxAttempts: 2, InitialBackoff: time.Millisecond}
+	deliverUntil(t, d, func() bool { return deliveries(t, store, h)[0].Status != repo.DeliveryPending })
+	got := deliveries(t, store, h)[0]
+	if got.Status != repo.DeliveryFailed || got.Attempts != 2 || got.NextAttemptAt != nil {
+		t.Fatalf("delivery = %+v, want failed after MaxAttempts", got)
+	}
+
+	if _, err := store.RedeliverWebhookDelivery(ctx, h.ID, got.ID); err != nil {
+		t.Fatalf("RedeliverWebhookDelivery() failed: %v", err)
+	}
+	deliverUntil(t, d, func() bool { return deliveries(t, store, h)[0].Status != repo.DeliveryPending })
+	got = deliveries(t, store, h)[0]
+	if got.Status != repo.DeliverySucceeded || len(got.AttemptLog) != 3 {
+		t.Errorf("delivery = %+v, want redelivered with the earlier attempts kept", got)
+	}
+}
+
+func TestDeliverer_UnreachableReceiver(t *testing.T) {
+	ctx := context.Background()
+	store := newStore(t)
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close() // nothing listens on the URL any more
+	h := subscribe(t, store, srv.URL, []string{queue.EventTransactionApplied})
+	if err := (&webhook.Dispatcher{Store: store}).PublishEvents(ctx, []queue.Event{event(queue.EventTransactionApplied, "acc")}); err != nil {
+		t.Fatalf("PublishEvents() failed: %v", err)
+	}
+	d := &webhook.Deliverer{Store: store, AllowedNetworks: loopback, MaxAttempts: 1}
+	deliverUntil(t, d, func() bool { return deliveries(t, store, h)[0].Status != repo.DeliveryPending })
+	if log := deliveries(t, store, h)[0].AttemptLog; len(log) != 1 || log[0].StatusCode != 0 || log[0].Error != "could not reach the receiver" {
+		t.Errorf("attempt log = %+v, want one attempt that could not reach the receiver, without the dial error", log)
+	}
+}
+
+func TestDeliverer_RefusesInternalAddresses(t *testing.T) {
+	ctx := context.Background()
+	store := newStore(t)
+	rc := &receiver{t: t, secret: []byte("whsec_test")}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+	h := subscribe(t, store, srv.URL, []string{queue.EventTransactionApplied})
+	if err := (&webhook.Dispatcher{Store: store}).PublishEvents(ctx, []queue.Event{event(queue.EventTransactionApplied, "acc")}); err != nil {
+		t.Fatalf("PublishEvents() failed: %v", err)
+	}
+	d := &webhook.Deliverer{Store: store, MaxAttempts: 1}
+	deliverUntil(t, d, func() bool { return deliveries(t, store, h)[0].Status != repo.DeliveryPending })
+	if log := deliveries(t, store, h)[0].AttemptLog; len(log) != 1 || log[0].Error != webhook.ErrAddressNotAllowed.Error() {
+		t.Errorf("attempt log = %+v, want one refused attempt", log)
+	}
+	if rc.count() != 0 {
+		t.Errorf("receiver got %d requests, want none", rc.count())
+	}
+}
+
+func TestDeliverer_DoesNotFollowRedirects(t *testing.T) {
+	ctx := context.Background()
+	store := newStore(t)
+	rc := &receiver{t: t, secret: []byte("whsec_test")}
+	target := httptest.NewServer(rc)
+	defer target.Close()
+	srv := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusTemporaryRedirect))
+	defer srv.Close()
+	h := subscribe(t, store, srv.URL, []string{queue.EventTransactionApplied})
+	if err := (&webhook.Dispatcher{Store: store}).PublishEvents(ctx, []queue.Event{event(queue.EventTransactionApplied, "acc")}); err != nil {
+		t.Fatalf("PublishEvents() failed: %v", err)
+	}
+	d := &webhook.Deliverer{Store: store, AllowedNetworks: loopback, MaxAttempts: 1}
+	deliverUntil(t, d, func() bool { return deliveries(t, store, h)[0].Status != repo.DeliveryPending })
+	if log := deliveries(t, store, h)[0].AttemptLog; len(log) != 1 || log[0].StatusCode != http.StatusTemporaryRedirect {
+		t.Errorf("attempt log = %+v, want one attempt answered with a redirect", log)
+	}
+	if rc.count() != 0 {
+		t.Errorf("redirect target got %d requests, want none", rc.count())
+	}
+}
+
+func TestAddressAllowed(t *testing.T) {
+	tests := []struct {
+		ip      string
+		allowed []netip.Prefix
+		want    bool
+	}{
+		{"93.184.215.14", nil, true},
+		{"2606:2800:21f:cb07:6820:80da:af6b:8b2c", nil, true},
+		{"127.0.0.1", nil, false},
+		{"::1", nil, false},
+		{"10.1.2.3", nil, false},
+		{"172.16.0.1", nil, false},
+		{"192.168.1.1", nil, false},
+		{"169.254.169.254", nil, false},
+		{"fe80::1", nil, false},
+		{"fd00::1", nil, false},
+		{"0.0.0.0", nil, false},
+		{"100.64.0.1", nil, false},
+		{"::ffff:127.0.0.1", nil, false},
+		{"224.0.0.1", nil, false},
+		{"10.1.2.3", []netip.Prefix{netip.MustParsePrefix("10.1.0.0/16")}, true},
+		{"10.2.0.1", []netip.Prefix{netip.MustParsePrefix("10.1.0.0/16")}, false},
+	}
+	for _, tt := range tests {
+		if got := webhook.AddressAllowed(netip.MustParseAddr(tt.ip), tt.allowed); got != tt.want {
+			t.Errorf("AddressAllowed(%s, %v) = %v, want %v", tt.ip, tt.allowed, got, tt.want)
+		}
+	}
+}
+
+func TestDeliverer_Backoff(t *testing.T) {
+	d := &webhook.Deliverer{InitialBackoff: time.Second, MaxBackoff: 10 * time.Second}
+	for attempt, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 4: 8 * time.Second, 5: 10 * time.Second, 50: 10 * time.Second} {
+		if got := d.Backoff(attempt); got != want {
+			t.Errorf("Backoff(%d) = %v, want %v", attempt, got, want)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	secret, body := []byte("whsec_x"), []byte(`{"id":"e1"}`)
+	now := time.Unix(1_700_000_000, 0)
+	ts := "1700000000"
+	sig := webhook.Signature(secret, ts, body)
+	tests := []struct {
+		name          string
+		secret        []byte
+		ts, sig, body string
+		now           time.Time
+		wantErr       bool
+	}{
+		{name: "valid", secret: secret, ts: ts, sig: sig, body: string(body), now: now},
+		{name: "tampered body", secret: secret, ts: ts, sig: sig, body: `{"id":"e2"}`, now: now, wantErr: true},
+		{name: "other secret", secret: []byte("whsec_y"), ts: ts, sig: sig, body: string(body), now: now, wantErr: true},
+		{name: "stale", secret: secret, ts: ts, sig: sig, body: string(body), now: now.Add(10 * time.Minute), wantErr: true},
+		{name: "malformed timestamp", secret: secret, ts: "yesterday", sig: sig, body: string(body), now: now, wantErr: true},
+	}
+	for _, tt := range tests {
+		err := webhook.Verify(tt.secret, tt.ts, tt.sig, []byte(tt.body), tt.now, 5*time.Minute)
+		if (err != nil) != tt.wantErr || (err != nil && !errors.Is(err, webhook.ErrBadSignature)) {
+			t.Errorf("%s: Verify() = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
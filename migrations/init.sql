@@ -17,3 +17,138 @@ CREATE TABLE IF NOT EXISTS processed_messages (
 );
 
 CREATE INDEX IF NOT EXISTS idx_accounts_owner ON accounts(owner);
+
+-- ledger_entries holds the account history when the service runs with
+-- LEDGER_STORE=postgres. Rows are written in the same transaction as the
+-- balance change so history and balances can never diverge.
+CREATE TABLE IF NOT EXISTS ledger_entries (
+  id BIGSERIAL PRIMARY KEY,
+  account_id UUID NOT NULL REFERENCES accounts(id),
+  type TEXT NOT NULL,
+  amount BIGINT NOT NULL,
+  balance_after BIGINT NOT NULL,
+  idempotency_key TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_account ON ledger_entries(account_id, created_at DESC);
+
+-- Account status; only active accounts accept balance changes.
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'active';
+
+-- Account attributes. external_ref is the caller's own identifier and makes provisioning idempotent.
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS type TEXT NOT NULL DEFAULT 'asset';
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS external_ref TEXT;
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS display_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS metadata JSONB NOT NULL DEFAULT '{}';
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_accounts_external_ref ON accounts(external_ref) WHERE external_ref IS NOT NULL;
+
+-- Account listing: keyset pagination by creation time, per owner, and metadata containment filters.
+CREATE INDEX IF NOT EXISTS idx_accounts_created ON accounts(created_at, id);
+CREATE INDEX IF NOT EXISTS idx_accounts_owner_created ON accounts(owner, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_accounts_metadata ON accounts USING GIN (metadata jsonb_path_ops);
+
+-- API keys. Only the SHA-256 hash of a key is stored; account_ids restricts a key to the listed
+-- accounts (empty means unrestricted) and revoked keys are kept for audit.
+CREATE TABLE IF NOT EXISTS api_keys (
+  id UUID PRIMARY KEY,
+  name TEXT NOT NULL,
+  prefix TEXT NOT NULL,
+  key_hash BYTEA NOT NULL UNIQUE,
+  scopes TEXT[] NOT NULL,
+  account_ids UUID[] NOT NULL DEFAULT '{}',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  revoked_at TIMESTAMPTZ
+);
+
+-- HMAC request signing. Keys with a signing secret only accept signed requests; the secret is
+-- stored as is because verification needs it.
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS signing_secret BYTEA;
+
+-- Daily per-client transaction quotas, shared by every API instance. Old days can be deleted.
+CREATE TABLE IF NOT EXISTS quota_usage (
+  client TEXT NOT NULL,
+  day DATE NOT NULL,
+  tx_count BIGINT NOT NULL,
+  amount BIGINT NOT NULL,
+  PRIMARY KEY (client, day)
+);
+
+-- Outbound webhooks. Each matching event is queued as a delivery, at most once per webhook, and
+-- every attempt is kept in webhook_attempts. Deleting a webhook deletes its deliveries.
+CREATE TABLE IF NOT EXISTS webhooks (
+  id UUID PRIMARY KEY,
+  owner TEXT NOT NULL DEFAULT '',
+  url TEXT NOT NULL,
+  event_types TEXT[] NOT NULL,
+  account_ids UUID[] NOT NULL DEFAULT '{}',
+  description TEXT NOT NULL DEFAULT '',
+  secret BYTEA NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+  id UUID PRIMARY KEY,
+  webhook_id UUID NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+  event_id TEXT NOT NULL,
+  event_type TEXT NOT NULL,
+  payload JSONB NOT NULL,
+  status TEXT NOT NULL DEFAULT 'pending',
+  attempts INT NOT NULL DEFAULT 0,
+  next_attempt_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  UNIQUE (webhook_id, event_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook ON webhook_deliveries(webhook_id, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS webhook_attempts (
+  id BIGSERIAL PRIMARY KEY,
+  delivery_id UUID NOT NULL REFERENCES webhook_deliveries(id) ON DELETE CASCADE,
+  attempted_at TIMESTAMPTZ NOT NULL,
+  status_code INT NOT NULL DEFAULT 0,
+  error TEXT NOT NULL DEFAULT '',
+  duration_ms BIGINT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_attempts_delivery ON webhook_attempts(delivery_id, attempted_at);
+
+-- Resuming an account's event stream looks up the ledger entry named by Last-Event-ID.
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_key ON ledger_entries(account_id, idempotency_key);
+
+-- Bulk transfer submissions. Items keep their submission order; progress is derived from their
+-- status and from processed_messages, and the worker marks refused items failed by key.
+CREATE TABLE IF NOT EXISTS transfer_batches (
+  id UUID PRIMARY KEY,
+  owner TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS transfer_batch_items (
+  batch_id UUID NOT NULL REFERENCES transfer_batches(id) ON DELETE CASCADE,
+  position INT NOT NULL,
+  idempotency_key TEXT NOT NULL,
+  status TEXT NOT NULL,
+  error TEXT NOT NULL DEFAULT '',
+  PRIMARY KEY (batch_id, position)
+);
+
+CREATE INDEX IF NOT EXISTS idx_transfer_batch_items_key ON transfer_batch_items(idempotency_key);
+
+-- Ledger exports over a time range, across accounts, scan entries in creation order.
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_created ON ledger_entries(created_at, id);
+
+-- Idempotency keys are unique per account (the account of a transaction, the source of a
+-- transfer) rather than globally, so a client cannot claim the keys of accounts it has no
+-- access to. Batch items record the source account to match their transfer.
+ALTER TABLE processed_messages DROP CONSTRAINT IF EXISTS processed_messages_pkey;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_processed_messages_account_key ON processed_messages(account_id, idempotency_key);
+CREATE INDEX IF NOT EXISTS idx_processed_messages_key ON processed_messages(idempotency_key);
+ALTER TABLE transfer_batch_items ADD COLUMN IF NOT EXISTS account_id TEXT NOT NULL DEFAULT '';
+
+-- Ledger entries record the account their idempotency key belongs to, so entries of one account
+-- that share a key (a deposit and transfers into it) have distinct IDs for event streams to
+-- resume from. It is NULL on older entries, which are read with the account as source.
+ALTER TABLE ledger_entries ADD COLUMN IF NOT EXISTS source_account_id UUID;
@@ -0,0 +1,10 @@
+// Package ledger holds repository-level assets shared by the service binaries.
+package ledger
+
+import _ "embed"
+
+// OpenAPISpec is the API contract in openapi.yaml. The HTTP layer validates requests against it,
+// so changes to the spec take effect without touching handler code.
+//
+//go:embed openapi.yaml
+var OpenAPISpec []byte
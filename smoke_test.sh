@@ -17,7 +17,7 @@ echo "✅ API is up!"
 echo " Creating account..."
 ACCOUNT_ID=$(curl -s -X POST "$API_URL/accounts" \
   -H "Content-Type: application/json" \
-  -d '{"owner":"Alice","currency":"USD","initial_balance":1000}' \
+  -d '{"owner":"Alice","currency":"USD","initial_balance":1000,"external_ref":"smoke-alice-usd"}' \
   | jq -r '.id')
 
 echo " Account created: $ACCOUNT_ID"
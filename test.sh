@@ -16,7 +16,7 @@ echo "✅ API is up!"
 
 # 1. Create account
 echo "📂 Creating account..."
-ACCOUNT_ID=$(curl -s -X POST "$API_URL/accounts"   -H "Content-Type: application/json"   -d '{"owner":"Alice","currency":"USD","initial_balance":1000}'   | jq -r '.id')
+ACCOUNT_ID=$(curl -s -X POST "$API_URL/accounts"   -H "Content-Type: application/json"   -d '{"owner":"Alice","currency":"USD","initial_balance":1000,"external_ref":"alice-usd"}'   | jq -r '.id')
 
 if [ -z "$ACCOUNT_ID" ] || [ "$ACCOUNT_ID" = "null" ]; then
   echo "Failed to create account or parse ID"